@@ -8,6 +8,13 @@ echo "${CLOUDFLARE_ORIGIN_CA_KEY}" > /etc/ssl/backend-easyflow.key
 
 # Start the Go application in the background
 /app/easyflow-backend &
+APP_PID=$!
 
-# Start Nginx in the foreground
-nginx -g 'daemon off;'
\ No newline at end of file
+# Start Nginx in the background so this script can forward signals
+nginx -g 'daemon off;' &
+NGINX_PID=$!
+
+# Let the Go application drain its connections before nginx stops proxying
+trap 'kill -TERM $APP_PID; wait $APP_PID || true; kill -QUIT $NGINX_PID' TERM INT
+
+wait $NGINX_PID
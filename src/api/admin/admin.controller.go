@@ -0,0 +1,277 @@
+package admin
+
+import (
+	"easyflow-backend/src/api"
+	"easyflow-backend/src/api/auth"
+	"easyflow-backend/src/common"
+	"easyflow-backend/src/database"
+	"easyflow-backend/src/enum"
+	"easyflow-backend/src/middleware"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterAdminEndpoints(r *gin.RouterGroup) {
+	r.Use(middleware.LoggerMiddleware("Admin"))
+	r.Use(auth.AuthGuard())
+	r.Use(middleware.RateLimiter(common.RateLimitUser))
+	r.Use(AdminGuard())
+	r.GET("/users", SearchUsersController)
+	r.POST("/users/:userId/disable", SetUserDisabledController(true))
+	r.POST("/users/:userId/enable", SetUserDisabledController(false))
+	r.DELETE("/users/:userId", DeleteUserController)
+	r.GET("/chats", SearchChatsController)
+	r.GET("/chats/:chatId", GetChatController)
+	r.DELETE("/chats/:chatId", DeleteChatController)
+	r.GET("/audit-logs", ListAuditLogsController)
+	r.GET("/audit-logs/export", ExportAuditLogsController)
+}
+
+// AdminGuard only lets enabled users with the admin role pass, it has to run after auth.AuthGuard.
+// The role is read from the database on every request so a revoked role takes effect right away.
+func AdminGuard() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, logger, repos, _, errs := common.SetupEndpoint[any](c)
+		if errs != nil {
+			c.JSON(http.StatusInternalServerError, api.ApiError{
+				Code:    http.StatusInternalServerError,
+				Error:   enum.ApiError,
+				Details: errs,
+			})
+			c.Abort()
+			return
+		}
+
+		user, err := repos.Users.GetById(c.Request.Context(), c.GetString("userId"))
+		if err != nil || user.Role != database.RoleAdmin || user.DisabledAt != nil {
+			logger.PrintfWarning("User: %s is not allowed to use the admin endpoints", c.GetString("userId"))
+			c.JSON(http.StatusForbidden, api.ApiError{
+				Code:  http.StatusForbidden,
+				Error: enum.NotAllowed,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Set("admin", user)
+		c.Next()
+	}
+}
+
+// bindQuery binds and validates the query parameters of a request
+func bindQuery[T any](c *gin.Context) (*T, *api.ApiError) {
+	var payload T
+	if err := c.ShouldBindQuery(&payload); err != nil {
+		return nil, &api.ApiError{
+			Code:    http.StatusBadRequest,
+			Error:   enum.MalformedRequest,
+			Details: err.Error(),
+		}
+	}
+	if err := api.Validate.Struct(payload); err != nil {
+		return nil, &api.ApiError{
+			Code:    http.StatusBadRequest,
+			Error:   enum.MalformedRequest,
+			Details: err.Error(),
+		}
+	}
+	return &payload, nil
+}
+
+func SearchUsersController(c *gin.Context) {
+	_, logger, repos, _, errors := common.SetupEndpoint[any](c)
+	if errors != nil {
+		c.JSON(http.StatusInternalServerError, api.ApiError{
+			Code:    http.StatusInternalServerError,
+			Error:   enum.ApiError,
+			Details: errors,
+		})
+		return
+	}
+
+	payload, err := bindQuery[SearchRequest](c)
+	if err != nil {
+		c.JSON(err.Code, err)
+		return
+	}
+
+	users, err := SearchUsers(c.Request.Context(), repos, c.MustGet("admin").(*database.User), payload, logger)
+	if err != nil {
+		c.JSON(err.Code, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, users)
+}
+
+func SetUserDisabledController(disabled bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, logger, repos, _, errors := common.SetupEndpoint[any](c)
+		if errors != nil {
+			c.JSON(http.StatusInternalServerError, api.ApiError{
+				Code:    http.StatusInternalServerError,
+				Error:   enum.ApiError,
+				Details: errors,
+			})
+			return
+		}
+
+		user, err := SetUserDisabled(c.Request.Context(), repos, c.MustGet("admin").(*database.User), c.Param("userId"), disabled, logger)
+		if err != nil {
+			c.JSON(err.Code, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, user)
+	}
+}
+
+func DeleteUserController(c *gin.Context) {
+	_, logger, repos, cfg, errors := common.SetupEndpoint[any](c)
+	if errors != nil {
+		c.JSON(http.StatusInternalServerError, api.ApiError{
+			Code:    http.StatusInternalServerError,
+			Error:   enum.ApiError,
+			Details: errors,
+		})
+		return
+	}
+
+	if err := DeleteUser(c.Request.Context(), repos, cfg, c.MustGet("admin").(*database.User), c.Param("userId"), logger); err != nil {
+		c.JSON(err.Code, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func SearchChatsController(c *gin.Context) {
+	_, logger, repos, _, errors := common.SetupEndpoint[any](c)
+	if errors != nil {
+		c.JSON(http.StatusInternalServerError, api.ApiError{
+			Code:    http.StatusInternalServerError,
+			Error:   enum.ApiError,
+			Details: errors,
+		})
+		return
+	}
+
+	payload, err := bindQuery[SearchRequest](c)
+	if err != nil {
+		c.JSON(err.Code, err)
+		return
+	}
+
+	chats, err := SearchChats(c.Request.Context(), repos, c.MustGet("admin").(*database.User), payload, logger)
+	if err != nil {
+		c.JSON(err.Code, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, chats)
+}
+
+func GetChatController(c *gin.Context) {
+	_, logger, repos, _, errors := common.SetupEndpoint[any](c)
+	if errors != nil {
+		c.JSON(http.StatusInternalServerError, api.ApiError{
+			Code:    http.StatusInternalServerError,
+			Error:   enum.ApiError,
+			Details: errors,
+		})
+		return
+	}
+
+	chat, err := GetChat(c.Request.Context(), repos, c.MustGet("admin").(*database.User), c.Param("chatId"), logger)
+	if err != nil {
+		c.JSON(err.Code, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, chat)
+}
+
+func DeleteChatController(c *gin.Context) {
+	_, logger, repos, _, errors := common.SetupEndpoint[any](c)
+	if errors != nil {
+		c.JSON(http.StatusInternalServerError, api.ApiError{
+			Code:    http.StatusInternalServerError,
+			Error:   enum.ApiError,
+			Details: errors,
+		})
+		return
+	}
+
+	if err := DeleteChat(c.Request.Context(), repos, c.MustGet("admin").(*database.User), c.Param("chatId"), logger); err != nil {
+		c.JSON(err.Code, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func ListAuditLogsController(c *gin.Context) {
+	_, logger, repos, _, errors := common.SetupEndpoint[any](c)
+	if errors != nil {
+		c.JSON(http.StatusInternalServerError, api.ApiError{
+			Code:    http.StatusInternalServerError,
+			Error:   enum.ApiError,
+			Details: errors,
+		})
+		return
+	}
+
+	payload, err := bindQuery[AuditLogRequest](c)
+	if err != nil {
+		c.JSON(err.Code, err)
+		return
+	}
+
+	entries, err := ListAuditLogs(c.Request.Context(), repos, c.MustGet("admin").(*database.User), payload, logger)
+	if err != nil {
+		c.JSON(err.Code, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
+
+func ExportAuditLogsController(c *gin.Context) {
+	_, logger, repos, _, errors := common.SetupEndpoint[any](c)
+	if errors != nil {
+		c.JSON(http.StatusInternalServerError, api.ApiError{
+			Code:    http.StatusInternalServerError,
+			Error:   enum.ApiError,
+			Details: errors,
+		})
+		return
+	}
+
+	payload, err := bindQuery[AuditLogRequest](c)
+	if err != nil {
+		c.JSON(err.Code, err)
+		return
+	}
+
+	entries, err := ExportAuditLogs(c.Request.Context(), repos, c.MustGet("admin").(*database.User), payload, logger)
+	if err != nil {
+		c.JSON(err.Code, err)
+		return
+	}
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="audit-log-%s.jsonl"`, time.Now().UTC().Format("20060102T150405Z")))
+	c.Status(http.StatusOK)
+
+	encoder := json.NewEncoder(c.Writer)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			logger.PrintfWarning("Could not write audit log export: %s", err)
+			return
+		}
+	}
+}
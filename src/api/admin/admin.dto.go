@@ -0,0 +1,39 @@
+package admin
+
+import (
+	"easyflow-backend/src/database"
+	"time"
+)
+
+type SearchRequest struct {
+	Query  string `form:"query" validate:"lte=255"`
+	Limit  int    `form:"limit" validate:"omitempty,min=1,max=100"`
+	Offset int    `form:"offset" validate:"omitempty,min=0"`
+}
+
+// AuditLogRequest selects the entries created in [since, until), both default to the last 30 days
+type AuditLogRequest struct {
+	Since *time.Time `form:"since" time_format:"2006-01-02T15:04:05Z07:00"`
+	Until *time.Time `form:"until" time_format:"2006-01-02T15:04:05Z07:00"`
+	Limit int        `form:"limit" validate:"omitempty,min=1,max=1000"`
+}
+
+type UserResponse struct {
+	Id         string            `json:"id"`
+	CreatedAt  time.Time         `json:"createdAt"`
+	Email      string            `json:"email"`
+	Name       string            `json:"name"`
+	Role       database.UserRole `json:"role"`
+	DisabledAt *time.Time        `json:"disabledAt"`
+}
+
+// ChatResponse holds the metadata of a chat, the messages and wrapped keys are never handed out
+type ChatResponse struct {
+	Id                   string    `json:"id"`
+	CreatedAt            time.Time `json:"createdAt"`
+	Name                 string    `json:"name"`
+	Description          *string   `json:"description"`
+	MessageRetentionDays *int      `json:"messageRetentionDays"`
+	MemberCount          int64     `json:"memberCount"`
+	MemberIds            []string  `json:"memberIds,omitempty"`
+}
@@ -0,0 +1,360 @@
+package admin
+
+import (
+	"context"
+	"easyflow-backend/src/api"
+	"easyflow-backend/src/common"
+	"easyflow-backend/src/database"
+	"easyflow-backend/src/enum"
+	"easyflow-backend/src/repository"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Actions recorded in the admin audit log
+const (
+	ActionSearchUsers    = "user.search"
+	ActionDisableUser    = "user.disable"
+	ActionEnableUser     = "user.enable"
+	ActionDeleteUser     = "user.delete"
+	ActionSearchChats    = "chat.search"
+	ActionViewChat       = "chat.view"
+	ActionDeleteChat     = "chat.delete"
+	ActionListAuditLogs  = "audit.list"
+	ActionExportAuditLog = "audit.export"
+	ActionGrantAdmin     = "role.grant"
+	ActionRevokeAdmin    = "role.revoke"
+)
+
+// Target types of the admin audit log
+const (
+	TargetUser  = "user"
+	TargetChat  = "chat"
+	TargetAudit = "audit"
+)
+
+const defaultPageSize = 25
+
+// defaultAuditPeriod is the period covered by audit log requests without since
+const defaultAuditPeriod = 30 * 24 * time.Hour
+
+// audit records an action, admin is nil for actions that were run from the cli
+func audit(ctx context.Context, repos *repository.Repositories, admin *database.User, action string, targetType string, targetId string, details map[string]any) error {
+	entry := &database.AdminAuditLog{
+		Action:     action,
+		TargetType: targetType,
+	}
+	if admin != nil {
+		entry.AdminId = &admin.Id
+	}
+	if targetId != "" {
+		entry.TargetId = &targetId
+	}
+	if len(details) > 0 {
+		raw, err := json.Marshal(details)
+		if err != nil {
+			return err
+		}
+		encoded := string(raw)
+		entry.Details = &encoded
+	}
+
+	return repos.AdminAudit.Create(ctx, entry)
+}
+
+func internalError() *api.ApiError {
+	return &api.ApiError{
+		Code:  http.StatusInternalServerError,
+		Error: enum.ApiError,
+	}
+}
+
+func notFound() *api.ApiError {
+	return &api.ApiError{
+		Code:  http.StatusNotFound,
+		Error: enum.NotFound,
+	}
+}
+
+func toUserResponse(user *database.User) UserResponse {
+	return UserResponse{
+		Id:         user.Id,
+		CreatedAt:  user.CreatedAt,
+		Email:      user.Email,
+		Name:       user.Name,
+		Role:       user.Role,
+		DisabledAt: user.DisabledAt,
+	}
+}
+
+func SearchUsers(ctx context.Context, repos *repository.Repositories, admin *database.User, payload *SearchRequest, logger *common.Logger) ([]UserResponse, *api.ApiError) {
+	limit := payload.Limit
+	if limit == 0 {
+		limit = defaultPageSize
+	}
+
+	users, err := repos.Users.Search(ctx, payload.Query, limit, payload.Offset)
+	if err != nil {
+		logger.PrintfError("Error searching users: %s", err)
+		return nil, internalError()
+	}
+
+	if err := audit(ctx, repos, admin, ActionSearchUsers, TargetUser, "", map[string]any{"query": payload.Query, "offset": payload.Offset}); err != nil {
+		logger.PrintfError("Error writing audit log: %s", err)
+		return nil, internalError()
+	}
+
+	response := make([]UserResponse, 0, len(users))
+	for _, user := range users {
+		response = append(response, toUserResponse(&user))
+	}
+	return response, nil
+}
+
+// SetUserDisabled disables or enables the account, disabling ends all of its sessions right away.
+// Access tokens that were already issued stay valid until they expire.
+func SetUserDisabled(ctx context.Context, repos *repository.Repositories, admin *database.User, userId string, disabled bool, logger *common.Logger) (*UserResponse, *api.ApiError) {
+	if userId == admin.Id {
+		logger.PrintfWarning("Admin: %s tried to change the state of its own account", admin.Id)
+		return nil, &api.ApiError{
+			Code:  http.StatusForbidden,
+			Error: enum.NotAllowed,
+		}
+	}
+
+	action := ActionEnableUser
+	if disabled {
+		action = ActionDisableUser
+	}
+
+	var user *database.User
+	err := repos.Transaction(ctx, func(tx *repository.Repositories) error {
+		if err := tx.Users.SetDisabled(ctx, userId, disabled); err != nil {
+			return err
+		}
+
+		var err error
+		if user, err = tx.Users.GetById(ctx, userId); err != nil {
+			return err
+		}
+
+		return audit(ctx, tx, admin, action, TargetUser, userId, nil)
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, notFound()
+	}
+	if err != nil {
+		logger.PrintfError("Error changing the state of user: %s. Error: %s", userId, err)
+		return nil, internalError()
+	}
+
+	logger.Printf("Admin: %s changed the state of user: %s, disabled: %t", admin.Id, userId, disabled)
+
+	response := toUserResponse(user)
+	return &response, nil
+}
+
+// DeleteUser purges the user right away instead of waiting for the retention grace period
+func DeleteUser(ctx context.Context, repos *repository.Repositories, cfg *common.Config, admin *database.User, userId string, logger *common.Logger) *api.ApiError {
+	if userId == admin.Id {
+		logger.PrintfWarning("Admin: %s tried to delete its own account", admin.Id)
+		return &api.ApiError{
+			Code:  http.StatusForbidden,
+			Error: enum.NotAllowed,
+		}
+	}
+
+	err := repos.Transaction(ctx, func(tx *repository.Repositories) error {
+		if err := tx.Users.Purge(ctx, userId, cfg.RetentionPurgeMessages); err != nil {
+			return err
+		}
+		return audit(ctx, tx, admin, ActionDeleteUser, TargetUser, userId, map[string]any{"purgeMessages": cfg.RetentionPurgeMessages})
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		return notFound()
+	}
+	if err != nil {
+		logger.PrintfError("Error deleting user: %s. Error: %s", userId, err)
+		return internalError()
+	}
+
+	logger.Printf("Admin: %s deleted user: %s", admin.Id, userId)
+
+	return nil
+}
+
+func SearchChats(ctx context.Context, repos *repository.Repositories, admin *database.User, payload *SearchRequest, logger *common.Logger) ([]ChatResponse, *api.ApiError) {
+	limit := payload.Limit
+	if limit == 0 {
+		limit = defaultPageSize
+	}
+
+	chats, err := repos.Chats.Search(ctx, payload.Query, limit, payload.Offset)
+	if err != nil {
+		logger.PrintfError("Error searching chats: %s", err)
+		return nil, internalError()
+	}
+
+	chatIds := make([]string, 0, len(chats))
+	for _, chat := range chats {
+		chatIds = append(chatIds, chat.Id)
+	}
+	counts, err := repos.Chats.CountMembers(ctx, chatIds)
+	if err != nil {
+		logger.PrintfError("Error counting chat members: %s", err)
+		return nil, internalError()
+	}
+
+	if err := audit(ctx, repos, admin, ActionSearchChats, TargetChat, "", map[string]any{"query": payload.Query, "offset": payload.Offset}); err != nil {
+		logger.PrintfError("Error writing audit log: %s", err)
+		return nil, internalError()
+	}
+
+	response := make([]ChatResponse, 0, len(chats))
+	for _, chat := range chats {
+		response = append(response, ChatResponse{
+			Id:                   chat.Id,
+			CreatedAt:            chat.CreatedAt,
+			Name:                 chat.Name,
+			Description:          chat.Description,
+			MessageRetentionDays: chat.MessageRetentionDays,
+			MemberCount:          counts[chat.Id],
+		})
+	}
+	return response, nil
+}
+
+func GetChat(ctx context.Context, repos *repository.Repositories, admin *database.User, chatId string, logger *common.Logger) (*ChatResponse, *api.ApiError) {
+	chat, err := repos.Chats.GetById(ctx, chatId)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, notFound()
+	}
+	if err != nil {
+		logger.PrintfError("Error getting chat: %s. Error: %s", chatId, err)
+		return nil, internalError()
+	}
+
+	members, err := repos.Chats.ListMembers(ctx, chatId)
+	if err != nil {
+		logger.PrintfError("Error getting members of chat: %s. Error: %s", chatId, err)
+		return nil, internalError()
+	}
+
+	if err := audit(ctx, repos, admin, ActionViewChat, TargetChat, chatId, nil); err != nil {
+		logger.PrintfError("Error writing audit log: %s", err)
+		return nil, internalError()
+	}
+
+	memberIds := make([]string, 0, len(members))
+	for _, member := range members {
+		memberIds = append(memberIds, member.UserId)
+	}
+
+	return &ChatResponse{
+		Id:                   chat.Id,
+		CreatedAt:            chat.CreatedAt,
+		Name:                 chat.Name,
+		Description:          chat.Description,
+		MessageRetentionDays: chat.MessageRetentionDays,
+		MemberCount:          int64(len(members)),
+		MemberIds:            memberIds,
+	}, nil
+}
+
+// DeleteChat purges the chat with its memberships and messages right away
+func DeleteChat(ctx context.Context, repos *repository.Repositories, admin *database.User, chatId string, logger *common.Logger) *api.ApiError {
+	err := repos.Transaction(ctx, func(tx *repository.Repositories) error {
+		if err := tx.Chats.Purge(ctx, chatId); err != nil {
+			return err
+		}
+		return audit(ctx, tx, admin, ActionDeleteChat, TargetChat, chatId, nil)
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		return notFound()
+	}
+	if err != nil {
+		logger.PrintfError("Error deleting chat: %s. Error: %s", chatId, err)
+		return internalError()
+	}
+
+	logger.Printf("Admin: %s deleted chat: %s", admin.Id, chatId)
+
+	return nil
+}
+
+// auditPeriod resolves the defaults of an audit log request
+func auditPeriod(payload *AuditLogRequest) (time.Time, time.Time) {
+	until := time.Now()
+	if payload.Until != nil {
+		until = *payload.Until
+	}
+	since := until.Add(-defaultAuditPeriod)
+	if payload.Since != nil {
+		since = *payload.Since
+	}
+	return since, until
+}
+
+func ListAuditLogs(ctx context.Context, repos *repository.Repositories, admin *database.User, payload *AuditLogRequest, logger *common.Logger) ([]database.AdminAuditLog, *api.ApiError) {
+	limit := payload.Limit
+	if limit == 0 {
+		limit = 100
+	}
+
+	since, until := auditPeriod(payload)
+	entries, err := repos.AdminAudit.List(ctx, since, until, limit)
+	if err != nil {
+		logger.PrintfError("Error listing audit logs: %s", err)
+		return nil, internalError()
+	}
+
+	if err := audit(ctx, repos, admin, ActionListAuditLogs, TargetAudit, "", map[string]any{"since": since, "until": until}); err != nil {
+		logger.PrintfError("Error writing audit log: %s", err)
+		return nil, internalError()
+	}
+
+	return entries, nil
+}
+
+// ExportAuditLogs returns every entry of the period, the controller writes them as json lines
+func ExportAuditLogs(ctx context.Context, repos *repository.Repositories, admin *database.User, payload *AuditLogRequest, logger *common.Logger) ([]database.AdminAuditLog, *api.ApiError) {
+	since, until := auditPeriod(payload)
+	entries, err := repos.AdminAudit.List(ctx, since, until, 0)
+	if err != nil {
+		logger.PrintfError("Error listing audit logs: %s", err)
+		return nil, internalError()
+	}
+
+	if err := audit(ctx, repos, admin, ActionExportAuditLog, TargetAudit, "", map[string]any{"since": since, "until": until, "entries": len(entries)}); err != nil {
+		logger.PrintfError("Error writing audit log: %s", err)
+		return nil, internalError()
+	}
+
+	logger.Printf("Admin: %s exported %d audit log entries", admin.Id, len(entries))
+
+	return entries, nil
+}
+
+// SetRole grants or revokes the admin role of the user with the email, it is used by the cli
+func SetRole(ctx context.Context, repos *repository.Repositories, email string, role database.UserRole) error {
+	action := ActionRevokeAdmin
+	if role == database.RoleAdmin {
+		action = ActionGrantAdmin
+	}
+
+	return repos.Transaction(ctx, func(tx *repository.Repositories) error {
+		user, err := tx.Users.GetByEmail(ctx, email)
+		if err != nil {
+			return fmt.Errorf("could not find user %s: %w", email, err)
+		}
+
+		if err := tx.Users.SetRole(ctx, user.Id, role); err != nil {
+			return err
+		}
+
+		return audit(ctx, tx, nil, action, TargetUser, user.Id, nil)
+	})
+}
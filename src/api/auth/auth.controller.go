@@ -2,6 +2,7 @@ package auth
 
 import (
 	"easyflow-backend/src/api"
+	"easyflow-backend/src/audit"
 	"easyflow-backend/src/common"
 	"easyflow-backend/src/enum"
 	"easyflow-backend/src/middleware"
@@ -12,7 +13,7 @@ import (
 
 func RegisterAuthEndpoints(r *gin.RouterGroup) {
 	r.Use(middleware.LoggerMiddleware("Auth"))
-	r.Use(middleware.RateLimiter(1, 2))
+	r.Use(middleware.RateLimiter(common.RateLimitAuth))
 	r.POST("/login", LoginController)
 	r.GET("/check", AuthGuard(), CheckLoginController)
 	r.GET("/refresh", RefreshAuthGuard(), RefreshController)
@@ -20,7 +21,7 @@ func RegisterAuthEndpoints(r *gin.RouterGroup) {
 }
 
 func LoginController(c *gin.Context) {
-	payload, logger, db, cfg, errors := common.SetupEndpoint[LoginRequest](c)
+	payload, logger, repos, cfg, errors := common.SetupEndpoint[LoginRequest](c)
 	if errors != nil {
 		c.JSON(http.StatusInternalServerError, api.ApiError{
 			Code:    http.StatusInternalServerError,
@@ -30,7 +31,16 @@ func LoginController(c *gin.Context) {
 		return
 	}
 
-	tokens, err := LoginService(db, cfg, payload, logger)
+	recorder, ok := c.Get("auditRecorder")
+	if !ok {
+		c.JSON(http.StatusInternalServerError, api.ApiError{
+			Code:  http.StatusInternalServerError,
+			Error: enum.ApiError,
+		})
+		return
+	}
+
+	tokens, err := LoginService(c.Request.Context(), repos, recorder.(*audit.Recorder), cfg, payload, logger)
 	if err != nil {
 		c.JSON(err.Code, err)
 		return
@@ -61,7 +71,7 @@ func CheckLoginController(c *gin.Context) {
 }
 
 func RefreshController(c *gin.Context) {
-	_, logger, db, cfg, errors := common.SetupEndpoint[any](c)
+	_, logger, repos, cfg, errors := common.SetupEndpoint[any](c)
 	if errors != nil {
 		c.JSON(http.StatusInternalServerError, api.ApiError{
 			Code:    http.StatusInternalServerError,
@@ -80,7 +90,16 @@ func RefreshController(c *gin.Context) {
 		return
 	}
 
-	tokens, err := RefreshService(db, cfg, payload.(*JWTAccessTokenPayload), logger)
+	recorder, ok := c.Get("auditRecorder")
+	if !ok {
+		c.JSON(http.StatusInternalServerError, api.ApiError{
+			Code:  http.StatusInternalServerError,
+			Error: enum.ApiError,
+		})
+		return
+	}
+
+	tokens, err := RefreshService(c.Request.Context(), repos, recorder.(*audit.Recorder), cfg, payload.(*JWTAccessTokenPayload), logger)
 
 	if err != nil {
 		c.JSON(err.Code, err)
@@ -97,7 +116,7 @@ func RefreshController(c *gin.Context) {
 }
 
 func LogoutController(c *gin.Context) {
-	_, logger, db, cfg, errors := common.SetupEndpoint[any](c)
+	_, logger, repos, cfg, errors := common.SetupEndpoint[any](c)
 	if errors != nil {
 		c.JSON(http.StatusInternalServerError, api.ApiError{
 			Code:    http.StatusInternalServerError,
@@ -114,6 +133,7 @@ func LogoutController(c *gin.Context) {
 			Error:   enum.InvalidRefreshToken,
 			Details: err,
 		})
+		return
 	}
 
 	payload, err := ValidateToken(cfg, refresh)
@@ -126,7 +146,16 @@ func LogoutController(c *gin.Context) {
 		return
 	}
 
-	e := LogoutService(db, payload, logger)
+	recorder, ok := c.Get("auditRecorder")
+	if !ok {
+		c.JSON(http.StatusInternalServerError, api.ApiError{
+			Code:  http.StatusInternalServerError,
+			Error: enum.ApiError,
+		})
+		return
+	}
+
+	e := LogoutService(c.Request.Context(), repos, recorder.(*audit.Recorder), payload, logger)
 	if e != nil {
 		c.JSON(e.Code, e)
 		return
@@ -3,7 +3,6 @@ package auth
 import (
 	"easyflow-backend/src/api"
 	"easyflow-backend/src/common"
-	"easyflow-backend/src/database"
 	"easyflow-backend/src/enum"
 	"errors"
 	"net/http"
@@ -14,7 +13,7 @@ import (
 
 func AuthGuard() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		_, logger, _, cfg, errs := common.SetupEndpoint[any](c)
+		_, logger, repos, cfg, errs := common.SetupEndpoint[any](c)
 		if errs != nil {
 			c.JSON(http.StatusInternalServerError, api.ApiError{
 				Code:    http.StatusInternalServerError,
@@ -39,7 +38,7 @@ func AuthGuard() gin.HandlerFunc {
 
 		if accessToken == "" {
 			logger.PrintfDebug("No access token provided")
-			c.JSON(http.StatusBadGateway, api.ApiError{
+			c.JSON(http.StatusBadRequest, api.ApiError{
 				Code:  http.StatusBadRequest,
 				Error: enum.InvalidAccessToken,
 			})
@@ -57,6 +56,8 @@ func AuthGuard() gin.HandlerFunc {
 					Error:   enum.ExpiredAccessToken,
 					Details: err,
 				})
+				c.Abort()
+				return
 			}
 			c.JSON(498, api.ApiError{
 				Code:    498, // token expired/invalid
@@ -67,15 +68,21 @@ func AuthGuard() gin.HandlerFunc {
 			return
 		}
 
+		// members that are online are not sent push notifications
+		if cfg.PushEnabled() {
+			markSeen(c.Request.Context(), repos, cfg, payload.UserId, logger)
+		}
+
 		// Set user payload in context
 		c.Set("user", payload)
+		c.Set("userId", payload.UserId)
 		c.Next()
 	}
 }
 
 func RefreshAuthGuard() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		_, logger, db, cfg, errs := common.SetupEndpoint[any](c)
+		_, logger, repos, cfg, errs := common.SetupEndpoint[any](c)
 		if errs != nil {
 			c.JSON(http.StatusInternalServerError, api.ApiError{
 				Code:    http.StatusInternalServerError,
@@ -101,7 +108,7 @@ func RefreshAuthGuard() gin.HandlerFunc {
 			logger.PrintfDebug("No refresh token provided")
 			c.JSON(498, api.ApiError{
 				Code:  498, // token expired/invalid
-				Error: enum.InvalidAccessToken,
+				Error: enum.InvalidRefreshToken,
 			})
 			c.Abort()
 			return
@@ -126,7 +133,7 @@ func RefreshAuthGuard() gin.HandlerFunc {
 			return
 		}
 
-		if err := db.First(&database.UserKeys{}, "user_id = ? AND random = ?", token.UserId, token.RefreshRand).Error; err != nil {
+		if _, err := repos.Sessions.Get(c.Request.Context(), token.UserId, token.RefreshRand.String()); err != nil {
 			logger.PrintfDebug("refresh token not found in db")
 			c.JSON(498, api.ApiError{
 				Code:  498,
@@ -138,6 +145,7 @@ func RefreshAuthGuard() gin.HandlerFunc {
 		}
 
 		c.Set("user", token)
+		c.Set("userId", token.UserId)
 		c.Next()
 	}
 }
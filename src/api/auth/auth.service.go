@@ -1,21 +1,22 @@
 package auth
 
 import (
+	"context"
 	"easyflow-backend/src/api"
-	"easyflow-backend/src/api/utils"
+	"easyflow-backend/src/audit"
 	"easyflow-backend/src/common"
 	"easyflow-backend/src/database"
 	"easyflow-backend/src/enum"
+	"easyflow-backend/src/metrics"
+	"easyflow-backend/src/repository"
+	"errors"
 	"fmt"
 	"net/http"
-	"net/url"
-	"strconv"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
-	"gorm.io/gorm"
 )
 
 func generateJwt[T interface{ jwt.Claims }](cfg *common.Config, payload T) (string, error) {
@@ -46,13 +47,19 @@ func ValidateToken(cfg *common.Config, token string) (*JWTAccessTokenPayload, er
 		return nil, err
 	}
 
+	if claims.RefreshRand == nil {
+		return nil, fmt.Errorf("token has no refresh random")
+	}
+
 	return &claims, nil
 }
 
-func LoginService(db *gorm.DB, cfg *common.Config, payload *LoginRequest, logger *common.Logger) (JWTPair, *api.ApiError) {
-	var user database.User
-	if err := db.Where("email = ?", payload.Email).First(&user).Error; err != nil {
-		logger.PrintfWarning("User with email: %s not found", payload.Email)
+func LoginService(ctx context.Context, repos *repository.Repositories, recorder *audit.Recorder, cfg *common.Config, payload *LoginRequest, logger *common.Logger) (JWTPair, *api.ApiError) {
+	user, err := repos.Users.GetByEmail(ctx, payload.Email)
+	if err != nil {
+		logger.PrintfWarning("Login with unknown email")
+		metrics.Logins.WithLabelValues("failure").Inc()
+		recorder.Record(ctx, repos, database.EventLoginFailed, "", map[string]any{"reason": "unknown_account"}, logger)
 		return JWTPair{}, &api.ApiError{
 			Code:    http.StatusUnauthorized,
 			Error:   enum.WrongCredentials,
@@ -62,7 +69,9 @@ func LoginService(db *gorm.DB, cfg *common.Config, payload *LoginRequest, logger
 
 	//check password
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(payload.Password)); err != nil {
-		logger.PrintfWarning("Wrong password for user with email: %s", payload.Email)
+		logger.PrintfWarning("Wrong password for user: %s", user.Id)
+		metrics.Logins.WithLabelValues("failure").Inc()
+		recorder.Record(ctx, repos, database.EventLoginFailed, user.Id, map[string]any{"reason": "wrong_password"}, logger)
 		return JWTPair{}, &api.ApiError{
 			Code:    http.StatusUnauthorized,
 			Error:   enum.WrongCredentials,
@@ -70,6 +79,16 @@ func LoginService(db *gorm.DB, cfg *common.Config, payload *LoginRequest, logger
 		}
 	}
 
+	if user.DisabledAt != nil {
+		logger.PrintfWarning("Login of disabled user: %s", user.Id)
+		metrics.Logins.WithLabelValues("failure").Inc()
+		recorder.Record(ctx, repos, database.EventLoginFailed, user.Id, map[string]any{"reason": "account_disabled"}, logger)
+		return JWTPair{}, &api.ApiError{
+			Code:  http.StatusForbidden,
+			Error: enum.AccountDisabled,
+		}
+	}
+
 	random := uuid.New()
 	expires := time.Now().Add(time.Duration(cfg.JwtExpirationTime) * time.Second)
 	refreshExpires := time.Now().Add(time.Duration(cfg.RefreshExpirationTime) * time.Second)
@@ -123,7 +142,7 @@ func LoginService(db *gorm.DB, cfg *common.Config, payload *LoginRequest, logger
 		UserId:    user.Id,
 	}
 
-	if err := db.Save(&entry).Error; err != nil {
+	if err := repos.Sessions.Create(ctx, &entry); err != nil {
 		logger.PrintfError("Error updating user key: %s", err)
 		return JWTPair{}, &api.ApiError{
 			Code:    http.StatusInternalServerError,
@@ -132,37 +151,9 @@ func LoginService(db *gorm.DB, cfg *common.Config, payload *LoginRequest, logger
 		}
 	}
 
-	if user.ProfilePicture == nil {
-		utils.GenerateNewProfilePictureUrl(logger, cfg, db, &user)
-	} else {
-		expired := false
-
-		pictureUrl, err := url.Parse(*user.ProfilePicture)
-		if err != nil {
-			expired = true
-		}
-
-		query := pictureUrl.Query()
-		issuedAt, err := time.Parse(time.RFC3339, query.Get("X-Amz-Date"))
-		if err != nil {
-			expired = true
-		}
-		expiryTime, err := strconv.ParseInt(query.Get("X-Amz-Expires"), 10, 64)
-		if err != nil {
-			expired = true
-		}
-
-		if issuedAt.Add(time.Duration(expiryTime) * time.Second).After(time.Now()) {
-			expired = true
-		}
-
-		if expired {
-			utils.GenerateNewProfilePictureUrl(logger, cfg, db, &user)
-		}
-
-	}
-
 	logger.Printf("Logged in user: %s", user.Id)
+	metrics.Logins.WithLabelValues("success").Inc()
+	recorder.Record(ctx, repos, database.EventLoginSucceeded, user.Id, nil, logger)
 
 	return JWTPair{
 		RefreshToken: refreshToken,
@@ -170,10 +161,10 @@ func LoginService(db *gorm.DB, cfg *common.Config, payload *LoginRequest, logger
 	}, nil
 }
 
-func RefreshService(db *gorm.DB, cfg *common.Config, payload *JWTAccessTokenPayload, logger *common.Logger) (JWTPair, *api.ApiError) {
+func RefreshService(ctx context.Context, repos *repository.Repositories, recorder *audit.Recorder, cfg *common.Config, payload *JWTAccessTokenPayload, logger *common.Logger) (JWTPair, *api.ApiError) {
 	//get user from db
-	var user database.User
-	if err := db.First(&user, "id = ?", payload.UserId).Error; err != nil {
+	user, err := repos.Users.GetById(ctx, payload.UserId)
+	if err != nil {
 		logger.PrintfWarning("Could not get user with id: %s", payload.UserId)
 		return JWTPair{}, &api.ApiError{
 			Code:    http.StatusUnauthorized,
@@ -182,6 +173,15 @@ func RefreshService(db *gorm.DB, cfg *common.Config, payload *JWTAccessTokenPayl
 		}
 	}
 
+	// the sessions are ended when the account is disabled, this only guards against a race with the admin
+	if user.DisabledAt != nil {
+		logger.PrintfWarning("Refresh of disabled user: %s", user.Id)
+		return JWTPair{}, &api.ApiError{
+			Code:  http.StatusForbidden,
+			Error: enum.AccountDisabled,
+		}
+	}
+
 	random := uuid.New()
 	expires := time.Now().Add(time.Duration(cfg.JwtExpirationTime) * time.Second)
 	refreshExpires := time.Now().Add(time.Duration(cfg.RefreshExpirationTime) * time.Second)
@@ -227,23 +227,14 @@ func RefreshService(db *gorm.DB, cfg *common.Config, payload *JWTAccessTokenPayl
 	}
 
 	//write refresh token random to db
-	err = db.Model(database.UserKeys{}).Where(
-		&database.UserKeys{
-			UserId: payload.UserId,
-			Random: payload.RefreshRand.String(),
-		},
-	).Updates(
-		database.UserKeys{
-			Random:    random.String(),
-			ExpiredAt: refreshExpires,
-		}).Error
-
+	err = repos.Sessions.Rotate(ctx, payload.UserId, payload.RefreshRand.String(), random.String(), refreshExpires)
 	if err != nil {
 		logger.PrintfError("Error updating user key with user id: %s and random: %s", payload.UserId, payload.RefreshRand)
 
 	}
 
 	logger.Printf("Refreshed token for user with id: %s", payload.UserId)
+	recorder.Record(ctx, repos, database.EventTokenRefreshed, payload.UserId, nil, logger)
 
 	return JWTPair{
 		AccessToken:  accessToken,
@@ -251,8 +242,8 @@ func RefreshService(db *gorm.DB, cfg *common.Config, payload *JWTAccessTokenPayl
 	}, nil
 }
 
-func LogoutService(db *gorm.DB, payload *JWTAccessTokenPayload, logger *common.Logger) *api.ApiError {
-	if err := db.Delete(&database.UserKeys{}, payload.RefreshRand).Error; err != nil {
+func LogoutService(ctx context.Context, repos *repository.Repositories, recorder *audit.Recorder, payload *JWTAccessTokenPayload, logger *common.Logger) *api.ApiError {
+	if err := repos.Sessions.Delete(ctx, payload.UserId, payload.RefreshRand.String()); err != nil && !errors.Is(err, repository.ErrNotFound) {
 		logger.PrintfError("Could not delete Refresh Token with random: %s and user id: %s", payload.RefreshRand, payload.UserId)
 		return &api.ApiError{
 			Code:    http.StatusInternalServerError,
@@ -262,6 +253,7 @@ func LogoutService(db *gorm.DB, payload *JWTAccessTokenPayload, logger *common.L
 	}
 
 	logger.Printf("Successfully ended session for user with id: %s and random: %s", payload.UserId, payload.RefreshRand)
+	recorder.Record(ctx, repos, database.EventLogout, payload.UserId, nil, logger)
 
 	return nil
 }
@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"context"
+	"easyflow-backend/src/common"
+	"easyflow-backend/src/repository"
+	"sync"
+	"time"
+)
+
+// seen remembers when the presence of a user was last stored by this instance, it is stored at most twice per PUSH_ONLINE_WINDOW
+var seen = struct {
+	sync.Mutex
+	at        map[string]time.Time
+	lastSweep time.Time
+}{at: map[string]time.Time{}}
+
+/*
+Private function to store that the user made an authenticated request, requests in between are not written to the database
+*/
+func markSeen(ctx context.Context, repos *repository.Repositories, cfg *common.Config, userId string, logger *common.Logger) {
+	now := time.Now()
+
+	seen.Lock()
+	if last, ok := seen.at[userId]; ok && now.Sub(last) < cfg.PushOnlineWindow/2 {
+		seen.Unlock()
+		return
+	}
+	seen.at[userId] = now
+
+	// users that left are forgotten once per window so the map does not grow
+	if now.Sub(seen.lastSweep) >= cfg.PushOnlineWindow {
+		for id, at := range seen.at {
+			if now.Sub(at) >= cfg.PushOnlineWindow {
+				delete(seen.at, id)
+			}
+		}
+		seen.lastSweep = now
+	}
+	seen.Unlock()
+
+	if err := repos.Users.MarkSeen(ctx, userId, now); err != nil {
+		logger.PrintfWarning("Could not store that user: %s was seen. Error: %s", userId, err)
+	}
+}
@@ -3,25 +3,37 @@ package chat
 import (
 	"easyflow-backend/src/api"
 	"easyflow-backend/src/api/auth"
+	"easyflow-backend/src/audit"
 	"easyflow-backend/src/common"
 	"easyflow-backend/src/enum"
 	"easyflow-backend/src/middleware"
+	"easyflow-backend/src/repository"
+	"easyflow-backend/src/scanning"
+	"easyflow-backend/src/storage"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 )
 
 func RegisterChatEndpoints(r *gin.RouterGroup) {
-	r.Use(auth.AuthGuard())
 	r.Use(middleware.LoggerMiddleware("Chat"))
-	r.Use(middleware.RateLimiter(1, 5))
+	r.Use(auth.AuthGuard())
+	r.Use(middleware.RateLimiter(common.RateLimitChat))
 	r.POST("", CreateChatController)
 	r.GET("/preview", GetChatPreviewsController)
 	r.GET("/:chatId", GetChatByIdController)
+	r.POST("/:chatId/messages", SendMessageController)
+	r.PUT("/:chatId/mute", MuteChatController)
+	r.DELETE("/:chatId/mute", UnmuteChatController)
+	r.POST("/:chatId/attachments", CreateAttachmentController)
+	r.GET("/:chatId/attachments/:attachmentId", GetAttachmentController)
+	r.GET("/:chatId/picture", GetChatPictureController)
+	r.POST("/:chatId/picture", ConfirmChatPictureController)
+	r.GET("/:chatId/upload-picture", GenerateUploadChatPictureURLController)
 }
 
 func CreateChatController(c *gin.Context) {
-	payload, logger, db, _, errors := common.SetupEndpoint[CreateChatRequest](c)
+	payload, logger, repos, _, errors := common.SetupEndpoint[CreateChatRequest](c)
 	if errors != nil {
 		c.JSON(http.StatusInternalServerError, api.ApiError{
 			Code:    http.StatusInternalServerError,
@@ -40,7 +52,16 @@ func CreateChatController(c *gin.Context) {
 		return
 	}
 
-	chat, err := CreateChat(db, payload, user.(*auth.JWTAccessTokenPayload), logger)
+	recorder, ok := c.Get("auditRecorder")
+	if !ok {
+		c.JSON(http.StatusInternalServerError, api.ApiError{
+			Code:  http.StatusInternalServerError,
+			Error: enum.ApiError,
+		})
+		return
+	}
+
+	chat, err := CreateChat(c.Request.Context(), repos, recorder.(*audit.Recorder), payload, user.(*auth.JWTAccessTokenPayload), logger)
 	if err != nil {
 		c.JSON(err.Code, err)
 		return
@@ -50,7 +71,22 @@ func CreateChatController(c *gin.Context) {
 }
 
 func GetChatPreviewsController(c *gin.Context) {
-	_, logger, db, _, errors := common.SetupEndpoint[any](c)
+	_, logger, repos, cfg, store, user, ok := setupChatEndpoint[any](c)
+	if !ok {
+		return
+	}
+
+	chats, err := GetChatPreviews(c.Request.Context(), repos, cfg, store, user, logger)
+	if err != nil {
+		c.JSON(err.Code, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, chats)
+}
+
+func GetChatByIdController(c *gin.Context) {
+	_, logger, repos, cfg, errors := common.SetupEndpoint[any](c)
 	if errors != nil {
 		c.JSON(http.StatusInternalServerError, api.ApiError{
 			Code:    http.StatusInternalServerError,
@@ -69,24 +105,36 @@ func GetChatPreviewsController(c *gin.Context) {
 		return
 	}
 
-	chats, err := GetChatPreviews(db, user.(*auth.JWTAccessTokenPayload), logger)
+	store, ok := c.Get("objectStore")
+	if !ok {
+		c.JSON(http.StatusInternalServerError, api.ApiError{
+			Code:  http.StatusInternalServerError,
+			Error: enum.ApiError,
+		})
+		return
+	}
+
+	chatId := c.Param("chatId")
+
+	chat, err := GetChatById(c.Request.Context(), repos, cfg, store.(storage.ObjectStore), chatId, user.(*auth.JWTAccessTokenPayload), logger)
 	if err != nil {
 		c.JSON(err.Code, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, chats)
+	c.JSON(http.StatusOK, chat)
 }
 
-func GetChatByIdController(c *gin.Context) {
-	_, logger, db, _, errors := common.SetupEndpoint[any](c)
+// setupChatEndpoint resolves everything the chat endpoints need, it writes the error response itself
+func setupChatEndpoint[T any](c *gin.Context) (*T, *common.Logger, *repository.Repositories, *common.Config, storage.ObjectStore, *auth.JWTAccessTokenPayload, bool) {
+	payload, logger, repos, cfg, errors := common.SetupEndpoint[T](c)
 	if errors != nil {
 		c.JSON(http.StatusInternalServerError, api.ApiError{
 			Code:    http.StatusInternalServerError,
 			Error:   enum.ApiError,
 			Details: errors,
 		})
-		return
+		return nil, nil, nil, nil, nil, nil, false
 	}
 
 	user, ok := c.Get("user")
@@ -95,12 +143,187 @@ func GetChatByIdController(c *gin.Context) {
 			Code:  http.StatusInternalServerError,
 			Error: enum.ApiError,
 		})
+		return nil, nil, nil, nil, nil, nil, false
+	}
+
+	store, ok := c.Get("objectStore")
+	if !ok {
+		c.JSON(http.StatusInternalServerError, api.ApiError{
+			Code:  http.StatusInternalServerError,
+			Error: enum.ApiError,
+		})
+		return nil, nil, nil, nil, nil, nil, false
+	}
+
+	return payload, logger, repos, cfg, store.(storage.ObjectStore), user.(*auth.JWTAccessTokenPayload), true
+}
+
+func SendMessageController(c *gin.Context) {
+	payload, logger, repos, cfg, store, user, ok := setupChatEndpoint[SendMessageRequest](c)
+	if !ok {
+		return
+	}
+	if payload == nil {
+		c.JSON(http.StatusBadRequest, api.ApiError{
+			Code:  http.StatusBadRequest,
+			Error: enum.MalformedRequest,
+		})
 		return
 	}
 
-	chatId := c.Param("chatId")
+	scans, ok := c.Get("scanRunner")
+	if !ok {
+		c.JSON(http.StatusInternalServerError, api.ApiError{
+			Code:  http.StatusInternalServerError,
+			Error: enum.ApiError,
+		})
+		return
+	}
+
+	message, err := SendMessage(c.Request.Context(), repos, scans.(*scanning.Runner), cfg, store, c.Param("chatId"), payload, user, logger)
+	if err != nil {
+		c.JSON(err.Code, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, message)
+}
+
+func MuteChatController(c *gin.Context) {
+	payload, logger, repos, _, _, user, ok := setupChatEndpoint[MuteChatRequest](c)
+	if !ok {
+		return
+	}
+	// without a body the chat is muted until it is unmuted
+	if payload == nil {
+		payload = &MuteChatRequest{}
+	}
+
+	mute, err := MuteChat(c.Request.Context(), repos, c.Param("chatId"), payload, user, logger)
+	if err != nil {
+		c.JSON(err.Code, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, mute)
+}
+
+func UnmuteChatController(c *gin.Context) {
+	_, logger, repos, _, _, user, ok := setupChatEndpoint[any](c)
+	if !ok {
+		return
+	}
+
+	mute, err := UnmuteChat(c.Request.Context(), repos, c.Param("chatId"), user, logger)
+	if err != nil {
+		c.JSON(err.Code, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, mute)
+}
+
+func CreateAttachmentController(c *gin.Context) {
+	payload, logger, repos, cfg, store, user, ok := setupChatEndpoint[CreateAttachmentRequest](c)
+	if !ok {
+		return
+	}
+	if payload == nil {
+		c.JSON(http.StatusBadRequest, api.ApiError{
+			Code:  http.StatusBadRequest,
+			Error: enum.MalformedRequest,
+		})
+		return
+	}
+
+	attachment, err := CreateAttachment(c.Request.Context(), repos, cfg, store, c.Param("chatId"), payload, user, logger)
+	if err != nil {
+		c.JSON(err.Code, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, attachment)
+}
+
+func GetAttachmentController(c *gin.Context) {
+	_, logger, repos, cfg, store, user, ok := setupChatEndpoint[any](c)
+	if !ok {
+		return
+	}
+
+	attachment, err := GetAttachment(c.Request.Context(), repos, cfg, store, c.Param("chatId"), c.Param("attachmentId"), user, logger)
+	if err != nil {
+		c.JSON(err.Code, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, attachment)
+}
+
+func GetChatPictureController(c *gin.Context) {
+	_, logger, repos, cfg, store, user, ok := setupChatEndpoint[any](c)
+	if !ok {
+		return
+	}
+
+	imageURL, err := GenerateGetChatPictureURL(c.Request.Context(), repos, cfg, store, c.Param("chatId"), user, logger)
+	if err != nil {
+		c.JSON(err.Code, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, imageURL)
+}
+
+func GenerateUploadChatPictureURLController(c *gin.Context) {
+	_, logger, repos, cfg, store, user, ok := setupChatEndpoint[any](c)
+	if !ok {
+		return
+	}
+
+	var payload UploadChatPictureRequest
+	if err := c.ShouldBindQuery(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, api.ApiError{
+			Code:    http.StatusBadRequest,
+			Error:   enum.MalformedRequest,
+			Details: err.Error(),
+		})
+		return
+	}
+	if err := api.Validate.Struct(payload); err != nil {
+		c.JSON(http.StatusBadRequest, api.ApiError{
+			Code:    http.StatusBadRequest,
+			Error:   enum.MalformedRequest,
+			Details: err.Error(),
+		})
+		return
+	}
+
+	upload, err := GenerateUploadChatPictureURL(c.Request.Context(), repos, cfg, store, c.Param("chatId"), &payload, user, logger)
+	if err != nil {
+		c.JSON(err.Code, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, upload)
+}
+
+func ConfirmChatPictureController(c *gin.Context) {
+	_, logger, repos, cfg, store, user, ok := setupChatEndpoint[any](c)
+	if !ok {
+		return
+	}
+
+	scans, ok := c.Get("scanRunner")
+	if !ok {
+		c.JSON(http.StatusInternalServerError, api.ApiError{
+			Code:  http.StatusInternalServerError,
+			Error: enum.ApiError,
+		})
+		return
+	}
 
-	chat, err := GetChatById(db, chatId, user.(*auth.JWTAccessTokenPayload), logger)
+	chat, err := ConfirmChatPicture(c.Request.Context(), repos, scans.(*scanning.Runner), cfg, store, c.Param("chatId"), user, logger)
 	if err != nil {
 		c.JSON(err.Code, err)
 		return
@@ -1,48 +1,119 @@
 package chat
 
+import (
+	"easyflow-backend/src/database"
+	"time"
+)
+
 type UserKeyEntry struct {
 	UserID string `json:"userId" validate:"required"`
 	Key    string `json:"key" validate:"required"`
 }
 
 type UserEntry struct {
-	Id   string  `json:"id"`
-	Name string  `json:"name"`
-	Bio  *string `json:"bio"`
+	Id                     string            `json:"id"`
+	Name                   string            `json:"name"`
+	Bio                    *string           `json:"bio"`
+	ProfilePictureVariants map[string]string `json:"profilePictureVariants"`
 }
 
 type MessageEntry struct {
-	Id        string `json:"id"`
-	CreatedAt string `json:"createdAt"`
-	UpdatedAt string `json:"updatedAt"`
-	Content   string `json:"content"`
-	Iv        string `json:"iv"`
-	SenderId  string `json:"sender_id"`
+	Id          string            `json:"id"`
+	CreatedAt   string            `json:"createdAt"`
+	UpdatedAt   string            `json:"updatedAt"`
+	Content     string            `json:"content"`
+	Iv          string            `json:"iv"`
+	SenderId    *string           `json:"sender_id"`
+	Attachments []AttachmentEntry `json:"attachments"`
+}
+
+type AttachmentEntry struct {
+	Id         string              `json:"id"`
+	Size       int64               `json:"size"`
+	MimeType   string              `json:"mimeType"`
+	Checksum   string              `json:"checksum"`
+	ScanStatus database.ScanStatus `json:"scanStatus"`
+}
+
+type SendMessageRequest struct {
+	Content       string   `json:"content" validate:"required"`
+	Iv            string   `json:"iv" validate:"required,lte=25"`
+	AttachmentIds []string `json:"attachmentIds" validate:"omitempty,max=10,unique,dive,uuid"`
+}
+
+// CreateAttachmentRequest describes the encrypted file, the upload url only accepts a file that matches it
+type CreateAttachmentRequest struct {
+	Size     int64  `json:"size" validate:"required,gte=1"`
+	MimeType string `json:"mimeType" validate:"required,lte=127,contains=/"`
+	Checksum string `json:"checksum" validate:"required,base64,len=44"` // base64 encoded sha256
+}
+
+// CreateAttachmentResponse holds the presigned upload, the client sends a PUT with the headers to the url
+type CreateAttachmentResponse struct {
+	Id            string            `json:"id"`
+	UploadURL     string            `json:"uploadUrl"`
+	UploadHeaders map[string]string `json:"uploadHeaders"`
+	ExpiresAt     time.Time         `json:"expiresAt"`
+}
+
+type GetAttachmentResponse struct {
+	AttachmentEntry
+	DownloadURL string    `json:"downloadUrl"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+}
+
+// UploadChatPictureRequest describes the picture, the upload url only accepts a file that matches it
+type UploadChatPictureRequest struct {
+	MimeType string `form:"mimeType" validate:"required,lte=127"`
+	Size     int64  `form:"size" validate:"required,gte=1"`
+}
+
+// UploadChatPictureResponse holds the presigned upload, the client sends a PUT with the headers to the url
+type UploadChatPictureResponse struct {
+	UploadURL     string            `json:"uploadUrl"`
+	UploadHeaders map[string]string `json:"uploadHeaders"`
+	ExpiresAt     time.Time         `json:"expiresAt"`
 }
 
 type CreateChatRequest struct {
-	Name        string         `json:"name" validate:"required"`
-	Picture     *string        `json:"picture" validate:"omitempty,url"`
-	Description *string        `json:"description" validate:"omitempty"`
-	UserKeys    []UserKeyEntry `json:"userKeys" validate:"required,dive"`
+	Name                 string         `json:"name" validate:"required"`
+	Description          *string        `json:"description" validate:"omitempty"`
+	MessageRetentionDays *int           `json:"messageRetentionDays" validate:"omitempty,min=1,max=3650"`
+	UserKeys             []UserKeyEntry `json:"userKeys" validate:"required,dive"`
 }
 
 type CreateChatResponse struct {
-	Id          string  `json:"id"`
-	CreatedAt   string  `json:"createdAt"`
-	UpdateAt    string  `json:"updatedAt"`
-	Name        string  `json:"name"`
-	Picture     *string `json:"picture"`
-	Description *string `json:"description"`
+	Id                   string               `json:"id"`
+	CreatedAt            string               `json:"createdAt"`
+	UpdateAt             string               `json:"updatedAt"`
+	Name                 string               `json:"name"`
+	Picture              *string              `json:"picture"`
+	PictureVariants      map[string]string    `json:"pictureVariants"`
+	PictureScan          *database.ScanStatus `json:"pictureScan"` // null without a picture
+	Description          *string              `json:"description"`
+	MessageRetentionDays *int                 `json:"messageRetentionDays"`
+}
+
+// ChatMuteResponse is the mute of the requesting member, members that muted the chat get no push notifications
+type ChatMuteResponse struct {
+	Muted     bool       `json:"muted"`
+	MuteUntil *time.Time `json:"muteUntil"` // null while muted until the member unmutes
+}
+
+// MuteChatRequest mutes the chat until the time or until the member unmutes it if until is omitted
+type MuteChatRequest struct {
+	Until *time.Time `json:"until" validate:"omitempty"`
 }
 
 type GetChatPreviewResponse struct {
 	CreateChatResponse
+	ChatMuteResponse
 	LastMessage *string `json:"last_message"`
 }
 
 type GetChatByIdResponse struct {
 	CreateChatResponse
+	ChatMuteResponse
 	UserKeys []UserKeyEntry `json:"userKeys"`
 	Messages []MessageEntry `json:"messages"`
 	Users    []UserEntry    `json:"users"`
@@ -1,252 +1,802 @@
 package chat
 
 import (
+	"context"
 	"easyflow-backend/src/api"
 	"easyflow-backend/src/api/auth"
+	"easyflow-backend/src/api/utils"
+	"easyflow-backend/src/audit"
 	"easyflow-backend/src/common"
 	"easyflow-backend/src/database"
 	"easyflow-backend/src/enum"
+	"easyflow-backend/src/notify"
+	"easyflow-backend/src/repository"
+	"easyflow-backend/src/scanning"
+	"easyflow-backend/src/storage"
+	"errors"
+	"fmt"
 	"net/http"
+	"time"
 
-	"gorm.io/gorm"
+	"github.com/google/uuid"
 )
 
-func CreateChat(db *gorm.DB, payload *CreateChatRequest, jwtPayload *auth.JWTAccessTokenPayload, logger *common.Logger) (*CreateChatResponse, *api.ApiError) {
-	var users []database.User
-	var userKeys []UserKeyEntry
+func CreateChat(ctx context.Context, repos *repository.Repositories, recorder *audit.Recorder, payload *CreateChatRequest, jwtPayload *auth.JWTAccessTokenPayload, logger *common.Logger) (*CreateChatResponse, *api.ApiError) {
+	var chat *database.Chat
+	var apiErr *api.ApiError
 
 	// Start a transaction
-	tx := db.Begin()
+	err := repos.Transaction(ctx, func(tx *repository.Repositories) error {
+		var users []database.User
+		var userKeys []UserKeyEntry
+
+		//get users from payload.UserKeys
+		for _, userKey := range payload.UserKeys {
+			user, err := tx.Users.GetById(ctx, userKey.UserID)
+			if err != nil {
+				logger.PrintfError("Error getting user with id: %s", userKey.UserID)
+				if errors.Is(err, repository.ErrNotFound) {
+					apiErr = &api.ApiError{
+						Code:  http.StatusNotFound,
+						Error: enum.UserNotFound,
+					}
+				}
+				return err
+			}
+			users = append(users, *user)
+			userKeys = append(userKeys, userKey)
+		}
+
+		chat = &database.Chat{
+			Name:                 payload.Name,
+			Description:          payload.Description,
+			MessageRetentionDays: payload.MessageRetentionDays,
+			Messages:             nil,
+		}
+
+		if err := tx.Chats.Create(ctx, chat); err != nil {
+			logger.PrintfError("Error creating chat: %s", err)
+			return err
+		}
+
+		for i, user := range users {
+			chatUserKeys := &database.ChatUserKeys{
+				ChatId: chat.Id,
+				UserId: user.Id,
+				Key:    userKeys[i].Key,
+				Role:   database.ChatRoleMember,
+			}
+			// the creator administrates the chat, e.g. sets its picture
+			if user.Id == jwtPayload.UserId {
+				chatUserKeys.Role = database.ChatRoleAdmin
+			}
+
+			if err := tx.Chats.AddMember(ctx, chatUserKeys); err != nil {
+				logger.PrintfError("Error creating chat user key: %s", err)
+				return err
+			}
+		}
+
+		return nil
+	})
 
-	//get users from payload.UserKeys
+	if err != nil {
+		if apiErr != nil {
+			return nil, apiErr
+		}
+		return nil, &api.ApiError{
+			Code:  http.StatusInternalServerError,
+			Error: enum.ApiError,
+		}
+	}
+
+	logger.Printf("Successfully created chat with id: %s", chat.Id)
+
+	recorder.Record(ctx, repos, database.EventChatCreated, jwtPayload.UserId, map[string]any{"chatId": chat.Id}, logger)
 	for _, userKey := range payload.UserKeys {
-		user := database.User{}
-		if err := tx.Where("id = ?", userKey.UserID).First(&user).Error; err != nil {
-			tx.Rollback()
-			logger.PrintfError("Error getting user with id: %s", userKey.UserID)
+		if userKey.UserID == jwtPayload.UserId {
+			continue
+		}
+		recorder.Record(ctx, repos, database.EventChatMemberAdded, userKey.UserID, map[string]any{"chatId": chat.Id, "addedBy": jwtPayload.UserId}, logger)
+	}
+
+	return &CreateChatResponse{
+		Id:                   chat.Id,
+		CreatedAt:            chat.CreatedAt.String(),
+		UpdateAt:             chat.UpdatedAt.String(),
+		Name:                 chat.Name,
+		Description:          chat.Description,
+		MessageRetentionDays: chat.MessageRetentionDays,
+	}, nil
+}
+
+// toChatResponse maps the chat and signs the urls of its picture
+func toChatResponse(ctx context.Context, logger *common.Logger, cfg *common.Config, store storage.ObjectStore, chat *database.Chat) (*CreateChatResponse, *api.ApiError) {
+	picture, apiErr := utils.ChatPicture(ctx, logger, cfg, store, chat)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	variants, apiErr := utils.ChatPictureVariants(ctx, logger, cfg, store, chat)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	// the status of the last confirmed picture, a previous picture is still served while a new one is scanned
+	var scan *database.ScanStatus
+	if chat.PictureKey != nil || chat.PictureScan != database.ScanClean {
+		scan = &chat.PictureScan
+	}
+
+	return &CreateChatResponse{
+		Id:                   chat.Id,
+		CreatedAt:            chat.CreatedAt.String(),
+		UpdateAt:             chat.UpdatedAt.String(),
+		Name:                 chat.Name,
+		Picture:              picture,
+		PictureVariants:      variants,
+		PictureScan:          scan,
+		Description:          chat.Description,
+		MessageRetentionDays: chat.MessageRetentionDays,
+	}, nil
+}
+
+func GetChatPreviews(ctx context.Context, repos *repository.Repositories, cfg *common.Config, store storage.ObjectStore, jwtPayload *auth.JWTAccessTokenPayload, logger *common.Logger) ([]GetChatPreviewResponse, *api.ApiError) {
+	logger.PrintfInfo("Attempting to get chat previews for user: %s", jwtPayload.UserId)
+	chatPreviews := []GetChatPreviewResponse{}
+
+	chatUserKeys, err := repos.Chats.ListMembershipsOfUser(ctx, jwtPayload.UserId)
+	if err != nil {
+		logger.PrintfError("Error getting chats for user: %s", err)
+		return nil, &api.ApiError{
+			Code:  http.StatusInternalServerError,
+			Error: enum.ApiError,
+		}
+	}
+
+	for _, chatUserKey := range chatUserKeys {
+		chat, err := repos.Chats.GetById(ctx, chatUserKey.ChatId)
+		if err != nil {
+			logger.PrintfError("Error getting chat with id: %s. %s", chatUserKey.ChatId, err)
 			return nil, &api.ApiError{
 				Code:  http.StatusInternalServerError,
 				Error: enum.ApiError,
 			}
 		}
-		users = append(users, user)
-		userKeys = append(userKeys, userKey)
+
+		var lastMessage *string
+		message, err := repos.Messages.GetLatest(ctx, chatUserKey.ChatId)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			logger.PrintfError("Error getting last message for chat with id: %s. Error: %s", chatUserKey.ChatId, err.Error())
+			return nil, &api.ApiError{
+				Code:  http.StatusInternalServerError,
+				Error: enum.ApiError,
+			}
+		}
+		if message != nil {
+			lastMessage = &message.Content
+		}
+
+		response, apiErr := toChatResponse(ctx, logger, cfg, store, chat)
+		if apiErr != nil {
+			return nil, apiErr
+		}
+
+		chatPreview := GetChatPreviewResponse{
+			CreateChatResponse: *response,
+			ChatMuteResponse:   toChatMuteResponse(&chatUserKey, time.Now()),
+			LastMessage:        lastMessage,
+		}
+
+		chatPreviews = append(chatPreviews, chatPreview)
 	}
 
-	if len(users) != len(payload.UserKeys) {
-		tx.Rollback()
-		logger.PrintfError("User keys and users length mismatch")
+	logger.Printf("Successfully got chat previews for user: %s", jwtPayload.UserId)
+
+	return chatPreviews, nil
+}
+
+func GetChatById(ctx context.Context, repos *repository.Repositories, cfg *common.Config, store storage.ObjectStore, chatId string, jwtPayload *auth.JWTAccessTokenPayload, logger *common.Logger) (*GetChatByIdResponse, *api.ApiError) {
+	chat, err := repos.Chats.GetById(ctx, chatId)
+	if err != nil {
+		logger.PrintfError("Error getting chat with id: %s. Error: %s", chatId, err)
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, &api.ApiError{
+				Code:  http.StatusNotFound,
+				Error: enum.NotFound,
+			}
+		}
 		return nil, &api.ApiError{
-			Code:  http.StatusNotFound,
-			Error: enum.UserNotFound,
+			Code:  http.StatusInternalServerError,
+			Error: enum.ApiError,
+		}
+	}
+
+	chatUserKey, err := repos.Chats.GetMember(ctx, chatId, jwtPayload.UserId)
+	if err != nil {
+		logger.PrintfWarning("User: %s is not a member of chat with id: %s. Error: %s", jwtPayload.UserId, chatId, err)
+		return nil, &api.ApiError{
+			Code:  http.StatusForbidden,
+			Error: enum.NotAllowed,
 		}
 	}
 
-	if len(users) != len(userKeys) {
-		tx.Rollback()
-		logger.PrintfError("User keys and users length mismatch")
+	messages, err := repos.Messages.ListByChat(ctx, chatId, 50)
+	if err != nil {
+		logger.PrintfError("Error getting messages for chat with id: %s. Error: %s", chatId, err)
 		return nil, &api.ApiError{
 			Code:  http.StatusInternalServerError,
 			Error: enum.ApiError,
 		}
 	}
 
-	chat := &database.Chat{
-		Name:        payload.Name,
-		Picture:     payload.Picture,
-		Description: payload.Description,
-		Messages:    nil,
+	// Mappings
+	user, err := repos.Users.GetById(ctx, chatUserKey.UserId)
+	if err != nil {
+		logger.PrintfError("Error getting user with id: %s. Error: %s", chatUserKey.UserId, err)
+		return nil, &api.ApiError{
+			Code:  http.StatusInternalServerError,
+			Error: enum.ApiError,
+		}
+	}
+
+	variants, apiErr := utils.ProfilePictureVariants(ctx, logger, cfg, store, user)
+	if apiErr != nil {
+		return nil, apiErr
 	}
 
-	if err := tx.Create(chat).Error; err != nil {
-		tx.Rollback()
-		logger.PrintfError("Error creating chat: %s", err)
+	usersEntries := []UserEntry{
+		{
+			Id:                     user.Id,
+			Name:                   user.Name,
+			Bio:                    user.Bio,
+			ProfilePictureVariants: variants,
+		},
+	}
+
+	// TODO: Just make one object for user keys not array
+	userKeyEntries := []UserKeyEntry{
+		{
+			UserID: chatUserKey.UserId,
+			Key:    chatUserKey.Key,
+		},
+	}
+
+	messageIds := make([]string, 0, len(messages))
+	for _, message := range messages {
+		messageIds = append(messageIds, message.Id)
+	}
+	attachments, err := repos.Attachments.ListByMessages(ctx, messageIds)
+	if err != nil {
+		logger.PrintfError("Error getting attachments for chat with id: %s. Error: %s", chatId, err)
 		return nil, &api.ApiError{
 			Code:  http.StatusInternalServerError,
 			Error: enum.ApiError,
 		}
 	}
+	attachmentsByMessage := make(map[string][]AttachmentEntry)
+	for _, attachment := range attachments {
+		attachmentsByMessage[*attachment.MessageId] = append(attachmentsByMessage[*attachment.MessageId], toAttachmentEntry(&attachment))
+	}
 
-	for i, user := range users {
-		chatUserKeys := &database.ChatUserKeys{
-			ChatId: chat.Id,
-			UserId: user.Id,
-			Key:    userKeys[i].Key,
+	messageEntries := []MessageEntry{}
+	for _, message := range messages {
+		entries := attachmentsByMessage[message.Id]
+		if entries == nil {
+			entries = []AttachmentEntry{}
 		}
+		messageEntries = append(messageEntries,
+			MessageEntry{
+				Id:          message.Id,
+				CreatedAt:   message.CreatedAt.String(),
+				UpdatedAt:   message.UpdatedAt.String(),
+				Content:     message.Content,
+				Iv:          message.Iv,
+				SenderId:    message.SenderId,
+				Attachments: entries,
+			},
+		)
+	}
 
-		if err := tx.Create(chatUserKeys).Error; err != nil {
-			tx.Rollback()
-			logger.PrintfError("Error creating chat user key: %s", err)
-			return nil, &api.ApiError{
-				Code:  http.StatusInternalServerError,
-				Error: enum.ApiError,
+	response, apiErr := toChatResponse(ctx, logger, cfg, store, chat)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	logger.Printf("Successfully got chat with id: %s", chatId)
+
+	return &GetChatByIdResponse{
+		CreateChatResponse: *response,
+		ChatMuteResponse:   toChatMuteResponse(chatUserKey, time.Now()),
+		Users:              usersEntries,
+		UserKeys:           userKeyEntries,
+		Messages:           messageEntries,
+	}, nil
+
+}
+
+// getMembership returns the chat and the membership of the user, NOT_FOUND for unknown chats and NOT_ALLOWED if the user is not a member
+func getMembership(ctx context.Context, repos *repository.Repositories, chatId string, userId string, logger *common.Logger) (*database.Chat, *database.ChatUserKeys, *api.ApiError) {
+	chat, err := repos.Chats.GetById(ctx, chatId)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, nil, &api.ApiError{
+				Code:  http.StatusNotFound,
+				Error: enum.NotFound,
 			}
 		}
+		logger.PrintfError("Error getting chat with id: %s. Error: %s", chatId, err)
+		return nil, nil, &api.ApiError{
+			Code:  http.StatusInternalServerError,
+			Error: enum.ApiError,
+		}
 	}
 
-	if err := tx.Commit().Error; err != nil {
-		logger.PrintfError("Error committing transaction: %s", err)
+	member, err := repos.Chats.GetMember(ctx, chatId, userId)
+	if err != nil {
+		logger.PrintfWarning("User: %s is not a member of chat with id: %s. Error: %s", userId, chatId, err)
+		return nil, nil, &api.ApiError{
+			Code:  http.StatusForbidden,
+			Error: enum.NotAllowed,
+		}
+	}
+
+	return chat, member, nil
+}
+
+// requireMember returns NOT_FOUND for unknown chats and NOT_ALLOWED if the user is not a member
+func requireMember(ctx context.Context, repos *repository.Repositories, chatId string, userId string, logger *common.Logger) *api.ApiError {
+	_, _, apiErr := getMembership(ctx, repos, chatId, userId, logger)
+	return apiErr
+}
+
+// requireAdmin is like requireMember but also returns NOT_ALLOWED for members that are no admin of the chat
+func requireAdmin(ctx context.Context, repos *repository.Repositories, chatId string, userId string, logger *common.Logger) (*database.Chat, *api.ApiError) {
+	chat, member, apiErr := getMembership(ctx, repos, chatId, userId, logger)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	if member.Role != database.ChatRoleAdmin {
+		logger.PrintfWarning("User: %s is no admin of chat with id: %s", userId, chatId)
 		return nil, &api.ApiError{
-			Code:  http.StatusInternalServerError,
-			Error: enum.ApiError,
+			Code:    http.StatusForbidden,
+			Error:   enum.NotAllowed,
+			Details: "only admins of the chat may change it",
 		}
 	}
 
-	logger.Printf("Successfully created chat with id: %s", chat.Id)
+	return chat, nil
+}
 
-	return &CreateChatResponse{
-		Id:          chat.Id,
-		CreatedAt:   chat.CreatedAt.String(),
-		UpdateAt:    chat.UpdatedAt.String(),
-		Name:        chat.Name,
-		Picture:     chat.Picture,
-		Description: chat.Description,
-	}, nil
+func toAttachmentEntry(attachment *database.Attachment) AttachmentEntry {
+	return AttachmentEntry{
+		Id:         attachment.Id,
+		Size:       attachment.Size,
+		MimeType:   attachment.MimeType,
+		Checksum:   attachment.Checksum,
+		ScanStatus: attachment.ScanStatus,
+	}
 }
 
-func GetChatPreviews(db *gorm.DB, jwtPayload *auth.JWTAccessTokenPayload, logger *common.Logger) ([]GetChatPreviewResponse, *api.ApiError) {
-	logger.PrintfInfo("Attempting to get chat previews for user: %s", jwtPayload.UserId)
-	var chatUserKeys []database.ChatUserKeys
-	chatPreviews := []GetChatPreviewResponse{}
+// attachmentObjectKey is random so the key reveals nothing about the attachment or its uploader
+func attachmentObjectKey(chatId string) string {
+	return fmt.Sprintf("chats/%s/%s", chatId, uuid.NewString())
+}
 
-	if err := db.Where("user_id = ?", jwtPayload.UserId).Find(&chatUserKeys).Error; err != nil {
-		logger.PrintfError("Error getting chats for user: %s", err)
+// CreateAttachment records the attachment and returns a presigned upload that only accepts the described file
+func CreateAttachment(ctx context.Context, repos *repository.Repositories, cfg *common.Config, store storage.ObjectStore, chatId string, payload *CreateAttachmentRequest, jwtPayload *auth.JWTAccessTokenPayload, logger *common.Logger) (*CreateAttachmentResponse, *api.ApiError) {
+	if err := requireMember(ctx, repos, chatId, jwtPayload.UserId, logger); err != nil {
+		return nil, err
+	}
+
+	if payload.Size > int64(cfg.AttachmentMaxSize) {
+		logger.PrintfWarning("User: %s requested an attachment of %d bytes in chat: %s", jwtPayload.UserId, payload.Size, chatId)
+		return nil, &api.ApiError{
+			Code:    http.StatusRequestEntityTooLarge,
+			Error:   enum.FileTooLarge,
+			Details: fmt.Sprintf("attachments may be at most %d bytes", cfg.AttachmentMaxSize),
+		}
+	}
+
+	attachment := &database.Attachment{
+		ChatId:     chatId,
+		UploaderId: &jwtPayload.UserId,
+		ObjectKey:  attachmentObjectKey(chatId),
+		Size:       payload.Size,
+		MimeType:   payload.MimeType,
+		Checksum:   payload.Checksum,
+	}
+
+	expiresAt := time.Now().Add(cfg.AttachmentUploadExpiration)
+	upload, apiErr := storage.GenerateConstrainedUploadURL(ctx, logger, store, cfg.AttachmentBucketName, attachment.ObjectKey, storage.UploadConstraints{
+		ContentType:    attachment.MimeType,
+		ContentLength:  attachment.Size,
+		ChecksumSHA256: attachment.Checksum,
+	}, int(cfg.AttachmentUploadExpiration.Seconds()))
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	if err := repos.Attachments.Create(ctx, attachment); err != nil {
+		logger.PrintfError("Error creating attachment in chat: %s. Error: %s", chatId, err)
 		return nil, &api.ApiError{
 			Code:  http.StatusInternalServerError,
 			Error: enum.ApiError,
 		}
 	}
 
-	for _, chatUserKey := range chatUserKeys {
-		var chat database.Chat
-		if err := db.Where("id = ?", chatUserKey.ChatId).First(&chat).Error; err != nil {
-			logger.PrintfError("Error getting chat with id: %s. %s", chatUserKey.ChatId, err)
+	logger.Printf("Successfully created attachment: %s in chat: %s", attachment.Id, chatId)
+
+	return &CreateAttachmentResponse{
+		Id:            attachment.Id,
+		UploadURL:     upload.URL,
+		UploadHeaders: upload.Headers,
+		ExpiresAt:     expiresAt,
+	}, nil
+}
+
+// SendMessage stores the encrypted message and links the attachments, they have to be uploaded by the sender beforehand
+func SendMessage(ctx context.Context, repos *repository.Repositories, scans *scanning.Runner, cfg *common.Config, store storage.ObjectStore, chatId string, payload *SendMessageRequest, jwtPayload *auth.JWTAccessTokenPayload, logger *common.Logger) (*MessageEntry, *api.ApiError) {
+	if err := requireMember(ctx, repos, chatId, jwtPayload.UserId, logger); err != nil {
+		return nil, err
+	}
+
+	attachments := make([]database.Attachment, 0, len(payload.AttachmentIds))
+	for _, attachmentId := range payload.AttachmentIds {
+		attachment, err := repos.Attachments.GetById(ctx, chatId, attachmentId)
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, &api.ApiError{
+				Code:    http.StatusNotFound,
+				Error:   enum.NotFound,
+				Details: fmt.Sprintf("attachment %s does not exist", attachmentId),
+			}
+		}
+		if err != nil {
+			logger.PrintfError("Error getting attachment: %s. Error: %s", attachmentId, err)
 			return nil, &api.ApiError{
 				Code:  http.StatusInternalServerError,
 				Error: enum.ApiError,
 			}
 		}
+		if attachment.UploaderId == nil || *attachment.UploaderId != jwtPayload.UserId {
+			logger.PrintfWarning("User: %s tried to send attachment: %s of another user", jwtPayload.UserId, attachmentId)
+			return nil, &api.ApiError{
+				Code:  http.StatusForbidden,
+				Error: enum.NotAllowed,
+			}
+		}
+		if attachment.MessageId != nil {
+			return nil, &api.ApiError{
+				Code:    http.StatusConflict,
+				Error:   enum.AlreadyExists,
+				Details: fmt.Sprintf("attachment %s was already sent", attachmentId),
+			}
+		}
 
-		var lastMessage *database.Message = nil
-		if err := db.Where("chat_id = ?", chatUserKey.ChatId).Order("created_at desc").First(&lastMessage).Error; err != nil {
-			if err != gorm.ErrRecordNotFound {
-				// If there's another error, log it and return
-				logger.PrintfError("Error getting last message for chat with id: %s. Error: %s", chatUserKey.ChatId, err.Error())
+		if _, apiErr := storage.ConfirmUpload(ctx, logger, store, cfg.AttachmentBucketName, attachment.ObjectKey, storage.UploadPolicy{
+			ContentTypes: []string{attachment.MimeType},
+			MaxSize:      attachment.Size,
+		}); apiErr != nil {
+			if apiErr.Error == enum.NotFound {
 				return nil, &api.ApiError{
-					Code:  http.StatusInternalServerError,
-					Error: enum.ApiError,
+					Code:    http.StatusBadRequest,
+					Error:   enum.MalformedRequest,
+					Details: fmt.Sprintf("attachment %s was not uploaded", attachmentId),
 				}
 			}
+			return nil, apiErr
+		}
 
-			chatPreview := GetChatPreviewResponse{
-				CreateChatResponse: CreateChatResponse{
-					Id:          chat.Id,
-					CreatedAt:   chat.CreatedAt.String(),
-					UpdateAt:    chat.UpdatedAt.String(),
-					Name:        chat.Name,
-					Picture:     chat.Picture,
-					Description: chat.Description,
-				},
-				LastMessage: &lastMessage.Content,
-			}
+		attachments = append(attachments, *attachment)
+	}
 
-			chatPreviews = append(chatPreviews, chatPreview)
+	message := &database.Message{
+		ChatId:   chatId,
+		SenderId: &jwtPayload.UserId,
+		Content:  payload.Content,
+		Iv:       payload.Iv,
+	}
+	err := repos.Transaction(ctx, func(tx *repository.Repositories) error {
+		if err := tx.Messages.Create(ctx, message); err != nil {
+			return err
+		}
+		if cfg.PushEnabled() {
+			if _, err := notify.NewMessage.Enqueue(ctx, tx, notify.NewMessagePayload{ChatId: chatId, SenderId: jwtPayload.UserId}); err != nil {
+				return err
+			}
+		}
+		if len(payload.AttachmentIds) == 0 {
+			return nil
+		}
+		if err := tx.Attachments.AttachToMessage(ctx, payload.AttachmentIds, message.Id); err != nil {
+			return err
+		}
+		if err := tx.Attachments.SetScanStatus(ctx, payload.AttachmentIds, scans.InitialStatus()); err != nil {
+			return err
+		}
+		for _, attachmentId := range payload.AttachmentIds {
+			if err := scans.Enqueue(ctx, tx, scanning.ScanPayload{Upload: scanning.UploadAttachment, Id: attachmentId, ChatId: chatId}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		// another message took one of the attachments in the meantime
+		return nil, &api.ApiError{
+			Code:  http.StatusConflict,
+			Error: enum.AlreadyExists,
+		}
+	}
+	if err != nil {
+		logger.PrintfError("Error sending message in chat: %s. Error: %s", chatId, err)
+		return nil, &api.ApiError{
+			Code:  http.StatusInternalServerError,
+			Error: enum.ApiError,
 		}
 	}
 
-	logger.Printf("Successfully got chat previews for user: %s", jwtPayload.UserId)
+	entries := make([]AttachmentEntry, 0, len(attachments))
+	for _, attachment := range attachments {
+		attachment.ScanStatus = scans.InitialStatus()
+		entries = append(entries, toAttachmentEntry(&attachment))
+	}
 
-	return chatPreviews, nil
+	logger.Printf("Successfully sent message: %s in chat: %s", message.Id, chatId)
+
+	return &MessageEntry{
+		Id:          message.Id,
+		CreatedAt:   message.CreatedAt.String(),
+		UpdatedAt:   message.UpdatedAt.String(),
+		Content:     message.Content,
+		Iv:          message.Iv,
+		SenderId:    message.SenderId,
+		Attachments: entries,
+	}, nil
 }
 
-func GetChatById(db *gorm.DB, chatId string, jwtPayload *auth.JWTAccessTokenPayload, logger *common.Logger) (*GetChatByIdResponse, *api.ApiError) {
-	var chat database.Chat
-	if err := db.Where("id = ?", chatId).First(&chat).Error; err != nil {
-		logger.PrintfError("Error getting chat with id: %s. Error: %s", chatId, err)
+// toChatMuteResponse reports a mute that ran out as not muted
+func toChatMuteResponse(member *database.ChatUserKeys, now time.Time) ChatMuteResponse {
+	if !member.IsMuted(now) {
+		return ChatMuteResponse{}
+	}
+	return ChatMuteResponse{Muted: true, MuteUntil: member.MuteUntil}
+}
+
+// MuteChat stops push notifications about the chat for the member until the time or until the chat is unmuted
+func MuteChat(ctx context.Context, repos *repository.Repositories, chatId string, payload *MuteChatRequest, jwtPayload *auth.JWTAccessTokenPayload, logger *common.Logger) (*ChatMuteResponse, *api.ApiError) {
+	now := time.Now()
+	if payload.Until != nil && !payload.Until.After(now) {
+		return nil, &api.ApiError{
+			Code:    http.StatusBadRequest,
+			Error:   enum.MalformedRequest,
+			Details: "until has to be in the future",
+		}
+	}
+
+	_, member, apiErr := getMembership(ctx, repos, chatId, jwtPayload.UserId, logger)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	member.Muted = true
+	member.MuteUntil = payload.Until
+	if err := repos.Chats.SetMute(ctx, member.Id, member.Muted, member.MuteUntil); err != nil {
+		logger.PrintfError("Error muting chat: %s for user: %s. Error: %s", chatId, jwtPayload.UserId, err)
 		return nil, &api.ApiError{
 			Code:  http.StatusInternalServerError,
 			Error: enum.ApiError,
 		}
 	}
 
-	var chatUserKeys []database.ChatUserKeys
-	if err := db.Where("chat_id = ? AND user_id = ?", chatId, jwtPayload.UserId).Find(&chatUserKeys).Error; err != nil {
-		logger.PrintfError("Error getting chat user key for chat with id: %s. Error: %s", chatId, err)
+	logger.Printf("Successfully muted chat: %s for user: %s", chatId, jwtPayload.UserId)
+
+	response := toChatMuteResponse(member, now)
+	return &response, nil
+}
+
+// UnmuteChat lets push notifications about the chat reach the member again
+func UnmuteChat(ctx context.Context, repos *repository.Repositories, chatId string, jwtPayload *auth.JWTAccessTokenPayload, logger *common.Logger) (*ChatMuteResponse, *api.ApiError) {
+	_, member, apiErr := getMembership(ctx, repos, chatId, jwtPayload.UserId, logger)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	member.Muted = false
+	member.MuteUntil = nil
+	if err := repos.Chats.SetMute(ctx, member.Id, member.Muted, member.MuteUntil); err != nil {
+		logger.PrintfError("Error unmuting chat: %s for user: %s. Error: %s", chatId, jwtPayload.UserId, err)
 		return nil, &api.ApiError{
 			Code:  http.StatusInternalServerError,
 			Error: enum.ApiError,
 		}
 	}
 
-	var Messages []database.Message
-	if err := db.Where("chat_id = ?", chatId).Order("created_at desc").Find(&Messages).Limit(50).Error; err != nil {
-		logger.PrintfError("Error getting messages for chat with id: %s. Error: %s", chatId, err)
+	logger.Printf("Successfully unmuted chat: %s for user: %s", chatId, jwtPayload.UserId)
+
+	return &ChatMuteResponse{}, nil
+}
+
+// GetAttachment hands out a short lived download url, attachments that were not sent yet are only visible to their uploader.
+// Attachments are only scanned once they are sent, until they were found clean there is no url.
+func GetAttachment(ctx context.Context, repos *repository.Repositories, cfg *common.Config, store storage.ObjectStore, chatId string, attachmentId string, jwtPayload *auth.JWTAccessTokenPayload, logger *common.Logger) (*GetAttachmentResponse, *api.ApiError) {
+	if err := requireMember(ctx, repos, chatId, jwtPayload.UserId, logger); err != nil {
+		return nil, err
+	}
+
+	attachment, err := repos.Attachments.GetById(ctx, chatId, attachmentId)
+	if err == nil && attachment.MessageId == nil && (attachment.UploaderId == nil || *attachment.UploaderId != jwtPayload.UserId) {
+		err = repository.ErrNotFound
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, &api.ApiError{
+			Code:  http.StatusNotFound,
+			Error: enum.NotFound,
+		}
+	}
+	if err != nil {
+		logger.PrintfError("Error getting attachment: %s. Error: %s", attachmentId, err)
 		return nil, &api.ApiError{
 			Code:  http.StatusInternalServerError,
 			Error: enum.ApiError,
 		}
 	}
 
-	// Mappings
-	usersEntries := []UserEntry{}
-	for _, chatUserKey := range chatUserKeys {
-		var user database.User
-		if err := db.Where("id = ?", chatUserKey.UserId).First(&user).Error; err != nil {
-			logger.PrintfError("Error getting user with id: %s. Error: %s", chatUserKey.UserId, err)
+	if apiErr := scanning.RequireClean(attachment.ScanStatus); apiErr != nil {
+		logger.PrintfWarning("Attachment: %s is %s", attachmentId, attachment.ScanStatus)
+		return nil, apiErr
+	}
+
+	expiresAt := time.Now().Add(cfg.AttachmentDownloadExpiration)
+	downloadURL, apiErr := storage.GenerateDownloadURL(ctx, logger, store, cfg.AttachmentBucketName, attachment.ObjectKey, int(cfg.AttachmentDownloadExpiration.Seconds()))
+	if apiErr != nil {
+		if apiErr.Error == enum.NotFound {
 			return nil, &api.ApiError{
-				Code:  http.StatusInternalServerError,
-				Error: enum.ApiError,
+				Code:  http.StatusNotFound,
+				Error: enum.NotFound,
 			}
 		}
+		return nil, apiErr
+	}
 
-		usersEntries = append(usersEntries,
-			UserEntry{
-				Id:   user.Id,
-				Name: user.Name,
-				Bio:  user.Bio,
-			},
-		)
+	logger.Printf("Successfully generated download url for attachment: %s", attachmentId)
+
+	return &GetAttachmentResponse{
+		AttachmentEntry: toAttachmentEntry(attachment),
+		DownloadURL:     *downloadURL,
+		ExpiresAt:       expiresAt,
+	}, nil
+}
+
+func GenerateUploadChatPictureURL(ctx context.Context, repos *repository.Repositories, cfg *common.Config, store storage.ObjectStore, chatId string, payload *UploadChatPictureRequest, jwtPayload *auth.JWTAccessTokenPayload, logger *common.Logger) (*UploadChatPictureResponse, *api.ApiError) {
+	if _, apiErr := requireAdmin(ctx, repos, chatId, jwtPayload.UserId, logger); apiErr != nil {
+		return nil, apiErr
 	}
 
-	// TODO: Just make one object for user keys not array
-	userKeyEntries := []UserKeyEntry{}
-	for _, chatUserKey := range chatUserKeys {
-		userKeyEntries = append(userKeyEntries,
-			UserKeyEntry{
-				UserID: chatUserKey.UserId,
-				Key:    chatUserKey.Key,
-			},
-		)
+	if apiErr := utils.PicturePolicy(cfg).Check(payload.MimeType, payload.Size); apiErr != nil {
+		logger.PrintfWarning("User: %s requested a picture upload of %d bytes of type %s in chat: %s", jwtPayload.UserId, payload.Size, payload.MimeType, chatId)
+		return nil, apiErr
 	}
 
-	messageEntries := []MessageEntry{}
-	for _, message := range Messages {
-		messageEntries = append(messageEntries,
-			MessageEntry{
-				Id:        message.Id,
-				CreatedAt: message.CreatedAt.String(),
-				UpdatedAt: message.UpdatedAt.String(),
-				Content:   message.Content,
-				Iv:        message.Iv,
-				SenderId:  message.SenderId,
-			},
-		)
+	uploadKey := utils.PictureUploadKey()
+	expiresAt := time.Now().Add(cfg.ProfilePictureUploadExpiration)
+	upload, apiErr := storage.GenerateConstrainedUploadURL(ctx, logger, store, cfg.ChatPictureBucket(), uploadKey, storage.UploadConstraints{
+		ContentType:   payload.MimeType,
+		ContentLength: payload.Size,
+	}, int(cfg.ProfilePictureUploadExpiration.Seconds()))
+	if apiErr != nil {
+		return nil, apiErr
 	}
 
-	logger.Printf("Successfully got chat with id: %s", chatId)
+	if err := repos.Chats.SetPictureUpload(ctx, chatId, uploadKey); err != nil {
+		logger.PrintfError("Error saving chat with id: %s. Error: %s", chatId, err)
+		return nil, &api.ApiError{
+			Code:  http.StatusInternalServerError,
+			Error: enum.ApiError,
+		}
+	}
 
-	return &GetChatByIdResponse{
-		CreateChatResponse: CreateChatResponse{
-			Id:          chat.Id,
-			CreatedAt:   chat.CreatedAt.String(),
-			UpdateAt:    chat.UpdatedAt.String(),
-			Name:        chat.Name,
-			Picture:     chat.Picture,
-			Description: chat.Description,
-		},
-		Users:    usersEntries,
-		UserKeys: userKeyEntries,
-		Messages: messageEntries,
+	logger.Printf("Successfully generated picture upload URL for chat: %s", chatId)
+
+	return &UploadChatPictureResponse{
+		UploadURL:     upload.URL,
+		UploadHeaders: upload.Headers,
+		ExpiresAt:     expiresAt,
 	}, nil
+}
+
+// ConfirmChatPicture validates, stores and scans the uploaded picture like ConfirmProfilePicture, it replaces the picture of the chat once it was found clean
+func ConfirmChatPicture(ctx context.Context, repos *repository.Repositories, scans *scanning.Runner, cfg *common.Config, store storage.ObjectStore, chatId string, jwtPayload *auth.JWTAccessTokenPayload, logger *common.Logger) (*CreateChatResponse, *api.ApiError) {
+	chat, apiErr := requireAdmin(ctx, repos, chatId, jwtPayload.UserId, logger)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	notUploaded := &api.ApiError{
+		Code:    http.StatusNotFound,
+		Error:   enum.NotFound,
+		Details: "no chat picture was uploaded",
+	}
+	if chat.PictureUpload == nil {
+		return nil, notUploaded
+	}
+
+	key, apiErr := utils.ProcessPicture(ctx, logger, cfg, store, cfg.ChatPictureBucket(), *chat.PictureUpload, cfg.ChatPictureKey(chat.Id))
+	if apiErr != nil {
+		if apiErr.Error == enum.NotFound {
+			return nil, notUploaded
+		}
+		return nil, apiErr
+	}
+
+	now := time.Now()
+	published := scans.InitialStatus() == database.ScanClean
+	err := repos.Transaction(ctx, func(tx *repository.Repositories) error {
+		if err := tx.Chats.SetPendingPicture(ctx, chat.Id, *chat.PictureUpload, key); err != nil {
+			return err
+		}
+		if published {
+			return tx.Chats.PublishPicture(ctx, chat.Id, key, now)
+		}
+		return scans.Enqueue(ctx, tx, scanning.ScanPayload{Upload: scanning.UploadChatPicture, Id: chat.Id, Key: key})
+	})
+	if err != nil {
+		utils.DeletePicture(ctx, logger, store, cfg.ChatPictureBucket(), key)
+		if errors.Is(err, repository.ErrNotFound) {
+			// a newer upload was requested or the upload was confirmed twice
+			return nil, notUploaded
+		}
+		logger.PrintfError("Error saving chat with id: %s. Error: %s", chat.Id, err)
+		return nil, &api.ApiError{
+			Code:  http.StatusInternalServerError,
+			Error: enum.ApiError,
+		}
+	}
+
+	// a picture that is still scanned is deleted by its scan job once it sees that it was replaced
+	previous := chat.PictureKey
+	chat.PictureUpload = nil
+	if published {
+		chat.PictureKey = &key
+		chat.PictureVersion = &now
+		chat.PictureScan = database.ScanClean
+		if previous != nil {
+			utils.DeletePicture(ctx, logger, store, cfg.ChatPictureBucket(), *previous)
+		}
+	} else {
+		chat.PicturePending = &key
+		chat.PictureScan = database.ScanPending
+	}
+
+	logger.Printf("Successfully processed picture of chat: %s", chat.Id)
+
+	return toChatResponse(ctx, logger, cfg, store, chat)
+}
+
+func GenerateGetChatPictureURL(ctx context.Context, repos *repository.Repositories, cfg *common.Config, store storage.ObjectStore, chatId string, jwtPayload *auth.JWTAccessTokenPayload, logger *common.Logger) (*string, *api.ApiError) {
+	chat, _, apiErr := getMembership(ctx, repos, chatId, jwtPayload.UserId, logger)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	// only pictures that were scanned clean are published, without one the status of the last confirmed picture explains why
+	if chat.PictureKey == nil {
+		if apiErr := scanning.RequireClean(chat.PictureScan); apiErr != nil {
+			logger.PrintfWarning("Picture of chat: %s is %s", chat.Id, chat.PictureScan)
+			return nil, apiErr
+		}
+	}
+
+	imageURL, apiErr := utils.ChatPicture(ctx, logger, cfg, store, chat)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	if imageURL == nil {
+		logger.PrintfWarning("Chat: %s has no picture", chat.Id)
+		return nil, &api.ApiError{
+			Code:  http.StatusNoContent,
+			Error: enum.NotFound,
+		}
+	}
 
+	return imageURL, nil
 }
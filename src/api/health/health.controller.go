@@ -0,0 +1,30 @@
+package health
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterHealthEndpoints(r gin.IRouter, checker *Checker) {
+	r.GET("/healthz", LivenessController)
+	r.GET("/readyz", ReadinessController(checker))
+}
+
+func LivenessController(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status": "alive",
+	})
+}
+
+func ReadinessController(checker *Checker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		readiness := checker.Readiness(c.Request.Context())
+		if !readiness.Ready {
+			c.JSON(http.StatusServiceUnavailable, readiness)
+			return
+		}
+
+		c.JSON(http.StatusOK, readiness)
+	}
+}
@@ -0,0 +1,29 @@
+package health
+
+type State string
+
+const (
+	Starting State = "starting"
+	Ready    State = "ready"
+	Draining State = "draining"
+)
+
+type CheckStatus string
+
+const (
+	Up      CheckStatus = "up"
+	Down    CheckStatus = "down"
+	Pending CheckStatus = "pending"
+)
+
+type DependencyStatus struct {
+	Status  CheckStatus `json:"status"`
+	Latency string      `json:"latency,omitempty"`
+	Error   string      `json:"error,omitempty"`
+}
+
+type ReadinessResponse struct {
+	Ready        bool                        `json:"ready"`
+	State        State                       `json:"state"`
+	Dependencies map[string]DependencyStatus `json:"dependencies"`
+}
@@ -0,0 +1,85 @@
+package health
+
+import (
+	"context"
+	"easyflow-backend/src/common"
+	"easyflow-backend/src/database"
+	"easyflow-backend/src/storage"
+	"sync/atomic"
+	"time"
+)
+
+const checkTimeout = 2 * time.Second
+
+// Checker tracks the lifecycle state of the process and probes its dependencies.
+type Checker struct {
+	cfg   *common.Config
+	store storage.ObjectStore
+	state atomic.Value
+	db    atomic.Pointer[database.DatabaseInst]
+}
+
+func NewChecker(cfg *common.Config, store storage.ObjectStore) *Checker {
+	checker := &Checker{cfg: cfg, store: store}
+	checker.state.Store(Starting)
+	return checker
+}
+
+func (h *Checker) SetDatabase(db *database.DatabaseInst) {
+	h.db.Store(db)
+}
+
+func (h *Checker) MarkReady() {
+	h.state.Store(Ready)
+}
+
+func (h *Checker) MarkDraining() {
+	h.state.Store(Draining)
+}
+
+func (h *Checker) State() State {
+	return h.state.Load().(State)
+}
+
+func probe(ctx context.Context, check func(context.Context) error) DependencyStatus {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	start := time.Now()
+	if err := check(ctx); err != nil {
+		return DependencyStatus{Status: Down, Latency: time.Since(start).String(), Error: err.Error()}
+	}
+
+	return DependencyStatus{Status: Up, Latency: time.Since(start).String()}
+}
+
+// Readiness probes every dependency and reports whether the process should receive traffic.
+func (h *Checker) Readiness(ctx context.Context) ReadinessResponse {
+	state := h.State()
+	dependencies := map[string]DependencyStatus{}
+
+	if db := h.db.Load(); db != nil {
+		dependencies["database"] = probe(ctx, db.Ping)
+	} else {
+		dependencies["database"] = DependencyStatus{Status: Pending}
+	}
+
+	if h.cfg.ReadinessCheckBucket {
+		dependencies["bucket"] = probe(ctx, func(ctx context.Context) error {
+			return h.store.Check(ctx, h.cfg.ProfilePictureBucketName)
+		})
+	}
+
+	ready := state == Ready
+	for _, dependency := range dependencies {
+		if dependency.Status != Up {
+			ready = false
+		}
+	}
+
+	return ReadinessResponse{
+		Ready:        ready,
+		State:        state,
+		Dependencies: dependencies,
+	}
+}
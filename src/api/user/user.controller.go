@@ -3,9 +3,12 @@ package user
 import (
 	"easyflow-backend/src/api"
 	"easyflow-backend/src/api/auth"
+	"easyflow-backend/src/audit"
 	"easyflow-backend/src/common"
 	"easyflow-backend/src/enum"
 	"easyflow-backend/src/middleware"
+	"easyflow-backend/src/scanning"
+	"easyflow-backend/src/storage"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -13,18 +16,26 @@ import (
 
 func RegisterUserEndpoints(r *gin.RouterGroup) {
 	r.Use(middleware.LoggerMiddleware("User"))
-	r.Use(middleware.RateLimiter(1, 4))
-	r.POST("/signup", middleware.RateLimiter(1, 0), CreateUserController)
+	r.Use(middleware.RateLimiter(common.RateLimitUser))
+	r.POST("/signup", middleware.RateLimiter(common.RateLimitSignup), CreateUserController)
 	r.GET("/", auth.AuthGuard(), GetUserController)
 	r.GET("/exists/:email", UserExists)
 	r.GET("/profile-picture", auth.AuthGuard(), GetProfilePictureController)
+	r.POST("/profile-picture", auth.AuthGuard(), ConfirmProfilePictureController)
 	r.GET("/upload-profile-picture", auth.AuthGuard(), GenerateUploadProfilePictureURLController)
 	r.PUT("/", auth.AuthGuard(), UpdateUserController)
 	r.DELETE("/", auth.AuthGuard(), DeleteUserController)
+	r.POST("/export", auth.AuthGuard(), RequestExportController)
+	r.GET("/export/:exportId", auth.AuthGuard(), GetExportController)
+	r.GET("/security-events", auth.AuthGuard(), ListSecurityEventsController)
+	r.GET("/devices", auth.AuthGuard(), ListDevicesController)
+	r.POST("/devices", auth.AuthGuard(), RegisterDeviceController)
+	r.DELETE("/devices/:deviceId", auth.AuthGuard(), DeleteDeviceController)
+	r.GET("/devices/vapid-public-key", auth.AuthGuard(), GetVapidPublicKeyController)
 }
 
 func CreateUserController(c *gin.Context) {
-	payload, logger, db, cfg, errors := common.SetupEndpoint[CreateUserRequest](c)
+	payload, logger, repos, cfg, errors := common.SetupEndpoint[CreateUserRequest](c)
 	if errors != nil {
 		c.JSON(http.StatusInternalServerError, api.ApiError{
 			Code:    http.StatusInternalServerError,
@@ -34,7 +45,7 @@ func CreateUserController(c *gin.Context) {
 		return
 	}
 
-	user, err := CreateUser(db, payload, cfg, logger)
+	user, err := CreateUser(c.Request.Context(), repos, payload, cfg, logger)
 	if err != nil {
 		c.JSON(err.Code, err)
 		return
@@ -43,7 +54,7 @@ func CreateUserController(c *gin.Context) {
 }
 
 func GetUserController(c *gin.Context) {
-	_, logger, db, _, errors := common.SetupEndpoint[any](c)
+	_, logger, repos, cfg, errors := common.SetupEndpoint[any](c)
 	if errors != nil {
 		c.JSON(http.StatusInternalServerError, api.ApiError{
 			Code:    http.StatusInternalServerError,
@@ -62,7 +73,16 @@ func GetUserController(c *gin.Context) {
 		return
 	}
 
-	userFromDb, err := GetUserById(db, user.(*auth.JWTAccessTokenPayload), logger)
+	store, ok := c.Get("objectStore")
+	if !ok {
+		c.JSON(http.StatusInternalServerError, api.ApiError{
+			Code:  http.StatusInternalServerError,
+			Error: enum.ApiError,
+		})
+		return
+	}
+
+	userFromDb, err := GetUserById(c.Request.Context(), repos, cfg, store.(storage.ObjectStore), user.(*auth.JWTAccessTokenPayload), logger)
 
 	if err != nil {
 		c.JSON(err.Code, err)
@@ -72,7 +92,7 @@ func GetUserController(c *gin.Context) {
 }
 
 func GetProfilePictureController(c *gin.Context) {
-	_, logger, db, cfg, errors := common.SetupEndpoint[any](c)
+	_, logger, repos, cfg, errors := common.SetupEndpoint[any](c)
 	if errors != nil {
 		c.JSON(http.StatusInternalServerError, api.ApiError{
 			Code:    http.StatusInternalServerError,
@@ -91,7 +111,16 @@ func GetProfilePictureController(c *gin.Context) {
 		return
 	}
 
-	imageURL, err := GenerateGetProfilePictureURL(db, user.(*auth.JWTAccessTokenPayload), logger, cfg)
+	store, ok := c.Get("objectStore")
+	if !ok {
+		c.JSON(http.StatusInternalServerError, api.ApiError{
+			Code:  http.StatusInternalServerError,
+			Error: enum.ApiError,
+		})
+		return
+	}
+
+	imageURL, err := GenerateGetProfilePictureURL(c.Request.Context(), repos, user.(*auth.JWTAccessTokenPayload), logger, cfg, store.(storage.ObjectStore))
 
 	if err != nil {
 		c.JSON(err.Code, err)
@@ -102,7 +131,7 @@ func GetProfilePictureController(c *gin.Context) {
 }
 
 func UserExists(c *gin.Context) {
-	_, logger, db, _, errors := common.SetupEndpoint[any](c)
+	_, logger, repos, _, errors := common.SetupEndpoint[any](c)
 	if errors != nil {
 		c.JSON(http.StatusInternalServerError, api.ApiError{
 			Code:    http.StatusInternalServerError,
@@ -121,7 +150,7 @@ func UserExists(c *gin.Context) {
 		return
 	}
 
-	userInDb, err := GetUserByEmail(db, email, logger)
+	userInDb, err := GetUserByEmail(c.Request.Context(), repos, email, logger)
 
 	if err != nil {
 		c.JSON(err.Code, err)
@@ -132,7 +161,7 @@ func UserExists(c *gin.Context) {
 }
 
 func UpdateUserController(c *gin.Context) {
-	payload, logger, db, _, errors := common.SetupEndpoint[UpdateUserRequest](c)
+	payload, logger, repos, _, errors := common.SetupEndpoint[UpdateUserRequest](c)
 	if errors != nil {
 		c.JSON(http.StatusInternalServerError, api.ApiError{
 			Code:    http.StatusInternalServerError,
@@ -148,9 +177,10 @@ func UpdateUserController(c *gin.Context) {
 			Code:  http.StatusInternalServerError,
 			Error: enum.ApiError,
 		})
+		return
 	}
 
-	updatedUser, err := UpdateUser(db, user.(*auth.JWTAccessTokenPayload), payload, logger)
+	updatedUser, err := UpdateUser(c.Request.Context(), repos, user.(*auth.JWTAccessTokenPayload), payload, logger)
 
 	if err != nil {
 		c.JSON(err.Code, err)
@@ -161,7 +191,7 @@ func UpdateUserController(c *gin.Context) {
 }
 
 func GenerateUploadProfilePictureURLController(c *gin.Context) {
-	_, logger, db, cfg, errors := common.SetupEndpoint[any](c)
+	_, logger, repos, cfg, errors := common.SetupEndpoint[any](c)
 	if errors != nil {
 		c.JSON(http.StatusInternalServerError, api.ApiError{
 			Code:    http.StatusInternalServerError,
@@ -177,20 +207,95 @@ func GenerateUploadProfilePictureURLController(c *gin.Context) {
 			Code:  http.StatusInternalServerError,
 			Error: enum.ApiError,
 		})
+		return
+	}
+
+	store, ok := c.Get("objectStore")
+	if !ok {
+		c.JSON(http.StatusInternalServerError, api.ApiError{
+			Code:  http.StatusInternalServerError,
+			Error: enum.ApiError,
+		})
+		return
+	}
+
+	var payload UploadProfilePictureRequest
+	if err := c.ShouldBindQuery(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, api.ApiError{
+			Code:    http.StatusBadRequest,
+			Error:   enum.MalformedRequest,
+			Details: err.Error(),
+		})
+		return
+	}
+	if err := api.Validate.Struct(payload); err != nil {
+		c.JSON(http.StatusBadRequest, api.ApiError{
+			Code:    http.StatusBadRequest,
+			Error:   enum.MalformedRequest,
+			Details: err.Error(),
+		})
+		return
 	}
 
-	uploadURL, err := GenerateUploadProfilePictureURL(db, user.(*auth.JWTAccessTokenPayload), logger, cfg)
+	upload, err := GenerateUploadProfilePictureURL(c.Request.Context(), repos, user.(*auth.JWTAccessTokenPayload), &payload, logger, cfg, store.(storage.ObjectStore))
 
 	if err != nil {
 		c.JSON(err.Code, err)
 		return
 	}
 
-	c.JSON(200, uploadURL)
+	c.JSON(200, upload)
+}
+
+func ConfirmProfilePictureController(c *gin.Context) {
+	_, logger, repos, cfg, errors := common.SetupEndpoint[any](c)
+	if errors != nil {
+		c.JSON(http.StatusInternalServerError, api.ApiError{
+			Code:    http.StatusInternalServerError,
+			Error:   enum.ApiError,
+			Details: errors,
+		})
+		return
+	}
+
+	user, ok := c.Get("user")
+	if !ok {
+		c.JSON(http.StatusInternalServerError, api.ApiError{
+			Code:  http.StatusInternalServerError,
+			Error: enum.ApiError,
+		})
+		return
+	}
+
+	store, ok := c.Get("objectStore")
+	if !ok {
+		c.JSON(http.StatusInternalServerError, api.ApiError{
+			Code:  http.StatusInternalServerError,
+			Error: enum.ApiError,
+		})
+		return
+	}
+
+	scans, ok := c.Get("scanRunner")
+	if !ok {
+		c.JSON(http.StatusInternalServerError, api.ApiError{
+			Code:  http.StatusInternalServerError,
+			Error: enum.ApiError,
+		})
+		return
+	}
+
+	updatedUser, err := ConfirmProfilePicture(c.Request.Context(), repos, scans.(*scanning.Runner), user.(*auth.JWTAccessTokenPayload), logger, cfg, store.(storage.ObjectStore))
+	if err != nil {
+		c.JSON(err.Code, err)
+		return
+	}
+
+	c.JSON(200, updatedUser)
 }
 
 func DeleteUserController(c *gin.Context) {
-	_, logger, db, _, errors := common.SetupEndpoint[CreateUserRequest](c)
+	_, logger, repos, _, errors := common.SetupEndpoint[CreateUserRequest](c)
 	if errors != nil {
 		c.JSON(http.StatusInternalServerError, api.ApiError{
 			Code:    http.StatusInternalServerError,
@@ -209,7 +314,16 @@ func DeleteUserController(c *gin.Context) {
 		return
 	}
 
-	err := DeleteUser(db, user.(*auth.JWTAccessTokenPayload), logger)
+	recorder, ok := c.Get("auditRecorder")
+	if !ok {
+		c.JSON(http.StatusInternalServerError, api.ApiError{
+			Code:  http.StatusInternalServerError,
+			Error: enum.ApiError,
+		})
+		return
+	}
+
+	err := DeleteUser(c.Request.Context(), repos, recorder.(*audit.Recorder), user.(*auth.JWTAccessTokenPayload), logger)
 
 	if err != nil {
 		c.JSON(err.Code, err)
@@ -218,3 +332,230 @@ func DeleteUserController(c *gin.Context) {
 
 	c.JSON(200, gin.H{})
 }
+
+func RequestExportController(c *gin.Context) {
+	_, logger, repos, cfg, errors := common.SetupEndpoint[any](c)
+	if errors != nil {
+		c.JSON(http.StatusInternalServerError, api.ApiError{
+			Code:    http.StatusInternalServerError,
+			Error:   enum.ApiError,
+			Details: errors,
+		})
+		return
+	}
+
+	user, ok := c.Get("user")
+	if !ok {
+		c.JSON(http.StatusInternalServerError, api.ApiError{
+			Code:  http.StatusInternalServerError,
+			Error: enum.ApiError,
+		})
+		return
+	}
+
+	dataExport, err := RequestExport(c.Request.Context(), repos, user.(*auth.JWTAccessTokenPayload), logger, cfg)
+	if err != nil {
+		c.JSON(err.Code, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, dataExport)
+}
+
+func GetExportController(c *gin.Context) {
+	_, logger, repos, cfg, errors := common.SetupEndpoint[any](c)
+	if errors != nil {
+		c.JSON(http.StatusInternalServerError, api.ApiError{
+			Code:    http.StatusInternalServerError,
+			Error:   enum.ApiError,
+			Details: errors,
+		})
+		return
+	}
+
+	user, ok := c.Get("user")
+	if !ok {
+		c.JSON(http.StatusInternalServerError, api.ApiError{
+			Code:  http.StatusInternalServerError,
+			Error: enum.ApiError,
+		})
+		return
+	}
+
+	store, ok := c.Get("objectStore")
+	if !ok {
+		c.JSON(http.StatusInternalServerError, api.ApiError{
+			Code:  http.StatusInternalServerError,
+			Error: enum.ApiError,
+		})
+		return
+	}
+
+	dataExport, err := GetExport(c.Request.Context(), repos, user.(*auth.JWTAccessTokenPayload), c.Param("exportId"), logger, cfg, store.(storage.ObjectStore))
+	if err != nil {
+		c.JSON(err.Code, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dataExport)
+}
+
+func ListSecurityEventsController(c *gin.Context) {
+	_, logger, repos, _, errors := common.SetupEndpoint[any](c)
+	if errors != nil {
+		c.JSON(http.StatusInternalServerError, api.ApiError{
+			Code:    http.StatusInternalServerError,
+			Error:   enum.ApiError,
+			Details: errors,
+		})
+		return
+	}
+
+	user, ok := c.Get("user")
+	if !ok {
+		c.JSON(http.StatusInternalServerError, api.ApiError{
+			Code:  http.StatusInternalServerError,
+			Error: enum.ApiError,
+		})
+		return
+	}
+
+	var payload ListSecurityEventsRequest
+	if err := c.ShouldBindQuery(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, api.ApiError{
+			Code:    http.StatusBadRequest,
+			Error:   enum.MalformedRequest,
+			Details: err.Error(),
+		})
+		return
+	}
+	if err := api.Validate.Struct(payload); err != nil {
+		c.JSON(http.StatusBadRequest, api.ApiError{
+			Code:    http.StatusBadRequest,
+			Error:   enum.MalformedRequest,
+			Details: err.Error(),
+		})
+		return
+	}
+
+	events, err := ListSecurityEvents(c.Request.Context(), repos, user.(*auth.JWTAccessTokenPayload), &payload, logger)
+	if err != nil {
+		c.JSON(err.Code, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, events)
+}
+
+func RegisterDeviceController(c *gin.Context) {
+	payload, logger, repos, cfg, errors := common.SetupEndpoint[RegisterDeviceRequest](c)
+	if errors != nil {
+		c.JSON(http.StatusInternalServerError, api.ApiError{
+			Code:    http.StatusInternalServerError,
+			Error:   enum.ApiError,
+			Details: errors,
+		})
+		return
+	}
+	if payload == nil {
+		c.JSON(http.StatusBadRequest, api.ApiError{
+			Code:  http.StatusBadRequest,
+			Error: enum.MalformedRequest,
+		})
+		return
+	}
+
+	user, ok := c.Get("user")
+	if !ok {
+		c.JSON(http.StatusInternalServerError, api.ApiError{
+			Code:  http.StatusInternalServerError,
+			Error: enum.ApiError,
+		})
+		return
+	}
+
+	device, err := RegisterDevice(c.Request.Context(), repos, cfg, payload, user.(*auth.JWTAccessTokenPayload), logger)
+	if err != nil {
+		c.JSON(err.Code, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, device)
+}
+
+func ListDevicesController(c *gin.Context) {
+	_, logger, repos, _, errors := common.SetupEndpoint[any](c)
+	if errors != nil {
+		c.JSON(http.StatusInternalServerError, api.ApiError{
+			Code:    http.StatusInternalServerError,
+			Error:   enum.ApiError,
+			Details: errors,
+		})
+		return
+	}
+
+	user, ok := c.Get("user")
+	if !ok {
+		c.JSON(http.StatusInternalServerError, api.ApiError{
+			Code:  http.StatusInternalServerError,
+			Error: enum.ApiError,
+		})
+		return
+	}
+
+	devices, err := ListDevices(c.Request.Context(), repos, user.(*auth.JWTAccessTokenPayload), logger)
+	if err != nil {
+		c.JSON(err.Code, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, devices)
+}
+
+func DeleteDeviceController(c *gin.Context) {
+	_, logger, repos, _, errors := common.SetupEndpoint[any](c)
+	if errors != nil {
+		c.JSON(http.StatusInternalServerError, api.ApiError{
+			Code:    http.StatusInternalServerError,
+			Error:   enum.ApiError,
+			Details: errors,
+		})
+		return
+	}
+
+	user, ok := c.Get("user")
+	if !ok {
+		c.JSON(http.StatusInternalServerError, api.ApiError{
+			Code:  http.StatusInternalServerError,
+			Error: enum.ApiError,
+		})
+		return
+	}
+
+	if err := DeleteDevice(c.Request.Context(), repos, c.Param("deviceId"), user.(*auth.JWTAccessTokenPayload), logger); err != nil {
+		c.JSON(err.Code, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func GetVapidPublicKeyController(c *gin.Context) {
+	_, logger, _, cfg, errors := common.SetupEndpoint[any](c)
+	if errors != nil {
+		c.JSON(http.StatusInternalServerError, api.ApiError{
+			Code:    http.StatusInternalServerError,
+			Error:   enum.ApiError,
+			Details: errors,
+		})
+		return
+	}
+
+	key, err := GetVapidPublicKey(cfg, logger)
+	if err != nil {
+		c.JSON(err.Code, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, key)
+}
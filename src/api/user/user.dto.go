@@ -1,6 +1,9 @@
 package user
 
-import "time"
+import (
+	"easyflow-backend/src/database"
+	"time"
+)
 
 type CreateUserRequest struct {
 	Email      string `json:"email" validate:"required,email"`
@@ -35,6 +38,15 @@ type CheckIfuserExistsRequest struct {
 	Email string `json:"email" validate:"required,email"`
 }
 
+// UserProfileResponse adds presigned urls of the profile picture and of its variants keyed by their size,
+// they are null until a picture was uploaded, processed and found clean by the malware scan
+type UserProfileResponse struct {
+	database.User
+	ProfilePicture         *string              `json:"profilePicture"`
+	ProfilePictureVariants map[string]string    `json:"profilePictureVariants"`
+	ProfilePictureScan     *database.ScanStatus `json:"profilePictureScan"` // null without a picture
+}
+
 type UpdateUserRequest struct {
 	Name           *string `json:"name" validate:"omitempty,lte=50"`
 	Bio            *string `json:"bio" validate:"omitempty,lte=1000"`
@@ -50,3 +62,67 @@ type UpdateUserResponse struct {
 	Bio            *string   `json:"bio"`
 	ProfilePicture *string   `json:"profilePicture"`
 }
+
+type ExportResponse struct {
+	Id          string                `json:"id"`
+	Status      database.ExportStatus `json:"status"`
+	CreatedAt   time.Time             `json:"createdAt"`
+	CompletedAt *time.Time            `json:"completedAt"`
+	DownloadURL *string               `json:"downloadUrl"`
+}
+
+// UploadProfilePictureRequest describes the picture, the upload url only accepts a file that matches it
+type UploadProfilePictureRequest struct {
+	MimeType string `form:"mimeType" validate:"required,lte=127"`
+	Size     int64  `form:"size" validate:"required,gte=1"`
+}
+
+// UploadProfilePictureResponse holds the presigned upload, the client sends a PUT with the headers to the url
+type UploadProfilePictureResponse struct {
+	UploadURL     string            `json:"uploadUrl"`
+	UploadHeaders map[string]string `json:"uploadHeaders"`
+	ExpiresAt     time.Time         `json:"expiresAt"`
+}
+
+type ListSecurityEventsRequest struct {
+	Limit  int `form:"limit" validate:"omitempty,gte=1,lte=100"`
+	Offset int `form:"offset" validate:"omitempty,gte=0"`
+}
+
+// SecurityEventResponse leaves out the user id, the events always belong to the requesting user
+type SecurityEventResponse struct {
+	Id        string                     `json:"id"`
+	CreatedAt time.Time                  `json:"createdAt"`
+	Kind      database.SecurityEventKind `json:"kind"`
+	Ip        string                     `json:"ip"`
+	UserAgent string                     `json:"userAgent"`
+	Details   map[string]any             `json:"details"`
+}
+
+// RegisterDeviceRequest registers the push subscription of a browser for webpush or the device token of the app for fcm and apns
+type RegisterDeviceRequest struct {
+	Platform     database.PushPlatform `json:"platform" validate:"required,oneof=webpush fcm apns"`
+	Token        string                `json:"token" validate:"omitempty,lte=512"`
+	Subscription *WebPushSubscription  `json:"subscription" validate:"omitempty"`
+}
+
+// WebPushSubscription is the json of the PushSubscription of the browser
+type WebPushSubscription struct {
+	Endpoint string `json:"endpoint" validate:"required,url,lte=512"`
+	Keys     struct {
+		P256dh string `json:"p256dh" validate:"required"`
+		Auth   string `json:"auth" validate:"required"`
+	} `json:"keys"`
+}
+
+// DeviceResponse leaves out the token and the keys, they are only needed to deliver
+type DeviceResponse struct {
+	Id        string                `json:"id"`
+	CreatedAt time.Time             `json:"createdAt"`
+	Platform  database.PushPlatform `json:"platform"`
+}
+
+// VapidPublicKeyResponse holds the applicationServerKey browsers subscribe with
+type VapidPublicKeyResponse struct {
+	PublicKey string `json:"publicKey"`
+}
@@ -1,24 +1,41 @@
 package user
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
+	"time"
 
 	"easyflow-backend/src/api"
 	"easyflow-backend/src/api/auth"
-	"easyflow-backend/src/api/s3"
+	"easyflow-backend/src/api/utils"
+	"easyflow-backend/src/audit"
 	"easyflow-backend/src/common"
 	"easyflow-backend/src/database"
 	"easyflow-backend/src/enum"
+	"easyflow-backend/src/export"
+	"easyflow-backend/src/notify"
+	"easyflow-backend/src/repository"
+	"easyflow-backend/src/scanning"
+	"easyflow-backend/src/storage"
 
 	"golang.org/x/crypto/bcrypt"
-	"gorm.io/gorm"
 )
 
-func CreateUser(db *gorm.DB, payload *CreateUserRequest, cfg *common.Config, logger *common.Logger) (*database.User, *api.ApiError) {
-	var user database.User
-	if err := db.Where("email = ?", payload.Email).First(&user).Error; err == nil {
-		logger.PrintfError("User with email: %s already exists", payload.Email)
+func CreateUser(ctx context.Context, repos *repository.Repositories, payload *CreateUserRequest, cfg *common.Config, logger *common.Logger) (*database.User, *api.ApiError) {
+	// the email of a deleted account stays taken until it is purged
+	exists, err := repos.Users.ExistsByEmail(ctx, payload.Email)
+	if err != nil {
+		logger.PrintfError("Error checking if user exists: %s", err)
+		return nil, &api.ApiError{
+			Code:  http.StatusInternalServerError,
+			Error: enum.ApiError,
+		}
+	}
+	if exists {
+		logger.PrintfError("Signup with an email that is already taken")
 		return nil, &api.ApiError{
 			Code:  http.StatusConflict,
 			Error: enum.AlreadyExists,
@@ -35,7 +52,7 @@ func CreateUser(db *gorm.DB, payload *CreateUserRequest, cfg *common.Config, log
 	}
 
 	//create a new user
-	user = database.User{
+	user := database.User{
 		Email:      payload.Email,
 		Name:       payload.Name,
 		Password:   string(password),
@@ -44,7 +61,7 @@ func CreateUser(db *gorm.DB, payload *CreateUserRequest, cfg *common.Config, log
 		Iv:         payload.Iv,
 	}
 
-	if err := db.Create(&user).Error; err != nil {
+	if err := repos.Users.Create(ctx, &user); err != nil {
 		logger.PrintfError("Error creating user: %s", err)
 		return nil, &api.ApiError{
 			Code:  http.StatusInternalServerError,
@@ -55,9 +72,9 @@ func CreateUser(db *gorm.DB, payload *CreateUserRequest, cfg *common.Config, log
 	return &user, nil
 }
 
-func GetUserById(db *gorm.DB, jwtPayload *auth.JWTAccessTokenPayload, logger *common.Logger) (*database.User, *api.ApiError) {
-	var user database.User
-	if err := db.Where("id = ?", jwtPayload.UserId).First(&user).Error; err != nil {
+func GetUserById(ctx context.Context, repos *repository.Repositories, cfg *common.Config, store storage.ObjectStore, jwtPayload *auth.JWTAccessTokenPayload, logger *common.Logger) (*UserProfileResponse, *api.ApiError) {
+	user, err := repos.Users.GetById(ctx, jwtPayload.UserId)
+	if err != nil {
 		logger.PrintfError("Error getting user: %s", err)
 		return nil, &api.ApiError{
 			Code:  http.StatusInternalServerError,
@@ -65,20 +82,28 @@ func GetUserById(db *gorm.DB, jwtPayload *auth.JWTAccessTokenPayload, logger *co
 		}
 	}
 
-	logger.Printf("Successfully got user: %s", user.Id)
+	picture, apiErr := utils.ProfilePicture(ctx, logger, cfg, store, user)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	variants, apiErr := utils.ProfilePictureVariants(ctx, logger, cfg, store, user)
+	if apiErr != nil {
+		return nil, apiErr
+	}
 
-	return &user, nil
-}
+	// the status of the last confirmed picture, a previous picture is still served while a new one is scanned
+	var scan *database.ScanStatus
+	if user.PictureKey != nil || user.PictureScan != database.ScanClean {
+		scan = &user.PictureScan
+	}
 
-func GetUserByEmail(db *gorm.DB, email string, logger *common.Logger) (bool, *api.ApiError) {
-	var user database.User
-	err := db.Where("email = ?", email).First(&user).Error
+	logger.Printf("Successfully got user: %s", user.Id)
 
-	if errors.Is(err, gorm.ErrRecordNotFound) {
-		logger.PrintfInfo("No user with email: %s found", err)
-		return false, nil
-	}
+	return &UserProfileResponse{User: *user, ProfilePicture: picture, ProfilePictureVariants: variants, ProfilePictureScan: scan}, nil
+}
 
+func GetUserByEmail(ctx context.Context, repos *repository.Repositories, email string, logger *common.Logger) (bool, *api.ApiError) {
+	exists, err := repos.Users.ExistsByEmail(ctx, email)
 	if err != nil {
 		logger.PrintfInfo("An error occured while trying to find user: %s ", err)
 		return false, &api.ApiError{
@@ -87,14 +112,19 @@ func GetUserByEmail(db *gorm.DB, email string, logger *common.Logger) (bool, *ap
 		}
 	}
 
-	logger.PrintfInfo("User with email: %s found", email)
+	if !exists {
+		logger.PrintfInfo("No user with the requested email found")
+		return false, nil
+	}
+
+	logger.PrintfInfo("User with the requested email found")
 
 	return true, nil
 }
 
-func GenerateGetProfilePictureURL(db *gorm.DB, jwtPayload *auth.JWTAccessTokenPayload, logger *common.Logger, cfg *common.Config) (*string, *api.ApiError) {
-	var user database.User
-	if err := db.Where("id = ?", jwtPayload.UserId).First(&user).Error; err != nil {
+func GenerateGetProfilePictureURL(ctx context.Context, repos *repository.Repositories, jwtPayload *auth.JWTAccessTokenPayload, logger *common.Logger, cfg *common.Config, store storage.ObjectStore) (*string, *api.ApiError) {
+	user, err := repos.Users.GetById(ctx, jwtPayload.UserId)
+	if err != nil {
 		logger.PrintfError("Error getting user: %s", err)
 		return nil, &api.ApiError{
 			Code:  http.StatusInternalServerError,
@@ -102,17 +132,23 @@ func GenerateGetProfilePictureURL(db *gorm.DB, jwtPayload *auth.JWTAccessTokenPa
 		}
 	}
 
-	imageURL, err := s3.GenerateDownloadURL(logger, cfg, cfg.ProfilePictureBucketName, user.Id, 60*60*24*7) // 1 week expiration time
-	if err != nil {
-		return nil, err
+	// only pictures that were scanned clean are published, without one the status of the last confirmed picture explains why
+	if user.PictureKey == nil {
+		if apiErr := scanning.RequireClean(user.PictureScan); apiErr != nil {
+			logger.PrintfWarning("Profile picture of user: %s is %s", user.Id, user.PictureScan)
+			return nil, apiErr
+		}
 	}
 
-	user.ProfilePicture = imageURL
-	if err := db.Update(user.Id, &user).Error; err != nil {
-		logger.PrintfError("Error saving user: %s", err)
+	imageURL, apiErr := utils.ProfilePicture(ctx, logger, cfg, store, user)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	if imageURL == nil {
+		logger.PrintfWarning("User: %s has no profile picture", user.Id)
 		return nil, &api.ApiError{
-			Code:  http.StatusInternalServerError,
-			Error: enum.ApiError,
+			Code:  http.StatusNoContent,
+			Error: enum.NotFound,
 		}
 	}
 
@@ -121,9 +157,9 @@ func GenerateGetProfilePictureURL(db *gorm.DB, jwtPayload *auth.JWTAccessTokenPa
 	return imageURL, nil
 }
 
-func GenerateUploadProfilePictureURL(db *gorm.DB, jwtPayload *auth.JWTAccessTokenPayload, logger *common.Logger, cfg *common.Config) (*string, *api.ApiError) {
-	var user database.User
-	if err := db.Where("id = ?", jwtPayload.UserId).First(&user).Error; err != nil {
+func GenerateUploadProfilePictureURL(ctx context.Context, repos *repository.Repositories, jwtPayload *auth.JWTAccessTokenPayload, payload *UploadProfilePictureRequest, logger *common.Logger, cfg *common.Config, store storage.ObjectStore) (*UploadProfilePictureResponse, *api.ApiError) {
+	user, err := repos.Users.GetById(ctx, jwtPayload.UserId)
+	if err != nil {
 		logger.PrintfError("Error getting user: %s", err)
 		return nil, &api.ApiError{
 			Code:  http.StatusInternalServerError,
@@ -131,24 +167,110 @@ func GenerateUploadProfilePictureURL(db *gorm.DB, jwtPayload *auth.JWTAccessToke
 		}
 	}
 
-	uploadURL, err := s3.GenerateUploadURL(logger, cfg, cfg.ProfilePictureBucketName, user.Id, 60*60)
-	if err != nil {
-		logger.PrintfError("Error uploading profile picture: %s", err.Error)
+	if apiErr := utils.PicturePolicy(cfg).Check(payload.MimeType, payload.Size); apiErr != nil {
+		logger.PrintfWarning("User: %s requested a profile picture upload of %d bytes of type %s", user.Id, payload.Size, payload.MimeType)
+		return nil, apiErr
+	}
+
+	// every upload gets its own staging object, the picture is only published under a new key once it was processed and scanned
+	uploadKey := utils.PictureUploadKey()
+	expiresAt := time.Now().Add(cfg.ProfilePictureUploadExpiration)
+	upload, apiErr := storage.GenerateConstrainedUploadURL(ctx, logger, store, cfg.ProfilePictureBucketName, uploadKey, storage.UploadConstraints{
+		ContentType:   payload.MimeType,
+		ContentLength: payload.Size,
+	}, int(cfg.ProfilePictureUploadExpiration.Seconds()))
+	if apiErr != nil {
+		logger.PrintfError("Error uploading profile picture: %s", apiErr.Error)
 		return nil, &api.ApiError{
 			Code:    http.StatusInternalServerError,
 			Error:   enum.ApiError,
-			Details: err,
+			Details: apiErr,
+		}
+	}
+
+	if err := repos.Users.SetPictureUpload(ctx, user.Id, uploadKey); err != nil {
+		logger.PrintfError("Error saving user: %s", err)
+		return nil, &api.ApiError{
+			Code:  http.StatusInternalServerError,
+			Error: enum.ApiError,
 		}
 	}
 
 	logger.Printf("Successfully generated profile picture upload URL for user: %s", user.Id)
 
-	return uploadURL, nil
+	return &UploadProfilePictureResponse{
+		UploadURL:     upload.URL,
+		UploadHeaders: upload.Headers,
+		ExpiresAt:     expiresAt,
+	}, nil
+}
+
+// ConfirmProfilePicture validates the uploaded picture and stores a copy without metadata under a new key,
+// pictures that violate the policy or can not be processed are deleted. The copy is scanned in the background
+// and replaces the current picture once it was found clean.
+func ConfirmProfilePicture(ctx context.Context, repos *repository.Repositories, scans *scanning.Runner, jwtPayload *auth.JWTAccessTokenPayload, logger *common.Logger, cfg *common.Config, store storage.ObjectStore) (*UserProfileResponse, *api.ApiError) {
+	user, err := repos.Users.GetById(ctx, jwtPayload.UserId)
+	if err != nil {
+		logger.PrintfError("Error getting user: %s", err)
+		return nil, &api.ApiError{
+			Code:  http.StatusInternalServerError,
+			Error: enum.NotFound,
+		}
+	}
+
+	notUploaded := &api.ApiError{
+		Code:    http.StatusNotFound,
+		Error:   enum.NotFound,
+		Details: "no profile picture was uploaded",
+	}
+	if user.PictureUpload == nil {
+		return nil, notUploaded
+	}
+
+	key, apiErr := utils.ProcessPicture(ctx, logger, cfg, store, cfg.ProfilePictureBucketName, *user.PictureUpload, user.Id)
+	if apiErr != nil {
+		if apiErr.Error == enum.NotFound {
+			return nil, notUploaded
+		}
+		return nil, apiErr
+	}
+
+	published := scans.InitialStatus() == database.ScanClean
+	err = repos.Transaction(ctx, func(tx *repository.Repositories) error {
+		if err := tx.Users.SetPendingPicture(ctx, user.Id, *user.PictureUpload, key); err != nil {
+			return err
+		}
+		if published {
+			return tx.Users.PublishPicture(ctx, user.Id, key, time.Now())
+		}
+		return scans.Enqueue(ctx, tx, scanning.ScanPayload{Upload: scanning.UploadProfilePicture, Id: user.Id, Key: key})
+	})
+	if err != nil {
+		utils.DeletePicture(ctx, logger, store, cfg.ProfilePictureBucketName, key)
+		if errors.Is(err, repository.ErrNotFound) {
+			// a newer upload was requested or the upload was confirmed twice
+			return nil, notUploaded
+		}
+		logger.PrintfError("Error saving user: %s", err)
+		return nil, &api.ApiError{
+			Code:  http.StatusInternalServerError,
+			Error: enum.ApiError,
+		}
+	}
+
+	// a picture that is still scanned is deleted by its scan job once it sees that it was replaced
+	if published && user.PictureKey != nil {
+		utils.DeletePicture(ctx, logger, store, cfg.ProfilePictureBucketName, *user.PictureKey)
+	}
+
+	logger.Printf("Successfully processed profile picture of user: %s", user.Id)
+
+	return GetUserById(ctx, repos, cfg, store, jwtPayload, logger)
 }
 
-func UpdateUser(db *gorm.DB, jwtPayload *auth.JWTAccessTokenPayload, payload *UpdateUserRequest, logger *common.Logger) (*database.User, *api.ApiError) {
-	var user database.User
-	if err := db.Where("id = ?", jwtPayload.UserId).First(&user).Error; err != nil {
+func UpdateUser(ctx context.Context, repos *repository.Repositories, jwtPayload *auth.JWTAccessTokenPayload, payload *UpdateUserRequest, logger *common.Logger) (*database.User, *api.ApiError) {
+	user, err := repos.Users.GetById(ctx, jwtPayload.UserId)
+	if err != nil {
 		logger.PrintfError("Error getting user: %s", err)
 		return nil, &api.ApiError{
 			Code:  http.StatusInternalServerError,
@@ -163,7 +285,7 @@ func UpdateUser(db *gorm.DB, jwtPayload *auth.JWTAccessTokenPayload, payload *Up
 		user.Bio = payload.Bio
 	}
 
-	if err := db.Update(user.Id, &user).Error; err != nil {
+	if err := repos.Users.UpdateProfile(ctx, user.Id, user.Name, user.Bio); err != nil {
 		logger.PrintfError("Error updating user: %s", err)
 		return nil, &api.ApiError{
 			Code:    http.StatusInternalServerError,
@@ -174,12 +296,12 @@ func UpdateUser(db *gorm.DB, jwtPayload *auth.JWTAccessTokenPayload, payload *Up
 
 	logger.Printf("Successfully updated user: %s", user.Id)
 
-	return &user, nil
+	return user, nil
 }
 
-func DeleteUser(db *gorm.DB, jwtPayload *auth.JWTAccessTokenPayload, logger *common.Logger) *api.ApiError {
-	var user database.User
-	if err := db.Where("id = ?", jwtPayload.UserId).First(&user).Error; err != nil {
+func DeleteUser(ctx context.Context, repos *repository.Repositories, recorder *audit.Recorder, jwtPayload *auth.JWTAccessTokenPayload, logger *common.Logger) *api.ApiError {
+	user, err := repos.Users.GetById(ctx, jwtPayload.UserId)
+	if err != nil {
 		logger.PrintfError("Error getting user: %s", err)
 		return &api.ApiError{
 			Code:  http.StatusInternalServerError,
@@ -187,7 +309,7 @@ func DeleteUser(db *gorm.DB, jwtPayload *auth.JWTAccessTokenPayload, logger *com
 		}
 	}
 
-	if err := db.Delete(&user).Error; err != nil {
+	if err := repos.Users.Delete(ctx, user.Id); err != nil {
 		logger.PrintfError("Error deleting user: %s", err)
 		return &api.ApiError{
 			Code:  http.StatusInternalServerError,
@@ -196,6 +318,274 @@ func DeleteUser(db *gorm.DB, jwtPayload *auth.JWTAccessTokenPayload, logger *com
 	}
 
 	logger.Printf("Successfully deleted user: %s", user.Id)
+	recorder.Record(ctx, repos, database.EventAccountDeleted, user.Id, nil, logger)
+
+	return nil
+}
+
+const defaultSecurityEventPageSize = 50
+
+func ListSecurityEvents(ctx context.Context, repos *repository.Repositories, jwtPayload *auth.JWTAccessTokenPayload, payload *ListSecurityEventsRequest, logger *common.Logger) ([]SecurityEventResponse, *api.ApiError) {
+	limit := payload.Limit
+	if limit == 0 {
+		limit = defaultSecurityEventPageSize
+	}
+
+	events, err := repos.Security.ListByUser(ctx, jwtPayload.UserId, limit, payload.Offset)
+	if err != nil {
+		logger.PrintfError("Error getting security events of user: %s. Error: %s", jwtPayload.UserId, err)
+		return nil, &api.ApiError{
+			Code:  http.StatusInternalServerError,
+			Error: enum.ApiError,
+		}
+	}
+
+	response := make([]SecurityEventResponse, 0, len(events))
+	for _, event := range events {
+		var details map[string]any
+		if event.Details != nil {
+			if err := json.Unmarshal([]byte(*event.Details), &details); err != nil {
+				logger.PrintfWarning("Could not decode details of security event: %s. Error: %s", event.Id, err)
+			}
+		}
+
+		response = append(response, SecurityEventResponse{
+			Id:        event.Id,
+			CreatedAt: event.CreatedAt,
+			Kind:      event.Kind,
+			Ip:        event.Ip,
+			UserAgent: event.UserAgent,
+			Details:   details,
+		})
+	}
+
+	logger.Printf("Successfully got security events of user: %s", jwtPayload.UserId)
+
+	return response, nil
+}
+
+func RequestExport(ctx context.Context, repos *repository.Repositories, jwtPayload *auth.JWTAccessTokenPayload, logger *common.Logger, cfg *common.Config) (*ExportResponse, *api.ApiError) {
+	unfinished, err := repos.Exports.GetUnfinishedByUser(ctx, jwtPayload.UserId)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		logger.PrintfError("Error getting unfinished export: %s", err)
+		return nil, &api.ApiError{
+			Code:  http.StatusInternalServerError,
+			Error: enum.ApiError,
+		}
+	}
+
+	if unfinished != nil {
+		if time.Since(unfinished.UpdatedAt) < cfg.ExportTimeout {
+			logger.PrintfWarning("Export: %s of user: %s is still running", unfinished.Id, jwtPayload.UserId)
+			return nil, &api.ApiError{
+				Code:  http.StatusConflict,
+				Error: enum.AlreadyExists,
+			}
+		}
+
+		// the export was abandoned by a restart, it would block the user forever
+		unfinished.Status = database.ExportFailed
+		if err := repos.Exports.Update(ctx, unfinished); err != nil {
+			logger.PrintfError("Error failing abandoned export: %s", err)
+			return nil, &api.ApiError{
+				Code:  http.StatusInternalServerError,
+				Error: enum.ApiError,
+			}
+		}
+	}
+
+	dataExport := database.DataExport{
+		UserId: jwtPayload.UserId,
+		Status: database.ExportPending,
+	}
+	// the archive is built by a job that is queued together with the export
+	err = repos.Transaction(ctx, func(tx *repository.Repositories) error {
+		if err := tx.Exports.Create(ctx, &dataExport); err != nil {
+			return err
+		}
+		_, err := export.BuildJob.Enqueue(ctx, tx, export.BuildPayload{ExportId: dataExport.Id, UserId: dataExport.UserId})
+		return err
+	})
+	if err != nil {
+		logger.PrintfError("Error creating export: %s", err)
+		return nil, &api.ApiError{
+			Code:  http.StatusInternalServerError,
+			Error: enum.ApiError,
+		}
+	}
+
+	logger.Printf("Successfully requested export: %s for user: %s", dataExport.Id, jwtPayload.UserId)
+
+	return &ExportResponse{
+		Id:        dataExport.Id,
+		Status:    dataExport.Status,
+		CreatedAt: dataExport.CreatedAt,
+	}, nil
+}
+
+func GetExport(ctx context.Context, repos *repository.Repositories, jwtPayload *auth.JWTAccessTokenPayload, exportId string, logger *common.Logger, cfg *common.Config, store storage.ObjectStore) (*ExportResponse, *api.ApiError) {
+	dataExport, err := repos.Exports.GetByUser(ctx, jwtPayload.UserId, exportId)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, &api.ApiError{
+			Code:  http.StatusNotFound,
+			Error: enum.NotFound,
+		}
+	}
+	if err != nil {
+		logger.PrintfError("Error getting export: %s", err)
+		return nil, &api.ApiError{
+			Code:  http.StatusInternalServerError,
+			Error: enum.ApiError,
+		}
+	}
+
+	response := &ExportResponse{
+		Id:          dataExport.Id,
+		Status:      dataExport.Status,
+		CreatedAt:   dataExport.CreatedAt,
+		CompletedAt: dataExport.CompletedAt,
+	}
+
+	if dataExport.Status != database.ExportReady || dataExport.ObjectKey == nil {
+		return response, nil
+	}
+
+	downloadURL, apiErr := storage.GenerateDownloadURL(ctx, logger, store, cfg.ExportBucketName, *dataExport.ObjectKey, int(cfg.ExportURLExpiration.Seconds()))
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	response.DownloadURL = downloadURL
+
+	return response, nil
+}
+
+func toDeviceResponse(device *database.PushDevice) DeviceResponse {
+	return DeviceResponse{
+		Id:        device.Id,
+		CreatedAt: device.CreatedAt,
+		Platform:  device.Platform,
+	}
+}
+
+// RegisterDevice stores where push notifications reach the user, a token that is already registered moves to the user
+func RegisterDevice(ctx context.Context, repos *repository.Repositories, cfg *common.Config, payload *RegisterDeviceRequest, jwtPayload *auth.JWTAccessTokenPayload, logger *common.Logger) (*DeviceResponse, *api.ApiError) {
+	if !cfg.PushPlatformEnabled(payload.Platform) {
+		return nil, &api.ApiError{
+			Code:    http.StatusBadRequest,
+			Error:   enum.PushNotConfigured,
+			Details: fmt.Sprintf("push notifications via %s are not configured", payload.Platform),
+		}
+	}
+
+	device := &database.PushDevice{
+		UserId:   jwtPayload.UserId,
+		Platform: payload.Platform,
+		Token:    payload.Token,
+	}
+	if payload.Platform == database.PushWeb {
+		if payload.Subscription == nil {
+			return nil, &api.ApiError{
+				Code:    http.StatusBadRequest,
+				Error:   enum.MalformedRequest,
+				Details: "webpush devices are registered with their subscription",
+			}
+		}
+		if _, err := notify.ValidateEndpoint(payload.Subscription.Endpoint, cfg.PushWebPushHosts); err != nil {
+			logger.PrintfWarning("User: %s tried to register the push endpoint: %s. Error: %s", jwtPayload.UserId, payload.Subscription.Endpoint, err)
+			return nil, &api.ApiError{
+				Code:    http.StatusBadRequest,
+				Error:   enum.MalformedRequest,
+				Details: err.Error(),
+			}
+		}
+		if err := notify.ValidateSubscription(payload.Subscription.Keys.P256dh, payload.Subscription.Keys.Auth); err != nil {
+			return nil, &api.ApiError{
+				Code:    http.StatusBadRequest,
+				Error:   enum.MalformedRequest,
+				Details: err.Error(),
+			}
+		}
+		device.Token = payload.Subscription.Endpoint
+		device.P256dh = &payload.Subscription.Keys.P256dh
+		device.Auth = &payload.Subscription.Keys.Auth
+	} else if payload.Token == "" {
+		return nil, &api.ApiError{
+			Code:    http.StatusBadRequest,
+			Error:   enum.MalformedRequest,
+			Details: fmt.Sprintf("%s devices are registered with their token", payload.Platform),
+		}
+	}
+
+	if err := repos.Devices.Register(ctx, device); err != nil {
+		logger.PrintfError("Error registering push device of user: %s. Error: %s", jwtPayload.UserId, err)
+		return nil, &api.ApiError{
+			Code:  http.StatusInternalServerError,
+			Error: enum.ApiError,
+		}
+	}
+
+	logger.Printf("Successfully registered push device: %s of user: %s", device.Id, jwtPayload.UserId)
+
+	response := toDeviceResponse(device)
+	return &response, nil
+}
+
+func ListDevices(ctx context.Context, repos *repository.Repositories, jwtPayload *auth.JWTAccessTokenPayload, logger *common.Logger) ([]DeviceResponse, *api.ApiError) {
+	devices, err := repos.Devices.ListByUsers(ctx, []string{jwtPayload.UserId})
+	if err != nil {
+		logger.PrintfError("Error getting push devices of user: %s. Error: %s", jwtPayload.UserId, err)
+		return nil, &api.ApiError{
+			Code:  http.StatusInternalServerError,
+			Error: enum.ApiError,
+		}
+	}
+
+	response := make([]DeviceResponse, 0, len(devices))
+	for _, device := range devices {
+		response = append(response, toDeviceResponse(&device))
+	}
+	return response, nil
+}
 
+// DeleteDevice stops push notifications to the device, e.g. on logout
+func DeleteDevice(ctx context.Context, repos *repository.Repositories, deviceId string, jwtPayload *auth.JWTAccessTokenPayload, logger *common.Logger) *api.ApiError {
+	err := repos.Devices.Delete(ctx, jwtPayload.UserId, deviceId)
+	if errors.Is(err, repository.ErrNotFound) {
+		return &api.ApiError{
+			Code:  http.StatusNotFound,
+			Error: enum.NotFound,
+		}
+	}
+	if err != nil {
+		logger.PrintfError("Error deleting push device: %s of user: %s. Error: %s", deviceId, jwtPayload.UserId, err)
+		return &api.ApiError{
+			Code:  http.StatusInternalServerError,
+			Error: enum.ApiError,
+		}
+	}
+
+	logger.Printf("Successfully deleted push device: %s of user: %s", deviceId, jwtPayload.UserId)
 	return nil
 }
+
+// GetVapidPublicKey returns the key browsers pass as applicationServerKey when they subscribe
+func GetVapidPublicKey(cfg *common.Config, logger *common.Logger) (*VapidPublicKeyResponse, *api.ApiError) {
+	if !cfg.PushPlatformEnabled(database.PushWeb) {
+		return nil, &api.ApiError{
+			Code:    http.StatusBadRequest,
+			Error:   enum.PushNotConfigured,
+			Details: "push notifications via webpush are not configured",
+		}
+	}
+
+	publicKey, err := notify.VapidPublicKey(cfg.PushVapidPrivateKey)
+	if err != nil {
+		logger.PrintfError("Error deriving the vapid public key: %s", err)
+		return nil, &api.ApiError{
+			Code:  http.StatusInternalServerError,
+			Error: enum.ApiError,
+		}
+	}
+
+	return &VapidPublicKeyResponse{PublicKey: publicKey}, nil
+}
@@ -1,20 +1,144 @@
 package utils
 
 import (
-	"easyflow-backend/src/api/s3"
+	"context"
+	"easyflow-backend/src/api"
 	"easyflow-backend/src/common"
 	"easyflow-backend/src/database"
+	"easyflow-backend/src/enum"
+	"easyflow-backend/src/imaging"
+	"easyflow-backend/src/storage"
+	"net/http"
+	"strconv"
+	"time"
 
-	"gorm.io/gorm"
+	"github.com/google/uuid"
 )
 
-func GenerateNewProfilePictureUrl(logger *common.Logger, cfg *common.Config, db *gorm.DB, user *database.User) {
-	pictureUrl, err := s3.GenerateDownloadURL(logger, cfg, cfg.ProfilePictureBucketName, user.Id, 7*24*60*60)
-	if err == nil {
-		user.ProfilePicture = pictureUrl
+// ProfilePictureURLExpiration is how long the presigned urls of profile and chat pictures are valid, in seconds
+const ProfilePictureURLExpiration = 7 * 24 * 60 * 60
 
-		if err := db.Save(user).Error; err != nil {
-			logger.PrintfWarning("Could not save the new ProfilePicture url for user: %s. Error: %s", user.Id, err)
+// PictureUploadPrefix is the prefix of the staging objects profile and chat pictures are uploaded to, they are never served
+const PictureUploadPrefix = "uploads/"
+
+// pictureVersion keys the cached urls, a new picture under the same key gets new urls
+func pictureVersion(version *time.Time) string {
+	if version == nil {
+		return ""
+	}
+	return strconv.FormatInt(version.UnixNano(), 10)
+}
+
+// pictureURL returns a presigned url of a picture, nil if there is none. A picture key is only set once the picture was scanned clean.
+func pictureURL(ctx context.Context, logger *common.Logger, store storage.ObjectStore, bucketName string, key *string, version *time.Time) (*string, *api.ApiError) {
+	if key == nil {
+		return nil, nil
+	}
+
+	return storage.CachedDownloadURL(ctx, logger, store, bucketName, *key, pictureVersion(version), ProfilePictureURLExpiration)
+}
+
+// pictureVariants returns presigned urls of the processed picture keyed by the size, nil if there is none
+func pictureVariants(ctx context.Context, logger *common.Logger, store storage.ObjectStore, bucketName string, key *string, version *time.Time) (map[string]string, *api.ApiError) {
+	if key == nil || version == nil {
+		return nil, nil
+	}
+
+	variants := make(map[string]string, len(imaging.VariantSizes))
+	for _, size := range imaging.VariantSizes {
+		variantURL, err := storage.CachedDownloadURL(ctx, logger, store, bucketName, imaging.VariantKey(*key, size), pictureVersion(version), ProfilePictureURLExpiration)
+		if err != nil {
+			return nil, err
 		}
+		variants[strconv.Itoa(size)] = *variantURL
+	}
+
+	return variants, nil
+}
+
+// ProfilePicture returns a presigned url of the profile picture, nil if the user has none
+func ProfilePicture(ctx context.Context, logger *common.Logger, cfg *common.Config, store storage.ObjectStore, user *database.User) (*string, *api.ApiError) {
+	return pictureURL(ctx, logger, store, cfg.ProfilePictureBucketName, user.PictureKey, user.PictureVersion)
+}
+
+// ProfilePictureVariants returns presigned urls of the processed profile picture keyed by the size, nil if there is none
+func ProfilePictureVariants(ctx context.Context, logger *common.Logger, cfg *common.Config, store storage.ObjectStore, user *database.User) (map[string]string, *api.ApiError) {
+	return pictureVariants(ctx, logger, store, cfg.ProfilePictureBucketName, user.PictureKey, user.PictureVersion)
+}
+
+// ChatPicture returns a presigned url of the chat picture, nil if the chat has none
+func ChatPicture(ctx context.Context, logger *common.Logger, cfg *common.Config, store storage.ObjectStore, chat *database.Chat) (*string, *api.ApiError) {
+	return pictureURL(ctx, logger, store, cfg.ChatPictureBucket(), chat.PictureKey, chat.PictureVersion)
+}
+
+// ChatPictureVariants returns presigned urls of the processed chat picture keyed by the size, nil if there is none
+func ChatPictureVariants(ctx context.Context, logger *common.Logger, cfg *common.Config, store storage.ObjectStore, chat *database.Chat) (map[string]string, *api.ApiError) {
+	return pictureVariants(ctx, logger, store, cfg.ChatPictureBucket(), chat.PictureKey, chat.PictureVersion)
+}
+
+// PicturePolicy is what an uploaded profile or chat picture has to satisfy
+func PicturePolicy(cfg *common.Config) storage.UploadPolicy {
+	return storage.UploadPolicy{
+		ContentTypes: cfg.ProfilePictureContentTypes,
+		MaxSize:      int64(cfg.ProfilePictureMaxSize),
+	}
+}
+
+// PictureUploadKey returns a new staging object key for the upload of a profile or chat picture
+func PictureUploadKey() string {
+	return PictureUploadPrefix + uuid.NewString()
+}
+
+// ProcessPicture validates an uploaded picture and stores a copy without metadata next to its variants under a new key below
+// the base key, the staging object is deleted once it was read or if it violates the policy. A missing upload is reported as NOT_FOUND.
+// The new key is returned, it is never written again so urls that were handed out can not serve other content later.
+func ProcessPicture(ctx context.Context, logger *common.Logger, cfg *common.Config, store storage.ObjectStore, bucketName string, uploadKey string, baseKey string) (string, *api.ApiError) {
+	if _, apiErr := storage.ConfirmUpload(ctx, logger, store, bucketName, uploadKey, PicturePolicy(cfg)); apiErr != nil {
+		return "", apiErr
+	}
+
+	raw, apiErr := storage.GetObject(ctx, logger, store, bucketName, uploadKey)
+	if apiErr != nil {
+		return "", apiErr
+	}
+	if apiErr := storage.DeleteObject(ctx, logger, store, bucketName, uploadKey); apiErr != nil {
+		return "", apiErr
+	}
+
+	processed, err := imaging.Process(raw, imaging.Limits{MinDimension: cfg.ImageMinDimension, MaxDimension: cfg.ImageMaxDimension})
+	if err != nil {
+		logger.PrintfWarning("Rejected picture %s in bucket %s. Error: %s", uploadKey, bucketName, err)
+		return "", &api.ApiError{
+			Code:    http.StatusBadRequest,
+			Error:   enum.InvalidImage,
+			Details: err.Error(),
+		}
+	}
+
+	key := baseKey + "/" + uuid.NewString()
+	for _, variant := range processed.Variants {
+		if apiErr := storage.PutObject(ctx, logger, store, bucketName, imaging.VariantKey(key, variant.Size), variant.Body, imaging.VariantContentType); apiErr != nil {
+			return "", apiErr
+		}
+	}
+	if apiErr := storage.PutObject(ctx, logger, store, bucketName, key, processed.Original, imaging.VariantContentType); apiErr != nil {
+		return "", apiErr
+	}
+	return key, nil
+}
+
+// DeletePicture deletes a processed picture that nothing points to anymore and its variants, failures are only logged
+func DeletePicture(ctx context.Context, logger *common.Logger, store storage.ObjectStore, bucketName string, key string) {
+	for _, objectKey := range PictureKeys(key) {
+		_ = storage.DeleteObject(ctx, logger, store, bucketName, objectKey)
+	}
+}
+
+// PictureKeys returns the keys of a processed picture and its variants, all of them are scanned
+func PictureKeys(objectKey string) []string {
+	keys := []string{objectKey}
+	for _, size := range imaging.VariantSizes {
+		keys = append(keys, imaging.VariantKey(objectKey, size))
 	}
+	return keys
 }
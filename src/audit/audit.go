@@ -0,0 +1,115 @@
+package audit
+
+import (
+	"context"
+	"easyflow-backend/src/common"
+	"easyflow-backend/src/database"
+	"easyflow-backend/src/repository"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// maxUserAgentLength is the size of the user_agent column, longer values are cut off
+const maxUserAgentLength = 255
+
+type clientKey struct{}
+
+// client is the origin of the request that caused an event
+type client struct {
+	ip        string
+	userAgent string
+}
+
+// WithClient attaches the ip and user agent of a request to ctx, Record stores them with the event
+func WithClient(ctx context.Context, ip string, userAgent string) context.Context {
+	return context.WithValue(ctx, clientKey{}, client{ip: ip, userAgent: userAgent})
+}
+
+// Recorder writes security events to the database and, if a file is configured, appends them to it as json lines.
+// The database is the source of truth, the file is meant to be shipped to a log pipeline.
+type Recorder struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewRecorder returns a recorder that only writes to the database if path is empty
+func NewRecorder(path string) (*Recorder, error) {
+	if path == "" {
+		return &Recorder{}, nil
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("could not open security event log: %w", err)
+	}
+
+	return &Recorder{file: file}, nil
+}
+
+// Close closes the file sink, events recorded afterwards are only written to the database
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+// Record stores an event of the user, userId is empty if the account is unknown.
+// Errors are logged but never fail the action that caused the event, a failing sink does not stop the other one.
+func (r *Recorder) Record(ctx context.Context, repos *repository.Repositories, kind database.SecurityEventKind, userId string, details map[string]any, logger *common.Logger) {
+	if err := r.record(ctx, repos, kind, userId, details); err != nil {
+		logger.PrintfError("Error recording security event: %s for user: %s. Error: %s", kind, userId, err)
+	}
+}
+
+func (r *Recorder) record(ctx context.Context, repos *repository.Repositories, kind database.SecurityEventKind, userId string, details map[string]any) error {
+	event := &database.SecurityEvent{CreatedAt: time.Now(), Kind: kind}
+	if userId != "" {
+		event.UserId = &userId
+	}
+	if c, ok := ctx.Value(clientKey{}).(client); ok {
+		event.Ip = c.ip
+		event.UserAgent = c.userAgent
+		if len(event.UserAgent) > maxUserAgentLength {
+			event.UserAgent = event.UserAgent[:maxUserAgentLength]
+		}
+	}
+	if len(details) > 0 {
+		raw, err := json.Marshal(details)
+		if err != nil {
+			return err
+		}
+		encoded := string(raw)
+		event.Details = &encoded
+	}
+
+	dbErr := repos.Security.Create(ctx, event)
+	return errors.Join(dbErr, r.append(event))
+}
+
+func (r *Recorder) append(event *database.SecurityEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return nil
+	}
+
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if _, err := r.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("could not write security event log: %w", err)
+	}
+	return nil
+}
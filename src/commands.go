@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"easyflow-backend/src/api/admin"
+	"easyflow-backend/src/common"
+	"easyflow-backend/src/database"
+	"easyflow-backend/src/notify"
+	"easyflow-backend/src/repository"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+const usage = `Usage: easyflow-backend [command]
+
+Without a command the api server is started.
+
+Commands:
+  admin grant <email>      give the user access to the /admin endpoints
+  admin revoke <email>     take the admin role away from the user
+  config print             print the effective configuration with secrets redacted and report problems
+  jobs list [status]       list the background jobs with the status, dead jobs by default
+  jobs requeue <id>...     queue dead jobs again with fresh attempts, all of them with --all
+  migrate up               apply all pending migrations
+  migrate down [steps]     revert the last applied migrations (default 1)
+  migrate status           list all migrations and whether they are applied
+  migrate force <version>  clear the dirty flag of a migration that was fixed by hand
+  push vapid-key           generate a key pair for PUSH_VAPID_PRIVATE_KEY
+`
+
+// runCommand executes the cli command named by args and returns the exit code.
+func runCommand(cfg *common.Config, log *common.Logger, args []string) int {
+	switch args[0] {
+	case "migrate":
+		return runMigrateCommand(cfg, log, args[1:])
+	case "config":
+		return runConfigCommand(cfg, args[1:])
+	case "admin":
+		return runAdminCommand(cfg, log, args[1:])
+	case "jobs":
+		return runJobsCommand(cfg, log, args[1:])
+	case "push":
+		return runPushCommand(log, args[1:])
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n%s", args[0], usage)
+		return 2
+	}
+}
+
+func runConfigCommand(cfg *common.Config, args []string) int {
+	if len(args) != 1 || args[0] != "print" {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	if err := cfg.Print(os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "Could not print the configuration: %s\n", err)
+		return 1
+	}
+
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "\nThe configuration is invalid:\n%s\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+func runAdminCommand(cfg *common.Config, log *common.Logger, args []string) int {
+	if len(args) != 2 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	var role database.UserRole
+	switch args[0] {
+	case "grant":
+		role = database.RoleAdmin
+	case "revoke":
+		role = database.RoleUser
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown admin command %q\n\n%s", args[0], usage)
+		return 2
+	}
+
+	dbInst, err := database.NewDatabaseInst(cfg.DatabaseURL, &cfg.GormConfig, cfg.DatabaseOptions())
+	if err != nil {
+		log.PrintfError("Failed to connect to database: %s", err)
+		return 1
+	}
+	defer dbInst.Close()
+
+	repos := repository.NewGormRepositories(dbInst.GetClient())
+	if err := admin.SetRole(context.Background(), repos, args[1], role); err != nil {
+		log.PrintfError("Could not change the role: %s", err)
+		return 1
+	}
+
+	log.Printf("Changed the role of %s to %s", args[1], role)
+	return 0
+}
+
+func runPushCommand(log *common.Logger, args []string) int {
+	if len(args) != 1 || args[0] != "vapid-key" {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	privateKey, publicKey, err := notify.GenerateVapidKey()
+	if err != nil {
+		log.PrintfError("Could not generate the key: %s", err)
+		return 1
+	}
+
+	// the public key is printed for reference, the api derives it and hands it out under /user/devices/vapid-public-key
+	fmt.Printf("PUSH_VAPID_PRIVATE_KEY=%s\n", privateKey)
+	fmt.Printf("# public key: %s\n", publicKey)
+	return 0
+}
+
+func runJobsCommand(cfg *common.Config, log *common.Logger, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	status := database.JobDead
+	switch args[0] {
+	case "list":
+		if len(args) > 2 {
+			fmt.Fprint(os.Stderr, usage)
+			return 2
+		}
+		if len(args) == 2 {
+			status = database.JobStatus(args[1])
+			if status != database.JobQueued && status != database.JobRunning && status != database.JobDead {
+				log.PrintfError("Unknown job status %q, expected %s, %s or %s", args[1], database.JobQueued, database.JobRunning, database.JobDead)
+				return 2
+			}
+		}
+	case "requeue":
+		if len(args) < 2 {
+			log.PrintfError("jobs requeue needs the ids of the jobs or --all")
+			return 2
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown jobs command %q\n\n%s", args[0], usage)
+		return 2
+	}
+
+	dbInst, err := database.NewDatabaseInst(cfg.DatabaseURL, &cfg.GormConfig, cfg.DatabaseOptions())
+	if err != nil {
+		log.PrintfError("Failed to connect to database: %s", err)
+		return 1
+	}
+	defer dbInst.Close()
+
+	repos := repository.NewGormRepositories(dbInst.GetClient())
+	ctx := context.Background()
+
+	if args[0] == "list" {
+		jobs, err := repos.Jobs.List(ctx, status, 0)
+		if err != nil {
+			log.PrintfError("Could not list the jobs: %s", err)
+			return 1
+		}
+
+		for _, job := range jobs {
+			lastError := ""
+			if job.LastError != nil {
+				lastError = *job.LastError
+			}
+			fmt.Printf("%s %-24s attempts %-3d run at %s %s\n", job.Id, job.Type, job.Attempts, job.RunAt.Format("2006-01-02 15:04:05"), lastError)
+		}
+		return 0
+	}
+
+	// without ids every dead job is requeued
+	var ids []string
+	if len(args) != 2 || args[1] != "--all" {
+		ids = args[1:]
+	}
+
+	requeued, err := repos.Jobs.Requeue(ctx, ids)
+	if err != nil {
+		log.PrintfError("Could not requeue the jobs: %s", err)
+		return 1
+	}
+
+	log.Printf("Requeued %d dead jobs", requeued)
+	if ids != nil && requeued < int64(len(ids)) {
+		log.PrintfWarning("%d of the jobs do not exist or are not dead", int64(len(ids))-requeued)
+		return 1
+	}
+	return 0
+}
+
+func runMigrateCommand(cfg *common.Config, log *common.Logger, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	dbInst, err := database.NewDatabaseInst(cfg.DatabaseURL, &cfg.GormConfig, cfg.DatabaseOptions())
+	if err != nil {
+		log.PrintfError("Failed to connect to database: %s", err)
+		return 1
+	}
+	defer dbInst.Close()
+
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		applied, err := dbInst.Migrate(ctx)
+		for _, migration := range applied {
+			log.Printf("Applied migration %d_%s", migration.Version, migration.Name)
+		}
+		if err != nil {
+			log.PrintfError("Migration failed: %s", err)
+			return 1
+		}
+		if len(applied) == 0 {
+			log.Printf("Database is up to date")
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				log.PrintfError("Invalid number of steps: %s", args[1])
+				return 2
+			}
+		}
+
+		reverted, err := dbInst.MigrateDown(ctx, steps)
+		for _, migration := range reverted {
+			log.Printf("Reverted migration %d_%s", migration.Version, migration.Name)
+		}
+		if err != nil {
+			log.PrintfError("Migration failed: %s", err)
+			return 1
+		}
+	case "status":
+		status, err := dbInst.MigrationStatus(ctx)
+		if err != nil {
+			log.PrintfError("Could not read migration status: %s", err)
+			return 1
+		}
+
+		for _, migration := range status {
+			state := "pending"
+			if migration.Dirty {
+				state = "dirty"
+			} else if migration.Applied {
+				state = "applied " + migration.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-30s %s\n", migration.Version, migration.Name, state)
+		}
+	case "force":
+		if len(args) < 2 {
+			log.PrintfError("migrate force needs a version")
+			return 2
+		}
+
+		version, err := strconv.ParseUint(args[1], 10, 32)
+		if err != nil {
+			log.PrintfError("Invalid version: %s", args[1])
+			return 2
+		}
+
+		if err := dbInst.MigrateForce(ctx, uint(version)); err != nil {
+			log.PrintfError("Could not force migration: %s", err)
+			return 1
+		}
+		log.Printf("Cleared dirty flag of migration %d", version)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown migrate command %q\n\n%s", args[0], usage)
+		return 2
+	}
+
+	return 0
+}
@@ -1,85 +1,571 @@
 package common
 
 import (
+	"easyflow-backend/src/database"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
 
+// Config is loaded in layers: the defaults below, then an optional yaml or toml file, then the environment.
+// Every field is set by the environment variable in its env tag, files use the same name in lower case
+// and may nest it in sections, e.g. `database: {url: ...}` sets DATABASE_URL.
+// Fields tagged with secret are redacted when the config is printed, secret:"url" only hides the password.
+// Fields tagged with reload are applied by RuntimeConfig.Reload while the server is running, the others need a restart.
 type Config struct {
 	// stage
-	Stage string
+	Stage string `env:"STAGE"`
 	// log level
-	LogLevel LogLevel
+	LogLevel LogLevel `env:"LOG_LEVEL" reload:"true"`
+	// config file watching, 0 only reloads on SIGHUP
+	ConfigWatchInterval time.Duration `env:"CONFIG_WATCH_INTERVAL"`
 	//gorm
 	GormConfig gorm.Config
 	//env
-	DatabaseURL string
-	SaltRounds  int
-	Port        string
-	DebugMode   bool
+	DatabaseURL    string `env:"DATABASE_URL" secret:"url"`
+	MigrateOnStart bool   `env:"MIGRATE_ON_START"`
+	// database pool and connect retries
+	DatabaseMaxOpenConns      int           `env:"DATABASE_MAX_OPEN_CONNS"`
+	DatabaseMaxIdleConns      int           `env:"DATABASE_MAX_IDLE_CONNS"`
+	DatabaseConnMaxLifetime   time.Duration `env:"DATABASE_CONN_MAX_LIFETIME"`
+	DatabaseConnMaxIdleTime   time.Duration `env:"DATABASE_CONN_MAX_IDLE_TIME"`
+	DatabaseReplicaURLs       []string      `env:"DATABASE_REPLICA_URLS" secret:"url"`
+	DatabaseConnectAttempts   int           `env:"DATABASE_CONNECT_ATTEMPTS"`
+	DatabaseBackoffInitial    time.Duration `env:"DATABASE_BACKOFF_INITIAL"`
+	DatabaseBackoffMax        time.Duration `env:"DATABASE_BACKOFF_MAX"`
+	DatabaseBackoffMultiplier float64       `env:"DATABASE_BACKOFF_MULTIPLIER"`
+	DatabaseBackoffJitter     float64       `env:"DATABASE_BACKOFF_JITTER"`
+	SaltRounds                int           `env:"SALT_OR_ROUNDS"`
+	Port                      string        `env:"PORT"`
+	DebugMode                 bool          `env:"DEBUG_MODE"`
 	//jwt
-	JwtSecret             string
-	JwtExpirationTime     int
-	RefreshExpirationTime int
+	JwtSecret             string `env:"JWT_SECRET" secret:"true"`
+	JwtExpirationTime     int    `env:"JWT_EXPIRATION_TIME"`     // seconds
+	RefreshExpirationTime int    `env:"REFRESH_EXPIRATION_TIME"` // seconds
 	// s3
-	BucketURL                string
-	BucketAccessKeyId        string
-	BucketSecret             string
-	ProfilePictureBucketName string
+	BucketURL                string `env:"BUCKET_URL"`
+	BucketAccessKeyId        string `env:"BUCKET_ACCESS_KEY_ID" secret:"true"`
+	BucketSecret             string `env:"BUCKET_SECRET" secret:"true"`
+	ProfilePictureBucketName string `env:"PROFILE_PICTURE_BUCKET_NAME"`
+	BucketUsePathStyle       bool   `env:"BUCKET_USE_PATH_STYLE"`
+	// object storage, the local driver keeps the buckets as directories and serves them with urls signed by the app
+	StorageDriver      string `env:"STORAGE_DRIVER"`
+	StorageLocalDir    string `env:"STORAGE_LOCAL_DIR"`
+	StorageLocalURL    string `env:"STORAGE_LOCAL_URL"` // public url of this server, the signed urls point to it
+	StorageLocalSecret string `env:"STORAGE_LOCAL_SECRET" secret:"true"`
+	// profile pictures
+	ProfilePictureContentTypes     []string      `env:"PROFILE_PICTURE_CONTENT_TYPES"`
+	ProfilePictureMaxSize          int           `env:"PROFILE_PICTURE_MAX_SIZE"` // bytes
+	ProfilePictureUploadExpiration time.Duration `env:"PROFILE_PICTURE_UPLOAD_EXPIRATION"`
+	ImageMinDimension              int           `env:"IMAGE_MIN_DIMENSION"` // pixels
+	ImageMaxDimension              int           `env:"IMAGE_MAX_DIMENSION"` // pixels
+	// chat pictures share the limits of the profile pictures, they are kept in the profile picture bucket if no own bucket is set
+	ChatPictureBucketName string `env:"CHAT_PICTURE_BUCKET_NAME"`
+	ChatPicturePrefix     string `env:"CHAT_PICTURE_PREFIX"`
+	// data export
+	ExportBucketName    string        `env:"EXPORT_BUCKET_NAME"`
+	ExportTimeout       time.Duration `env:"EXPORT_TIMEOUT"`
+	ExportURLExpiration time.Duration `env:"EXPORT_URL_EXPIRATION"`
+	// chat attachments
+	AttachmentBucketName         string        `env:"ATTACHMENT_BUCKET_NAME"`
+	AttachmentMaxSize            int           `env:"ATTACHMENT_MAX_SIZE"` // bytes
+	AttachmentUploadExpiration   time.Duration `env:"ATTACHMENT_UPLOAD_EXPIRATION"`
+	AttachmentDownloadExpiration time.Duration `env:"ATTACHMENT_DOWNLOAD_EXPIRATION"`
+	// malware scanning of confirmed uploads, the none driver marks them as clean right away
+	ScannerDriver       string        `env:"SCANNER_DRIVER"`
+	ScannerClamdAddress string        `env:"SCANNER_CLAMD_ADDRESS"` // host:port of clamd
+	ScannerTimeout      time.Duration `env:"SCANNER_TIMEOUT"`
 	// app
-	FrontendURL string
-	Domain      string
+	FrontendURL  string   `env:"FRONTEND_URL" reload:"true"` // comma separated, also the allowed cors origins
+	Domain       string   `env:"DOMAIN"`
+	FeatureFlags []string `env:"FEATURE_FLAGS" reload:"true"`
+	// data retention
+	RetentionInterval      time.Duration `env:"RETENTION_INTERVAL"`
+	RetentionGracePeriod   time.Duration `env:"RETENTION_GRACE_PERIOD"`
+	RetentionPurgeMessages bool          `env:"RETENTION_PURGE_MESSAGES"`
+	// background jobs, failed jobs are retried with a doubling pause and dead-lettered after the last attempt
+	JobWorkers         int           `env:"JOB_WORKERS"` // 0 disables the workers, jobs are still enqueued
+	JobPollInterval    time.Duration `env:"JOB_POLL_INTERVAL"`
+	JobLeaseDuration   time.Duration `env:"JOB_LEASE_DURATION"` // a job is cancelled and leased again once its lease is over
+	JobMaxAttempts     int           `env:"JOB_MAX_ATTEMPTS"`
+	JobRetryBackoff    time.Duration `env:"JOB_RETRY_BACKOFF"`
+	JobRetryMaxBackoff time.Duration `env:"JOB_RETRY_MAX_BACKOFF"`
+	// push notifications to members that are offline, a platform is enabled once its credentials are set
+	PushVapidPrivateKey    string        `env:"PUSH_VAPID_PRIVATE_KEY" secret:"true"` // base64url encoded P-256 key, `push vapid-key` generates one
+	PushVapidSubject       string        `env:"PUSH_VAPID_SUBJECT"`                   // mailto: or https: contact of the operator
+	PushWebPushHosts       []string      `env:"PUSH_WEBPUSH_HOSTS"`                   // push services browsers subscribe at, subdomains are included
+	PushFcmCredentialsFile string        `env:"PUSH_FCM_CREDENTIALS_FILE"`            // service account json of the firebase project
+	PushFcmURL             string        `env:"PUSH_FCM_URL"`
+	PushApnsKeyFile        string        `env:"PUSH_APNS_KEY_FILE"` // .p8 token signing key
+	PushApnsKeyId          string        `env:"PUSH_APNS_KEY_ID"`
+	PushApnsTeamId         string        `env:"PUSH_APNS_TEAM_ID"`
+	PushApnsTopic          string        `env:"PUSH_APNS_TOPIC"` // bundle id of the app
+	PushApnsURL            string        `env:"PUSH_APNS_URL"`
+	PushOnlineWindow       time.Duration `env:"PUSH_ONLINE_WINDOW"` // members with a request within the window are not notified
+	PushTimeout            time.Duration `env:"PUSH_TIMEOUT"`
+	// rate limiting, requests per second and burst per client ip
+	RateLimitEnabled     bool    `env:"RATE_LIMIT_ENABLED" reload:"true"`
+	RateLimitUserRate    float64 `env:"RATE_LIMIT_USER_RATE" reload:"true"`
+	RateLimitUserBurst   int     `env:"RATE_LIMIT_USER_BURST" reload:"true"`
+	RateLimitSignupRate  float64 `env:"RATE_LIMIT_SIGNUP_RATE" reload:"true"`
+	RateLimitSignupBurst int     `env:"RATE_LIMIT_SIGNUP_BURST" reload:"true"`
+	RateLimitAuthRate    float64 `env:"RATE_LIMIT_AUTH_RATE" reload:"true"`
+	RateLimitAuthBurst   int     `env:"RATE_LIMIT_AUTH_BURST" reload:"true"`
+	RateLimitChatRate    float64 `env:"RATE_LIMIT_CHAT_RATE" reload:"true"`
+	RateLimitChatBurst   int     `env:"RATE_LIMIT_CHAT_BURST" reload:"true"`
+	// access log
+	AccessLogSampleRate float64  `env:"ACCESS_LOG_SAMPLE_RATE"`
+	AccessLogSkipPaths  []string `env:"ACCESS_LOG_SKIP_PATHS"`
+	// security events, the file is an optional json lines sink next to the database
+	SecurityEventLogFile string `env:"SECURITY_EVENT_LOG_FILE"`
+	// metrics
+	MetricsAddr  string `env:"METRICS_ADDR"`
+	MetricsToken string `env:"METRICS_TOKEN" secret:"true"`
+	// tracing
+	TracingEndpoint   string  `env:"OTEL_EXPORTER_OTLP_ENDPOINT"`
+	TracingSampleRate float64 `env:"TRACING_SAMPLE_RATE"`
+	// health
+	ReadinessCheckBucket bool `env:"READINESS_CHECK_BUCKET"`
+	// server
+	ServerReadTimeout       time.Duration `env:"SERVER_READ_TIMEOUT"`
+	ServerReadHeaderTimeout time.Duration `env:"SERVER_READ_HEADER_TIMEOUT"`
+	ServerWriteTimeout      time.Duration `env:"SERVER_WRITE_TIMEOUT"`
+	ServerIdleTimeout       time.Duration `env:"SERVER_IDLE_TIMEOUT"`
+	ShutdownDelay           time.Duration `env:"SHUTDOWN_DELAY"`
+	ShutdownTimeout         time.Duration `env:"SHUTDOWN_TIMEOUT"`
 }
 
-func getEnv(key, fallback string) string {
-	if value, ok := os.LookupEnv(key); ok {
-		return value
+// defaultConfig returns the values that are used if neither the file nor the environment sets a field
+func defaultConfig() *Config {
+	return &Config{
+		GormConfig: gorm.Config{
+			Logger: logger.Default.LogMode(logger.Silent),
+		},
+		Stage:                          "development",
+		LogLevel:                       DEBUG,
+		ConfigWatchInterval:            5 * time.Second,
+		MigrateOnStart:                 true,
+		DatabaseMaxOpenConns:           25,
+		DatabaseMaxIdleConns:           10,
+		DatabaseConnMaxLifetime:        30 * time.Minute,
+		DatabaseConnMaxIdleTime:        5 * time.Minute,
+		DatabaseConnectAttempts:        10,
+		DatabaseBackoffInitial:         time.Second,
+		DatabaseBackoffMax:             30 * time.Second,
+		DatabaseBackoffMultiplier:      2,
+		DatabaseBackoffJitter:          0.2,
+		SaltRounds:                     10,
+		JwtSecret:                      insecureJwtSecret,
+		JwtExpirationTime:              60 * 10,          // 10 minutes
+		RefreshExpirationTime:          60 * 60 * 24 * 7, // 1 week
+		Port:                           "4000",
+		StorageDriver:                  StorageDriverS3,
+		StorageLocalDir:                "data/storage",
+		StorageLocalURL:                "http://localhost:4000",
+		ProfilePictureContentTypes:     []string{"image/jpeg", "image/png"},
+		ProfilePictureMaxSize:          5 << 20, // 5 MiB
+		ProfilePictureUploadExpiration: 15 * time.Minute,
+		ImageMinDimension:              64,
+		ImageMaxDimension:              4096,
+		ChatPicturePrefix:              "chats/",
+		ExportTimeout:                  10 * time.Minute,
+		ExportURLExpiration:            time.Hour,
+		AttachmentMaxSize:              25 << 20, // 25 MiB
+		AttachmentUploadExpiration:     15 * time.Minute,
+		AttachmentDownloadExpiration:   5 * time.Minute,
+		ScannerDriver:                  ScannerDriverNone,
+		ScannerClamdAddress:            "localhost:3310",
+		ScannerTimeout:                 time.Minute,
+		FrontendURL:                    "http://localhost:3000",
+		Domain:                         "localhost",
+		RetentionInterval:              time.Hour,
+		RetentionGracePeriod:           30 * 24 * time.Hour,
+		JobWorkers:                     4,
+		JobPollInterval:                time.Second,
+		JobLeaseDuration:               5 * time.Minute,
+		JobMaxAttempts:                 5,
+		JobRetryBackoff:                30 * time.Second,
+		JobRetryMaxBackoff:             time.Hour,
+		PushWebPushHosts:               []string{"fcm.googleapis.com", "push.services.mozilla.com", "push.apple.com", "notify.windows.com"},
+		PushFcmURL:                     "https://fcm.googleapis.com",
+		PushApnsURL:                    "https://api.push.apple.com",
+		PushOnlineWindow:               time.Minute,
+		PushTimeout:                    10 * time.Second,
+		RateLimitEnabled:               true,
+		RateLimitUserRate:              1,
+		RateLimitUserBurst:             4,
+		RateLimitSignupRate:            1,
+		RateLimitSignupBurst:           1,
+		RateLimitAuthRate:              1,
+		RateLimitAuthBurst:             2,
+		RateLimitChatRate:              1,
+		RateLimitChatBurst:             5,
+		AccessLogSampleRate:            1,
+		AccessLogSkipPaths:             []string{"/healthz", "/readyz", "/metrics"},
+		TracingSampleRate:              1,
+		ServerReadTimeout:              15 * time.Second,
+		ServerReadHeaderTimeout:        5 * time.Second,
+		ServerWriteTimeout:             30 * time.Second,
+		ServerIdleTimeout:              2 * time.Minute,
+		ShutdownTimeout:                20 * time.Second,
 	}
-	return fallback
 }
 
-func getEnvInt(key string, fallback int) int {
-	if value, ok := os.LookupEnv(key); ok {
-		if i, err := strconv.Atoi(value); err == nil {
-			return i
+// LoadConfig loads the defaults, the config file at path if it is not empty and the environment including the .env file.
+// Every value that can not be parsed is reported, the returned error lists all of them.
+func LoadConfig(path string) (*Config, error) {
+	if err := godotenv.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("could not load .env file: %w", err)
+	}
+
+	cfg := defaultConfig()
+	var errs []error
+
+	if path != "" {
+		values, err := readConfigFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		known := map[string]bool{}
+		for _, field := range configFields(cfg) {
+			key := strings.ToLower(field.env)
+			known[key] = true
+			if value, ok := values[key]; ok {
+				if err := field.set(value); err != nil {
+					errs = append(errs, fmt.Errorf("%s in %s: %w", key, path, err))
+				}
+			}
+		}
+		for key := range values {
+			if !known[key] {
+				errs = append(errs, fmt.Errorf("%s in %s: unknown setting", key, path))
+			}
+		}
+	}
+
+	for _, field := range configFields(cfg) {
+		value, ok := os.LookupEnv(field.env)
+		// an empty variable only clears strings and lists, other types keep their value
+		if !ok || (value == "" && field.value.Kind() != reflect.String && field.value.Kind() != reflect.Slice) {
+			continue
+		}
+		if err := field.set(value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", field.env, err))
 		}
 	}
-	return fallback
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
 }
 
-// LoadDefaultConfig loads the default configuration values.
-// It reads the environment variables from the .env file, if present,
-// and returns a Config struct with the loaded values.
-func LoadDefaultConfig() *Config {
-	err := godotenv.Load()
+// readConfigFile returns the settings of a yaml or toml file with nested sections joined by underscores
+func readConfigFile(path string) (map[string]string, error) {
+	content, err := os.ReadFile(path)
 	if err != nil {
-		fmt.Println("Error loading .env file: ", err)
+		return nil, fmt.Errorf("could not read config file: %w", err)
 	}
 
-	return &Config{
-		GormConfig: gorm.Config{
-			Logger:                                   logger.Default.LogMode(logger.Silent),
-			DisableForeignKeyConstraintWhenMigrating: true,
+	var raw map[string]any
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &raw)
+	case ".toml":
+		err = toml.Unmarshal(content, &raw)
+	default:
+		return nil, fmt.Errorf("unsupported config file %s, use .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not parse config file %s: %w", path, err)
+	}
+
+	values := map[string]string{}
+	flattenConfig("", raw, values)
+	return values, nil
+}
+
+func flattenConfig(prefix string, raw map[string]any, values map[string]string) {
+	for key, value := range raw {
+		key = strings.ToLower(key)
+		if prefix != "" {
+			key = prefix + "_" + key
+		}
+
+		switch value := value.(type) {
+		case map[string]any:
+			flattenConfig(key, value, values)
+		case []any:
+			entries := make([]string, 0, len(value))
+			for _, entry := range value {
+				entries = append(entries, fmt.Sprint(entry))
+			}
+			values[key] = strings.Join(entries, ",")
+		case nil:
+			values[key] = ""
+		default:
+			values[key] = fmt.Sprint(value)
+		}
+	}
+}
+
+type configField struct {
+	env    string
+	secret string
+	reload bool
+	value  reflect.Value
+}
+
+// configFields returns every field of cfg that has an env tag in declaration order
+func configFields(cfg *Config) []configField {
+	v := reflect.ValueOf(cfg).Elem()
+	t := v.Type()
+
+	var fields []configField
+	for i := range t.NumField() {
+		env, ok := t.Field(i).Tag.Lookup("env")
+		if !ok {
+			continue
+		}
+		fields = append(fields, configField{
+			env:    env,
+			secret: t.Field(i).Tag.Get("secret"),
+			reload: t.Field(i).Tag.Get("reload") == "true",
+			value:  v.Field(i),
+		})
+	}
+	return fields
+}
+
+func (f configField) set(raw string) error {
+	raw = strings.TrimSpace(raw)
+
+	if f.value.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration like 30s or 5m", raw)
+		}
+		f.value.SetInt(int64(d))
+		return nil
+	}
+
+	switch f.value.Kind() {
+	case reflect.String:
+		f.value.SetString(raw)
+	case reflect.Int:
+		i, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", raw)
+		}
+		f.value.SetInt(int64(i))
+	case reflect.Float64:
+		fl, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", raw)
+		}
+		f.value.SetFloat(fl)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", raw)
+		}
+		f.value.SetBool(b)
+	case reflect.Slice:
+		var list []string
+		for _, entry := range strings.Split(raw, ",") {
+			if entry = strings.TrimSpace(entry); entry != "" {
+				list = append(list, entry)
+			}
+		}
+		f.value.Set(reflect.ValueOf(list))
+	default:
+		return fmt.Errorf("unsupported type %s", f.value.Type())
+	}
+	return nil
+}
+
+// Print writes the effective config as yaml that can be used as a config file, secrets are redacted
+func (cfg *Config) Print(w io.Writer) error {
+	doc := &yaml.Node{Kind: yaml.MappingNode}
+	for _, field := range configFields(cfg) {
+		key := &yaml.Node{Kind: yaml.ScalarNode, Value: strings.ToLower(field.env)}
+
+		var value yaml.Node
+		if err := value.Encode(printableValue(field)); err != nil {
+			return err
+		}
+		doc.Content = append(doc.Content, key, &value)
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+func printableValue(field configField) any {
+	if d, ok := field.value.Interface().(time.Duration); ok {
+		return d.String()
+	}
+
+	switch field.secret {
+	case "true":
+		if field.value.String() != "" {
+			return "[redacted]"
+		}
+	case "url":
+		if list, ok := field.value.Interface().([]string); ok {
+			redacted := make([]string, 0, len(list))
+			for _, entry := range list {
+				redacted = append(redacted, redactURL(entry))
+			}
+			return redacted
+		}
+		return redactURL(field.value.String())
+	}
+
+	if field.value.Kind() == reflect.String {
+		return field.value.String()
+	}
+	return field.value.Interface()
+}
+
+// redactURL hides the password of a database url or go-sql-driver dsn, user:password@host becomes user:[redacted]@host
+func redactURL(url string) string {
+	at := strings.LastIndex(url, "@")
+	if at < 0 {
+		return url
+	}
+
+	credentials := url[:at]
+	start := 0
+	if scheme := strings.Index(credentials, "://"); scheme >= 0 {
+		start = scheme + len("://")
+	}
+
+	colon := strings.Index(credentials[start:], ":")
+	if colon < 0 {
+		return url
+	}
+
+	return url[:start+colon+1] + "[redacted]" + url[at:]
+}
+
+// the drivers of STORAGE_DRIVER
+const (
+	StorageDriverS3    = "s3"
+	StorageDriverLocal = "local"
+)
+
+// the drivers of SCANNER_DRIVER
+const (
+	ScannerDriverNone  = "none"
+	ScannerDriverClamd = "clamd"
+)
+
+// RateLimitScope names a group of endpoints that share a rate limit
+type RateLimitScope string
+
+const (
+	RateLimitUser   RateLimitScope = "user"
+	RateLimitSignup RateLimitScope = "signup"
+	RateLimitAuth   RateLimitScope = "auth"
+	RateLimitChat   RateLimitScope = "chat"
+)
+
+// RateLimit returns the requests per second and the burst of a scope
+func (cfg *Config) RateLimit(scope RateLimitScope) (float64, int) {
+	switch scope {
+	case RateLimitSignup:
+		return cfg.RateLimitSignupRate, cfg.RateLimitSignupBurst
+	case RateLimitAuth:
+		return cfg.RateLimitAuthRate, cfg.RateLimitAuthBurst
+	case RateLimitChat:
+		return cfg.RateLimitChatRate, cfg.RateLimitChatBurst
+	default:
+		return cfg.RateLimitUserRate, cfg.RateLimitUserBurst
+	}
+}
+
+// FeatureEnabled reports whether the feature flag is listed in FEATURE_FLAGS
+func (cfg *Config) FeatureEnabled(name string) bool {
+	return slices.Contains(cfg.FeatureFlags, name)
+}
+
+// ChatPictureBucket returns CHAT_PICTURE_BUCKET_NAME, or the profile picture bucket if it is not set
+func (cfg *Config) ChatPictureBucket() string {
+	if cfg.ChatPictureBucketName != "" {
+		return cfg.ChatPictureBucketName
+	}
+	return cfg.ProfilePictureBucketName
+}
+
+// ChatPictureKey returns the key the pictures of a chat are stored below, each picture gets a new key of its own
+func (cfg *Config) ChatPictureKey(chatId string) string {
+	return cfg.ChatPicturePrefix + chatId
+}
+
+// PushPlatformEnabled reports whether the credentials of the push platform are set
+func (cfg *Config) PushPlatformEnabled(platform database.PushPlatform) bool {
+	switch platform {
+	case database.PushWeb:
+		return cfg.PushVapidPrivateKey != ""
+	case database.PushFCM:
+		return cfg.PushFcmCredentialsFile != ""
+	case database.PushAPNs:
+		return cfg.PushApnsKeyFile != ""
+	default:
+		return false
+	}
+}
+
+// PushEnabled reports whether any push platform is enabled
+func (cfg *Config) PushEnabled() bool {
+	return cfg.PushPlatformEnabled(database.PushWeb) || cfg.PushPlatformEnabled(database.PushFCM) || cfg.PushPlatformEnabled(database.PushAPNs)
+}
+
+// CorsOrigins returns the origins in FRONTEND_URL
+func (cfg *Config) CorsOrigins() []string {
+	var origins []string
+	for _, origin := range strings.Split(cfg.FrontendURL, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	return origins
+}
+
+// DatabaseOptions returns the pool, retry and replica settings for database.NewDatabaseInst and database.Connect
+func (cfg *Config) DatabaseOptions() database.Options {
+	return database.Options{
+		MaxOpenConns:    cfg.DatabaseMaxOpenConns,
+		MaxIdleConns:    cfg.DatabaseMaxIdleConns,
+		ConnMaxLifetime: cfg.DatabaseConnMaxLifetime,
+		ConnMaxIdleTime: cfg.DatabaseConnMaxIdleTime,
+		ReplicaURLs:     cfg.DatabaseReplicaURLs,
+		Retry: database.RetryOptions{
+			MaxAttempts:     cfg.DatabaseConnectAttempts,
+			InitialInterval: cfg.DatabaseBackoffInitial,
+			MaxInterval:     cfg.DatabaseBackoffMax,
+			Multiplier:      cfg.DatabaseBackoffMultiplier,
+			Jitter:          cfg.DatabaseBackoffJitter,
 		},
-		Stage:                    getEnv("STAGE", "development"),
-		LogLevel:                 LogLevel(getEnv("LOG_LEVEL", "DEBUG")),
-		DatabaseURL:              getEnv("DATABASE_URL", ""),
-		SaltRounds:               getEnvInt("SALT_OR_ROUNDS", 10),
-		JwtSecret:                getEnv("JWT_SECRET", "public_secret"),
-		JwtExpirationTime:        getEnvInt("JWT_EXPIRATION_TIME", 60*10),          // 10 minutes
-		RefreshExpirationTime:    getEnvInt("REFRESH_EXPIRATION_TIME", 60*60*24*7), // 1 week
-		Port:                     getEnv("PORT", "4000"),
-		DebugMode:                getEnv("DEBUG_MODE", "false") == "true",
-		BucketURL:                getEnv("BUCKET_URL", ""),
-		BucketAccessKeyId:        getEnv("BUCKET_ACCESS_KEY_ID", ""),
-		BucketSecret:             getEnv("BUCKET_SECRET", ""),
-		ProfilePictureBucketName: getEnv("PROFILE_PICTURE_BUCKET_NAME", ""),
-		FrontendURL:              getEnv("FRONTEND_URL", "http://localhost:3000"),
-		Domain:                   getEnv("DOMAIN", "localhost"),
 	}
 }
@@ -2,11 +2,12 @@ package common
 
 import (
 	"easyflow-backend/src/api"
+	"easyflow-backend/src/repository"
 	"fmt"
+	"reflect"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
-	"gorm.io/gorm"
 )
 
 type AnyStruct struct{}
@@ -18,6 +19,11 @@ func getPayload[T any](c *gin.Context) (*T, error) {
 		return nil, nil
 	}
 
+	// guards and handlers without a payload use any, the body is left untouched for the next handler
+	if reflect.TypeFor[T]().Kind() == reflect.Interface {
+		return nil, nil
+	}
+
 	if err := c.ShouldBind(&payload); err != nil {
 		return nil, err
 	}
@@ -29,18 +35,18 @@ func getPayload[T any](c *gin.Context) (*T, error) {
 	return &payload, nil
 }
 
-func getDatabse(c *gin.Context) (*gorm.DB, error) {
-	raw_db, ok := c.Get("db")
+func getRepositories(c *gin.Context) (*repository.Repositories, error) {
+	raw_repos, ok := c.Get("repositories")
 	if !ok {
-		return nil, fmt.Errorf("database not found in context")
+		return nil, fmt.Errorf("repositories not found in context")
 	}
 
-	db, ok := raw_db.(*gorm.DB)
+	repos, ok := raw_repos.(*repository.Repositories)
 	if !ok {
-		return nil, fmt.Errorf("type assertion to *gorm.DB failed")
+		return nil, fmt.Errorf("type assertion to *repository.Repositories failed")
 	}
 
-	return db, nil
+	return repos, nil
 }
 
 func getConfig(c *gin.Context) (*Config, error) {
@@ -71,14 +77,14 @@ func getLogger(c *gin.Context) (*Logger, error) {
 	return logger, nil
 }
 
-func SetupEndpoint[T any](c *gin.Context) (*T, *Logger, *gorm.DB, *Config, []string) {
+func SetupEndpoint[T any](c *gin.Context) (*T, *Logger, *repository.Repositories, *Config, []string) {
 	var errors []error
 	payload, err := getPayload[T](c)
 	if err != nil {
 		errors = append(errors, err)
 	}
 
-	db, err := getDatabse(c)
+	repos, err := getRepositories(c)
 	if err != nil {
 		errors = append(errors, err)
 	}
@@ -104,5 +110,5 @@ func SetupEndpoint[T any](c *gin.Context) (*T, *Logger, *gorm.DB, *Config, []str
 		}
 	}
 
-	return payload, logger, db, cfg, serializableErrors
+	return payload, logger, repos, cfg, serializableErrors
 }
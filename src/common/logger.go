@@ -38,7 +38,7 @@ type Logger struct {
 	Target   io.Writer
 	Module   atomic.Value
 	C        *gin.Context
-	logLevel LogLevel
+	logLevel atomic.Value
 }
 
 //GENERAL SCHEMA:
@@ -46,14 +46,23 @@ type Logger struct {
 
 func NewLogger(target io.Writer, module string, c *gin.Context, logLevel LogLevel) *Logger {
 	logger := &Logger{
-		Target:   target,
-		C:        c,
-		logLevel: logLevel,
+		Target: target,
+		C:      c,
 	}
 	logger.Module.Store(module)
+	logger.logLevel.Store(logLevel)
 	return logger
 }
 
+// SetLogLevel changes the level of a long living logger, e.g. after the config was reloaded
+func (l *Logger) SetLogLevel(logLevel LogLevel) {
+	l.logLevel.Store(logLevel)
+}
+
+func (l *Logger) level() LogLevel {
+	return l.logLevel.Load().(LogLevel)
+}
+
 func (l *Logger) SetPrefix(prefix string) {
 	l.Module.Store(prefix)
 }
@@ -99,7 +108,7 @@ func (l *Logger) PrintfError(format string, args ...interface{}) {
 }
 
 func (l *Logger) PrintfWarning(format string, args ...interface{}) {
-	if l.logLevel == LogLevel(WARNING) || l.logLevel == LogLevel(INFO) || l.logLevel == LogLevel(DEBUG) {
+	if level := l.level(); level == WARNING || level == INFO || level == DEBUG {
 		l.LogMutex.Lock()
 		defer l.LogMutex.Unlock()
 
@@ -110,7 +119,7 @@ func (l *Logger) PrintfWarning(format string, args ...interface{}) {
 }
 
 func (l *Logger) PrintfInfo(format string, args ...interface{}) {
-	if l.logLevel == LogLevel(INFO) || l.logLevel == LogLevel(DEBUG) {
+	if level := l.level(); level == INFO || level == DEBUG {
 		l.LogMutex.Lock()
 		defer l.LogMutex.Unlock()
 
@@ -121,7 +130,7 @@ func (l *Logger) PrintfInfo(format string, args ...interface{}) {
 }
 
 func (l *Logger) PrintfDebug(format string, args ...interface{}) {
-	if l.logLevel == LogLevel(DEBUG) {
+	if l.level() == DEBUG {
 		l.LogMutex.Lock()
 		defer l.LogMutex.Unlock()
 
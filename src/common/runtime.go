@@ -0,0 +1,153 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// RuntimeConfig holds the config of the running server. Readers get an immutable snapshot with Load,
+// Reload swaps in a new snapshot in which only the fields tagged with reload differ from the old one.
+type RuntimeConfig struct {
+	path    string
+	current atomic.Pointer[Config]
+	// modification time of the config file when it was last seen by Watch, only used by the Watch goroutine
+	lastModified time.Time
+
+	// serializes reloads and guards the listeners
+	mu        sync.Mutex
+	listeners []func(*Config)
+}
+
+// ConfigChanges describes the outcome of a reload
+type ConfigChanges struct {
+	// Applied lists the reloaded settings as "NAME: old -> new", secrets are redacted
+	Applied []string
+	// Ignored lists the settings that changed but only take effect after a restart
+	Ignored []string
+}
+
+// NewRuntimeConfig wraps the config that was loaded from path on startup
+func NewRuntimeConfig(cfg *Config, path string) *RuntimeConfig {
+	r := &RuntimeConfig{path: path}
+	r.current.Store(cfg)
+	r.lastModified = r.modified()
+	return r
+}
+
+// Load returns the current config, it must not be modified
+func (r *RuntimeConfig) Load() *Config {
+	return r.current.Load()
+}
+
+// OnReload registers fn to be called with the new config after every reload that applied a change
+func (r *RuntimeConfig) OnReload(fn func(*Config)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.listeners = append(r.listeners, fn)
+}
+
+// Reload loads and validates the config again. The current config is kept if the new one is invalid.
+func (r *RuntimeConfig) Reload() (ConfigChanges, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	loaded, err := LoadConfig(r.path)
+	if err != nil {
+		return ConfigChanges{}, err
+	}
+	if err := loaded.Validate(); err != nil {
+		return ConfigChanges{}, err
+	}
+
+	current := r.Load()
+	next := *current
+
+	var changes ConfigChanges
+	currentFields, nextFields, loadedFields := configFields(current), configFields(&next), configFields(loaded)
+	for i, field := range currentFields {
+		if reflect.DeepEqual(field.value.Interface(), loadedFields[i].value.Interface()) {
+			continue
+		}
+		if !field.reload {
+			changes.Ignored = append(changes.Ignored, field.env)
+			continue
+		}
+
+		nextFields[i].value.Set(loadedFields[i].value)
+		changes.Applied = append(changes.Applied, fmt.Sprintf("%s: %v -> %v", field.env, printableValue(field), printableValue(loadedFields[i])))
+	}
+
+	if len(changes.Applied) > 0 {
+		r.current.Store(&next)
+		for _, fn := range r.listeners {
+			fn(&next)
+		}
+	}
+
+	return changes, nil
+}
+
+// Watch reloads the config on SIGHUP and whenever the config file changes until ctx is cancelled.
+// The file is polled every CONFIG_WATCH_INTERVAL, the environment can not change while the process runs.
+func (r *RuntimeConfig) Watch(ctx context.Context, log *Logger) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	var poll <-chan time.Time
+	if interval := r.Load().ConfigWatchInterval; r.path != "" && interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			log.Printf("Received SIGHUP, reloading the config")
+		case <-poll:
+			modified := r.modified()
+			if modified.Equal(r.lastModified) {
+				continue
+			}
+			r.lastModified = modified
+			log.Printf("Config file %s changed, reloading the config", r.path)
+		}
+
+		changes, err := r.Reload()
+		if err != nil {
+			log.PrintfError("Could not reload the config, keeping the current one:\n%s", err)
+			continue
+		}
+		for _, change := range changes.Applied {
+			log.Printf("Reloaded %s", change)
+		}
+		if len(changes.Applied) == 0 {
+			log.Printf("Config reloaded without changes")
+		}
+		for _, env := range changes.Ignored {
+			log.PrintfWarning("%s changed but only takes effect after a restart", env)
+		}
+	}
+}
+
+// modified returns the modification time of the config file, the zero time if there is none
+func (r *RuntimeConfig) modified() time.Time {
+	if r.path == "" {
+		return time.Time{}
+	}
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
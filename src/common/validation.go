@@ -0,0 +1,257 @@
+package common
+
+import (
+	"easyflow-backend/src/imaging"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// insecureJwtSecret is the development default, it must never sign tokens in production
+const insecureJwtSecret = "public_secret"
+
+// minJwtSecretLength is the minimum length of the jwt secret in production, 32 bytes match the HS256 key size
+const minJwtSecretLength = 32
+
+// Validate checks the config for missing and inconsistent values, the returned error lists every problem
+func (cfg *Config) Validate() error {
+	var errs []error
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	production := cfg.Stage == "production"
+
+	switch cfg.LogLevel {
+	case DEBUG, INFO, WARNING, ERROR:
+	default:
+		fail("LOG_LEVEL must be one of DEBUG, INFO, WARNING or ERROR, got %q", cfg.LogLevel)
+	}
+
+	if cfg.DatabaseURL == "" {
+		fail("DATABASE_URL is required")
+	}
+	if cfg.DatabaseMaxOpenConns < 0 || cfg.DatabaseMaxIdleConns < 0 {
+		fail("DATABASE_MAX_OPEN_CONNS and DATABASE_MAX_IDLE_CONNS must not be negative")
+	}
+	if cfg.DatabaseMaxOpenConns > 0 && cfg.DatabaseMaxIdleConns > cfg.DatabaseMaxOpenConns {
+		fail("DATABASE_MAX_IDLE_CONNS (%d) must not exceed DATABASE_MAX_OPEN_CONNS (%d)", cfg.DatabaseMaxIdleConns, cfg.DatabaseMaxOpenConns)
+	}
+	if cfg.DatabaseConnectAttempts < 0 {
+		fail("DATABASE_CONNECT_ATTEMPTS must not be negative")
+	}
+	if cfg.DatabaseBackoffInitial <= 0 || cfg.DatabaseBackoffMax < cfg.DatabaseBackoffInitial {
+		fail("DATABASE_BACKOFF_INITIAL must be positive and not exceed DATABASE_BACKOFF_MAX")
+	}
+	if cfg.DatabaseBackoffMultiplier < 1 {
+		fail("DATABASE_BACKOFF_MULTIPLIER must be at least 1, got %g", cfg.DatabaseBackoffMultiplier)
+	}
+	if cfg.DatabaseBackoffJitter < 0 || cfg.DatabaseBackoffJitter > 1 {
+		fail("DATABASE_BACKOFF_JITTER must be between 0 and 1, got %g", cfg.DatabaseBackoffJitter)
+	}
+
+	if cfg.SaltRounds < bcrypt.MinCost || cfg.SaltRounds > bcrypt.MaxCost {
+		fail("SALT_OR_ROUNDS must be between %d and %d, got %d", bcrypt.MinCost, bcrypt.MaxCost, cfg.SaltRounds)
+	}
+	if port, err := strconv.Atoi(cfg.Port); err != nil || port < 1 || port > 65535 {
+		fail("PORT must be a port number, got %q", cfg.Port)
+	}
+
+	if cfg.JwtSecret == "" {
+		fail("JWT_SECRET is required")
+	} else if production && cfg.JwtSecret == insecureJwtSecret {
+		fail("JWT_SECRET must be changed from the development default in production")
+	} else if production && len(cfg.JwtSecret) < minJwtSecretLength {
+		fail("JWT_SECRET must be at least %d characters in production", minJwtSecretLength)
+	}
+	if cfg.JwtExpirationTime <= 0 || cfg.RefreshExpirationTime <= 0 {
+		fail("JWT_EXPIRATION_TIME and REFRESH_EXPIRATION_TIME must be positive")
+	}
+	if cfg.RefreshExpirationTime < cfg.JwtExpirationTime {
+		fail("REFRESH_EXPIRATION_TIME must not be shorter than JWT_EXPIRATION_TIME")
+	}
+
+	// the bucket names are directories of the local driver, only s3 needs the endpoint and credentials
+	buckets := []struct{ key, value string }{
+		{"PROFILE_PICTURE_BUCKET_NAME", cfg.ProfilePictureBucketName},
+		{"EXPORT_BUCKET_NAME", cfg.ExportBucketName},
+		{"ATTACHMENT_BUCKET_NAME", cfg.AttachmentBucketName},
+	}
+	switch cfg.StorageDriver {
+	case StorageDriverS3:
+		buckets = append(buckets, []struct{ key, value string }{
+			{"BUCKET_URL", cfg.BucketURL},
+			{"BUCKET_ACCESS_KEY_ID", cfg.BucketAccessKeyId},
+			{"BUCKET_SECRET", cfg.BucketSecret},
+		}...)
+	case StorageDriverLocal:
+		buckets = append(buckets, []struct{ key, value string }{
+			{"STORAGE_LOCAL_DIR", cfg.StorageLocalDir},
+			{"STORAGE_LOCAL_URL", cfg.StorageLocalURL},
+			{"STORAGE_LOCAL_SECRET", cfg.StorageLocalSecret},
+		}...)
+		if localURL, err := url.Parse(cfg.StorageLocalURL); cfg.StorageLocalURL != "" && (err != nil || localURL.Host == "" || (localURL.Scheme != "http" && localURL.Scheme != "https")) {
+			fail("STORAGE_LOCAL_URL must be an absolute http or https url, got %q", cfg.StorageLocalURL)
+		}
+		if production && cfg.StorageLocalSecret != "" && len(cfg.StorageLocalSecret) < minJwtSecretLength {
+			fail("STORAGE_LOCAL_SECRET must be at least %d characters in production", minJwtSecretLength)
+		}
+	default:
+		fail("STORAGE_DRIVER must be %s or %s, got %q", StorageDriverS3, StorageDriverLocal, cfg.StorageDriver)
+	}
+	var missing []string
+	for _, setting := range buckets {
+		if setting.value == "" {
+			missing = append(missing, setting.key)
+		}
+	}
+	if len(missing) > 0 {
+		fail("bucket config is incomplete, missing %s", strings.Join(missing, ", "))
+	}
+	// the keys of profile pictures are user ids, a prefix keeps chat pictures in a shared bucket apart from them
+	if cfg.ChatPictureBucketName == "" && cfg.ChatPicturePrefix == "" {
+		fail("CHAT_PICTURE_PREFIX must not be empty when chat pictures share PROFILE_PICTURE_BUCKET_NAME")
+	}
+	if cfg.ExportTimeout <= 0 || cfg.ExportURLExpiration <= 0 {
+		fail("EXPORT_TIMEOUT and EXPORT_URL_EXPIRATION must be positive")
+	}
+	if len(cfg.ProfilePictureContentTypes) == 0 {
+		fail("PROFILE_PICTURE_CONTENT_TYPES must not be empty")
+	}
+	for _, contentType := range cfg.ProfilePictureContentTypes {
+		if !imaging.Decodable(contentType) {
+			fail("PROFILE_PICTURE_CONTENT_TYPES contains %q which can not be processed", contentType)
+		}
+	}
+	if cfg.ProfilePictureMaxSize <= 0 {
+		fail("PROFILE_PICTURE_MAX_SIZE must be positive")
+	}
+	if cfg.ImageMinDimension < 1 || cfg.ImageMaxDimension < cfg.ImageMinDimension {
+		fail("IMAGE_MIN_DIMENSION must be positive and not larger than IMAGE_MAX_DIMENSION")
+	}
+	if cfg.AttachmentMaxSize <= 0 {
+		fail("ATTACHMENT_MAX_SIZE must be positive")
+	}
+	switch cfg.ScannerDriver {
+	case ScannerDriverNone:
+	case ScannerDriverClamd:
+		if _, _, err := net.SplitHostPort(cfg.ScannerClamdAddress); err != nil {
+			fail("SCANNER_CLAMD_ADDRESS must be a host:port, got %q", cfg.ScannerClamdAddress)
+		}
+		if cfg.ScannerTimeout <= 0 {
+			fail("SCANNER_TIMEOUT must be positive")
+		}
+	default:
+		fail("SCANNER_DRIVER must be %s or %s, got %q", ScannerDriverNone, ScannerDriverClamd, cfg.ScannerDriver)
+	}
+	// presigned urls can not be valid for longer than a week
+	for _, setting := range []struct {
+		key   string
+		value time.Duration
+	}{
+		{"PROFILE_PICTURE_UPLOAD_EXPIRATION", cfg.ProfilePictureUploadExpiration},
+		{"ATTACHMENT_UPLOAD_EXPIRATION", cfg.AttachmentUploadExpiration},
+		{"ATTACHMENT_DOWNLOAD_EXPIRATION", cfg.AttachmentDownloadExpiration},
+	} {
+		if setting.value < time.Second || setting.value > 7*24*time.Hour {
+			fail("%s must be between 1s and 168h, got %s", setting.key, setting.value)
+		}
+	}
+
+	if cfg.FrontendURL == "" {
+		fail("FRONTEND_URL is required")
+	} else if slices.Contains(cfg.CorsOrigins(), "*") {
+		// cors credentials can not be combined with a wildcard origin
+		fail("FRONTEND_URL must list the origins explicitly instead of *")
+	}
+	if cfg.Domain == "" {
+		fail("DOMAIN is required")
+	}
+
+	if cfg.RetentionInterval < 0 || cfg.RetentionGracePeriod < 0 {
+		fail("RETENTION_INTERVAL and RETENTION_GRACE_PERIOD must not be negative")
+	}
+	if cfg.JobWorkers < 0 {
+		fail("JOB_WORKERS must not be negative")
+	}
+	if cfg.JobPollInterval <= 0 || cfg.JobLeaseDuration <= 0 {
+		fail("JOB_POLL_INTERVAL and JOB_LEASE_DURATION must be positive")
+	}
+	if cfg.JobMaxAttempts < 1 {
+		fail("JOB_MAX_ATTEMPTS must be at least 1")
+	}
+	if cfg.JobRetryBackoff <= 0 || cfg.JobRetryMaxBackoff < cfg.JobRetryBackoff {
+		fail("JOB_RETRY_BACKOFF must be positive and not larger than JOB_RETRY_MAX_BACKOFF")
+	}
+	if cfg.PushVapidPrivateKey != "" {
+		if key, err := base64.RawURLEncoding.DecodeString(cfg.PushVapidPrivateKey); err != nil || len(key) != 32 {
+			fail("PUSH_VAPID_PRIVATE_KEY must be a base64url encoded P-256 private key")
+		}
+		if !strings.HasPrefix(cfg.PushVapidSubject, "mailto:") && !strings.HasPrefix(cfg.PushVapidSubject, "https://") {
+			fail("PUSH_VAPID_SUBJECT must be a mailto: or https: url when PUSH_VAPID_PRIVATE_KEY is set")
+		}
+		if len(cfg.PushWebPushHosts) == 0 {
+			fail("PUSH_WEBPUSH_HOSTS must list the push services of the browsers when PUSH_VAPID_PRIVATE_KEY is set")
+		}
+	}
+	if cfg.PushApnsKeyFile != "" || cfg.PushApnsKeyId != "" || cfg.PushApnsTeamId != "" || cfg.PushApnsTopic != "" {
+		if cfg.PushApnsKeyFile == "" || cfg.PushApnsKeyId == "" || cfg.PushApnsTeamId == "" || cfg.PushApnsTopic == "" {
+			fail("apns config is incomplete, PUSH_APNS_KEY_FILE, PUSH_APNS_KEY_ID, PUSH_APNS_TEAM_ID and PUSH_APNS_TOPIC are required")
+		}
+	}
+	for _, setting := range []struct {
+		key   string
+		value string
+	}{
+		{"PUSH_FCM_URL", cfg.PushFcmURL},
+		{"PUSH_APNS_URL", cfg.PushApnsURL},
+	} {
+		if pushURL, err := url.Parse(setting.value); err != nil || pushURL.Host == "" || (pushURL.Scheme != "http" && pushURL.Scheme != "https") {
+			fail("%s must be an http or https url, got %q", setting.key, setting.value)
+		}
+	}
+	if cfg.PushOnlineWindow <= 0 || cfg.PushTimeout <= 0 {
+		fail("PUSH_ONLINE_WINDOW and PUSH_TIMEOUT must be positive")
+	}
+
+	for _, scope := range []RateLimitScope{RateLimitUser, RateLimitSignup, RateLimitAuth, RateLimitChat} {
+		if limit, burst := cfg.RateLimit(scope); limit <= 0 || burst < 1 {
+			name := strings.ToUpper(string(scope))
+			fail("RATE_LIMIT_%s_RATE must be positive and RATE_LIMIT_%s_BURST at least 1", name, name)
+		}
+	}
+	if cfg.ConfigWatchInterval < 0 {
+		fail("CONFIG_WATCH_INTERVAL must not be negative")
+	}
+
+	if cfg.AccessLogSampleRate < 0 || cfg.AccessLogSampleRate > 1 {
+		fail("ACCESS_LOG_SAMPLE_RATE must be between 0 and 1, got %g", cfg.AccessLogSampleRate)
+	}
+	if cfg.TracingSampleRate < 0 || cfg.TracingSampleRate > 1 {
+		fail("TRACING_SAMPLE_RATE must be between 0 and 1, got %g", cfg.TracingSampleRate)
+	}
+
+	if cfg.ServerReadTimeout < 0 || cfg.ServerReadHeaderTimeout < 0 || cfg.ServerWriteTimeout < 0 || cfg.ServerIdleTimeout < 0 {
+		fail("server timeouts must not be negative")
+	}
+	if cfg.ShutdownDelay < 0 {
+		fail("SHUTDOWN_DELAY must not be negative")
+	}
+	if cfg.ShutdownTimeout <= 0 {
+		fail("SHUTDOWN_TIMEOUT must be positive")
+	}
+
+	if production && cfg.DebugMode {
+		fail("DEBUG_MODE must be disabled in production")
+	}
+
+	return errors.Join(errs...)
+}
@@ -1,32 +1,155 @@
 package database
 
 import (
-	"gorm.io/driver/mysql"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
+	"gorm.io/plugin/dbresolver"
 )
 
 type DatabaseInst struct {
-	client *gorm.DB
+	client   *gorm.DB
+	dialect  Dialect
+	resolver *dbresolver.DBResolver
+}
+
+// Options configures the connection pool, the retries while connecting and the read replicas.
+// Zero values leave the defaults of database/sql in place.
+type Options struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+	// reads outside of transactions are routed to a random replica, replicas have to use the same driver as the primary
+	ReplicaURLs []string
+	Retry       RetryOptions
 }
 
-func NewDatabaseInst(url string, config *gorm.Config) (*DatabaseInst, error) {
-	db, err := gorm.Open(mysql.Open(url), config)
+// NewDatabaseInst opens the database once and configures the pool and read replicas
+func NewDatabaseInst(url string, config *gorm.Config, opts Options) (*DatabaseInst, error) {
+	dialector, dialect, err := openDialector(url)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := gorm.Open(dialector, config)
+	if err != nil {
+		return nil, err
+	}
+
+	sqlDB, err := db.DB()
 	if err != nil {
 		return nil, err
 	}
 
-	return &DatabaseInst{client: db}, nil
+	if dialect == SQLite && isInMemorySQLite(url) {
+		// every connection to an in-memory sqlite database opens a new empty database,
+		// so the single connection must never be closed by the pool
+		sqlDB.SetMaxOpenConns(1)
+		sqlDB.SetMaxIdleConns(1)
+		return &DatabaseInst{client: db, dialect: dialect}, nil
+	}
+
+	configurePool(sqlDB, opts)
+
+	inst := &DatabaseInst{client: db, dialect: dialect}
+
+	if len(opts.ReplicaURLs) > 0 {
+		replicas := make([]gorm.Dialector, 0, len(opts.ReplicaURLs))
+		for _, replicaURL := range opts.ReplicaURLs {
+			replica, replicaDialect, err := openDialector(replicaURL)
+			if err != nil {
+				_ = sqlDB.Close()
+				return nil, fmt.Errorf("invalid replica url: %w", err)
+			}
+			if replicaDialect != dialect {
+				_ = sqlDB.Close()
+				return nil, fmt.Errorf("replica uses %s but the primary uses %s", replicaDialect, dialect)
+			}
+			replicas = append(replicas, replica)
+		}
+
+		inst.resolver = dbresolver.Register(dbresolver.Config{
+			Replicas: replicas,
+			Policy:   dbresolver.RandomPolicy{},
+		})
+
+		if err := db.Use(inst.resolver); err != nil {
+			_ = sqlDB.Close()
+			return nil, err
+		}
+
+		// every replica gets its own pool with the same limits as the primary
+		_ = inst.resolver.Call(func(connPool gorm.ConnPool) error {
+			if replicaDB, ok := connPool.(*sql.DB); ok {
+				configurePool(replicaDB, opts)
+			}
+			return nil
+		})
+	}
+
+	return inst, nil
+}
+
+func configurePool(p *sql.DB, opts Options) {
+	if opts.MaxOpenConns > 0 {
+		p.SetMaxOpenConns(opts.MaxOpenConns)
+	}
+	if opts.MaxIdleConns > 0 {
+		p.SetMaxIdleConns(opts.MaxIdleConns)
+	}
+	if opts.ConnMaxLifetime > 0 {
+		p.SetConnMaxLifetime(opts.ConnMaxLifetime)
+	}
+	if opts.ConnMaxIdleTime > 0 {
+		p.SetConnMaxIdleTime(opts.ConnMaxIdleTime)
+	}
 }
 
 func (d *DatabaseInst) GetClient() *gorm.DB {
 	return d.client
 }
 
-func (d *DatabaseInst) Migrate() error {
-	return d.client.AutoMigrate(&Message{}, &Chat{}, &User{}, &ChatUserKeys{}, &UserKeys{})
+func (d *DatabaseInst) Dialect() Dialect {
+	return d.dialect
 }
 
 func (d *DatabaseInst) SetLogMode(mode logger.LogLevel) {
-	d.client.Logger.LogMode(mode)
+	d.client.Logger = d.client.Logger.LogMode(mode)
+}
+
+func (d *DatabaseInst) Ping(ctx context.Context) error {
+	sqlDB, err := d.client.DB()
+	if err != nil {
+		return err
+	}
+
+	return sqlDB.PingContext(ctx)
+}
+
+// Close closes the pool of the primary and of every replica
+func (d *DatabaseInst) Close() error {
+	sqlDB, err := d.client.DB()
+	if err != nil {
+		return err
+	}
+
+	if d.resolver == nil {
+		return sqlDB.Close()
+	}
+
+	var errs []error
+	_ = d.resolver.Call(func(connPool gorm.ConnPool) error {
+		if replicaDB, ok := connPool.(*sql.DB); ok {
+			errs = append(errs, replicaDB.Close())
+		}
+		return nil
+	})
+
+	return errors.Join(append(errs, sqlDB.Close())...)
 }
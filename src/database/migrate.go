@@ -0,0 +1,411 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+const (
+	migrationLockName    = "easyflow_schema_migrations"
+	migrationLockKey     = 7431858264 // postgres advisory locks are identified by a number
+	migrationLockTimeout = 60         // seconds
+)
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+var ErrMigrationLocked = errors.New("another instance is migrating the database")
+
+type Migration struct {
+	Version uint
+	Name    string
+	Up      string
+	Down    string
+}
+
+// SchemaMigration is a row of the version table, one per applied migration.
+// A dirty row belongs to a migration that failed halfway and has to be fixed by hand.
+type SchemaMigration struct {
+	Version   uint `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	Dirty     bool
+	AppliedAt time.Time
+}
+
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	Dirty     bool
+	AppliedAt *time.Time
+}
+
+// loadMigrations reads the embedded sql files of a dialect and returns them ordered by version.
+func loadMigrations(dialect Dialect) ([]Migration, error) {
+	dir := "migrations/" + string(dialect)
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[uint]*Migration{}
+	for _, entry := range entries {
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name: %s", entry.Name())
+		}
+
+		version, err := strconv.ParseUint(match[1], 10, 32)
+		if err != nil {
+			return nil, err
+		}
+
+		content, err := migrationFiles.ReadFile(dir + "/" + entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[uint(version)]
+		if !ok {
+			migration = &Migration{Version: uint(version), Name: match[2]}
+			byVersion[uint(version)] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %s and %s", version, migration.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs an up and a down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// splitStatements splits a script into single statements, a statement ends with a semicolon at the end of a line.
+func splitStatements(script string) []string {
+	var statements []string
+	var current strings.Builder
+
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+
+		current.WriteString(line)
+		current.WriteString("\n")
+
+		if strings.HasSuffix(trimmed, ";") {
+			statements = append(statements, strings.TrimSpace(current.String()))
+			current.Reset()
+		}
+	}
+
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		statements = append(statements, rest)
+	}
+
+	return statements
+}
+
+// withMigrationLock runs fn on a single connection while holding a named lock,
+// so that only one instance changes the schema at a time.
+func (d *DatabaseInst) withMigrationLock(ctx context.Context, fn func(conn *gorm.DB) error) error {
+	return d.client.WithContext(ctx).Connection(func(conn *gorm.DB) error {
+		// every chain on conn has to start with a fresh statement but stay on the pinned connection
+		conn = conn.Session(&gorm.Session{NewDB: true})
+
+		unlock, err := d.lock(ctx, conn)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		if err := conn.Migrator().AutoMigrate(&SchemaMigration{}); err != nil {
+			return err
+		}
+
+		return fn(conn)
+	})
+}
+
+// lock acquires the migration lock on conn, it is released with the returned function.
+// Locks are bound to the session, so the same connection has to be used until the lock is released.
+func (d *DatabaseInst) lock(ctx context.Context, conn *gorm.DB) (func(), error) {
+	switch d.dialect {
+	case MySQL:
+		var acquired sql.NullInt64
+		if err := conn.Raw("SELECT GET_LOCK(?, ?)", migrationLockName, migrationLockTimeout).Scan(&acquired).Error; err != nil {
+			return nil, err
+		}
+		if !acquired.Valid || acquired.Int64 != 1 {
+			return nil, ErrMigrationLocked
+		}
+		return func() { conn.Exec("SELECT RELEASE_LOCK(?)", migrationLockName) }, nil
+	case Postgres:
+		deadline := time.Now().Add(migrationLockTimeout * time.Second)
+		for {
+			var acquired bool
+			if err := conn.Raw("SELECT pg_try_advisory_lock(?)", migrationLockKey).Scan(&acquired).Error; err != nil {
+				return nil, err
+			}
+			if acquired {
+				return func() { conn.Exec("SELECT pg_advisory_unlock(?)", migrationLockKey) }, nil
+			}
+			if time.Now().After(deadline) {
+				return nil, ErrMigrationLocked
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(500 * time.Millisecond):
+			}
+		}
+	default:
+		// sqlite locks the database file itself and is never shared between instances
+		return func() {}, nil
+	}
+}
+
+func appliedMigrations(conn *gorm.DB) ([]SchemaMigration, error) {
+	var applied []SchemaMigration
+	if err := conn.Order("version asc").Find(&applied).Error; err != nil {
+		return nil, err
+	}
+
+	for _, migration := range applied {
+		if migration.Dirty {
+			return nil, fmt.Errorf("migration %d_%s is dirty, fix the schema by hand and run `migrate force %d`", migration.Version, migration.Name, migration.Version)
+		}
+	}
+
+	return applied, nil
+}
+
+// migrationChecks run before the migration of the same version is applied. A failing check leaves
+// the schema and the version table untouched, the problem is fixed by hand and the migration is run again.
+var migrationChecks = map[uint]func(conn *gorm.DB) error{
+	2: checkOrphans,
+}
+
+// orphans are the rows that reference deleted users or chats, they were left behind while the foreign keys were missing
+var orphans = []struct {
+	Table     string
+	Condition string
+}{
+	{"messages", "chat_id NOT IN (SELECT id FROM chats) OR sender_id NOT IN (SELECT id FROM users)"},
+	{"chat_user_keys", "chat_id NOT IN (SELECT id FROM chats) OR user_id NOT IN (SELECT id FROM users)"},
+	{"user_keys", "user_id NOT IN (SELECT id FROM users)"},
+}
+
+// checkOrphans refuses to add the foreign keys while orphans exist, they are not deleted without asking
+func checkOrphans(conn *gorm.DB) error {
+	var found []string
+	for _, orphan := range orphans {
+		var count int64
+		if err := conn.Raw("SELECT COUNT(*) FROM " + orphan.Table + " WHERE " + orphan.Condition).Scan(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			found = append(found, fmt.Sprintf("%d rows in %s, delete them with `DELETE FROM %s WHERE %s`", count, orphan.Table, orphan.Table, orphan.Condition))
+		}
+	}
+
+	if len(found) > 0 {
+		return fmt.Errorf("rows reference deleted users or chats, the foreign keys can not be added: %s", strings.Join(found, "; "))
+	}
+	return nil
+}
+
+/*
+runScript runs the statements of a migration in one transaction. MySQL commits every DDL statement implicitly,
+so a MySQL migration that fails halfway keeps the statements before the failing one. The migration stays dirty
+and the remaining statements have to be applied or the applied ones reverted by hand before `migrate force`.
+*/
+func runScript(conn *gorm.DB, script string) error {
+	return conn.Transaction(func(tx *gorm.DB) error {
+		for _, statement := range splitStatements(script) {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Migrate applies every embedded migration that has not been applied yet and returns them.
+func (d *DatabaseInst) Migrate(ctx context.Context) ([]Migration, error) {
+	migrations, err := loadMigrations(d.dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	err = d.withMigrationLock(ctx, func(conn *gorm.DB) error {
+		applied, err := appliedMigrations(conn)
+		if err != nil {
+			return err
+		}
+
+		isApplied := map[uint]bool{}
+		for _, migration := range applied {
+			isApplied[migration.Version] = true
+		}
+
+		for _, migration := range migrations {
+			if isApplied[migration.Version] {
+				continue
+			}
+
+			if check, ok := migrationChecks[migration.Version]; ok {
+				if err := check(conn); err != nil {
+					return fmt.Errorf("migration %d_%s can not be applied: %w", migration.Version, migration.Name, err)
+				}
+			}
+
+			row := SchemaMigration{Version: migration.Version, Name: migration.Name, Dirty: true, AppliedAt: time.Now()}
+			if err := conn.Create(&row).Error; err != nil {
+				return err
+			}
+
+			if err := runScript(conn, migration.Up); err != nil {
+				return fmt.Errorf("migration %d_%s failed: %w", migration.Version, migration.Name, err)
+			}
+
+			if err := conn.Model(&row).Update("dirty", false).Error; err != nil {
+				return err
+			}
+
+			done = append(done, migration)
+		}
+
+		return nil
+	})
+
+	return done, err
+}
+
+// MigrateDown reverts the last steps applied migrations and returns them.
+func (d *DatabaseInst) MigrateDown(ctx context.Context, steps int) ([]Migration, error) {
+	migrations, err := loadMigrations(d.dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[uint]Migration{}
+	for _, migration := range migrations {
+		byVersion[migration.Version] = migration
+	}
+
+	var done []Migration
+	err = d.withMigrationLock(ctx, func(conn *gorm.DB) error {
+		applied, err := appliedMigrations(conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(applied) - 1; i >= 0 && len(done) < steps; i-- {
+			row := applied[i]
+			migration, ok := byVersion[row.Version]
+			if !ok {
+				return fmt.Errorf("migration %d_%s is applied but unknown to this binary", row.Version, row.Name)
+			}
+
+			if err := conn.Model(&row).Update("dirty", true).Error; err != nil {
+				return err
+			}
+
+			if err := runScript(conn, migration.Down); err != nil {
+				return fmt.Errorf("reverting migration %d_%s failed: %w", migration.Version, migration.Name, err)
+			}
+
+			if err := conn.Delete(&row).Error; err != nil {
+				return err
+			}
+
+			done = append(done, migration)
+		}
+
+		return nil
+	})
+
+	return done, err
+}
+
+// MigrateForce clears the dirty flag of a migration after its schema changes were fixed by hand.
+func (d *DatabaseInst) MigrateForce(ctx context.Context, version uint) error {
+	return d.withMigrationLock(ctx, func(conn *gorm.DB) error {
+		result := conn.Model(&SchemaMigration{}).Where("version = ?", version).Update("dirty", false)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("migration %d has not been applied", version)
+		}
+		return nil
+	})
+}
+
+// MigrationStatus lists every embedded migration together with its state in the database.
+func (d *DatabaseInst) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	migrations, err := loadMigrations(d.dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []SchemaMigration
+	if d.client.Migrator().HasTable(&SchemaMigration{}) {
+		if err := d.client.WithContext(ctx).Find(&applied).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	appliedByVersion := map[uint]SchemaMigration{}
+	for _, row := range applied {
+		appliedByVersion[row.Version] = row
+	}
+
+	status := make([]MigrationStatus, 0, len(migrations))
+	for _, migration := range migrations {
+		entry := MigrationStatus{Migration: migration}
+		if row, ok := appliedByVersion[migration.Version]; ok {
+			entry.Applied = true
+			entry.Dirty = row.Dirty
+			entry.AppliedAt = &row.AppliedAt
+		}
+		status = append(status, entry)
+	}
+
+	return status, nil
+}
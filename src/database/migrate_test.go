@@ -0,0 +1,128 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func newTestDatabase(t *testing.T) *DatabaseInst {
+	t.Helper()
+
+	db, err := NewDatabaseInst("sqlite://:memory:", &gorm.Config{}, Options{})
+	if err != nil {
+		t.Fatalf("could not open database: %s", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+func TestCheckOrphans(t *testing.T) {
+	conn := newTestDatabase(t).GetClient()
+	for _, statement := range []string{
+		"CREATE TABLE users (id varchar(36))",
+		"CREATE TABLE chats (id varchar(36))",
+		"CREATE TABLE messages (id varchar(36), chat_id varchar(36), sender_id varchar(36))",
+		"CREATE TABLE chat_user_keys (chat_id varchar(36), user_id varchar(36))",
+		"CREATE TABLE user_keys (user_id varchar(36))",
+		"INSERT INTO users (id) VALUES ('alice')",
+		"INSERT INTO chats (id) VALUES ('talk')",
+		"INSERT INTO messages (id, chat_id, sender_id) VALUES ('kept', 'talk', 'alice')",
+		"INSERT INTO chat_user_keys (chat_id, user_id) VALUES ('talk', 'alice')",
+	} {
+		if err := conn.Exec(statement).Error; err != nil {
+			t.Fatalf("could not prepare the tables: %s", err)
+		}
+	}
+
+	if err := checkOrphans(conn); err != nil {
+		t.Fatalf("rows without orphans were refused: %s", err)
+	}
+
+	for _, statement := range []string{
+		"INSERT INTO messages (id, chat_id, sender_id) VALUES ('orphan', 'deleted', 'alice')",
+		"INSERT INTO messages (id, chat_id, sender_id) VALUES ('orphan', 'talk', 'deleted')",
+		"INSERT INTO user_keys (user_id) VALUES ('deleted')",
+	} {
+		if err := conn.Exec(statement).Error; err != nil {
+			t.Fatalf("could not insert orphan: %s", err)
+		}
+	}
+
+	err := checkOrphans(conn)
+	if err == nil {
+		t.Fatalf("orphans were not found")
+	}
+	for _, expected := range []string{"2 rows in messages", "1 rows in user_keys", "DELETE FROM user_keys WHERE"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Fatalf("expected %q in %q", expected, err)
+		}
+	}
+	if strings.Contains(err.Error(), "chat_user_keys") {
+		t.Fatalf("chat_user_keys has no orphans: %s", err)
+	}
+
+	// nothing was deleted
+	var count int64
+	if err := conn.Raw("SELECT COUNT(*) FROM messages").Scan(&count).Error; err != nil || count != 3 {
+		t.Fatalf("expected 3 messages, got %d: %v", count, err)
+	}
+}
+
+func TestFailedCheckLeavesNoDirtyMigration(t *testing.T) {
+	refused := errors.New("refused")
+	previous := migrationChecks
+	migrationChecks = map[uint]func(conn *gorm.DB) error{
+		1: func(conn *gorm.DB) error { return refused },
+	}
+	t.Cleanup(func() { migrationChecks = previous })
+
+	db := newTestDatabase(t)
+	if _, err := db.Migrate(context.Background()); !errors.Is(err, refused) {
+		t.Fatalf("expected the check to fail the migration, got %v", err)
+	}
+
+	status, err := db.MigrationStatus(context.Background())
+	if err != nil {
+		t.Fatalf("could not get the status: %s", err)
+	}
+	for _, migration := range status {
+		if migration.Applied || migration.Dirty {
+			t.Fatalf("migration %d was recorded: %+v", migration.Version, migration)
+		}
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	script := `-- a comment before the first statement
+CREATE TABLE chats (
+    id varchar(36)
+);
+
+-- a comment between statements
+INSERT INTO chats (id) VALUES ('talk');
+UPDATE chats SET id = 'chat'`
+
+	expected := []string{
+		"CREATE TABLE chats (\n    id varchar(36)\n);",
+		"INSERT INTO chats (id) VALUES ('talk');",
+		"UPDATE chats SET id = 'chat'",
+	}
+
+	statements := splitStatements(script)
+	if len(statements) != len(expected) {
+		t.Fatalf("expected %d statements, got %d: %q", len(expected), len(statements), statements)
+	}
+	for i := range expected {
+		if statements[i] != expected[i] {
+			t.Fatalf("statement %d: expected %q, got %q", i, expected[i], statements[i])
+		}
+	}
+
+	if statements := splitStatements("-- only a comment\n\n"); len(statements) != 0 {
+		t.Fatalf("expected no statements, got %q", statements)
+	}
+}
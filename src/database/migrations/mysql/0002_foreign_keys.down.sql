@@ -0,0 +1,9 @@
+ALTER TABLE `user_keys` DROP FOREIGN KEY `fk_user_keys_user`;
+
+ALTER TABLE `chat_user_keys`
+  DROP FOREIGN KEY `fk_chat_user_keys_chat`,
+  DROP FOREIGN KEY `fk_chat_user_keys_user`;
+
+ALTER TABLE `messages`
+  DROP FOREIGN KEY `fk_messages_chat`,
+  DROP FOREIGN KEY `fk_messages_sender`;
@@ -0,0 +1,9 @@
+DELETE FROM `messages` WHERE `sender_id` IS NULL;
+ALTER TABLE `messages` DROP FOREIGN KEY `fk_messages_sender`;
+ALTER TABLE `messages`
+  ADD CONSTRAINT `fk_messages_sender` FOREIGN KEY (`sender_id`) REFERENCES `users` (`id`) ON DELETE CASCADE;
+
+ALTER TABLE `chats` DROP COLUMN `message_retention_days`;
+
+ALTER TABLE `chat_user_keys` DROP KEY `idx_chat_user_keys_deleted_at`, DROP COLUMN `deleted_at`;
+ALTER TABLE `users` DROP KEY `idx_users_deleted_at`, DROP COLUMN `deleted_at`;
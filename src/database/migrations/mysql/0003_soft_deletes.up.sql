@@ -0,0 +1,10 @@
+ALTER TABLE `users` ADD COLUMN `deleted_at` datetime DEFAULT NULL, ADD KEY `idx_users_deleted_at` (`deleted_at`);
+ALTER TABLE `chat_user_keys` ADD COLUMN `deleted_at` datetime DEFAULT NULL, ADD KEY `idx_chat_user_keys_deleted_at` (`deleted_at`);
+
+-- days after which the retention worker deletes messages of the chat, NULL keeps them forever
+ALTER TABLE `chats` ADD COLUMN `message_retention_days` int DEFAULT NULL;
+
+-- messages of purged users can outlive their sender
+ALTER TABLE `messages` DROP FOREIGN KEY `fk_messages_sender`;
+ALTER TABLE `messages`
+  ADD CONSTRAINT `fk_messages_sender` FOREIGN KEY (`sender_id`) REFERENCES `users` (`id`) ON DELETE SET NULL;
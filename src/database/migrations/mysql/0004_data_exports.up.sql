@@ -0,0 +1,13 @@
+-- archives of all data of a user, the archive itself is stored in the export bucket
+CREATE TABLE IF NOT EXISTS `data_exports` (
+  `id` varchar(36) NOT NULL,
+  `created_at` datetime DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` datetime DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  `user_id` varchar(36) NOT NULL,
+  `status` varchar(16) NOT NULL,
+  `object_key` varchar(255) DEFAULT NULL,
+  `completed_at` datetime DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_data_exports_user_id` (`user_id`),
+  CONSTRAINT `fk_data_exports_user` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+);
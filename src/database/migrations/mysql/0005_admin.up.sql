@@ -0,0 +1,16 @@
+ALTER TABLE `users` ADD COLUMN `role` varchar(16) NOT NULL DEFAULT 'user', ADD COLUMN `disabled_at` datetime DEFAULT NULL;
+
+-- actions of admins, entries are only ever inserted
+CREATE TABLE IF NOT EXISTS `admin_audit_logs` (
+  `id` varchar(36) NOT NULL,
+  `created_at` datetime DEFAULT CURRENT_TIMESTAMP,
+  `admin_id` varchar(36) DEFAULT NULL,
+  `action` varchar(64) NOT NULL,
+  `target_type` varchar(16) NOT NULL,
+  `target_id` varchar(36) DEFAULT NULL,
+  `details` text,
+  PRIMARY KEY (`id`),
+  KEY `idx_admin_audit_logs_created_at` (`created_at`),
+  KEY `idx_admin_audit_logs_admin_id` (`admin_id`),
+  CONSTRAINT `fk_admin_audit_logs_admin` FOREIGN KEY (`admin_id`) REFERENCES `users` (`id`) ON DELETE SET NULL
+);
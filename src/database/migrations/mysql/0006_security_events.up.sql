@@ -0,0 +1,13 @@
+-- activity on user accounts, events are only ever inserted
+CREATE TABLE IF NOT EXISTS `security_events` (
+  `id` varchar(36) NOT NULL,
+  `created_at` datetime DEFAULT CURRENT_TIMESTAMP,
+  `user_id` varchar(36) DEFAULT NULL,
+  `kind` varchar(32) NOT NULL,
+  `ip` varchar(45) NOT NULL DEFAULT '',
+  `user_agent` varchar(255) NOT NULL DEFAULT '',
+  `details` text,
+  PRIMARY KEY (`id`),
+  KEY `idx_security_events_user_id_created_at` (`user_id`, `created_at`),
+  CONSTRAINT `fk_security_events_user` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE SET NULL
+);
@@ -0,0 +1,20 @@
+-- encrypted files of chat messages, the objects live in the attachment bucket
+CREATE TABLE IF NOT EXISTS `attachments` (
+  `id` varchar(36) NOT NULL,
+  `created_at` datetime DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` datetime DEFAULT CURRENT_TIMESTAMP,
+  `chat_id` varchar(36) NOT NULL,
+  `uploader_id` varchar(36) DEFAULT NULL,
+  `message_id` varchar(36) DEFAULT NULL,
+  `object_key` varchar(255) NOT NULL,
+  `size` bigint NOT NULL,
+  `mime_type` varchar(127) NOT NULL,
+  `checksum` varchar(44) NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_attachments_chat_id` (`chat_id`),
+  KEY `idx_attachments_uploader_id` (`uploader_id`),
+  KEY `idx_attachments_message_id` (`message_id`),
+  CONSTRAINT `fk_attachments_chat` FOREIGN KEY (`chat_id`) REFERENCES `chats` (`id`) ON DELETE CASCADE,
+  CONSTRAINT `fk_attachments_uploader` FOREIGN KEY (`uploader_id`) REFERENCES `users` (`id`) ON DELETE SET NULL,
+  CONSTRAINT `fk_attachments_message` FOREIGN KEY (`message_id`) REFERENCES `messages` (`id`) ON DELETE CASCADE
+);
@@ -0,0 +1,2 @@
+-- set once the uploaded profile picture was sanitized and its variants were generated
+ALTER TABLE `users` ADD COLUMN `picture_version` datetime DEFAULT NULL;
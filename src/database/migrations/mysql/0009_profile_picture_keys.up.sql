@@ -0,0 +1,4 @@
+-- only the object key is stored, the presigned urls are generated on read
+ALTER TABLE `users` ADD COLUMN `picture_key` varchar(255) DEFAULT NULL;
+UPDATE `users` SET `picture_key` = `id` WHERE `profile_picture` IS NOT NULL;
+ALTER TABLE `users` DROP COLUMN `profile_picture`;
@@ -0,0 +1,6 @@
+-- chat pictures are uploaded to the object store, external urls leaked the ips of the members and are dropped
+ALTER TABLE `chats` ADD COLUMN `picture_key` varchar(255) DEFAULT NULL, ADD COLUMN `picture_version` datetime DEFAULT NULL;
+ALTER TABLE `chats` DROP COLUMN `picture`;
+-- admins of a chat may change its picture, members of existing chats keep the equal rights they had
+ALTER TABLE `chat_user_keys` ADD COLUMN `role` varchar(16) NOT NULL DEFAULT 'member';
+UPDATE `chat_user_keys` SET `role` = 'admin';
@@ -0,0 +1,3 @@
+ALTER TABLE `chats` DROP COLUMN `picture_scan`;
+ALTER TABLE `users` DROP COLUMN `picture_scan`;
+ALTER TABLE `attachments` DROP COLUMN `scan_status`;
@@ -0,0 +1,16 @@
+-- background jobs, jobs that succeeded are deleted and dead jobs stay until they are requeued
+CREATE TABLE IF NOT EXISTS `jobs` (
+  `id` varchar(36) NOT NULL,
+  `created_at` datetime DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` datetime DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  `type` varchar(64) NOT NULL,
+  `payload` text NOT NULL,
+  `status` varchar(16) NOT NULL,
+  `attempts` int NOT NULL DEFAULT 0,
+  `run_at` datetime(3) NOT NULL,
+  `lease_token` varchar(36) DEFAULT NULL,
+  `leased_until` datetime(3) DEFAULT NULL,
+  `last_error` text,
+  PRIMARY KEY (`id`),
+  KEY `idx_jobs_status_run_at` (`status`, `run_at`)
+);
@@ -0,0 +1,3 @@
+ALTER TABLE `chat_user_keys` DROP COLUMN `muted`, DROP COLUMN `mute_until`;
+ALTER TABLE `users` DROP COLUMN `last_seen_at`;
+DROP TABLE IF EXISTS `push_devices`;
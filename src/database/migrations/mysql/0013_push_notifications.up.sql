@@ -0,0 +1,17 @@
+-- devices that are notified about new messages while their user is offline
+CREATE TABLE IF NOT EXISTS `push_devices` (
+  `id` varchar(36) NOT NULL,
+  `created_at` datetime DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` datetime DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  `user_id` varchar(36) NOT NULL,
+  `platform` varchar(16) NOT NULL,
+  `token` varchar(512) NOT NULL,
+  `p256dh` varchar(128) DEFAULT NULL,
+  `auth` varchar(32) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_push_devices_user_id` (`user_id`),
+  UNIQUE KEY `idx_push_devices_platform_token` (`platform`, `token`),
+  CONSTRAINT `fk_push_devices_user` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+);
+ALTER TABLE `users` ADD COLUMN `last_seen_at` datetime DEFAULT NULL;
+ALTER TABLE `chat_user_keys` ADD COLUMN `muted` boolean NOT NULL DEFAULT false, ADD COLUMN `mute_until` datetime DEFAULT NULL;
@@ -0,0 +1,5 @@
+-- pictures that are still uploaded or scanned are lost, the published ones keep their keys
+ALTER TABLE `chats` DROP COLUMN `picture_pending`;
+ALTER TABLE `chats` DROP COLUMN `picture_upload`;
+ALTER TABLE `users` DROP COLUMN `picture_pending`;
+ALTER TABLE `users` DROP COLUMN `picture_upload`;
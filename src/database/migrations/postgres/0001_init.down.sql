@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS "user_keys";
+DROP TABLE IF EXISTS "chat_user_keys";
+DROP TABLE IF EXISTS "messages";
+DROP TABLE IF EXISTS "chats";
+DROP TABLE IF EXISTS "users";
@@ -0,0 +1,9 @@
+ALTER TABLE "user_keys" DROP CONSTRAINT "fk_user_keys_user";
+
+ALTER TABLE "chat_user_keys"
+  DROP CONSTRAINT "fk_chat_user_keys_chat",
+  DROP CONSTRAINT "fk_chat_user_keys_user";
+
+ALTER TABLE "messages"
+  DROP CONSTRAINT "fk_messages_chat",
+  DROP CONSTRAINT "fk_messages_sender";
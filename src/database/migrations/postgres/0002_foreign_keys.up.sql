@@ -0,0 +1,12 @@
+-- Rows that reference deleted users or chats were left behind while foreign keys were disabled.
+-- The migration refuses to run while they exist, see checkOrphans in migrate.go.
+ALTER TABLE "messages"
+  ADD CONSTRAINT "fk_messages_chat" FOREIGN KEY ("chat_id") REFERENCES "chats" ("id") ON DELETE CASCADE,
+  ADD CONSTRAINT "fk_messages_sender" FOREIGN KEY ("sender_id") REFERENCES "users" ("id") ON DELETE CASCADE;
+
+ALTER TABLE "chat_user_keys"
+  ADD CONSTRAINT "fk_chat_user_keys_chat" FOREIGN KEY ("chat_id") REFERENCES "chats" ("id") ON DELETE CASCADE,
+  ADD CONSTRAINT "fk_chat_user_keys_user" FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE;
+
+ALTER TABLE "user_keys"
+  ADD CONSTRAINT "fk_user_keys_user" FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE;
@@ -0,0 +1,11 @@
+DELETE FROM "messages" WHERE "sender_id" IS NULL;
+ALTER TABLE "messages"
+  DROP CONSTRAINT "fk_messages_sender",
+  ADD CONSTRAINT "fk_messages_sender" FOREIGN KEY ("sender_id") REFERENCES "users" ("id") ON DELETE CASCADE;
+
+ALTER TABLE "chats" DROP COLUMN "message_retention_days";
+
+DROP INDEX IF EXISTS "idx_chat_user_keys_deleted_at";
+ALTER TABLE "chat_user_keys" DROP COLUMN "deleted_at";
+DROP INDEX IF EXISTS "idx_users_deleted_at";
+ALTER TABLE "users" DROP COLUMN "deleted_at";
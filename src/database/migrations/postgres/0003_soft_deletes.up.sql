@@ -0,0 +1,12 @@
+ALTER TABLE "users" ADD COLUMN "deleted_at" timestamptz;
+CREATE INDEX IF NOT EXISTS "idx_users_deleted_at" ON "users" ("deleted_at");
+ALTER TABLE "chat_user_keys" ADD COLUMN "deleted_at" timestamptz;
+CREATE INDEX IF NOT EXISTS "idx_chat_user_keys_deleted_at" ON "chat_user_keys" ("deleted_at");
+
+-- days after which the retention worker deletes messages of the chat, NULL keeps them forever
+ALTER TABLE "chats" ADD COLUMN "message_retention_days" integer;
+
+-- messages of purged users can outlive their sender
+ALTER TABLE "messages"
+  DROP CONSTRAINT "fk_messages_sender",
+  ADD CONSTRAINT "fk_messages_sender" FOREIGN KEY ("sender_id") REFERENCES "users" ("id") ON DELETE SET NULL;
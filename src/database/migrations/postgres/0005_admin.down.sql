@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS "admin_audit_logs";
+
+ALTER TABLE "users" DROP COLUMN "disabled_at";
+ALTER TABLE "users" DROP COLUMN "role";
@@ -0,0 +1,16 @@
+ALTER TABLE "users" ADD COLUMN "role" varchar(16) NOT NULL DEFAULT 'user';
+ALTER TABLE "users" ADD COLUMN "disabled_at" timestamptz;
+
+-- actions of admins, entries are only ever inserted
+CREATE TABLE IF NOT EXISTS "admin_audit_logs" (
+  "id" varchar(36) NOT NULL PRIMARY KEY,
+  "created_at" timestamptz DEFAULT CURRENT_TIMESTAMP,
+  "admin_id" varchar(36),
+  "action" varchar(64) NOT NULL,
+  "target_type" varchar(16) NOT NULL,
+  "target_id" varchar(36),
+  "details" text,
+  CONSTRAINT "fk_admin_audit_logs_admin" FOREIGN KEY ("admin_id") REFERENCES "users" ("id") ON DELETE SET NULL
+);
+CREATE INDEX IF NOT EXISTS "idx_admin_audit_logs_created_at" ON "admin_audit_logs" ("created_at");
+CREATE INDEX IF NOT EXISTS "idx_admin_audit_logs_admin_id" ON "admin_audit_logs" ("admin_id");
@@ -0,0 +1,12 @@
+-- activity on user accounts, events are only ever inserted
+CREATE TABLE IF NOT EXISTS "security_events" (
+  "id" varchar(36) NOT NULL PRIMARY KEY,
+  "created_at" timestamptz DEFAULT CURRENT_TIMESTAMP,
+  "user_id" varchar(36),
+  "kind" varchar(32) NOT NULL,
+  "ip" varchar(45) NOT NULL DEFAULT '',
+  "user_agent" varchar(255) NOT NULL DEFAULT '',
+  "details" text,
+  CONSTRAINT "fk_security_events_user" FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE SET NULL
+);
+CREATE INDEX IF NOT EXISTS "idx_security_events_user_id_created_at" ON "security_events" ("user_id", "created_at");
@@ -0,0 +1,3 @@
+-- the urls can not be restored, they are generated again on the next login
+ALTER TABLE "users" ADD COLUMN "profile_picture" varchar(512);
+ALTER TABLE "users" DROP COLUMN "picture_key";
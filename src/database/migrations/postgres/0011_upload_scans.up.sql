@@ -0,0 +1,4 @@
+-- confirmed uploads are scanned before they can be downloaded, objects that existed before were never scanned and stay available
+ALTER TABLE "attachments" ADD COLUMN "scan_status" varchar(16) NOT NULL DEFAULT 'clean';
+ALTER TABLE "users" ADD COLUMN "picture_scan" varchar(16) NOT NULL DEFAULT 'clean';
+ALTER TABLE "chats" ADD COLUMN "picture_scan" varchar(16) NOT NULL DEFAULT 'clean';
@@ -0,0 +1,4 @@
+ALTER TABLE "chat_user_keys" DROP COLUMN "mute_until";
+ALTER TABLE "chat_user_keys" DROP COLUMN "muted";
+ALTER TABLE "users" DROP COLUMN "last_seen_at";
+DROP TABLE IF EXISTS "push_devices";
@@ -0,0 +1,57 @@
+-- sqlite can not add constraints to existing tables, so the foreign keys are created right away.
+CREATE TABLE IF NOT EXISTS `users` (
+  `id` varchar(36) NOT NULL PRIMARY KEY,
+  `created_at` datetime DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` datetime DEFAULT CURRENT_TIMESTAMP,
+  `email` varchar(255),
+  `password` text,
+  `name` varchar(50),
+  `bio` varchar(1000),
+  `iv` varchar(25),
+  `profile_picture` varchar(512),
+  `public_key` text,
+  `private_key` text
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_users_email` ON `users` (`email`);
+
+CREATE TABLE IF NOT EXISTS `chats` (
+  `id` varchar(36) NOT NULL PRIMARY KEY,
+  `created_at` datetime DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` datetime DEFAULT CURRENT_TIMESTAMP,
+  `name` varchar(255),
+  `picture` varchar(2048),
+  `description` text
+);
+
+CREATE TABLE IF NOT EXISTS `messages` (
+  `id` varchar(36) NOT NULL PRIMARY KEY,
+  `created_at` datetime DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` datetime DEFAULT CURRENT_TIMESTAMP,
+  `content` text,
+  `iv` varchar(25),
+  `chat_id` varchar(36) REFERENCES `chats` (`id`) ON DELETE CASCADE,
+  `sender_id` varchar(36) REFERENCES `users` (`id`) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS `idx_messages_chat_id` ON `messages` (`chat_id`);
+CREATE INDEX IF NOT EXISTS `idx_messages_sender_id` ON `messages` (`sender_id`);
+
+CREATE TABLE IF NOT EXISTS `chat_user_keys` (
+  `id` varchar(36) NOT NULL PRIMARY KEY,
+  `created_at` datetime DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` datetime DEFAULT CURRENT_TIMESTAMP,
+  `key` text,
+  `chat_id` varchar(36) REFERENCES `chats` (`id`) ON DELETE CASCADE,
+  `user_id` varchar(36) REFERENCES `users` (`id`) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS `idx_chat_user_keys_chat_id` ON `chat_user_keys` (`chat_id`);
+CREATE INDEX IF NOT EXISTS `idx_chat_user_keys_user_id` ON `chat_user_keys` (`user_id`);
+
+CREATE TABLE IF NOT EXISTS `user_keys` (
+  `id` varchar(36) NOT NULL PRIMARY KEY,
+  `created_at` datetime DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` datetime DEFAULT CURRENT_TIMESTAMP,
+  `expired_at` datetime,
+  `random` varchar(36),
+  `user_id` varchar(36) REFERENCES `users` (`id`) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS `idx_user_keys_user_id` ON `user_keys` (`user_id`);
@@ -0,0 +1 @@
+-- The foreign keys are part of 0001 and are dropped together with the tables.
@@ -0,0 +1 @@
+-- The foreign keys are already part of 0001, sqlite can not add constraints to existing tables.
@@ -0,0 +1,22 @@
+CREATE TABLE `messages_old` (
+  `id` varchar(36) NOT NULL PRIMARY KEY,
+  `created_at` datetime DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` datetime DEFAULT CURRENT_TIMESTAMP,
+  `content` text,
+  `iv` varchar(25),
+  `chat_id` varchar(36) REFERENCES `chats` (`id`) ON DELETE CASCADE,
+  `sender_id` varchar(36) REFERENCES `users` (`id`) ON DELETE CASCADE
+);
+INSERT INTO `messages_old` (`id`, `created_at`, `updated_at`, `content`, `iv`, `chat_id`, `sender_id`)
+  SELECT `id`, `created_at`, `updated_at`, `content`, `iv`, `chat_id`, `sender_id` FROM `messages` WHERE `sender_id` IS NOT NULL;
+DROP TABLE `messages`;
+ALTER TABLE `messages_old` RENAME TO `messages`;
+CREATE INDEX IF NOT EXISTS `idx_messages_chat_id` ON `messages` (`chat_id`);
+CREATE INDEX IF NOT EXISTS `idx_messages_sender_id` ON `messages` (`sender_id`);
+
+ALTER TABLE `chats` DROP COLUMN `message_retention_days`;
+
+DROP INDEX IF EXISTS `idx_chat_user_keys_deleted_at`;
+ALTER TABLE `chat_user_keys` DROP COLUMN `deleted_at`;
+DROP INDEX IF EXISTS `idx_users_deleted_at`;
+ALTER TABLE `users` DROP COLUMN `deleted_at`;
@@ -0,0 +1,24 @@
+ALTER TABLE `users` ADD COLUMN `deleted_at` datetime;
+CREATE INDEX IF NOT EXISTS `idx_users_deleted_at` ON `users` (`deleted_at`);
+ALTER TABLE `chat_user_keys` ADD COLUMN `deleted_at` datetime;
+CREATE INDEX IF NOT EXISTS `idx_chat_user_keys_deleted_at` ON `chat_user_keys` (`deleted_at`);
+
+-- days after which the retention worker deletes messages of the chat, NULL keeps them forever
+ALTER TABLE `chats` ADD COLUMN `message_retention_days` integer;
+
+-- messages of purged users can outlive their sender, sqlite can not alter a foreign key so the table is rebuilt
+CREATE TABLE `messages_new` (
+  `id` varchar(36) NOT NULL PRIMARY KEY,
+  `created_at` datetime DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` datetime DEFAULT CURRENT_TIMESTAMP,
+  `content` text,
+  `iv` varchar(25),
+  `chat_id` varchar(36) REFERENCES `chats` (`id`) ON DELETE CASCADE,
+  `sender_id` varchar(36) REFERENCES `users` (`id`) ON DELETE SET NULL
+);
+INSERT INTO `messages_new` (`id`, `created_at`, `updated_at`, `content`, `iv`, `chat_id`, `sender_id`)
+  SELECT `id`, `created_at`, `updated_at`, `content`, `iv`, `chat_id`, `sender_id` FROM `messages`;
+DROP TABLE `messages`;
+ALTER TABLE `messages_new` RENAME TO `messages`;
+CREATE INDEX IF NOT EXISTS `idx_messages_chat_id` ON `messages` (`chat_id`);
+CREATE INDEX IF NOT EXISTS `idx_messages_sender_id` ON `messages` (`sender_id`);
@@ -0,0 +1,11 @@
+-- archives of all data of a user, the archive itself is stored in the export bucket
+CREATE TABLE IF NOT EXISTS `data_exports` (
+  `id` varchar(36) NOT NULL PRIMARY KEY,
+  `created_at` datetime DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` datetime DEFAULT CURRENT_TIMESTAMP,
+  `user_id` varchar(36) NOT NULL REFERENCES `users` (`id`) ON DELETE CASCADE,
+  `status` varchar(16) NOT NULL,
+  `object_key` varchar(255),
+  `completed_at` datetime
+);
+CREATE INDEX IF NOT EXISTS `idx_data_exports_user_id` ON `data_exports` (`user_id`);
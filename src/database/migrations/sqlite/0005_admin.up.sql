@@ -0,0 +1,15 @@
+ALTER TABLE `users` ADD COLUMN `role` varchar(16) NOT NULL DEFAULT 'user';
+ALTER TABLE `users` ADD COLUMN `disabled_at` datetime;
+
+-- actions of admins, entries are only ever inserted
+CREATE TABLE IF NOT EXISTS `admin_audit_logs` (
+  `id` varchar(36) NOT NULL PRIMARY KEY,
+  `created_at` datetime DEFAULT CURRENT_TIMESTAMP,
+  `admin_id` varchar(36) REFERENCES `users` (`id`) ON DELETE SET NULL,
+  `action` varchar(64) NOT NULL,
+  `target_type` varchar(16) NOT NULL,
+  `target_id` varchar(36),
+  `details` text
+);
+CREATE INDEX IF NOT EXISTS `idx_admin_audit_logs_created_at` ON `admin_audit_logs` (`created_at`);
+CREATE INDEX IF NOT EXISTS `idx_admin_audit_logs_admin_id` ON `admin_audit_logs` (`admin_id`);
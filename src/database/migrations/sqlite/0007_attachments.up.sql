@@ -0,0 +1,16 @@
+-- encrypted files of chat messages, the objects live in the attachment bucket
+CREATE TABLE IF NOT EXISTS `attachments` (
+  `id` varchar(36) NOT NULL PRIMARY KEY,
+  `created_at` datetime DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` datetime DEFAULT CURRENT_TIMESTAMP,
+  `chat_id` varchar(36) NOT NULL REFERENCES `chats` (`id`) ON DELETE CASCADE,
+  `uploader_id` varchar(36) REFERENCES `users` (`id`) ON DELETE SET NULL,
+  `message_id` varchar(36) REFERENCES `messages` (`id`) ON DELETE CASCADE,
+  `object_key` varchar(255) NOT NULL,
+  `size` bigint NOT NULL,
+  `mime_type` varchar(127) NOT NULL,
+  `checksum` varchar(44) NOT NULL
+);
+CREATE INDEX IF NOT EXISTS `idx_attachments_chat_id` ON `attachments` (`chat_id`);
+CREATE INDEX IF NOT EXISTS `idx_attachments_uploader_id` ON `attachments` (`uploader_id`);
+CREATE INDEX IF NOT EXISTS `idx_attachments_message_id` ON `attachments` (`message_id`);
@@ -0,0 +1,5 @@
+ALTER TABLE `chat_user_keys` DROP COLUMN `role`;
+-- the uploaded pictures can not be restored as urls
+ALTER TABLE `chats` ADD COLUMN `picture` varchar(2048);
+ALTER TABLE `chats` DROP COLUMN `picture_key`;
+ALTER TABLE `chats` DROP COLUMN `picture_version`;
@@ -0,0 +1,15 @@
+-- background jobs, jobs that succeeded are deleted and dead jobs stay until they are requeued
+CREATE TABLE IF NOT EXISTS `jobs` (
+  `id` varchar(36) NOT NULL PRIMARY KEY,
+  `created_at` datetime DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` datetime DEFAULT CURRENT_TIMESTAMP,
+  `type` varchar(64) NOT NULL,
+  `payload` text NOT NULL,
+  `status` varchar(16) NOT NULL,
+  `attempts` integer NOT NULL DEFAULT 0,
+  `run_at` datetime NOT NULL,
+  `lease_token` varchar(36),
+  `leased_until` datetime,
+  `last_error` text
+);
+CREATE INDEX IF NOT EXISTS `idx_jobs_status_run_at` ON `jobs` (`status`, `run_at`);
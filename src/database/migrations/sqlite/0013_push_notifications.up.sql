@@ -0,0 +1,16 @@
+-- devices that are notified about new messages while their user is offline
+CREATE TABLE IF NOT EXISTS `push_devices` (
+  `id` varchar(36) NOT NULL PRIMARY KEY,
+  `created_at` datetime DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` datetime DEFAULT CURRENT_TIMESTAMP,
+  `user_id` varchar(36) NOT NULL REFERENCES `users` (`id`) ON DELETE CASCADE,
+  `platform` varchar(16) NOT NULL,
+  `token` varchar(512) NOT NULL,
+  `p256dh` varchar(128),
+  `auth` varchar(32)
+);
+CREATE INDEX IF NOT EXISTS `idx_push_devices_user_id` ON `push_devices` (`user_id`);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_push_devices_platform_token` ON `push_devices` (`platform`, `token`);
+ALTER TABLE `users` ADD COLUMN `last_seen_at` datetime;
+ALTER TABLE `chat_user_keys` ADD COLUMN `muted` boolean NOT NULL DEFAULT false;
+ALTER TABLE `chat_user_keys` ADD COLUMN `mute_until` datetime;
@@ -0,0 +1,11 @@
+-- pictures are uploaded to a staging object and only published under a new key once they were scanned clean
+ALTER TABLE `users` ADD COLUMN `picture_upload` varchar(255);
+ALTER TABLE `users` ADD COLUMN `picture_pending` varchar(255);
+ALTER TABLE `chats` ADD COLUMN `picture_upload` varchar(255);
+ALTER TABLE `chats` ADD COLUMN `picture_pending` varchar(255);
+-- pictures that were not scanned clean yet can still be overwritten by their uploader, they are dropped and have to be uploaded again
+UPDATE `users` SET `picture_key` = NULL, `picture_version` = NULL, `picture_scan` = 'clean' WHERE `picture_scan` = 'pending';
+UPDATE `chats` SET `picture_key` = NULL, `picture_version` = NULL, `picture_scan` = 'clean' WHERE `picture_scan` = 'pending';
+-- quarantined pictures were never served, only their status is kept
+UPDATE `users` SET `picture_key` = NULL, `picture_version` = NULL WHERE `picture_scan` = 'quarantined';
+UPDATE `chats` SET `picture_key` = NULL, `picture_version` = NULL WHERE `picture_scan` = 'quarantined';
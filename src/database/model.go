@@ -9,12 +9,12 @@ import (
 
 type Message struct {
 	Id        string    `gorm:"type:varchar(36);primaryKey"`
-	CreatedAt time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP"`
-	UpdatedAt time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime"`
 	Content   string    `gorm:"type:text"`
 	Iv        string    `gorm:"type:varchar(25)"`
 	ChatId    string    `gorm:"type:varchar(36);index"`
-	SenderId  string    `gorm:"type:varchar(36);index"`
+	SenderId  *string   `gorm:"type:varchar(36);index"` // nil once the sender was purged
 	Chat      Chat      `gorm:"foreignKey:ChatId"`
 	Sender    User      `gorm:"foreignKey:SenderId"`
 }
@@ -24,68 +24,291 @@ func (m *Message) BeforeCreate(tx *gorm.DB) (err error) {
 	return
 }
 
+// Attachment is an encrypted file of a chat message, the client uploads it through a presigned url.
+// It is created when the upload slot is requested and linked to its message once the message is sent.
+type Attachment struct {
+	Id         string    `gorm:"type:varchar(36);primaryKey"`
+	CreatedAt  time.Time `gorm:"autoCreateTime"`
+	UpdatedAt  time.Time `gorm:"autoUpdateTime"`
+	ChatId     string    `gorm:"type:varchar(36);index"`
+	Chat       Chat      `gorm:"foreignKey:ChatId"`
+	UploaderId *string   `gorm:"type:varchar(36);index"` // nil once the uploader was purged
+	MessageId  *string   `gorm:"type:varchar(36);index"` // nil until the message is sent
+	ObjectKey  string    `gorm:"type:varchar(255)"`
+	Size       int64
+	MimeType   string     `gorm:"type:varchar(127)"`
+	Checksum   string     `gorm:"type:varchar(44)"` // base64 encoded sha256 of the encrypted object
+	ScanStatus ScanStatus `gorm:"type:varchar(16)"`
+}
+
+func (a *Attachment) BeforeCreate(tx *gorm.DB) (err error) {
+	a.Id = uuid.NewString()
+	if a.ScanStatus == "" {
+		a.ScanStatus = ScanPending
+	}
+	return
+}
+
+// ScanStatus is the verdict of the malware scan of an upload, only clean objects can be downloaded
+type ScanStatus string
+
+const (
+	ScanPending     ScanStatus = "pending"
+	ScanClean       ScanStatus = "clean"
+	ScanQuarantined ScanStatus = "quarantined"
+)
+
 type Chat struct {
 	Id          string    `gorm:"type:varchar(36);primaryKey"`
-	CreatedAt   time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP"`
-	UpdatedAt   time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP"`
+	CreatedAt   time.Time `gorm:"autoCreateTime"`
+	UpdatedAt   time.Time `gorm:"autoUpdateTime"`
 	Name        string    `gorm:"type:varchar(255)"`
-	Picture     *string   `gorm:"type:varchar(2048)"` // TODO: adjust for s3 file key
 	Description *string   `gorm:"type:text"`
-	Messages    []Message `gorm:"foreignKey:ChatId"`
+	// PictureKey is the object key of the picture, urls are signed on read like the profile pictures
+	PictureKey     *string    `gorm:"type:varchar(255)"`
+	PictureVersion *time.Time // set once the uploaded picture was sanitized and its variants were generated
+	PictureScan    ScanStatus `gorm:"type:varchar(16);default:clean"` // status of the last confirmed picture
+	PictureUpload  *string    `gorm:"type:varchar(255)"`              // staging object key of the last requested upload
+	PicturePending *string    `gorm:"type:varchar(255)"`              // object key of the confirmed picture while it is scanned
+	// MessageRetentionDays is the age in days after which messages are deleted, nil keeps them forever
+	MessageRetentionDays *int      `gorm:"type:int"`
+	Messages             []Message `gorm:"foreignKey:ChatId"`
 }
 
 func (c *Chat) BeforeCreate(tx *gorm.DB) (err error) {
 	c.Id = uuid.NewString()
+	if c.PictureScan == "" {
+		c.PictureScan = ScanClean
+	}
 	return
 }
 
+// UserRole decides which endpoints a user may call, admins can additionally use the /admin endpoints
+type UserRole string
+
+const (
+	RoleUser  UserRole = "user"
+	RoleAdmin UserRole = "admin"
+)
+
 type User struct {
 	Id             string         `gorm:"type:varchar(36);primaryKey" json:"id"`
-	CreatedAt      time.Time      `gorm:"type:datetime;default:CURRENT_TIMESTAMP" json:"createdAt"`
-	UpdatedAt      time.Time      `gorm:"type:datetime;default:CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP" json:"updatedAt"`
+	CreatedAt      time.Time      `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt      time.Time      `gorm:"autoUpdateTime" json:"updatedAt"`
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
 	Email          string         `gorm:"type:varchar(255);uniqueIndex" json:"email"`
 	Password       string         `gorm:"type:text" json:"-"`
 	Name           string         `gorm:"type:varchar(50)" json:"name"`
 	Bio            *string        `gorm:"type:varchar(1000)" json:"bio"`
 	Iv             string         `gorm:"type:varchar(25)" json:"iv"`
-	ProfilePicture *string        `gorm:"type:varchar(512)" json:"profilePicture"`
+	PictureKey     *string        `gorm:"type:varchar(255)" json:"-"`              // object key of the profile picture, urls are signed on read
+	PictureVersion *time.Time     `json:"-"`                                       // set once the uploaded picture was sanitized and its variants were generated
+	PictureScan    ScanStatus     `gorm:"type:varchar(16);default:clean" json:"-"` // status of the last confirmed picture
+	PictureUpload  *string        `gorm:"type:varchar(255)" json:"-"`              // staging object key of the last requested upload
+	PicturePending *string        `gorm:"type:varchar(255)" json:"-"`              // object key of the confirmed picture while it is scanned
 	PublicKey      string         `gorm:"type:text" json:"publicKey"`
 	PrivateKey     string         `gorm:"type:text" json:"privateKey"`
+	Role           UserRole       `gorm:"type:varchar(16);default:user" json:"role"`
+	DisabledAt     *time.Time     `json:"-"` // set while an admin has disabled the account
+	LastSeenAt     *time.Time     `json:"-"` // last authenticated request, users seen within PUSH_ONLINE_WINDOW are not notified
 	Keys           []ChatUserKeys `gorm:"foreignKey:UserId" json:"-"`
 }
 
 func (u *User) BeforeCreate(tx *gorm.DB) (err error) {
 	u.Id = uuid.NewString()
+	if u.Role == "" {
+		u.Role = RoleUser
+	}
+	if u.PictureScan == "" {
+		u.PictureScan = ScanClean
+	}
 	return
 }
 
 type ChatUserKeys struct {
-	Id        string    `gorm:"type:varchar(36);primaryKey"`
-	CreatedAt time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP"`
-	UpdatedAt time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP"`
-	Key       string    `gorm:"type:text"`
-	ChatId    string    `gorm:"type:varchar(36);index"`
-	Chat      Chat      `gorm:"foreignKey:ChatId"`
-	UserId    string    `gorm:"type:varchar(36);index"`
-	User      User      `gorm:"foreignKey:UserId"`
+	Id        string         `gorm:"type:varchar(36);primaryKey"`
+	CreatedAt time.Time      `gorm:"autoCreateTime"`
+	UpdatedAt time.Time      `gorm:"autoUpdateTime"`
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+	Key       string         `gorm:"type:text"`
+	ChatId    string         `gorm:"type:varchar(36);index"`
+	Chat      Chat           `gorm:"foreignKey:ChatId"`
+	UserId    string         `gorm:"type:varchar(36);index"`
+	User      User           `gorm:"foreignKey:UserId"`
+	Role      ChatRole       `gorm:"type:varchar(16);default:member"`
+	Muted     bool           // no push notifications about the chat are sent to the member
+	MuteUntil *time.Time     // the mute ends on its own at this time, nil mutes until the member unmutes
 }
 
 func (cuk *ChatUserKeys) BeforeCreate(tx *gorm.DB) (err error) {
 	cuk.Id = uuid.NewString()
+	if cuk.Role == "" {
+		cuk.Role = ChatRoleMember
+	}
 	return
 }
 
+// IsMuted reports whether the member muted the chat at the given time
+func (cuk *ChatUserKeys) IsMuted(now time.Time) bool {
+	return cuk.Muted && (cuk.MuteUntil == nil || cuk.MuteUntil.After(now))
+}
+
+// ChatRole decides what a member may change in a chat, the creator of a chat is its admin
+type ChatRole string
+
+const (
+	ChatRoleMember ChatRole = "member"
+	ChatRoleAdmin  ChatRole = "admin"
+)
+
 type UserKeys struct {
 	Id        string    `gorm:"type:varchar(36);primaryKey"`
-	CreatedAt time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP"`
-	UpdatedAt time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP"`
-	ExpiredAt time.Time `gorm:"type:datetime"`
-	Random    string    `gorm:"type:varchar(36)"`
-	User      User      `gorm:"foreignKey:UserId"`
-	UserId    string    `gorm:"type:varchar(36);index"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime"`
+	ExpiredAt time.Time
+	Random    string `gorm:"type:varchar(36)"`
+	User      User   `gorm:"foreignKey:UserId"`
+	UserId    string `gorm:"type:varchar(36);index"`
 }
 
 func (uk *UserKeys) BeforeCreate(tx *gorm.DB) (err error) {
 	uk.Id = uuid.NewString()
 	return
 }
+
+// ExportStatus is the state of a data export, pending exports have not been picked up yet
+type ExportStatus string
+
+const (
+	ExportPending ExportStatus = "pending"
+	ExportRunning ExportStatus = "running"
+	ExportReady   ExportStatus = "ready"
+	ExportFailed  ExportStatus = "failed"
+)
+
+// DataExport is an archive with all data of a user, the archive itself is stored in the export bucket
+type DataExport struct {
+	Id          string       `gorm:"type:varchar(36);primaryKey"`
+	CreatedAt   time.Time    `gorm:"autoCreateTime"`
+	UpdatedAt   time.Time    `gorm:"autoUpdateTime"`
+	UserId      string       `gorm:"type:varchar(36);index"`
+	User        User         `gorm:"foreignKey:UserId"`
+	Status      ExportStatus `gorm:"type:varchar(16)"`
+	ObjectKey   *string      `gorm:"type:varchar(255)"` // set once the archive is uploaded
+	CompletedAt *time.Time
+}
+
+func (de *DataExport) BeforeCreate(tx *gorm.DB) (err error) {
+	de.Id = uuid.NewString()
+	return
+}
+
+// AdminAuditLog records an action of an admin, entries are never updated or deleted
+type AdminAuditLog struct {
+	Id         string    `gorm:"type:varchar(36);primaryKey" json:"id"`
+	CreatedAt  time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	AdminId    *string   `gorm:"type:varchar(36);index" json:"adminId"` // nil for actions run from the cli or once the admin was purged
+	Action     string    `gorm:"type:varchar(64)" json:"action"`
+	TargetType string    `gorm:"type:varchar(16)" json:"targetType"`
+	TargetId   *string   `gorm:"type:varchar(36)" json:"targetId"`
+	Details    *string   `gorm:"type:text" json:"details"`
+}
+
+func (a *AdminAuditLog) BeforeCreate(tx *gorm.DB) (err error) {
+	a.Id = uuid.NewString()
+	return
+}
+
+// SecurityEventKind is the type of a security event
+type SecurityEventKind string
+
+const (
+	EventLoginSucceeded  SecurityEventKind = "login.succeeded"
+	EventLoginFailed     SecurityEventKind = "login.failed"
+	EventLogout          SecurityEventKind = "logout"
+	EventTokenRefreshed  SecurityEventKind = "token.refreshed"
+	EventAccountDeleted  SecurityEventKind = "account.deleted"
+	EventChatCreated     SecurityEventKind = "chat.created"
+	EventChatMemberAdded SecurityEventKind = "chat.member_added"
+)
+
+// SecurityEvent records activity on an account, events are never updated or deleted.
+// Failed logins with an unknown email are stored without a user, the email itself is never stored.
+type SecurityEvent struct {
+	Id        string            `gorm:"type:varchar(36);primaryKey" json:"id"`
+	CreatedAt time.Time         `gorm:"autoCreateTime" json:"createdAt"`
+	UserId    *string           `gorm:"type:varchar(36);index" json:"userId"` // nil for unknown accounts or once the user was purged
+	Kind      SecurityEventKind `gorm:"type:varchar(32)" json:"kind"`
+	Ip        string            `gorm:"type:varchar(45)" json:"ip"`
+	UserAgent string            `gorm:"type:varchar(255)" json:"userAgent"`
+	Details   *string           `gorm:"type:text" json:"details"`
+}
+
+func (se *SecurityEvent) BeforeCreate(tx *gorm.DB) (err error) {
+	se.Id = uuid.NewString()
+	return
+}
+
+// JobStatus is the state of a background job, jobs that succeeded are deleted
+type JobStatus string
+
+const (
+	JobQueued  JobStatus = "queued"
+	JobRunning JobStatus = "running"
+	JobDead    JobStatus = "dead" // out of attempts or failed permanently, only requeued by hand
+)
+
+// Job is a unit of background work, the payload is the json of the typed job.
+// A running job is leased by one worker until LeasedUntil, it is due again if the worker did not finish it by then.
+type Job struct {
+	Id          string    `gorm:"type:varchar(36);primaryKey"`
+	CreatedAt   time.Time `gorm:"autoCreateTime"`
+	UpdatedAt   time.Time `gorm:"autoUpdateTime"`
+	Type        string    `gorm:"type:varchar(64)"`
+	Payload     string    `gorm:"type:text"`
+	Status      JobStatus `gorm:"type:varchar(16)"`
+	Attempts    int       // counted when the job is leased
+	RunAt       time.Time // the job is not leased before
+	LeaseToken  *string   `gorm:"type:varchar(36)"` // identifies the lease, a worker that lost its lease can not change the job
+	LeasedUntil *time.Time
+	LastError   *string `gorm:"type:text"`
+}
+
+func (j *Job) BeforeCreate(tx *gorm.DB) (err error) {
+	j.Id = uuid.NewString()
+	if j.Status == "" {
+		j.Status = JobQueued
+	}
+	if j.RunAt.IsZero() {
+		j.RunAt = time.Now()
+	}
+	return
+}
+
+// PushPlatform is the push service a device is registered with
+type PushPlatform string
+
+const (
+	PushWeb  PushPlatform = "webpush"
+	PushFCM  PushPlatform = "fcm"
+	PushAPNs PushPlatform = "apns"
+)
+
+// PushDevice is notified about new messages while its user is offline. The token is the endpoint of a web push
+// subscription or the registration token of fcm or apns, a token belongs to the user that registered it last.
+type PushDevice struct {
+	Id        string       `gorm:"type:varchar(36);primaryKey"`
+	CreatedAt time.Time    `gorm:"autoCreateTime"`
+	UpdatedAt time.Time    `gorm:"autoUpdateTime"`
+	UserId    string       `gorm:"type:varchar(36);index"`
+	User      User         `gorm:"foreignKey:UserId"`
+	Platform  PushPlatform `gorm:"type:varchar(16)"`
+	Token     string       `gorm:"type:varchar(512)"`
+	P256dh    *string      `gorm:"type:varchar(128)"` // public key of a web push subscription, the payload is encrypted for it
+	Auth      *string      `gorm:"type:varchar(32)"`  // authentication secret of a web push subscription
+}
+
+func (pd *PushDevice) BeforeCreate(tx *gorm.DB) (err error) {
+	pd.Id = uuid.NewString()
+	return
+}
@@ -0,0 +1,72 @@
+package database
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RetryOptions configures the exponential backoff used by Connect
+type RetryOptions struct {
+	// MaxAttempts is the number of connection attempts, 0 retries until the context is cancelled
+	MaxAttempts     int
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	Multiplier      float64
+	// Jitter randomizes every wait by up to this fraction in both directions, between 0 and 1
+	Jitter float64
+}
+
+// Connect opens the database like NewDatabaseInst and retries with exponential backoff until it succeeds,
+// the attempts are exhausted or ctx is cancelled. onRetry is called before every wait.
+// A malformed url is returned right away as retrying can not fix it.
+func Connect(ctx context.Context, url string, config *gorm.Config, opts Options, onRetry func(attempt int, wait time.Duration, err error)) (*DatabaseInst, error) {
+	if _, _, err := openDialector(url); err != nil {
+		return nil, err
+	}
+
+	for attempt := 1; ; attempt++ {
+		inst, err := NewDatabaseInst(url, config, opts)
+		if err == nil {
+			return inst, nil
+		}
+
+		if opts.Retry.MaxAttempts > 0 && attempt >= opts.Retry.MaxAttempts {
+			return nil, err
+		}
+
+		wait := opts.Retry.backoff(attempt)
+		if onRetry != nil {
+			onRetry(attempt, wait, err)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff returns the wait after the given failed attempt, starting at 1
+func (r RetryOptions) backoff(attempt int) time.Duration {
+	multiplier := r.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	wait := float64(r.InitialInterval) * math.Pow(multiplier, float64(attempt-1))
+	if r.MaxInterval > 0 && wait > float64(r.MaxInterval) {
+		wait = float64(r.MaxInterval)
+	}
+
+	jitter := math.Min(math.Max(r.Jitter, 0), 1)
+	wait *= 1 + jitter*(2*rand.Float64()-1)
+
+	return time.Duration(wait)
+}
@@ -0,0 +1,305 @@
+package e2e
+
+import (
+	"context"
+	"easyflow-backend/src/api/admin"
+	"easyflow-backend/src/api/auth"
+	"easyflow-backend/src/database"
+	"easyflow-backend/src/enum"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// newAdmin returns a logged in client whose user was granted the admin role through the cli service
+func (h *harness) newAdmin(name string) *client {
+	h.t.Helper()
+
+	c := h.newUser(name)
+	if err := admin.SetRole(context.Background(), h.repos, c.user.Email, database.RoleAdmin); err != nil {
+		h.t.Fatalf("could not grant admin role: %s", err)
+	}
+
+	return c
+}
+
+// auditActions returns the actions of all audit log entries, oldest first
+func (h *harness) auditActions() []string {
+	h.t.Helper()
+
+	var entries []database.AdminAuditLog
+	if err := h.db.GetClient().Order("created_at").Find(&entries).Error; err != nil {
+		h.t.Fatalf("could not list audit logs: %s", err)
+	}
+
+	actions := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		actions = append(actions, entry.Action)
+	}
+	return actions
+}
+
+func TestAdminGuard(t *testing.T) {
+	runEndpointCases(t, []endpointCase{
+		{
+			name:   "admin",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				return h.newAdmin("root"), "/admin/users", nil
+			},
+			status: http.StatusOK,
+		},
+		{
+			name:   "regular user",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				return h.newUser("alice"), "/admin/users", nil
+			},
+			status: http.StatusForbidden,
+			code:   enum.NotAllowed,
+		},
+		{
+			name:   "revoked role",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				c := h.newAdmin("root")
+				if err := admin.SetRole(context.Background(), h.repos, c.user.Email, database.RoleUser); err != nil {
+					h.t.Fatalf("could not revoke admin role: %s", err)
+				}
+				return c, "/admin/users", nil
+			},
+			status: http.StatusForbidden,
+			code:   enum.NotAllowed,
+			check: func(t *testing.T, h *harness, c *client, r *response) {
+				actions := h.auditActions()
+				if len(actions) != 2 || actions[0] != admin.ActionGrantAdmin || actions[1] != admin.ActionRevokeAdmin {
+					t.Fatalf("role changes were not audited: %v", actions)
+				}
+			},
+		},
+		{
+			name:   "logged out",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				return h.newClient(), "/admin/users", nil
+			},
+			status: http.StatusBadRequest,
+			code:   enum.InvalidCookie,
+		},
+	})
+}
+
+func TestAdminSearchUsers(t *testing.T) {
+	runEndpointCases(t, []endpointCase{
+		{
+			name:   "matches name and email",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				h.newUser("alice")
+				h.newUser("bob")
+				return h.newAdmin("root"), "/admin/users?query=ALI", nil
+			},
+			status: http.StatusOK,
+			check: func(t *testing.T, h *harness, c *client, r *response) {
+				var users []admin.UserResponse
+				r.decode(&users)
+				if len(users) != 1 || users[0].Name != "alice" || users[0].Role != database.RoleUser {
+					t.Fatalf("unexpected search result: %+v", users)
+				}
+
+				actions := h.auditActions()
+				if actions[len(actions)-1] != admin.ActionSearchUsers {
+					t.Fatalf("search was not audited: %v", actions)
+				}
+			},
+		},
+		{
+			name:   "pagination",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				h.newUser("alice")
+				h.newUser("bob")
+				return h.newAdmin("root"), "/admin/users?limit=2&offset=1", nil
+			},
+			status: http.StatusOK,
+			check: func(t *testing.T, h *harness, c *client, r *response) {
+				var users []admin.UserResponse
+				r.decode(&users)
+				if len(users) != 2 {
+					t.Fatalf("expected the second page to contain 2 users: %+v", users)
+				}
+			},
+		},
+		{
+			name:   "invalid limit",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				return h.newAdmin("root"), "/admin/users?limit=1000", nil
+			},
+			status: http.StatusBadRequest,
+			code:   enum.MalformedRequest,
+		},
+	})
+}
+
+func TestAdminDisableUser(t *testing.T) {
+	h := newHarness(t)
+	root := h.newAdmin("root")
+	alice := h.newUser("alice")
+
+	var disabled admin.UserResponse
+	root.do(http.MethodPost, "/admin/users/"+alice.user.Id+"/disable", nil).expect(http.StatusOK).decode(&disabled)
+	if disabled.DisabledAt == nil {
+		t.Fatalf("user was not disabled: %+v", disabled)
+	}
+
+	// the sessions are gone and a new login is rejected
+	alice.do(http.MethodGet, "/auth/refresh", nil).expectError(498, enum.InvalidRefreshToken)
+	h.newClient().do(http.MethodPost, "/auth/login", auth.LoginRequest{
+		Email:    alice.user.Email,
+		Password: alice.user.Password,
+	}).expectError(http.StatusForbidden, enum.AccountDisabled)
+
+	var enabled admin.UserResponse
+	root.do(http.MethodPost, "/admin/users/"+alice.user.Id+"/enable", nil).expect(http.StatusOK).decode(&enabled)
+	if enabled.DisabledAt != nil {
+		t.Fatalf("user was not enabled: %+v", enabled)
+	}
+	h.newClient().login(alice.user)
+
+	root.do(http.MethodPost, "/admin/users/"+root.user.Id+"/disable", nil).expectError(http.StatusForbidden, enum.NotAllowed)
+	root.do(http.MethodPost, "/admin/users/unknown/disable", nil).expectError(http.StatusNotFound, enum.NotFound)
+
+	actions := h.auditActions()
+	if !containsAll(actions, admin.ActionDisableUser, admin.ActionEnableUser) {
+		t.Fatalf("state changes were not audited: %v", actions)
+	}
+}
+
+func TestAdminDeleteUser(t *testing.T) {
+	runEndpointCases(t, []endpointCase{
+		{
+			name:   "purges the user",
+			method: http.MethodDelete,
+			prepare: func(h *harness) (*client, string, any) {
+				root, alice, bob := h.newAdmin("root"), h.newUser("alice"), h.newUser("bob")
+				alice.createChat("talk", bob)
+				return root, "/admin/users/" + alice.user.Id, nil
+			},
+			status: http.StatusNoContent,
+			check: func(t *testing.T, h *harness, c *client, r *response) {
+				userId := strings.TrimPrefix(r.path, "/admin/users/")
+				if h.unscopedCount(&database.User{}, "id = ?", userId) != 0 {
+					t.Fatalf("user was not purged")
+				}
+				if h.unscopedCount(&database.ChatUserKeys{}, "user_id = ?", userId) != 0 {
+					t.Fatalf("memberships of the user were not purged")
+				}
+			},
+		},
+		{
+			name:   "own account",
+			method: http.MethodDelete,
+			prepare: func(h *harness) (*client, string, any) {
+				root := h.newAdmin("root")
+				return root, "/admin/users/" + root.user.Id, nil
+			},
+			status: http.StatusForbidden,
+			code:   enum.NotAllowed,
+		},
+		{
+			name:   "unknown user",
+			method: http.MethodDelete,
+			prepare: func(h *harness) (*client, string, any) {
+				return h.newAdmin("root"), "/admin/users/unknown", nil
+			},
+			status: http.StatusNotFound,
+			code:   enum.NotFound,
+		},
+	})
+}
+
+func TestAdminChats(t *testing.T) {
+	h := newHarness(t)
+	root, alice, bob := h.newAdmin("root"), h.newUser("alice"), h.newUser("bob")
+	talk := alice.createChat("Team talk", bob)
+	alice.sendMessage(talk.Id, "secret content")
+
+	var chats []admin.ChatResponse
+	root.do(http.MethodGet, "/admin/chats?query=team", nil).expect(http.StatusOK).decode(&chats)
+	if len(chats) != 1 || chats[0].Id != talk.Id || chats[0].MemberCount != 2 || chats[0].MemberIds != nil {
+		t.Fatalf("unexpected search result: %+v", chats)
+	}
+
+	r := root.do(http.MethodGet, "/admin/chats/"+talk.Id, nil).expect(http.StatusOK)
+	if body := r.rec.Body.String(); strings.Contains(body, "secret content") || strings.Contains(body, "key-") {
+		t.Fatalf("chat metadata exposes content: %s", body)
+	}
+	var details admin.ChatResponse
+	r.decode(&details)
+	if details.MemberCount != 2 || !containsAll(details.MemberIds, alice.user.Id, bob.user.Id) {
+		t.Fatalf("unexpected chat metadata: %+v", details)
+	}
+
+	root.do(http.MethodDelete, "/admin/chats/"+talk.Id, nil).expect(http.StatusNoContent)
+	if h.unscopedCount(&database.Chat{}, "id = ?", talk.Id) != 0 || h.unscopedCount(&database.Message{}, "chat_id = ?", talk.Id) != 0 {
+		t.Fatalf("chat was not purged")
+	}
+	root.do(http.MethodGet, "/admin/chats/"+talk.Id, nil).expectError(http.StatusNotFound, enum.NotFound)
+	root.do(http.MethodDelete, "/admin/chats/"+talk.Id, nil).expectError(http.StatusNotFound, enum.NotFound)
+
+	actions := h.auditActions()
+	if !containsAll(actions, admin.ActionSearchChats, admin.ActionViewChat, admin.ActionDeleteChat) {
+		t.Fatalf("chat actions were not audited: %v", actions)
+	}
+}
+
+func TestAdminAuditLogs(t *testing.T) {
+	h := newHarness(t)
+	root, alice := h.newAdmin("root"), h.newUser("alice")
+	root.do(http.MethodPost, "/admin/users/"+alice.user.Id+"/disable", nil).expect(http.StatusOK)
+
+	var entries []database.AdminAuditLog
+	root.do(http.MethodGet, "/admin/audit-logs", nil).expect(http.StatusOK).decode(&entries)
+	if len(entries) != 2 || entries[0].Action != admin.ActionGrantAdmin || entries[0].AdminId != nil {
+		t.Fatalf("unexpected audit log: %+v", entries)
+	}
+	if entries[1].Action != admin.ActionDisableUser || *entries[1].AdminId != root.user.Id || *entries[1].TargetId != alice.user.Id {
+		t.Fatalf("unexpected audit log entry: %+v", entries[1])
+	}
+
+	root.do(http.MethodGet, "/admin/audit-logs?since=yesterday", nil).expectError(http.StatusBadRequest, enum.MalformedRequest)
+
+	r := root.do(http.MethodGet, "/admin/audit-logs/export", nil).expect(http.StatusOK)
+	if contentType := r.rec.Header().Get("Content-Type"); contentType != "application/x-ndjson" {
+		t.Fatalf("unexpected content type: %s", contentType)
+	}
+	if !strings.HasPrefix(r.rec.Header().Get("Content-Disposition"), "attachment;") {
+		t.Fatalf("export is not an attachment")
+	}
+
+	lines := strings.Split(strings.TrimSpace(r.rec.Body.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 exported entries, got: %v", lines)
+	}
+	var last database.AdminAuditLog
+	if err := json.Unmarshal([]byte(lines[2]), &last); err != nil || last.Action != admin.ActionListAuditLogs {
+		t.Fatalf("unexpected exported entry: %s", lines[2])
+	}
+
+	actions := h.auditActions()
+	if actions[len(actions)-1] != admin.ActionExportAuditLog {
+		t.Fatalf("export was not audited: %v", actions)
+	}
+}
+
+func containsAll(values []string, expected ...string) bool {
+	for _, value := range expected {
+		if !slices.Contains(values, value) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,306 @@
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"easyflow-backend/src/api/chat"
+	"easyflow-backend/src/database"
+	"easyflow-backend/src/enum"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// describeFile returns the attachment request for the encrypted content
+func describeFile(content []byte) chat.CreateAttachmentRequest {
+	sum := sha256.Sum256(content)
+	return chat.CreateAttachmentRequest{
+		Size:     int64(len(content)),
+		MimeType: "image/png",
+		Checksum: base64.StdEncoding.EncodeToString(sum[:]),
+	}
+}
+
+// createAttachment requests an upload slot for the content in the chat without uploading it
+func (c *client) createAttachment(chatId string, content []byte) chat.CreateAttachmentResponse {
+	c.h.t.Helper()
+
+	var created chat.CreateAttachmentResponse
+	c.do(http.MethodPost, "/chat/"+chatId+"/attachments", describeFile(content)).expect(http.StatusCreated).decode(&created)
+	return created
+}
+
+// upload sends the content to the presigned url like a browser would and returns the status of the bucket
+func (h *harness) upload(uploadURL string, headers map[string]string, content []byte) int {
+	h.t.Helper()
+
+	req, err := http.NewRequest(http.MethodPut, uploadURL, bytes.NewReader(content))
+	if err != nil {
+		h.t.Fatalf("could not build upload: %s", err)
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		h.t.Fatalf("could not upload attachment: %s", err)
+	}
+	defer res.Body.Close()
+
+	return res.StatusCode
+}
+
+func (c *client) sendMessageWith(chatId string, attachmentIds ...string) *response {
+	c.h.t.Helper()
+
+	return c.do(http.MethodPost, "/chat/"+chatId+"/messages", chat.SendMessageRequest{
+		Content:       "encrypted",
+		Iv:            "iv",
+		AttachmentIds: attachmentIds,
+	})
+}
+
+func TestAttachmentRoundTrip(t *testing.T) {
+	h := newHarness(t)
+	alice, bob, talk := h.newTalk()
+	content := []byte("encrypted picture")
+
+	created := alice.createAttachment(talk.Id, content)
+	if len(created.UploadHeaders) == 0 || created.UploadHeaders["Content-Type"] != "image/png" {
+		t.Fatalf("upload is not restricted to the described file: %+v", created.UploadHeaders)
+	}
+	if status := h.upload(created.UploadURL, created.UploadHeaders, content); status != http.StatusOK {
+		t.Fatalf("upload failed with status %d", status)
+	}
+
+	var message chat.MessageEntry
+	alice.sendMessageWith(talk.Id, created.Id).expect(http.StatusCreated).decode(&message)
+	if len(message.Attachments) != 1 || message.Attachments[0].Id != created.Id || message.Attachments[0].Size != int64(len(content)) {
+		t.Fatalf("unexpected message: %+v", message)
+	}
+
+	var fetched chat.GetChatByIdResponse
+	bob.do(http.MethodGet, "/chat/"+talk.Id, nil).expect(http.StatusOK).decode(&fetched)
+	if len(fetched.Messages) != 1 || len(fetched.Messages[0].Attachments) != 1 || fetched.Messages[0].Attachments[0].Checksum != describeFile(content).Checksum {
+		t.Fatalf("attachment is missing from the chat: %+v", fetched.Messages)
+	}
+
+	var download chat.GetAttachmentResponse
+	bob.do(http.MethodGet, "/chat/"+talk.Id+"/attachments/"+created.Id, nil).expect(http.StatusOK).decode(&download)
+	if !strings.Contains(download.DownloadURL, "/"+testAttachments+"/chats/"+talk.Id+"/") || download.MimeType != "image/png" {
+		t.Fatalf("unexpected download: %+v", download)
+	}
+
+	res, err := http.Get(download.DownloadURL)
+	if err != nil {
+		t.Fatalf("could not download attachment: %s", err)
+	}
+	defer res.Body.Close()
+	if body, _ := io.ReadAll(res.Body); !bytes.Equal(body, content) {
+		t.Fatalf("unexpected attachment content: %q", body)
+	}
+
+	// the object key does not reveal the uploader or the file
+	if strings.Contains(download.DownloadURL, alice.user.Id) || strings.Contains(download.DownloadURL, created.Id) {
+		t.Fatalf("object key is not random: %s", download.DownloadURL)
+	}
+
+	// an attachment is only sent once
+	alice.sendMessageWith(talk.Id, created.Id).expectError(http.StatusConflict, enum.AlreadyExists)
+}
+
+func TestAttachToMessageWithRepeatedIds(t *testing.T) {
+	h := newHarness(t)
+	alice := h.newUser("alice")
+	talk := alice.createChat("talk")
+	created := alice.createAttachment(talk.Id, []byte("file"))
+	h.upload(created.UploadURL, created.UploadHeaders, []byte("file"))
+
+	// the request validation refuses repeated ids
+	alice.sendMessageWith(talk.Id, created.Id, created.Id).expect(http.StatusInternalServerError)
+
+	message := alice.sendMessage(talk.Id, "hello")
+	if err := h.repos.Attachments.AttachToMessage(context.Background(), []string{created.Id, created.Id}, message.Id); err != nil {
+		t.Fatalf("repeated id was not linked: %s", err)
+	}
+	attachment, err := h.repos.Attachments.GetById(context.Background(), talk.Id, created.Id)
+	if err != nil || attachment.MessageId == nil || *attachment.MessageId != message.Id {
+		t.Fatalf("attachment was not linked: %+v, %v", attachment, err)
+	}
+}
+
+func TestAttachmentUploadIsConstrained(t *testing.T) {
+	h := newHarness(t)
+	alice := h.newUser("alice")
+	talk := alice.createChat("talk")
+
+	created := alice.createAttachment(talk.Id, []byte("encrypted picture"))
+	if status := h.upload(created.UploadURL, created.UploadHeaders, []byte("something different")); status == http.StatusOK {
+		t.Fatalf("upload of a different file was accepted")
+	}
+
+	alice.sendMessageWith(talk.Id, created.Id).expectError(http.StatusBadRequest, enum.MalformedRequest)
+	if h.unscopedCount(&database.Message{}, "chat_id = ?", talk.Id) != 0 {
+		t.Fatalf("message with a missing attachment was stored")
+	}
+}
+
+func TestAttachmentsArePurgedWithTheChat(t *testing.T) {
+	h := newHarness(t)
+	alice := h.newUser("alice")
+	talk := alice.createChat("talk")
+	content := []byte("encrypted picture")
+
+	created := alice.createAttachment(talk.Id, content)
+	h.upload(created.UploadURL, created.UploadHeaders, content)
+	alice.sendMessageWith(talk.Id, created.Id).expect(http.StatusCreated)
+
+	if err := h.repos.Chats.Purge(context.Background(), talk.Id); err != nil {
+		t.Fatalf("could not purge chat: %s", err)
+	}
+	if h.unscopedCount(&database.Attachment{}, "id = ?", created.Id) != 0 {
+		t.Fatalf("attachment of the purged chat was kept")
+	}
+}
+
+func TestCreateAttachment(t *testing.T) {
+	runEndpointCases(t, []endpointCase{
+		{
+			name:   "not a member",
+			method: http.MethodPost,
+			prepare: func(h *harness) (*client, string, any) {
+				talk := h.newUser("alice").createChat("talk")
+				return h.newUser("mallory"), "/chat/" + talk.Id + "/attachments", describeFile([]byte("file"))
+			},
+			status: http.StatusForbidden,
+			code:   enum.NotAllowed,
+		},
+		{
+			name:   "unknown chat",
+			method: http.MethodPost,
+			prepare: func(h *harness) (*client, string, any) {
+				return h.newUser("alice"), "/chat/00000000-0000-0000-0000-000000000000/attachments", describeFile([]byte("file"))
+			},
+			status: http.StatusNotFound,
+			code:   enum.NotFound,
+		},
+		{
+			name:   "too large",
+			method: http.MethodPost,
+			prepare: func(h *harness) (*client, string, any) {
+				alice := h.newUser("alice")
+				talk := alice.createChat("talk")
+				payload := describeFile([]byte("file"))
+				payload.Size = int64(h.cfg.AttachmentMaxSize) + 1
+				return alice, "/chat/" + talk.Id + "/attachments", payload
+			},
+			status: http.StatusRequestEntityTooLarge,
+			code:   enum.FileTooLarge,
+		},
+	})
+}
+
+func TestSendMessage(t *testing.T) {
+	runEndpointCases(t, []endpointCase{
+		{
+			name:   "without attachments",
+			method: http.MethodPost,
+			prepare: func(h *harness) (*client, string, any) {
+				alice := h.newUser("alice")
+				talk := alice.createChat("talk")
+				return alice, "/chat/" + talk.Id + "/messages", chat.SendMessageRequest{Content: "encrypted", Iv: "iv"}
+			},
+			status: http.StatusCreated,
+			check: func(t *testing.T, h *harness, c *client, r *response) {
+				var message chat.MessageEntry
+				r.decode(&message)
+				if message.SenderId == nil || *message.SenderId != c.user.Id || message.Attachments == nil {
+					t.Fatalf("unexpected message: %+v", message)
+				}
+			},
+		},
+		{
+			name:   "not a member",
+			method: http.MethodPost,
+			prepare: func(h *harness) (*client, string, any) {
+				talk := h.newUser("alice").createChat("talk")
+				return h.newUser("mallory"), "/chat/" + talk.Id + "/messages", chat.SendMessageRequest{Content: "encrypted", Iv: "iv"}
+			},
+			status: http.StatusForbidden,
+			code:   enum.NotAllowed,
+		},
+		{
+			name:   "attachment of another member",
+			method: http.MethodPost,
+			prepare: func(h *harness) (*client, string, any) {
+				alice, bob, talk := h.newTalk()
+				created := alice.createAttachment(talk.Id, []byte("file"))
+				h.upload(created.UploadURL, created.UploadHeaders, []byte("file"))
+				return bob, "/chat/" + talk.Id + "/messages", chat.SendMessageRequest{Content: "encrypted", Iv: "iv", AttachmentIds: []string{created.Id}}
+			},
+			status: http.StatusForbidden,
+			code:   enum.NotAllowed,
+		},
+		{
+			name:   "attachment of another chat",
+			method: http.MethodPost,
+			prepare: func(h *harness) (*client, string, any) {
+				alice := h.newUser("alice")
+				first, second := alice.createChat("first"), alice.createChat("second")
+				created := alice.createAttachment(first.Id, []byte("file"))
+				h.upload(created.UploadURL, created.UploadHeaders, []byte("file"))
+				return alice, "/chat/" + second.Id + "/messages", chat.SendMessageRequest{Content: "encrypted", Iv: "iv", AttachmentIds: []string{created.Id}}
+			},
+			status: http.StatusNotFound,
+			code:   enum.NotFound,
+		},
+	})
+}
+
+func TestGetAttachment(t *testing.T) {
+	runEndpointCases(t, []endpointCase{
+		{
+			name:   "not a member",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				alice := h.newUser("alice")
+				talk := alice.createChat("talk")
+				created := alice.createAttachment(talk.Id, []byte("file"))
+				h.upload(created.UploadURL, created.UploadHeaders, []byte("file"))
+				alice.sendMessageWith(talk.Id, created.Id).expect(http.StatusCreated)
+				return h.newUser("mallory"), "/chat/" + talk.Id + "/attachments/" + created.Id, nil
+			},
+			status: http.StatusForbidden,
+			code:   enum.NotAllowed,
+		},
+		{
+			name:   "unsent attachment of another member",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				alice, bob, talk := h.newTalk()
+				created := alice.createAttachment(talk.Id, []byte("file"))
+				return bob, "/chat/" + talk.Id + "/attachments/" + created.Id, nil
+			},
+			status: http.StatusNotFound,
+			code:   enum.NotFound,
+		},
+		{
+			// attachments are scanned once they are sent
+			name:   "own unsent attachment",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				alice := h.newUser("alice")
+				talk := alice.createChat("talk")
+				created := alice.createAttachment(talk.Id, []byte("file"))
+				h.upload(created.UploadURL, created.UploadHeaders, []byte("file"))
+				return alice, "/chat/" + talk.Id + "/attachments/" + created.Id, nil
+			},
+			status: http.StatusConflict,
+			code:   enum.ScanPending,
+		},
+	})
+}
@@ -0,0 +1,251 @@
+package e2e
+
+import (
+	"easyflow-backend/src/api/auth"
+	"easyflow-backend/src/database"
+	"easyflow-backend/src/enum"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func TestLogin(t *testing.T) {
+	runEndpointCases(t, []endpointCase{
+		{
+			name:   "sets session cookies",
+			method: http.MethodPost,
+			prepare: func(h *harness) (*client, string, any) {
+				c := h.newClient()
+				user := c.signup("alice")
+				return c, "/auth/login", auth.LoginRequest{Email: user.Email, Password: user.Password}
+			},
+			status: http.StatusOK,
+			check: func(t *testing.T, h *harness, c *client, r *response) {
+				if c.cookie("access_token") == "" || c.cookie("refresh_token") == "" {
+					t.Fatalf("login did not set the session cookies")
+				}
+
+				var body map[string]int
+				r.decode(&body)
+				if body["accessTokenExpiresIn"] != h.cfg.JwtExpirationTime {
+					t.Fatalf("unexpected expiry: %v", body)
+				}
+			},
+		},
+		{
+			name:   "wrong password",
+			method: http.MethodPost,
+			prepare: func(h *harness) (*client, string, any) {
+				c := h.newClient()
+				user := c.signup("alice")
+				return c, "/auth/login", auth.LoginRequest{Email: user.Email, Password: "wrong-password"}
+			},
+			status: http.StatusUnauthorized,
+			code:   enum.WrongCredentials,
+		},
+		{
+			name:   "unknown email",
+			method: http.MethodPost,
+			prepare: func(h *harness) (*client, string, any) {
+				return h.newClient(), "/auth/login", auth.LoginRequest{Email: "nobody@example.com", Password: testPassword}
+			},
+			status: http.StatusUnauthorized,
+			code:   enum.WrongCredentials,
+		},
+		{
+			name:   "missing password",
+			method: http.MethodPost,
+			prepare: func(h *harness) (*client, string, any) {
+				return h.newClient(), "/auth/login", map[string]string{"email": "alice@example.com"}
+			},
+			status: http.StatusInternalServerError,
+			code:   enum.ApiError,
+		},
+	})
+}
+
+func TestCheckLogin(t *testing.T) {
+	runEndpointCases(t, []endpointCase{
+		{
+			name:   "logged in",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				return h.newUser("alice"), "/auth/check", nil
+			},
+			status: http.StatusOK,
+			check:  expectBody("true"),
+		},
+		{
+			name:   "logged out",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				return h.newClient(), "/auth/check", nil
+			},
+			status: http.StatusBadRequest,
+			code:   enum.InvalidCookie,
+		},
+		{
+			// every access token belongs to a session, a token without one can not be logged out
+			name:   "token without refresh random",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				c := h.newUser("alice")
+				token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, auth.JWTAccessTokenPayload{
+					RegisteredClaims: jwt.RegisteredClaims{
+						ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+						Issuer:    "easyflow",
+					},
+					UserId: c.user.Id,
+				}).SignedString([]byte(h.cfg.JwtSecret))
+				if err != nil {
+					h.t.Fatalf("could not sign token: %s", err)
+				}
+				c.setCookie("access_token", token)
+				return c, "/auth/check", nil
+			},
+			status: 498,
+			code:   enum.InvalidAccessToken,
+		},
+	})
+}
+
+func TestRefresh(t *testing.T) {
+	runEndpointCases(t, []endpointCase{
+		{
+			name:   "rotates the session",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				c := h.newUser("alice")
+				c.setCookie("previous_refresh_token", c.cookie("refresh_token"))
+				return c, "/auth/refresh", nil
+			},
+			status: http.StatusOK,
+			check: func(t *testing.T, h *harness, c *client, r *response) {
+				previous := c.cookie("previous_refresh_token")
+				if c.cookie("refresh_token") == previous {
+					t.Fatalf("refresh token was not rotated")
+				}
+				c.do(http.MethodGet, "/auth/check", nil).expect(http.StatusOK)
+
+				// the rotated token must not be usable again
+				c.setCookie("refresh_token", previous)
+				c.do(http.MethodGet, "/auth/refresh", nil).expectError(498, enum.InvalidRefreshToken)
+			},
+		},
+		{
+			name:   "without cookie",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				return h.newClient(), "/auth/refresh", nil
+			},
+			status: http.StatusBadRequest,
+			code:   enum.InvalidCookie,
+		},
+		{
+			name:   "empty refresh token",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				c := h.newClient()
+				c.setCookie("refresh_token", "")
+				return c, "/auth/refresh", nil
+			},
+			status: 498,
+			code:   enum.InvalidRefreshToken,
+		},
+		{
+			name:   "malformed refresh token",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				c := h.newClient()
+				c.setCookie("refresh_token", "not-a-jwt")
+				return c, "/auth/refresh", nil
+			},
+			status: 498,
+			code:   enum.InvalidRefreshToken,
+		},
+		{
+			name:   "expired refresh token",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				c := h.newUser("alice")
+				c.setCookie("refresh_token", h.token(c.user.Id, uuid.New(), -time.Minute, h.cfg.JwtSecret))
+				return c, "/auth/refresh", nil
+			},
+			status: 498,
+			code:   enum.ExpiredRefreshToken,
+		},
+		{
+			name:   "unknown session",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				c := h.newUser("alice")
+				c.setCookie("refresh_token", h.token(c.user.Id, uuid.New(), time.Hour, h.cfg.JwtSecret))
+				return c, "/auth/refresh", nil
+			},
+			status: 498,
+			code:   enum.InvalidRefreshToken,
+		},
+	})
+}
+
+func TestLogout(t *testing.T) {
+	runEndpointCases(t, []endpointCase{
+		{
+			name:   "ends the session",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				c := h.newUser("alice")
+				c.setCookie("previous_refresh_token", c.cookie("refresh_token"))
+				return c, "/auth/logout", nil
+			},
+			status: http.StatusOK,
+			check: func(t *testing.T, h *harness, c *client, r *response) {
+				if c.cookie("access_token") != "" || c.cookie("refresh_token") != "" {
+					t.Fatalf("logout did not clear the session cookies")
+				}
+
+				c.setCookie("refresh_token", c.cookie("previous_refresh_token"))
+				c.do(http.MethodGet, "/auth/refresh", nil).expectError(498, enum.InvalidRefreshToken)
+			},
+		},
+		{
+			name:   "keeps the other sessions",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				c := h.newUser("alice")
+				h.newClient().login(c.user)
+				return c, "/auth/logout", nil
+			},
+			status: http.StatusOK,
+			check: func(t *testing.T, h *harness, c *client, r *response) {
+				// only the session of the refresh token is ended
+				if count := h.unscopedCount(&database.UserKeys{}, "user_id = ?", c.user.Id); count != 1 {
+					t.Fatalf("expected the other session to remain, got %d sessions", count)
+				}
+			},
+		},
+		{
+			name:   "without refresh cookie",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				c := h.newUser("alice")
+				c.jar.SetCookies(baseURL, []*http.Cookie{{Name: "refresh_token", Path: "/", MaxAge: -1}})
+				return c, "/auth/logout", nil
+			},
+			status: http.StatusBadRequest,
+			code:   enum.InvalidRefreshToken,
+		},
+		{
+			name:   "without login",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				return h.newClient(), "/auth/logout", nil
+			},
+			status: http.StatusBadRequest,
+			code:   enum.InvalidCookie,
+		},
+	})
+}
@@ -0,0 +1,202 @@
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"easyflow-backend/src/api/chat"
+	"easyflow-backend/src/enum"
+	"fmt"
+	"image/jpeg"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// uploadChatPicture uploads the picture through a presigned url and returns the response of the confirmation
+func (c *client) uploadChatPicture(chatId string, mimeType string, picture []byte) *response {
+	c.h.t.Helper()
+
+	var upload chat.UploadChatPictureResponse
+	c.do(http.MethodGet, fmt.Sprintf("/chat/%s/upload-picture?mimeType=%s&size=%d", chatId, mimeType, len(picture)), nil).
+		expect(http.StatusOK).decode(&upload)
+	if status := c.h.upload(upload.UploadURL, upload.UploadHeaders, picture); status != http.StatusOK {
+		c.h.t.Fatalf("upload failed with status %d", status)
+	}
+
+	return c.do(http.MethodPost, "/chat/"+chatId+"/picture", nil)
+}
+
+// requestChatPictureUpload requests an upload and returns the staging key the presigned url writes to
+func (c *client) requestChatPictureUpload(chatId string) string {
+	c.h.t.Helper()
+
+	c.do(http.MethodGet, "/chat/"+chatId+"/upload-picture?mimeType=image/png&size=1024", nil).expect(http.StatusOK)
+	chat, err := c.h.repos.Chats.GetById(context.Background(), chatId)
+	if err != nil || chat.PictureUpload == nil {
+		c.h.t.Fatalf("upload was not stored: %v", err)
+	}
+	return *chat.PictureUpload
+}
+
+// chatPictureKey returns the key the picture of the chat is published under
+func (h *harness) chatPictureKey(chatId string) string {
+	h.t.Helper()
+
+	chat, err := h.repos.Chats.GetById(context.Background(), chatId)
+	if err != nil || chat.PictureKey == nil {
+		h.t.Fatalf("chat has no picture: %v", err)
+	}
+	return *chat.PictureKey
+}
+
+func TestChatPicture(t *testing.T) {
+	h := newHarness(t)
+	alice, bob, talk := h.newTalk()
+
+	bob.do(http.MethodGet, "/chat/"+talk.Id+"/picture", nil).expect(http.StatusNoContent)
+
+	var confirmed chat.CreateChatResponse
+	alice.uploadChatPicture(talk.Id, "image/jpeg", jpegWithExif(t, testPicture(200, 100), 6)).expect(http.StatusOK).decode(&confirmed)
+	if confirmed.Picture == nil || len(confirmed.PictureVariants) != 3 {
+		t.Fatalf("picture was not processed: %+v", confirmed)
+	}
+
+	// shares the profile picture bucket under its own prefix
+	key := h.chatPictureKey(talk.Id)
+	if !strings.HasPrefix(key, "chats/"+talk.Id+"/") {
+		t.Fatalf("unexpected picture key: %s", key)
+	}
+	original, ok := h.s3.Get(testBucket, key)
+	if !ok || bytes.Contains(original, []byte(exifMarker)) {
+		t.Fatalf("metadata was not stripped from the stored picture")
+	}
+	for _, size := range []int{64, 256, 512} {
+		variantURL := confirmed.PictureVariants[fmt.Sprint(size)]
+		if !strings.Contains(variantURL, fmt.Sprintf("/%s/%s/%d.jpg", testBucket, key, size)) {
+			t.Fatalf("unexpected url of the %d variant: %s", size, variantURL)
+		}
+		variant, err := jpeg.Decode(bytes.NewReader(download(t, variantURL)))
+		if err != nil || variant.Bounds().Dx() != size {
+			t.Fatalf("unexpected %d variant: %v", size, err)
+		}
+	}
+
+	// every member sees the picture
+	var pictureURL string
+	bob.do(http.MethodGet, "/chat/"+talk.Id+"/picture", nil).expect(http.StatusOK).decode(&pictureURL)
+	if len(download(t, pictureURL)) == 0 {
+		t.Fatalf("picture is empty")
+	}
+
+	var fetched chat.GetChatByIdResponse
+	bob.do(http.MethodGet, "/chat/"+talk.Id, nil).expect(http.StatusOK).decode(&fetched)
+	if fetched.Picture == nil || len(fetched.PictureVariants) != 3 {
+		t.Fatalf("chat does not expose the picture: %+v", fetched.CreateChatResponse)
+	}
+
+	var previews []chat.GetChatPreviewResponse
+	bob.do(http.MethodGet, "/chat/preview", nil).expect(http.StatusOK).decode(&previews)
+	if len(previews) != 1 || previews[0].Picture == nil || len(previews[0].PictureVariants) != 3 {
+		t.Fatalf("preview does not expose the picture: %+v", previews)
+	}
+}
+
+func TestChatPictureBucket(t *testing.T) {
+	h := newHarness(t)
+	h.cfg.ChatPictureBucketName = "chat-pictures"
+	alice := h.newUser("alice")
+	talk := alice.createChat("talk")
+
+	alice.uploadChatPicture(talk.Id, "image/png", pngOf(t, testPicture(64, 64))).expect(http.StatusOK)
+
+	if _, ok := h.s3.Get("chat-pictures", h.chatPictureKey(talk.Id)); !ok {
+		t.Fatalf("picture was not stored in its own bucket")
+	}
+	if keys := h.s3.Keys(testBucket, ""); len(keys) != 0 {
+		t.Fatalf("picture was stored in the profile picture bucket: %v", keys)
+	}
+}
+
+func TestChatPictureEndpoints(t *testing.T) {
+	upload := func(chatId string) string {
+		return "/chat/" + chatId + "/upload-picture?mimeType=image/png&size=1024"
+	}
+
+	runEndpointCases(t, []endpointCase{
+		{
+			name:   "member can not request an upload",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				_, bob, talk := h.newTalk()
+				return bob, upload(talk.Id), nil
+			},
+			status: http.StatusForbidden,
+			code:   enum.NotAllowed,
+		},
+		{
+			name:   "member can not confirm a picture",
+			method: http.MethodPost,
+			prepare: func(h *harness) (*client, string, any) {
+				alice, bob, talk := h.newTalk()
+				h.s3.Put(testBucket, alice.requestChatPictureUpload(talk.Id), pngOf(h.t, testPicture(64, 64)), "image/png")
+				return bob, "/chat/" + talk.Id + "/picture", nil
+			},
+			status: http.StatusForbidden,
+			code:   enum.NotAllowed,
+		},
+		{
+			name:   "outsider can not see the picture",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				alice, mallory := h.newUser("alice"), h.newUser("mallory")
+				talk := alice.createChat("talk")
+				return mallory, "/chat/" + talk.Id + "/picture", nil
+			},
+			status: http.StatusForbidden,
+			code:   enum.NotAllowed,
+		},
+		{
+			name:   "unknown chat",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				return h.newUser("alice"), upload("00000000-0000-0000-0000-000000000000"), nil
+			},
+			status: http.StatusNotFound,
+			code:   enum.NotFound,
+		},
+		{
+			name:   "unsupported type",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				alice := h.newUser("alice")
+				talk := alice.createChat("talk")
+				return alice, "/chat/" + talk.Id + "/upload-picture?mimeType=image/svg%2Bxml&size=1024", nil
+			},
+			status: http.StatusUnsupportedMediaType,
+			code:   enum.UnsupportedFileType,
+		},
+		{
+			name:   "nothing uploaded",
+			method: http.MethodPost,
+			prepare: func(h *harness) (*client, string, any) {
+				alice := h.newUser("alice")
+				talk := alice.createChat("talk")
+				return alice, "/chat/" + talk.Id + "/picture", nil
+			},
+			status: http.StatusNotFound,
+			code:   enum.NotFound,
+		},
+		{
+			name:   "not a picture",
+			method: http.MethodPost,
+			prepare: func(h *harness) (*client, string, any) {
+				alice := h.newUser("alice")
+				talk := alice.createChat("talk")
+				h.s3.Put(testBucket, alice.requestChatPictureUpload(talk.Id), []byte("not a picture"), "image/png")
+				return alice, "/chat/" + talk.Id + "/picture", nil
+			},
+			status: http.StatusBadRequest,
+			code:   enum.InvalidImage,
+		},
+	})
+}
@@ -0,0 +1,209 @@
+package e2e
+
+import (
+	"context"
+	"easyflow-backend/src/api/chat"
+	"easyflow-backend/src/database"
+	"easyflow-backend/src/enum"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCreateChat(t *testing.T) {
+	runEndpointCases(t, []endpointCase{
+		{
+			name:   "creates chat with members",
+			method: http.MethodPost,
+			prepare: func(h *harness) (*client, string, any) {
+				alice, bob := h.newUser("alice"), h.newUser("bob")
+				return alice, "/chat", chat.CreateChatRequest{
+					Name: "alice and bob",
+					UserKeys: []chat.UserKeyEntry{
+						{UserID: alice.user.Id, Key: "key-alice"},
+						{UserID: bob.user.Id, Key: "key-bob"},
+					},
+				}
+			},
+			status: http.StatusCreated,
+			check: func(t *testing.T, h *harness, c *client, r *response) {
+				var created chat.CreateChatResponse
+				r.decode(&created)
+				if created.Id == "" || created.Name != "alice and bob" {
+					t.Fatalf("unexpected chat: %+v", created)
+				}
+
+				var fetched chat.GetChatByIdResponse
+				c.do(http.MethodGet, "/chat/"+created.Id, nil).expect(http.StatusOK).decode(&fetched)
+				if len(fetched.UserKeys) != 1 || fetched.UserKeys[0].Key != "key-alice" {
+					t.Fatalf("expected only the key of the caller, got %+v", fetched.UserKeys)
+				}
+			},
+		},
+		{
+			name:   "unknown member",
+			method: http.MethodPost,
+			prepare: func(h *harness) (*client, string, any) {
+				alice := h.newUser("alice")
+				return alice, "/chat", chat.CreateChatRequest{
+					Name: "ghost",
+					UserKeys: []chat.UserKeyEntry{
+						{UserID: alice.user.Id, Key: "key-alice"},
+						{UserID: "00000000-0000-0000-0000-000000000000", Key: "key-ghost"},
+					},
+				}
+			},
+			status: http.StatusNotFound,
+			code:   enum.UserNotFound,
+			check: func(t *testing.T, h *harness, c *client, r *response) {
+				var previews []chat.GetChatPreviewResponse
+				c.do(http.MethodGet, "/chat/preview", nil).expect(http.StatusOK).decode(&previews)
+				if len(previews) != 0 {
+					t.Fatalf("failed chat creation was not rolled back: %+v", previews)
+				}
+			},
+		},
+		{
+			name:   "missing name",
+			method: http.MethodPost,
+			prepare: func(h *harness) (*client, string, any) {
+				alice := h.newUser("alice")
+				return alice, "/chat", chat.CreateChatRequest{
+					UserKeys: []chat.UserKeyEntry{{UserID: alice.user.Id, Key: "key-alice"}},
+				}
+			},
+			status: http.StatusInternalServerError,
+			code:   enum.ApiError,
+		},
+		{
+			name:   "without login",
+			method: http.MethodPost,
+			prepare: func(h *harness) (*client, string, any) {
+				return h.newClient(), "/chat", chat.CreateChatRequest{Name: "anonymous"}
+			},
+			status: http.StatusBadRequest,
+			code:   enum.InvalidCookie,
+		},
+	})
+}
+
+func TestChatPreviews(t *testing.T) {
+	runEndpointCases(t, []endpointCase{
+		{
+			name:   "no chats",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				return h.newUser("alice"), "/chat/preview", nil
+			},
+			status: http.StatusOK,
+			check:  expectBody("[]"),
+		},
+		{
+			name:   "without login",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				return h.newClient(), "/chat/preview", nil
+			},
+			status: http.StatusBadRequest,
+			code:   enum.InvalidCookie,
+		},
+		{
+			name:   "latest message per chat",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				alice, bob, talk := h.newTalk()
+				alice.sendMessage(talk.Id, "first")
+				bob.sendMessage(talk.Id, "second")
+				alice.createChat("quiet")
+				return bob, "/chat/preview", nil
+			},
+			status: http.StatusOK,
+			check: func(t *testing.T, h *harness, c *client, r *response) {
+				var previews []chat.GetChatPreviewResponse
+				r.decode(&previews)
+				if len(previews) != 1 || previews[0].Name != "talk" {
+					t.Fatalf("expected only the chat bob is a member of, got %+v", previews)
+				}
+				if previews[0].LastMessage == nil || *previews[0].LastMessage != "second" {
+					t.Fatalf("unexpected last message: %v", previews[0].LastMessage)
+				}
+			},
+		},
+	})
+}
+
+func TestGetChatById(t *testing.T) {
+	runEndpointCases(t, []endpointCase{
+		{
+			name:   "messages newest first",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				alice, bob, talk := h.newTalk()
+				alice.sendMessage(talk.Id, "first")
+				bob.sendMessage(talk.Id, "second")
+				return bob, "/chat/" + talk.Id, nil
+			},
+			status: http.StatusOK,
+			check: func(t *testing.T, h *harness, c *client, r *response) {
+				var fetched chat.GetChatByIdResponse
+				r.decode(&fetched)
+				if len(fetched.Messages) != 2 || fetched.Messages[0].Content != "second" || fetched.Messages[1].Content != "first" {
+					t.Fatalf("unexpected messages: %+v", fetched.Messages)
+				}
+				if len(fetched.Users) != 1 || fetched.Users[0].Id != c.user.Id {
+					t.Fatalf("unexpected users: %+v", fetched.Users)
+				}
+			},
+		},
+		{
+			name:   "newest fifty messages",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				alice := h.newUser("alice")
+				talk := alice.createChat("talk")
+				start := time.Now().Add(-time.Hour)
+				for i := range 51 {
+					if err := h.repos.Messages.Create(context.Background(), &database.Message{
+						ChatId:    talk.Id,
+						SenderId:  &alice.user.Id,
+						Content:   fmt.Sprintf("message-%d", i),
+						Iv:        "iv",
+						CreatedAt: start.Add(time.Duration(i) * time.Second),
+					}); err != nil {
+						h.t.Fatalf("could not create message: %s", err)
+					}
+				}
+				return alice, "/chat/" + talk.Id, nil
+			},
+			status: http.StatusOK,
+			check: func(t *testing.T, h *harness, c *client, r *response) {
+				var fetched chat.GetChatByIdResponse
+				r.decode(&fetched)
+				if len(fetched.Messages) != 50 || fetched.Messages[0].Content != "message-50" || fetched.Messages[49].Content != "message-1" {
+					t.Fatalf("expected the newest 50 messages, got %d", len(fetched.Messages))
+				}
+			},
+		},
+		{
+			name:   "not a member",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				alice, mallory := h.newUser("alice"), h.newUser("mallory")
+				talk := alice.createChat("private")
+				return mallory, "/chat/" + talk.Id, nil
+			},
+			status: http.StatusForbidden,
+			code:   enum.NotAllowed,
+		},
+		{
+			name:   "unknown chat",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				return h.newUser("alice"), "/chat/00000000-0000-0000-0000-000000000000", nil
+			},
+			status: http.StatusNotFound,
+			code:   enum.NotFound,
+		},
+	})
+}
@@ -0,0 +1,149 @@
+package e2e
+
+import (
+	"bytes"
+	"easyflow-backend/src/common"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, name string, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("could not write config file: %s", err)
+	}
+	return path
+}
+
+func TestLoadConfigLayers(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{
+			name: "yaml",
+			file: "config.yaml",
+			content: `
+database:
+  url: sqlite://file.db
+  conn_max_lifetime: 10m
+shutdown_timeout: 5s
+access_log_skip_paths: [/healthz, /status]
+rate_limit_enabled: false
+`,
+		},
+		{
+			name: "toml",
+			file: "config.toml",
+			content: `
+shutdown_timeout = "5s"
+access_log_skip_paths = ["/healthz", "/status"]
+rate_limit_enabled = false
+
+[database]
+url = "sqlite://file.db"
+conn_max_lifetime = "10m"
+`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("SHUTDOWN_TIMEOUT", "7s")
+
+			cfg, err := common.LoadConfig(writeConfigFile(t, tc.file, tc.content))
+			if err != nil {
+				t.Fatalf("could not load config: %s", err)
+			}
+
+			if cfg.DatabaseURL != "sqlite://file.db" || cfg.DatabaseConnMaxLifetime != 10*time.Minute {
+				t.Fatalf("nested settings were not applied: %q %s", cfg.DatabaseURL, cfg.DatabaseConnMaxLifetime)
+			}
+			if cfg.ShutdownTimeout != 7*time.Second {
+				t.Fatalf("the environment must override the file, got %s", cfg.ShutdownTimeout)
+			}
+			if len(cfg.AccessLogSkipPaths) != 2 || cfg.AccessLogSkipPaths[1] != "/status" || cfg.RateLimitEnabled {
+				t.Fatalf("file settings were not applied: %+v %v", cfg.AccessLogSkipPaths, cfg.RateLimitEnabled)
+			}
+			if cfg.DatabaseMaxOpenConns != 25 {
+				t.Fatalf("defaults were not kept: %d", cfg.DatabaseMaxOpenConns)
+			}
+		})
+	}
+}
+
+func TestLoadConfigReportsEveryError(t *testing.T) {
+	t.Setenv("DATABASE_MAX_OPEN_CONNS", "many")
+	t.Setenv("RATE_LIMIT_ENABLED", "sometimes")
+
+	path := writeConfigFile(t, "config.yaml", "shutdown_timeout: 20\nunknown_setting: true\n")
+
+	_, err := common.LoadConfig(path)
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+
+	for _, expected := range []string{"DATABASE_MAX_OPEN_CONNS", "RATE_LIMIT_ENABLED", "shutdown_timeout", "unknown_setting"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Fatalf("error does not mention %s: %s", expected, err)
+		}
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	h := newHarness(t)
+
+	cfg := *h.cfg
+	cfg.Stage = "production"
+	cfg.JwtSecret = "public_secret"
+	cfg.BucketSecret = ""
+	cfg.AccessLogSampleRate = 2
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+
+	for _, expected := range []string{"JWT_SECRET", "BUCKET_SECRET", "ACCESS_LOG_SAMPLE_RATE"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Fatalf("error does not mention %s: %s", expected, err)
+		}
+	}
+}
+
+func TestPrintConfigRedactsSecrets(t *testing.T) {
+	h := newHarness(t)
+
+	cfg := *h.cfg
+	cfg.DatabaseURL = "postgres://app:database-password@db:5432/app"
+	cfg.DatabaseReplicaURLs = []string{"app:replica-password@tcp(replica:3306)/app"}
+	cfg.JwtSecret = "jwt-secret-value"
+	cfg.BucketSecret = "bucket-secret-value"
+
+	var out bytes.Buffer
+	if err := cfg.Print(&out); err != nil {
+		t.Fatalf("could not print config: %s", err)
+	}
+
+	printed := out.String()
+	for _, secret := range []string{cfg.JwtSecret, cfg.BucketSecret, testMetricsToken, "database-password", "replica-password"} {
+		if strings.Contains(printed, secret) {
+			t.Fatalf("printed config contains the secret %q:\n%s", secret, printed)
+		}
+	}
+	for _, expected := range []string{"database_url: postgres://app:[redacted]@db:5432/app", "shutdown_timeout: 20s", "profile_picture_bucket_name: " + testBucket} {
+		if !strings.Contains(printed, expected) {
+			t.Fatalf("printed config is missing %q:\n%s", expected, printed)
+		}
+	}
+
+	// the printed config can be loaded again
+	path := writeConfigFile(t, "config.yaml", printed)
+	if _, err := common.LoadConfig(path); err != nil {
+		t.Fatalf("printed config can not be loaded: %s", err)
+	}
+}
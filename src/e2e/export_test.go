@@ -0,0 +1,277 @@
+package e2e
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"easyflow-backend/src/api/user"
+	"easyflow-backend/src/database"
+	"easyflow-backend/src/enum"
+	"easyflow-backend/src/export"
+	"easyflow-backend/src/jobs"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// waitForExport runs the queued jobs and polls the status endpoint until the export is finished
+func (c *client) waitForExport(exportId string) user.ExportResponse {
+	c.h.t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		c.h.runJobs()
+		var status user.ExportResponse
+		c.do(http.MethodGet, "/user/export/"+exportId, nil).expect(http.StatusOK).decode(&status)
+		if status.Status == database.ExportReady || status.Status == database.ExportFailed {
+			return status
+		}
+		if time.Now().After(deadline) {
+			c.h.t.Fatalf("export %s did not finish, last status %s", exportId, status.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// downloadArchive fetches the archive through the presigned url and returns its files by name
+func downloadArchive(t *testing.T, downloadURL string) map[string][]byte {
+	t.Helper()
+
+	res, err := http.Get(downloadURL)
+	if err != nil {
+		t.Fatalf("could not download archive: %s", err)
+	}
+	defer res.Body.Close()
+
+	body, _ := io.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected download status: %d", res.StatusCode)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatalf("download is not a zip archive: %s", err)
+	}
+
+	files := map[string][]byte{}
+	for _, f := range archive.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatalf("could not open %s: %s", f.Name, err)
+		}
+		files[f.Name], _ = io.ReadAll(r)
+		_ = r.Close()
+	}
+	return files
+}
+
+func decodeFile(t *testing.T, files map[string][]byte, name string, v any) {
+	t.Helper()
+
+	content, ok := files[name]
+	if !ok {
+		t.Fatalf("archive has no %s", name)
+	}
+	if err := json.Unmarshal(content, v); err != nil {
+		t.Fatalf("could not decode %s: %s", name, err)
+	}
+}
+
+func TestRequestExport(t *testing.T) {
+	runEndpointCases(t, []endpointCase{
+		{
+			name:   "builds the archive",
+			method: http.MethodPost,
+			prepare: func(h *harness) (*client, string, any) {
+				alice, bob, talk := h.newTalk()
+				alice.sendMessage(talk.Id, "ciphertext-alice")
+				bob.sendMessage(talk.Id, "ciphertext-bob")
+				h.s3.Put(testBucket, alice.user.Id, []byte("picture"), "image/png")
+				h.setPictureKey(alice.user.Id, alice.user.Id)
+				return alice, "/user/export", nil
+			},
+			status: http.StatusAccepted,
+			check: func(t *testing.T, h *harness, c *client, r *response) {
+				var requested user.ExportResponse
+				r.decode(&requested)
+				if requested.Id == "" || requested.Status != database.ExportPending || requested.DownloadURL != nil {
+					t.Fatalf("unexpected export: %+v", requested)
+				}
+
+				finished := c.waitForExport(requested.Id)
+				if finished.Status != database.ExportReady || finished.DownloadURL == nil || finished.CompletedAt == nil {
+					t.Fatalf("export did not succeed: %+v", finished)
+				}
+
+				files := downloadArchive(t, *finished.DownloadURL)
+
+				var profile database.User
+				decodeFile(t, files, "profile.json", &profile)
+				if profile.Id != c.user.Id || profile.Email != c.user.Email {
+					t.Fatalf("unexpected profile: %+v", profile)
+				}
+				if bytes.Contains(files["profile.json"], []byte("password")) {
+					t.Fatalf("profile contains the password hash")
+				}
+
+				var chats []export.Chat
+				decodeFile(t, files, "chats.json", &chats)
+				if len(chats) != 1 || chats[0].Name != "talk" || chats[0].Key != "key-"+c.user.Id || len(chats[0].MemberIds) != 2 {
+					t.Fatalf("unexpected chats: %+v", chats)
+				}
+
+				var messages []export.Message
+				decodeFile(t, files, "messages.json", &messages)
+				if len(messages) != 1 || messages[0].Content != "ciphertext-alice" || messages[0].Iv == "" {
+					t.Fatalf("expected only the messages sent by the user, got %+v", messages)
+				}
+
+				var sessions []export.Session
+				decodeFile(t, files, "sessions.json", &sessions)
+				if len(sessions) != 1 {
+					t.Fatalf("unexpected sessions: %+v", sessions)
+				}
+
+				if string(files["profile-picture"]) != "picture" {
+					t.Fatalf("unexpected profile picture: %q", files["profile-picture"])
+				}
+			},
+		},
+		{
+			name:   "without profile picture",
+			method: http.MethodPost,
+			prepare: func(h *harness) (*client, string, any) {
+				return h.newUser("alice"), "/user/export", nil
+			},
+			status: http.StatusAccepted,
+			check: func(t *testing.T, h *harness, c *client, r *response) {
+				var requested user.ExportResponse
+				r.decode(&requested)
+
+				finished := c.waitForExport(requested.Id)
+				if finished.Status != database.ExportReady {
+					t.Fatalf("export did not succeed: %+v", finished)
+				}
+
+				files := downloadArchive(t, *finished.DownloadURL)
+				if _, ok := files["profile-picture"]; ok {
+					t.Fatalf("archive has a profile picture")
+				}
+				var chats []export.Chat
+				decodeFile(t, files, "chats.json", &chats)
+				if len(chats) != 0 {
+					t.Fatalf("unexpected chats: %+v", chats)
+				}
+			},
+		},
+		{
+			name:   "export already running",
+			method: http.MethodPost,
+			prepare: func(h *harness) (*client, string, any) {
+				c := h.newUser("alice")
+				if err := h.repos.Exports.Create(context.Background(), &database.DataExport{UserId: c.user.Id, Status: database.ExportRunning}); err != nil {
+					h.t.Fatalf("could not create export: %s", err)
+				}
+				return c, "/user/export", nil
+			},
+			status: http.StatusConflict,
+			code:   enum.AlreadyExists,
+		},
+		{
+			name:   "without login",
+			method: http.MethodPost,
+			prepare: func(h *harness) (*client, string, any) {
+				return h.newClient(), "/user/export", nil
+			},
+			status: http.StatusBadRequest,
+			code:   enum.InvalidCookie,
+		},
+	})
+}
+
+func TestRequestExportAfterAbandonedExport(t *testing.T) {
+	h := newHarness(t)
+	alice := h.newUser("alice")
+
+	// an export that was running when the server stopped
+	abandoned := &database.DataExport{UserId: alice.user.Id, Status: database.ExportRunning}
+	if err := h.repos.Exports.Create(context.Background(), abandoned); err != nil {
+		t.Fatalf("could not create export: %s", err)
+	}
+	if err := h.db.GetClient().Model(abandoned).UpdateColumn("updated_at", time.Now().Add(-2*h.cfg.ExportTimeout)).Error; err != nil {
+		t.Fatalf("could not age export: %s", err)
+	}
+
+	var requested user.ExportResponse
+	alice.do(http.MethodPost, "/user/export", nil).expect(http.StatusAccepted).decode(&requested)
+	if finished := alice.waitForExport(requested.Id); finished.Status != database.ExportReady {
+		t.Fatalf("export did not succeed: %+v", finished)
+	}
+
+	var status user.ExportResponse
+	alice.do(http.MethodGet, "/user/export/"+abandoned.Id, nil).expect(http.StatusOK).decode(&status)
+	if status.Status != database.ExportFailed || status.DownloadURL != nil {
+		t.Fatalf("abandoned export was not failed: %+v", status)
+	}
+}
+
+func TestExportSurvivesRestart(t *testing.T) {
+	h := newHarness(t)
+	alice := h.newUser("alice")
+
+	var requested user.ExportResponse
+	alice.do(http.MethodPost, "/user/export", nil).expect(http.StatusAccepted).decode(&requested)
+
+	// the export is queued with the request, a pool of a later process builds it
+	queued := h.listJobs(database.JobQueued)
+	if len(queued) != 1 || queued[0].Type != export.BuildJob.Name {
+		t.Fatalf("expected a queued export job: %+v", queued)
+	}
+	pool := jobs.NewPool(h.repos, h.cfg)
+	export.NewBuilder(h.repos, h.cfg, h.store).Register(pool)
+	drainJobs(t, pool)
+
+	var status user.ExportResponse
+	alice.do(http.MethodGet, "/user/export/"+requested.Id, nil).expect(http.StatusOK).decode(&status)
+	if status.Status != database.ExportReady || status.DownloadURL == nil {
+		t.Fatalf("export was not built: %+v", status)
+	}
+}
+
+func TestGetExport(t *testing.T) {
+	runEndpointCases(t, []endpointCase{
+		{
+			name:   "export of another user",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				alice, mallory := h.newUser("alice"), h.newUser("mallory")
+				var requested user.ExportResponse
+				alice.do(http.MethodPost, "/user/export", nil).expect(http.StatusAccepted).decode(&requested)
+				alice.waitForExport(requested.Id)
+				return mallory, "/user/export/" + requested.Id, nil
+			},
+			status: http.StatusNotFound,
+			code:   enum.NotFound,
+		},
+		{
+			name:   "unknown export",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				return h.newUser("alice"), "/user/export/00000000-0000-0000-0000-000000000000", nil
+			},
+			status: http.StatusNotFound,
+			code:   enum.NotFound,
+		},
+		{
+			name:   "without login",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				return h.newClient(), "/user/export/00000000-0000-0000-0000-000000000000", nil
+			},
+			status: http.StatusBadRequest,
+			code:   enum.InvalidCookie,
+		},
+	})
+}
@@ -0,0 +1,469 @@
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"easyflow-backend/src/api"
+	"easyflow-backend/src/api/auth"
+	"easyflow-backend/src/api/chat"
+	"easyflow-backend/src/api/health"
+	"easyflow-backend/src/audit"
+	"easyflow-backend/src/common"
+	"easyflow-backend/src/database"
+	"easyflow-backend/src/enum"
+	"easyflow-backend/src/export"
+	"easyflow-backend/src/jobs"
+	"easyflow-backend/src/repository"
+	"easyflow-backend/src/router"
+	"easyflow-backend/src/scanning"
+	"easyflow-backend/src/storage"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	testBucket       = "profile-pictures"
+	testExportBucket = "exports"
+	testAttachments  = "attachments"
+	testPassword     = "correct-horse-battery"
+	testOrigin       = "http://localhost:3000"
+	testMetricsToken = "metrics-token"
+)
+
+var baseURL = &url.URL{Scheme: "http", Host: "localhost", Path: "/"}
+
+// harness runs the api router built by router.New against a private in-memory sqlite
+// database with all migrations applied and a fake bucket, every test gets its own instance.
+// The local harness keeps the objects in the local store instead, s3 is nil there.
+type harness struct {
+	t        *testing.T
+	cfg      *common.Config
+	runtime  *common.RuntimeConfig
+	db       *database.DatabaseInst
+	repos    *repository.Repositories
+	checker  *health.Checker
+	pool     *jobs.Pool
+	scans    *scanning.Runner
+	recorder *audit.Recorder
+	store    storage.ObjectStore
+	router   *gin.Engine
+	s3       *fakeS3
+	clients  int
+	users    int
+}
+
+func newHarness(t *testing.T) *harness {
+	t.Helper()
+	return buildHarness(t, false, nil)
+}
+
+// newLocalHarness stores the objects on disk, the signed urls point to a test server in front of the router
+func newLocalHarness(t *testing.T) *harness {
+	t.Helper()
+	return buildHarness(t, true, nil)
+}
+
+// buildHarness sets up the harness, configure can change the config before anything is built from it
+func buildHarness(t *testing.T, local bool, configure func(cfg *common.Config)) *harness {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+
+	h := &harness{t: t}
+
+	cfg, err := common.LoadConfig("")
+	if err != nil {
+		t.Fatalf("could not load config: %s", err)
+	}
+	cfg.Stage = "test"
+	cfg.LogLevel = common.ERROR
+	cfg.DatabaseURL = "sqlite://:memory:"
+	cfg.SaltRounds = bcrypt.MinCost
+	cfg.JwtSecret = "test-secret"
+	if local {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h.router.ServeHTTP(w, r)
+		}))
+		t.Cleanup(server.Close)
+
+		cfg.StorageDriver = common.StorageDriverLocal
+		cfg.StorageLocalDir = t.TempDir()
+		cfg.StorageLocalURL = server.URL
+		cfg.StorageLocalSecret = "storage-secret"
+	} else {
+		h.s3 = newFakeS3(t)
+		cfg.StorageDriver = common.StorageDriverS3
+		cfg.BucketURL = h.s3.URL()
+		cfg.BucketAccessKeyId = "test"
+		cfg.BucketSecret = "test"
+		cfg.BucketUsePathStyle = true
+	}
+	cfg.ProfilePictureBucketName = testBucket
+	cfg.ExportBucketName = testExportBucket
+	cfg.AttachmentBucketName = testAttachments
+	cfg.FrontendURL = testOrigin
+	cfg.Domain = "localhost"
+	cfg.RateLimitEnabled = false
+	cfg.AccessLogSampleRate = 0
+	cfg.MetricsAddr = ""
+	cfg.MetricsToken = testMetricsToken
+	cfg.TracingEndpoint = ""
+	cfg.SecurityEventLogFile = filepath.Join(t.TempDir(), "security-events.jsonl")
+	if configure != nil {
+		configure(cfg)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("invalid test config: %s", err)
+	}
+
+	db, err := database.NewDatabaseInst(cfg.DatabaseURL, &cfg.GormConfig, cfg.DatabaseOptions())
+	if err != nil {
+		t.Fatalf("could not open database: %s", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	if _, err := db.Migrate(context.Background()); err != nil {
+		t.Fatalf("could not migrate database: %s", err)
+	}
+
+	repos := repository.NewGormRepositories(db.GetClient())
+
+	store, err := storage.New(cfg)
+	if err != nil {
+		t.Fatalf("could not set up storage: %s", err)
+	}
+
+	checker := health.NewChecker(cfg, store)
+	checker.SetDatabase(db)
+	checker.MarkReady()
+
+	scanner, err := scanning.New(cfg)
+	if err != nil {
+		t.Fatalf("could not set up scanner: %s", err)
+	}
+
+	// exports and scans are run by h.runJobs, the tests of other kinds build pools of their own
+	pool := jobs.NewPool(repos, cfg)
+	exports := export.NewBuilder(repos, cfg, store)
+	exports.Register(pool)
+	scans := scanning.NewRunner(repos, cfg, store, scanner)
+	scans.Register(pool)
+
+	recorder, err := audit.NewRecorder(cfg.SecurityEventLogFile)
+	if err != nil {
+		t.Fatalf("could not open security event log: %s", err)
+	}
+	t.Cleanup(func() { _ = recorder.Close() })
+
+	runtime := common.NewRuntimeConfig(cfg, "")
+
+	r, err := router.New(runtime, repos, checker, scans, recorder, store, common.NewLogger(io.Discard, "Test", nil, cfg.LogLevel))
+	if err != nil {
+		t.Fatalf("could not build router: %s", err)
+	}
+
+	h.cfg = cfg
+	h.runtime = runtime
+	h.db = db
+	h.repos = repos
+	h.checker = checker
+	h.pool = pool
+	h.scans = scans
+	h.recorder = recorder
+	h.store = store
+	h.router = r
+	return h
+}
+
+// drainJobs runs jobs until none is due
+func drainJobs(t *testing.T, pool *jobs.Pool) {
+	t.Helper()
+
+	for {
+		ran, err := pool.RunOnce(context.Background())
+		if err != nil {
+			t.Fatalf("could not run job: %s", err)
+		}
+		if !ran {
+			return
+		}
+	}
+}
+
+// runJobs runs the queued exports and scans until none is due
+func (h *harness) runJobs() {
+	h.t.Helper()
+	drainJobs(h.t, h.pool)
+}
+
+// client is a browser like api consumer with its own cookie jar and client ip
+type client struct {
+	h    *harness
+	jar  *cookiejar.Jar
+	ip   string
+	user *testUser
+}
+
+type testUser struct {
+	Id       string
+	Email    string
+	Password string
+	Name     string
+}
+
+func (h *harness) newClient() *client {
+	h.t.Helper()
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		h.t.Fatalf("could not create cookie jar: %s", err)
+	}
+	h.clients++
+
+	return &client{
+		h:   h,
+		jar: jar,
+		ip:  fmt.Sprintf("192.0.2.%d", h.clients),
+	}
+}
+
+// do sends a request through the router, a non nil body is sent as json
+func (c *client) do(method string, path string, body any) *response {
+	c.h.t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			c.h.t.Fatalf("could not marshal body: %s", err)
+		}
+		reader = bytes.NewReader(raw)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	req.RemoteAddr = c.ip + ":40000"
+	req.Header.Set("Origin", testOrigin)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for _, cookie := range c.jar.Cookies(baseURL) {
+		req.AddCookie(cookie)
+	}
+
+	rec := httptest.NewRecorder()
+	c.h.router.ServeHTTP(rec, req)
+
+	c.jar.SetCookies(baseURL, rec.Result().Cookies())
+
+	return &response{t: c.h.t, method: method, path: path, rec: rec}
+}
+
+func (c *client) setCookie(name string, value string) {
+	c.jar.SetCookies(baseURL, []*http.Cookie{{Name: name, Value: value, Path: "/"}})
+}
+
+func (c *client) cookie(name string) string {
+	for _, cookie := range c.jar.Cookies(baseURL) {
+		if cookie.Name == name {
+			return cookie.Value
+		}
+	}
+	return ""
+}
+
+// signup creates a new account with a unique email without logging in
+func (c *client) signup(name string) *testUser {
+	c.h.t.Helper()
+
+	c.h.users++
+	user := &testUser{
+		Email:    fmt.Sprintf("%s-%d@example.com", name, c.h.users),
+		Password: testPassword,
+		Name:     name,
+	}
+
+	var created database.User
+	c.do(http.MethodPost, "/user/signup", signupBody(user.Email, user.Name)).expect(http.StatusOK).decode(&created)
+	user.Id = created.Id
+
+	return user
+}
+
+// login stores the session cookies in the jar of the client
+func (c *client) login(user *testUser) {
+	c.h.t.Helper()
+
+	c.do(http.MethodPost, "/auth/login", auth.LoginRequest{
+		Email:    user.Email,
+		Password: user.Password,
+	}).expect(http.StatusOK)
+	c.user = user
+}
+
+// newUser returns a client with a freshly signed up and logged in user
+func (h *harness) newUser(name string) *client {
+	h.t.Helper()
+
+	c := h.newClient()
+	c.login(c.signup(name))
+
+	return c
+}
+
+// createChat creates a chat with the client and all members, every member gets a dummy wrapped key
+func (c *client) createChat(name string, members ...*client) chat.CreateChatResponse {
+	c.h.t.Helper()
+
+	keys := []chat.UserKeyEntry{{UserID: c.user.Id, Key: "key-" + c.user.Id}}
+	for _, member := range members {
+		keys = append(keys, chat.UserKeyEntry{UserID: member.user.Id, Key: "key-" + member.user.Id})
+	}
+
+	var created chat.CreateChatResponse
+	c.do(http.MethodPost, "/chat", chat.CreateChatRequest{Name: name, UserKeys: keys}).expect(http.StatusCreated).decode(&created)
+
+	return created
+}
+
+// newTalk signs up alice and bob and creates the chat "talk" between them, the setup most chat tests start from
+func (h *harness) newTalk() (*client, *client, chat.CreateChatResponse) {
+	h.t.Helper()
+
+	alice, bob := h.newUser("alice"), h.newUser("bob")
+	return alice, bob, alice.createChat("talk", bob)
+}
+
+// sendMessage stores an encrypted message from the client in the chat,
+// it goes through the repositories so tests of other endpoints do not depend on the send endpoint
+func (c *client) sendMessage(chatId string, content string) *database.Message {
+	c.h.t.Helper()
+
+	message := &database.Message{
+		ChatId:   chatId,
+		SenderId: &c.user.Id,
+		Content:  content,
+		Iv:       "iv",
+	}
+	if err := c.h.repos.Messages.Create(context.Background(), message); err != nil {
+		c.h.t.Fatalf("could not send message: %s", err)
+	}
+
+	return message
+}
+
+// token signs a token for the user like the auth service does, used to craft expired or foreign tokens
+func (h *harness) token(userId string, random uuid.UUID, expiresIn time.Duration, secret string) string {
+	h.t.Helper()
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, auth.JWTAccessTokenPayload{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
+			Issuer:    "easyflow",
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+		UserId:      userId,
+		RefreshRand: &random,
+	}).SignedString([]byte(secret))
+	if err != nil {
+		h.t.Fatalf("could not sign token: %s", err)
+	}
+
+	return token
+}
+
+func signupBody(email string, name string) map[string]string {
+	return map[string]string{
+		"email":      email,
+		"name":       name,
+		"password":   testPassword,
+		"publicKey":  "public-key",
+		"privateKey": "private-key",
+		"iv":         "iv",
+	}
+}
+
+type response struct {
+	t      *testing.T
+	method string
+	path   string
+	rec    *httptest.ResponseRecorder
+}
+
+func (r *response) expect(status int) *response {
+	r.t.Helper()
+
+	if r.rec.Code != status {
+		r.t.Fatalf("%s %s: expected status %d, got %d: %s", r.method, r.path, status, r.rec.Code, r.rec.Body.String())
+	}
+
+	return r
+}
+
+// expectError checks the status and the error code of an api.ApiError response
+func (r *response) expectError(status int, code enum.ErrorCode) {
+	r.t.Helper()
+
+	r.expect(status)
+
+	var apiErr api.ApiError
+	r.decode(&apiErr)
+	if apiErr.Error != code {
+		r.t.Fatalf("%s %s: expected error %s, got %s", r.method, r.path, code, apiErr.Error)
+	}
+}
+
+func (r *response) decode(v any) {
+	r.t.Helper()
+
+	if err := json.Unmarshal(r.rec.Body.Bytes(), v); err != nil {
+		r.t.Fatalf("%s %s: could not decode %q: %s", r.method, r.path, r.rec.Body.String(), err)
+	}
+}
+
+// endpointCase is a single request against a fresh harness. prepare sets up the state and
+// returns the client, path and body of the request. If code is set the response must be
+// an api.ApiError with that code, check runs additional assertions on the response.
+type endpointCase struct {
+	name    string
+	method  string
+	prepare func(h *harness) (c *client, path string, body any)
+	status  int
+	code    enum.ErrorCode
+	check   func(t *testing.T, h *harness, c *client, r *response)
+}
+
+func runEndpointCases(t *testing.T, cases []endpointCase) {
+	t.Helper()
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := newHarness(t)
+			c, path, body := tc.prepare(h)
+
+			r := c.do(tc.method, path, body)
+			if tc.code != "" {
+				r.expectError(tc.status, tc.code)
+			} else {
+				r.expect(tc.status)
+			}
+
+			if tc.check != nil {
+				tc.check(t, h, c, r)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package e2e
+
+import (
+	"easyflow-backend/src/api/health"
+	"easyflow-backend/src/enum"
+	"easyflow-backend/src/router"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHealthEndpoints(t *testing.T) {
+	runEndpointCases(t, []endpointCase{
+		{
+			name:   "liveness",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				return h.newClient(), "/healthz", nil
+			},
+			status: http.StatusOK,
+		},
+		{
+			name:   "ready with database",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				return h.newClient(), "/readyz", nil
+			},
+			status: http.StatusOK,
+			check: func(t *testing.T, h *harness, c *client, r *response) {
+				var readiness health.ReadinessResponse
+				r.decode(&readiness)
+				if readiness.State != health.Ready || readiness.Dependencies["database"].Status != health.Up {
+					t.Fatalf("unexpected readiness: %+v", readiness)
+				}
+			},
+		},
+		{
+			name:   "not ready while draining",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				h.checker.MarkDraining()
+				return h.newClient(), "/readyz", nil
+			},
+			status: http.StatusServiceUnavailable,
+		},
+	})
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	h := newHarness(t)
+	h.newClient().do(http.MethodGet, "/user/exists/nobody@example.com", nil).expect(http.StatusOK)
+
+	for _, tc := range []struct {
+		name          string
+		authorization string
+		status        int
+	}{
+		{name: "without token", status: http.StatusUnauthorized},
+		{name: "wrong token", authorization: "Bearer wrong", status: http.StatusUnauthorized},
+		{name: "with token", authorization: "Bearer " + testMetricsToken, status: http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			req.Header.Set("Authorization", tc.authorization)
+			rec := httptest.NewRecorder()
+			h.router.ServeHTTP(rec, req)
+
+			if rec.Code != tc.status {
+				t.Fatalf("expected status %d, got %d", tc.status, rec.Code)
+			}
+			if tc.status == http.StatusOK && !strings.Contains(rec.Body.String(), "http_requests_total") {
+				t.Fatalf("metrics output misses the request counter")
+			}
+		})
+	}
+}
+
+func TestStartupRouter(t *testing.T) {
+	h := newHarness(t)
+	checker := health.NewChecker(h.cfg, h.store)
+	startup := router.NewStartup(checker)
+
+	for _, tc := range []struct {
+		path   string
+		status int
+		code   enum.ErrorCode
+	}{
+		{path: "/healthz", status: http.StatusOK},
+		{path: "/readyz", status: http.StatusServiceUnavailable},
+		{path: "/user/", status: http.StatusServiceUnavailable, code: enum.ServiceUnavailable},
+	} {
+		t.Run(tc.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			startup.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+			r := &response{t: t, method: http.MethodGet, path: tc.path, rec: rec}
+			if tc.code != "" {
+				r.expectError(tc.status, tc.code)
+			} else {
+				r.expect(tc.status)
+			}
+		})
+	}
+}
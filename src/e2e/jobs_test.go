@@ -0,0 +1,280 @@
+package e2e
+
+import (
+	"context"
+	"easyflow-backend/src/common"
+	"easyflow-backend/src/database"
+	"easyflow-backend/src/jobs"
+	"easyflow-backend/src/repository"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type greeting struct {
+	Name string `json:"name"`
+}
+
+var greet = jobs.NewKind[greeting]("test.greet")
+
+// runJob runs the next due job and fails the test if none was due
+func runJob(t *testing.T, pool *jobs.Pool) {
+	t.Helper()
+
+	ran, err := pool.RunOnce(context.Background())
+	if err != nil || !ran {
+		t.Fatalf("no job was run: %v", err)
+	}
+}
+
+// greetPool returns a pool that runs the greet jobs with handle
+func greetPool(h *harness, handle func(ctx context.Context, payload greeting) error) *jobs.Pool {
+	pool := jobs.NewPool(h.repos, h.cfg)
+	jobs.Handle(pool, greet, handle)
+	return pool
+}
+
+// listJobs returns the jobs with the status
+func (h *harness) listJobs(status database.JobStatus) []database.Job {
+	h.t.Helper()
+
+	list, err := h.repos.Jobs.List(context.Background(), status, 0)
+	if err != nil {
+		h.t.Fatalf("could not list jobs: %s", err)
+	}
+	return list
+}
+
+// makeDue moves the next attempt of the job to now instead of waiting for the backoff
+func (h *harness) makeDue(id string) {
+	h.t.Helper()
+
+	if err := h.db.GetClient().Model(&database.Job{}).Where("id = ?", id).Update("run_at", time.Now().Add(-time.Second)).Error; err != nil {
+		h.t.Fatalf("could not move job: %s", err)
+	}
+}
+
+func TestJobRuns(t *testing.T) {
+	h := newHarness(t)
+	ctx := context.Background()
+	var greeted []string
+	pool := greetPool(h, func(ctx context.Context, payload greeting) error {
+		greeted = append(greeted, payload.Name)
+		return nil
+	})
+
+	if _, err := greet.Enqueue(ctx, h.repos, greeting{Name: "alice"}); err != nil {
+		t.Fatalf("could not enqueue: %s", err)
+	}
+	runJob(t, pool)
+	if len(greeted) != 1 || greeted[0] != "alice" {
+		t.Fatalf("handler did not get the payload: %v", greeted)
+	}
+	if queued := h.listJobs(database.JobQueued); len(queued) != 0 {
+		t.Fatalf("job was not removed: %+v", queued)
+	}
+
+	// jobs are enqueued together with the changes of a transaction
+	err := h.repos.Transaction(ctx, func(repos *repository.Repositories) error {
+		if _, err := greet.Enqueue(ctx, repos, greeting{Name: "bob"}); err != nil {
+			return err
+		}
+		return errors.New("rolled back")
+	})
+	if err == nil || len(h.listJobs(database.JobQueued)) != 0 {
+		t.Fatalf("job survived the rollback")
+	}
+
+	// neither jobs that are not due yet nor jobs without a handler are run
+	if _, err := greet.EnqueueAt(ctx, h.repos, greeting{Name: "carol"}, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("could not enqueue: %s", err)
+	}
+	if _, err := jobs.NewKind[greeting]("test.unknown").Enqueue(ctx, h.repos, greeting{Name: "dave"}); err != nil {
+		t.Fatalf("could not enqueue: %s", err)
+	}
+	if ran, err := pool.RunOnce(ctx); ran || err != nil {
+		t.Fatalf("unexpected run: %v, %v", ran, err)
+	}
+	if len(greeted) != 1 || len(h.listJobs(database.JobQueued)) != 2 {
+		t.Fatalf("unexpected jobs: %v", greeted)
+	}
+}
+
+func TestJobFailures(t *testing.T) {
+	h := buildHarness(t, false, func(cfg *common.Config) {
+		cfg.JobMaxAttempts = 2
+	})
+	ctx := context.Background()
+
+	healthy := false
+	pool := greetPool(h, func(ctx context.Context, payload greeting) error {
+		switch {
+		case payload.Name == "unknown":
+			return jobs.Permanent(errors.New("user does not exist"))
+		case !healthy:
+			return errors.New("mail server unavailable")
+		}
+		return nil
+	})
+
+	// permanent failures and payloads that can not be decoded are not retried
+	if _, err := greet.Enqueue(ctx, h.repos, greeting{Name: "unknown"}); err != nil {
+		t.Fatalf("could not enqueue: %s", err)
+	}
+	if err := h.repos.Jobs.Create(ctx, &database.Job{Type: greet.Name, Payload: "not json"}); err != nil {
+		t.Fatalf("could not enqueue: %s", err)
+	}
+	runJob(t, pool)
+	runJob(t, pool)
+	dead := h.listJobs(database.JobDead)
+	if len(dead) != 2 || dead[0].Attempts != 1 || dead[1].Attempts != 1 {
+		t.Fatalf("jobs were not dead-lettered right away: %+v", dead)
+	}
+
+	// the error and the next attempt of a failed job are stored
+	job, err := greet.Enqueue(ctx, h.repos, greeting{Name: "alice"})
+	if err != nil {
+		t.Fatalf("could not enqueue: %s", err)
+	}
+	runJob(t, pool)
+	queued := h.listJobs(database.JobQueued)
+	if len(queued) != 1 || queued[0].Attempts != 1 || queued[0].LastError == nil || *queued[0].LastError != "mail server unavailable" || !queued[0].RunAt.After(time.Now()) {
+		t.Fatalf("failed job was not queued again: %+v", queued)
+	}
+	if ran, _ := pool.RunOnce(ctx); ran {
+		t.Fatalf("job was run before its backoff was over")
+	}
+	h.makeDue(job.Id)
+	runJob(t, pool)
+	if dead := h.listJobs(database.JobDead); len(dead) != 3 {
+		t.Fatalf("job was not dead-lettered after its last attempt: %+v", dead)
+	}
+
+	// only the given dead jobs are requeued, with fresh attempts
+	requeued, err := h.repos.Jobs.Requeue(ctx, []string{job.Id, "unknown"})
+	if err != nil || requeued != 1 || len(h.listJobs(database.JobDead)) != 2 {
+		t.Fatalf("unexpected requeue: %d, %v", requeued, err)
+	}
+	if queued := h.listJobs(database.JobQueued); len(queued) != 1 || queued[0].Attempts != 0 {
+		t.Fatalf("job was not requeued with fresh attempts: %+v", queued)
+	}
+
+	healthy = true
+	runJob(t, pool)
+	if len(h.listJobs(database.JobQueued)) != 0 {
+		t.Fatalf("requeued job was not run")
+	}
+}
+
+func TestExpiredJobLeases(t *testing.T) {
+	h := newHarness(t)
+	ctx := context.Background()
+
+	job, err := greet.Enqueue(ctx, h.repos, greeting{Name: "alice"})
+	if err != nil {
+		t.Fatalf("could not enqueue: %s", err)
+	}
+
+	// a worker that is shutting down does not claim anything
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if leased, err := h.repos.Jobs.Lease(cancelled, []string{greet.Name}, "cancelled", time.Now().Add(time.Minute), h.cfg.JobMaxAttempts); leased != nil || !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %+v, %v", leased, err)
+	}
+
+	// a worker that crashed never gives its lease back
+	crashed, err := h.repos.Jobs.Lease(ctx, []string{greet.Name}, "crashed", time.Now().Add(-time.Second), h.cfg.JobMaxAttempts)
+	if err != nil || crashed.Id != job.Id || crashed.Attempts != 1 {
+		t.Fatalf("could not lease: %+v, %v", crashed, err)
+	}
+
+	leased, err := h.repos.Jobs.Lease(ctx, []string{greet.Name}, "second", time.Now().Add(time.Minute), h.cfg.JobMaxAttempts)
+	if err != nil || leased.Id != job.Id || leased.Attempts != 2 {
+		t.Fatalf("expired lease was not leased again: %+v, %v", leased, err)
+	}
+	if _, err := h.repos.Jobs.Lease(ctx, []string{greet.Name}, "third", time.Now().Add(time.Minute), h.cfg.JobMaxAttempts); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("job was leased twice: %v", err)
+	}
+
+	// the first worker lost its lease and can not change the job anymore
+	crashed.Status = database.JobDead
+	if err := h.repos.Jobs.Update(ctx, crashed, "crashed"); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if err := h.repos.Jobs.Delete(ctx, job.Id, "crashed"); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if err := h.repos.Jobs.Delete(ctx, job.Id, "second"); err != nil {
+		t.Fatalf("could not finish the job: %s", err)
+	}
+}
+
+func TestJobWorkers(t *testing.T) {
+	h := buildHarness(t, false, func(cfg *common.Config) {
+		cfg.JobWorkers = 4
+		cfg.JobPollInterval = 10 * time.Millisecond
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var mu sync.Mutex
+	runs := map[string]int{}
+	pool := greetPool(h, func(ctx context.Context, payload greeting) error {
+		mu.Lock()
+		defer mu.Unlock()
+		runs[payload.Name]++
+		return nil
+	})
+
+	names := []string{"alice", "bob", "carol", "dave", "erin", "frank", "grace", "heidi"}
+	for _, name := range names {
+		if _, err := greet.Enqueue(ctx, h.repos, greeting{Name: name}); err != nil {
+			t.Fatalf("could not enqueue: %s", err)
+		}
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		pool.Run(ctx)
+		close(stopped)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(h.listJobs(database.JobQueued))+len(h.listJobs(database.JobRunning)) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("jobs were not run")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-stopped
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, name := range names {
+		if runs[name] != 1 {
+			t.Fatalf("job of %s ran %d times", name, runs[name])
+		}
+	}
+}
+
+func TestValidateJobConfig(t *testing.T) {
+	h := newHarness(t)
+
+	cfg := *h.cfg
+	cfg.JobWorkers = -1
+	cfg.JobMaxAttempts = 0
+	cfg.JobRetryBackoff = time.Hour
+	cfg.JobRetryMaxBackoff = time.Minute
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+	for _, expected := range []string{"JOB_WORKERS", "JOB_MAX_ATTEMPTS", "JOB_RETRY_BACKOFF"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Fatalf("error does not mention %s: %s", expected, err)
+		}
+	}
+}
@@ -0,0 +1,360 @@
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"easyflow-backend/src/api/chat"
+	"easyflow-backend/src/api/user"
+	"easyflow-backend/src/api/utils"
+	"easyflow-backend/src/database"
+	"easyflow-backend/src/enum"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// exifMarker is embedded in the exif block of test pictures to check that metadata is stripped
+const exifMarker = "gps-location-of-alice"
+
+var (
+	red  = color.RGBA{R: 255, A: 255}
+	blue = color.RGBA{B: 255, A: 255}
+)
+
+// testPicture returns a picture whose left half is red and right half is blue
+func testPicture(width int, height int) *image.RGBA {
+	picture := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if x < width/2 {
+				picture.Set(x, y, red)
+			} else {
+				picture.Set(x, y, blue)
+			}
+		}
+	}
+	return picture
+}
+
+// jpegWithExif encodes the picture and inserts an exif block with the orientation and the marker after the start of image
+func jpegWithExif(t *testing.T, picture image.Image, orientation uint16) []byte {
+	t.Helper()
+
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, picture, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatalf("could not encode picture: %s", err)
+	}
+
+	// little endian tiff header with a single directory holding the orientation
+	tiff := []byte("II*\x00\x08\x00\x00\x00")
+	tiff = binary.LittleEndian.AppendUint16(tiff, 1)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 0x0112)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 3)
+	tiff = binary.LittleEndian.AppendUint32(tiff, 1)
+	tiff = binary.LittleEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0)
+	tiff = append(tiff, exifMarker...)
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := binary.BigEndian.AppendUint16([]byte{0xFF, 0xE1}, uint16(len(segment)+2))
+
+	raw := encoded.Bytes()
+	return append(append(append([]byte{}, raw[:2]...), append(app1, segment...)...), raw[2:]...)
+}
+
+func pngOf(t *testing.T, picture image.Image) []byte {
+	t.Helper()
+
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, picture); err != nil {
+		t.Fatalf("could not encode picture: %s", err)
+	}
+	return encoded.Bytes()
+}
+
+// uploadProfilePicture uploads the picture through a presigned url and returns the response of the confirmation
+func (c *client) uploadProfilePicture(mimeType string, picture []byte) *response {
+	c.h.t.Helper()
+
+	var upload user.UploadProfilePictureResponse
+	c.do(http.MethodGet, fmt.Sprintf("/user/upload-profile-picture?mimeType=%s&size=%d", mimeType, len(picture)), nil).
+		expect(http.StatusOK).decode(&upload)
+	if status := c.h.upload(upload.UploadURL, upload.UploadHeaders, picture); status != http.StatusOK {
+		c.h.t.Fatalf("upload failed with status %d", status)
+	}
+
+	return c.do(http.MethodPost, "/user/profile-picture", nil)
+}
+
+// requestProfilePictureUpload requests an upload and returns the staging key the presigned url writes to
+func (c *client) requestProfilePictureUpload() string {
+	c.h.t.Helper()
+
+	c.do(http.MethodGet, "/user/upload-profile-picture?mimeType=image/png&size=1024", nil).expect(http.StatusOK)
+	return c.requestedUpload()
+}
+
+// requestedUpload returns the staging key of the last profile picture upload the user requested
+func (c *client) requestedUpload() string {
+	c.h.t.Helper()
+
+	user, err := c.h.repos.Users.GetById(context.Background(), c.user.Id)
+	if err != nil || user.PictureUpload == nil {
+		c.h.t.Fatalf("upload was not stored: %v", err)
+	}
+	return *user.PictureUpload
+}
+
+// profilePictureKey returns the key the profile picture of the user is published under
+func (h *harness) profilePictureKey(userId string) string {
+	h.t.Helper()
+
+	user, err := h.repos.Users.GetById(context.Background(), userId)
+	if err != nil || user.PictureKey == nil {
+		h.t.Fatalf("user has no picture: %v", err)
+	}
+	return *user.PictureKey
+}
+
+func download(t *testing.T, url string) []byte {
+	t.Helper()
+
+	res, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("could not download %s: %s", url, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("download failed with status %d", res.StatusCode)
+	}
+	body, _ := io.ReadAll(res.Body)
+	return body
+}
+
+func isColor(c color.Color, expected color.RGBA) bool {
+	r, g, b, _ := c.RGBA()
+	near := func(value uint32, expected uint8) bool {
+		diff := int(value>>8) - int(expected)
+		return diff > -40 && diff < 40
+	}
+	return near(r, expected.R) && near(g, expected.G) && near(b, expected.B)
+}
+
+func TestProfilePictureVariants(t *testing.T) {
+	h := newHarness(t)
+	alice, bob := h.newUser("alice"), h.newUser("bob")
+
+	// stored sideways, the exif orientation rotates it clockwise so red ends up on top
+	var confirmed user.UserProfileResponse
+	alice.uploadProfilePicture("image/jpeg", jpegWithExif(t, testPicture(200, 100), 6)).expect(http.StatusOK).decode(&confirmed)
+	if len(confirmed.ProfilePictureVariants) != 3 || confirmed.ProfilePicture == nil {
+		t.Fatalf("unexpected profile: %+v", confirmed)
+	}
+
+	// published under a key of its own, next to its variants
+	key := h.profilePictureKey(alice.user.Id)
+	if !strings.HasPrefix(key, alice.user.Id+"/") {
+		t.Fatalf("unexpected picture key: %s", key)
+	}
+	original, ok := h.s3.Get(testBucket, key)
+	if !ok || bytes.Contains(original, []byte(exifMarker)) || bytes.Contains(original, []byte("Exif")) {
+		t.Fatalf("metadata was not stripped from the stored picture")
+	}
+	if config, err := jpeg.DecodeConfig(bytes.NewReader(original)); err != nil || config.Width != 100 || config.Height != 200 {
+		t.Fatalf("orientation was not applied to the stored picture: %+v %v", config, err)
+	}
+
+	for _, size := range []int{64, 256, 512} {
+		variantURL := confirmed.ProfilePictureVariants[fmt.Sprint(size)]
+		if !strings.Contains(variantURL, fmt.Sprintf("/%s/%s/%d.jpg", testBucket, key, size)) {
+			t.Fatalf("unexpected url of the %d variant: %s", size, variantURL)
+		}
+
+		variant, err := jpeg.Decode(bytes.NewReader(download(t, variantURL)))
+		if err != nil || variant.Bounds().Dx() != size || variant.Bounds().Dy() != size {
+			t.Fatalf("unexpected %d variant: %v", size, err)
+		}
+		if !isColor(variant.At(size/2, size/8), red) || !isColor(variant.At(size/2, size-size/8), blue) {
+			t.Fatalf("the %d variant is not oriented", size)
+		}
+	}
+
+	var profile user.UserProfileResponse
+	alice.do(http.MethodGet, "/user/", nil).expect(http.StatusOK).decode(&profile)
+	if len(profile.ProfilePictureVariants) != 3 {
+		t.Fatalf("profile does not expose the variants: %+v", profile)
+	}
+
+	// user entries of chats carry the variants as well, users without a picture have none
+	talk := bob.createChat("talk", alice)
+	var fetched chat.GetChatByIdResponse
+	alice.do(http.MethodGet, "/chat/"+talk.Id, nil).expect(http.StatusOK).decode(&fetched)
+	if len(fetched.Users) != 1 || len(fetched.Users[0].ProfilePictureVariants) != 3 {
+		t.Fatalf("chat does not expose the variants: %+v", fetched.Users)
+	}
+	bob.do(http.MethodGet, "/chat/"+talk.Id, nil).expect(http.StatusOK).decode(&fetched)
+	if fetched.Users[0].ProfilePictureVariants != nil {
+		t.Fatalf("user without a picture has variants: %+v", fetched.Users)
+	}
+}
+
+func TestProfilePictureTransparency(t *testing.T) {
+	h := newHarness(t)
+	alice := h.newUser("alice")
+
+	var confirmed user.UserProfileResponse
+	alice.uploadProfilePicture("image/png", pngOf(t, image.NewRGBA(image.Rect(0, 0, 128, 128)))).expect(http.StatusOK).decode(&confirmed)
+
+	variant, err := jpeg.Decode(bytes.NewReader(download(t, confirmed.ProfilePictureVariants["64"])))
+	if err != nil || !isColor(variant.At(32, 32), color.RGBA{R: 255, G: 255, B: 255}) {
+		t.Fatalf("transparent pixels are not white: %v", err)
+	}
+}
+
+func TestInvalidProfilePicture(t *testing.T) {
+	runEndpointCases(t, []endpointCase{
+		{
+			name:   "not a picture",
+			method: http.MethodPost,
+			prepare: func(h *harness) (*client, string, any) {
+				c := h.newUser("alice")
+				h.s3.Put(testBucket, c.requestProfilePictureUpload(), []byte("not a picture"), "image/png")
+				return c, "/user/profile-picture", nil
+			},
+			status: http.StatusBadRequest,
+			code:   enum.InvalidImage,
+			check: func(t *testing.T, h *harness, c *client, r *response) {
+				if keys := h.s3.Keys(testBucket, ""); len(keys) != 0 {
+					t.Fatalf("invalid picture was kept: %v", keys)
+				}
+			},
+		},
+		{
+			name:   "too small",
+			method: http.MethodPost,
+			prepare: func(h *harness) (*client, string, any) {
+				c := h.newUser("alice")
+				h.s3.Put(testBucket, c.requestProfilePictureUpload(), pngOf(h.t, testPicture(32, 32)), "image/png")
+				return c, "/user/profile-picture", nil
+			},
+			status: http.StatusBadRequest,
+			code:   enum.InvalidImage,
+		},
+		{
+			name:   "too large",
+			method: http.MethodPost,
+			prepare: func(h *harness) (*client, string, any) {
+				c := h.newUser("alice")
+				h.s3.Put(testBucket, c.requestProfilePictureUpload(), pngOf(h.t, testPicture(h.cfg.ImageMaxDimension+1, 64)), "image/png")
+				return c, "/user/profile-picture", nil
+			},
+			status: http.StatusBadRequest,
+			code:   enum.InvalidImage,
+		},
+	})
+}
+
+// setPictureKey points the profile picture of the user to an object like the migration does for existing pictures
+func (h *harness) setPictureKey(userId string, key string) {
+	h.t.Helper()
+
+	if err := h.db.GetClient().Model(&database.User{}).Where("id = ?", userId).Update("picture_key", key).Error; err != nil {
+		h.t.Fatalf("could not update user: %s", err)
+	}
+}
+
+// userUpdatedAt returns when the user row was last written
+func (h *harness) userUpdatedAt(userId string) time.Time {
+	h.t.Helper()
+
+	var user database.User
+	if err := h.db.GetClient().Unscoped().First(&user, "id = ?", userId).Error; err != nil {
+		h.t.Fatalf("could not get user: %s", err)
+	}
+	return user.UpdatedAt
+}
+
+func TestProfilePictureURLsAreSignedOnRead(t *testing.T) {
+	h := newHarness(t)
+	alice := h.newUser("alice")
+	alice.uploadProfilePicture("image/png", pngOf(t, testPicture(64, 64))).expect(http.StatusOK)
+	updatedAt := h.userUpdatedAt(alice.user.Id)
+
+	var first, second user.UserProfileResponse
+	alice.do(http.MethodGet, "/user/", nil).expect(http.StatusOK).decode(&first)
+	h.newClient().login(alice.user)
+	alice.do(http.MethodGet, "/user/", nil).expect(http.StatusOK).decode(&second)
+
+	var pictureURL string
+	alice.do(http.MethodGet, "/user/profile-picture", nil).expect(http.StatusOK).decode(&pictureURL)
+
+	if first.ProfilePicture == nil || *first.ProfilePicture != *second.ProfilePicture || pictureURL != *first.ProfilePicture {
+		t.Fatalf("cached url was not reused: %v %v %s", first.ProfilePicture, second.ProfilePicture, pictureURL)
+	}
+	if first.ProfilePictureVariants["64"] != second.ProfilePictureVariants["64"] {
+		t.Fatalf("cached variant url was not reused")
+	}
+	if !h.userUpdatedAt(alice.user.Id).Equal(updatedAt) {
+		t.Fatalf("reads and logins wrote to the user")
+	}
+
+	// a replaced picture is published under a new key, the urls that were handed out for the old one stop working
+	var replaced user.UserProfileResponse
+	alice.uploadProfilePicture("image/png", pngOf(t, testPicture(128, 128))).expect(http.StatusOK).decode(&replaced)
+	if *replaced.ProfilePicture == *first.ProfilePicture {
+		t.Fatalf("replaced picture has the url of the old one")
+	}
+	config, err := jpeg.DecodeConfig(bytes.NewReader(download(t, *replaced.ProfilePicture)))
+	if err != nil || config.Width != 128 {
+		t.Fatalf("replaced picture is not served: %+v %v", config, err)
+	}
+	if res, err := http.Get(*first.ProfilePicture); err != nil || res.StatusCode == http.StatusOK {
+		t.Fatalf("old picture is still served: %v", err)
+	}
+}
+
+func TestProfilePictureUploadCanNotReplaceConfirmedPicture(t *testing.T) {
+	h := newHarness(t)
+	alice := h.newUser("alice")
+
+	picture := pngOf(t, testPicture(64, 64))
+	var upload user.UploadProfilePictureResponse
+	alice.do(http.MethodGet, fmt.Sprintf("/user/upload-profile-picture?mimeType=image/png&size=%d", len(picture)), nil).
+		expect(http.StatusOK).decode(&upload)
+	if status := h.upload(upload.UploadURL, upload.UploadHeaders, picture); status != http.StatusOK {
+		t.Fatalf("upload failed with status %d", status)
+	}
+
+	var confirmed user.UserProfileResponse
+	alice.do(http.MethodPost, "/user/profile-picture", nil).expect(http.StatusOK).decode(&confirmed)
+	if keys := h.s3.Keys(testBucket, utils.PictureUploadPrefix); len(keys) != 0 {
+		t.Fatalf("staging object was kept: %v", keys)
+	}
+	served := download(t, *confirmed.ProfilePicture)
+
+	// the presigned url is still valid, but it only writes to its staging object which is never served
+	forged := append([]byte{}, picture...)
+	forged[len(forged)-1] ^= 0xFF
+	if status := h.upload(upload.UploadURL, upload.UploadHeaders, forged); status != http.StatusOK {
+		t.Fatalf("upload failed with status %d", status)
+	}
+	if !bytes.Equal(download(t, *confirmed.ProfilePicture), served) {
+		t.Fatalf("the published picture was overwritten")
+	}
+
+	// and a staging object is only confirmed once
+	alice.do(http.MethodPost, "/user/profile-picture", nil).expectError(http.StatusNotFound, enum.NotFound)
+	var profile user.UserProfileResponse
+	alice.do(http.MethodGet, "/user/", nil).expect(http.StatusOK).decode(&profile)
+	if profile.ProfilePicture == nil || !bytes.Equal(download(t, *profile.ProfilePicture), served) {
+		t.Fatalf("the published picture was replaced")
+	}
+}
@@ -0,0 +1,618 @@
+package e2e
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"easyflow-backend/src/api/chat"
+	"easyflow-backend/src/api/user"
+	"easyflow-backend/src/common"
+	"easyflow-backend/src/database"
+	"easyflow-backend/src/enum"
+	"easyflow-backend/src/jobs"
+	"easyflow-backend/src/notify"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/hkdf"
+)
+
+// pushed is a notification the fake push server accepted
+type pushed struct {
+	platform     database.PushPlatform
+	token        string
+	notification notify.Notification
+}
+
+// subscriber is a browser push subscription, the fake decrypts the payloads with its key
+type subscriber struct {
+	key  *ecdh.PrivateKey
+	auth []byte
+}
+
+/*
+fakePush plays the web push services of the browsers, the oauth and send endpoints of fcm and apns.
+It checks the credentials like the real services do and answers 404 or 410 for tokens that are gone.
+*/
+type fakePush struct {
+	t       *testing.T
+	server  *httptest.Server
+	fcmKey  *rsa.PrivateKey
+	apnsKey *ecdsa.PrivateKey
+
+	mu          sync.Mutex
+	subscribers map[string]*subscriber
+	gone        map[string]bool
+	received    []pushed
+}
+
+func newFakePush(t *testing.T) *fakePush {
+	t.Helper()
+
+	fcmKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("could not generate fcm key: %s", err)
+	}
+	apnsKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("could not generate apns key: %s", err)
+	}
+
+	fake := &fakePush{
+		t:           t,
+		fcmKey:      fcmKey,
+		apnsKey:     apnsKey,
+		subscribers: map[string]*subscriber{},
+		gone:        map[string]bool{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /webpush/{id}", fake.webPush)
+	mux.HandleFunc("POST /token", fake.fcmToken)
+	mux.HandleFunc("POST /v1/projects/{project}/messages:send", fake.fcmSend)
+	mux.HandleFunc("POST /3/device/{token}", fake.apnsSend)
+	fake.server = httptest.NewTLSServer(mux)
+	t.Cleanup(fake.server.Close)
+
+	return fake
+}
+
+// configure enables all platforms against the fake
+func (f *fakePush) configure(cfg *common.Config) {
+	f.t.Helper()
+	dir := f.t.TempDir()
+
+	privateKey, _, err := notify.GenerateVapidKey()
+	if err != nil {
+		f.t.Fatalf("could not generate vapid key: %s", err)
+	}
+	cfg.PushVapidPrivateKey = privateKey
+	cfg.PushVapidSubject = "mailto:ops@example.com"
+	cfg.PushWebPushHosts = []string{"127.0.0.1"}
+
+	credentials, err := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"project_id":   "easyflow",
+		"client_email": "push@easyflow.iam.gserviceaccount.com",
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(f.fcmKey)})),
+		"token_uri":    f.server.URL + "/token",
+	})
+	if err != nil {
+		f.t.Fatalf("could not marshal credentials: %s", err)
+	}
+	cfg.PushFcmCredentialsFile = filepath.Join(dir, "firebase.json")
+	cfg.PushFcmURL = f.server.URL
+
+	apnsKey, err := x509.MarshalPKCS8PrivateKey(f.apnsKey)
+	if err != nil {
+		f.t.Fatalf("could not marshal apns key: %s", err)
+	}
+	cfg.PushApnsKeyFile = filepath.Join(dir, "AuthKey.p8")
+	cfg.PushApnsKeyId = "KEY123"
+	cfg.PushApnsTeamId = "TEAM123"
+	cfg.PushApnsTopic = "com.example.easyflow"
+	cfg.PushApnsURL = f.server.URL
+
+	for file, content := range map[string][]byte{
+		cfg.PushFcmCredentialsFile: credentials,
+		cfg.PushApnsKeyFile:        pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: apnsKey}),
+	} {
+		if err := os.WriteFile(file, content, 0o600); err != nil {
+			f.t.Fatalf("could not write %s: %s", file, err)
+		}
+	}
+}
+
+// subscribe creates a browser subscription whose endpoint is on the fake
+func (f *fakePush) subscribe(id string) user.WebPushSubscription {
+	f.t.Helper()
+
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		f.t.Fatalf("could not generate subscription key: %s", err)
+	}
+	auth := make([]byte, 16)
+	rand.Read(auth)
+
+	f.mu.Lock()
+	f.subscribers[id] = &subscriber{key: key, auth: auth}
+	f.mu.Unlock()
+
+	var subscription user.WebPushSubscription
+	subscription.Endpoint = f.server.URL + "/webpush/" + id
+	subscription.Keys.P256dh = base64.RawURLEncoding.EncodeToString(key.PublicKey().Bytes())
+	subscription.Keys.Auth = base64.RawURLEncoding.EncodeToString(auth)
+	return subscription
+}
+
+// expire makes the fake answer that the subscription or token is gone
+func (f *fakePush) expire(token string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.gone[token] = true
+}
+
+// take returns the notifications received since the last call
+func (f *fakePush) take() []pushed {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	received := f.received
+	f.received = nil
+	return received
+}
+
+func (f *fakePush) record(platform database.PushPlatform, token string, notification notify.Notification) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.received = append(f.received, pushed{platform: platform, token: token, notification: notification})
+}
+
+func (f *fakePush) isGone(token string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.gone[token]
+}
+
+func (f *fakePush) webPush(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if f.isGone(id) {
+		w.WriteHeader(http.StatusGone)
+		return
+	}
+
+	// the token has to be signed by the key that is sent along and be meant for this origin
+	var token, key string
+	for _, part := range strings.Split(strings.TrimPrefix(r.Header.Get("Authorization"), "vapid "), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch name {
+		case "t":
+			token = value
+		case "k":
+			key = value
+		}
+	}
+	point, err := base64.RawURLEncoding.DecodeString(key)
+	if err != nil || len(point) != 65 {
+		http.Error(w, "invalid vapid key", http.StatusUnauthorized)
+		return
+	}
+	publicKey := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(point[1:33]), Y: new(big.Int).SetBytes(point[33:])}
+	_, err = jwt.Parse(token, func(*jwt.Token) (any, error) { return publicKey, nil },
+		jwt.WithValidMethods([]string{"ES256"}), jwt.WithAudience(f.server.URL), jwt.WithExpirationRequired())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if r.Header.Get("Content-Encoding") != "aes128gcm" || r.Header.Get("TTL") == "" {
+		http.Error(w, "missing headers", http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	sub := f.subscribers[id]
+	f.mu.Unlock()
+	body, _ := io.ReadAll(r.Body)
+	plaintext, err := decryptWebPush(sub, body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var notification notify.Notification
+	if err := json.Unmarshal(plaintext, &notification); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.record(database.PushWeb, id, notification)
+	w.WriteHeader(http.StatusCreated)
+}
+
+/*
+decryptWebPush reverses the aes128gcm content coding like a browser does
+*/
+func decryptWebPush(sub *subscriber, body []byte) ([]byte, error) {
+	if len(body) < 21 || len(body) < 21+int(body[20]) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	salt, keyLength := body[:16], int(body[20])
+	if binary.BigEndian.Uint32(body[16:20]) < 18 {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	serverKey, err := ecdh.P256().NewPublicKey(body[21 : 21+keyLength])
+	if err != nil {
+		return nil, err
+	}
+	shared, err := sub.key.ECDH(serverKey)
+	if err != nil {
+		return nil, err
+	}
+
+	read := func(prk []byte, info string, length int) []byte {
+		out := make([]byte, length)
+		io.ReadFull(hkdf.Expand(sha256.New, prk, []byte(info)), out)
+		return out
+	}
+	keyInfo := "WebPush: info\x00" + string(sub.key.PublicKey().Bytes()) + string(serverKey.Bytes())
+	ikm := read(hkdf.Extract(sha256.New, shared, sub.auth), keyInfo, 32)
+	prk := hkdf.Extract(sha256.New, ikm, salt)
+
+	block, err := aes.NewCipher(read(prk, "Content-Encoding: aes128gcm\x00", 16))
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := gcm.Open(nil, read(prk, "Content-Encoding: nonce\x00", 12), body[21+keyLength:], nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// the last record ends with the 0x02 delimiter
+	if len(plaintext) == 0 || plaintext[len(plaintext)-1] != 0x02 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return plaintext[:len(plaintext)-1], nil
+}
+
+func (f *fakePush) fcmToken(w http.ResponseWriter, r *http.Request) {
+	if r.FormValue("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" {
+		http.Error(w, "unsupported grant", http.StatusBadRequest)
+		return
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(r.FormValue("assertion"), claims, func(*jwt.Token) (any, error) { return &f.fcmKey.PublicKey, nil },
+		jwt.WithValidMethods([]string{"RS256"}), jwt.WithAudience(f.server.URL+"/token"))
+	if err != nil || claims["scope"] != "https://www.googleapis.com/auth/firebase.messaging" {
+		http.Error(w, "invalid assertion", http.StatusUnauthorized)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]any{"access_token": "fcm-access-token", "expires_in": 3600, "token_type": "Bearer"})
+}
+
+func (f *fakePush) fcmSend(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer fcm-access-token" || r.PathValue("project") != "easyflow" {
+		http.Error(w, "unauthenticated", http.StatusUnauthorized)
+		return
+	}
+
+	var body struct {
+		Message struct {
+			Token string            `json:"token"`
+			Data  map[string]string `json:"data"`
+		} `json:"message"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if f.isGone(body.Message.Token) {
+		http.Error(w, `{"error":{"status":"NOT_FOUND","details":[{"errorCode":"UNREGISTERED"}]}}`, http.StatusNotFound)
+		return
+	}
+
+	f.record(database.PushFCM, body.Message.Token, notify.Notification{Type: body.Message.Data["type"], ChatId: body.Message.Data["chatId"]})
+	json.NewEncoder(w).Encode(map[string]string{"name": "projects/easyflow/messages/1"})
+}
+
+func (f *fakePush) apnsSend(w http.ResponseWriter, r *http.Request) {
+	token := jwt.New(jwt.SigningMethodES256)
+	_, err := jwt.ParseWithClaims(strings.TrimPrefix(r.Header.Get("Authorization"), "bearer "), token.Claims, func(parsed *jwt.Token) (any, error) {
+		token = parsed
+		return &f.apnsKey.PublicKey, nil
+	}, jwt.WithValidMethods([]string{"ES256"}), jwt.WithIssuer("TEAM123"))
+	if err != nil || token.Header["kid"] != "KEY123" {
+		http.Error(w, `{"reason":"InvalidProviderToken"}`, http.StatusForbidden)
+		return
+	}
+	if r.Header.Get("apns-topic") != "com.example.easyflow" || r.Header.Get("apns-push-type") != "alert" {
+		http.Error(w, `{"reason":"MissingTopic"}`, http.StatusBadRequest)
+		return
+	}
+
+	device := r.PathValue("token")
+	if f.isGone(device) {
+		http.Error(w, `{"reason":"Unregistered"}`, http.StatusGone)
+		return
+	}
+
+	var notification notify.Notification
+	if err := json.NewDecoder(r.Body).Decode(&notification); err != nil {
+		http.Error(w, `{"reason":"PayloadEmpty"}`, http.StatusBadRequest)
+		return
+	}
+	f.record(database.PushAPNs, device, notification)
+}
+
+func newPushHarness(t *testing.T, fake *fakePush) *harness {
+	return buildHarness(t, false, fake.configure)
+}
+
+// pushPool returns a pool that runs the push jobs against the fake
+func (h *harness) pushPool(fake *fakePush) *jobs.Pool {
+	h.t.Helper()
+
+	transports, err := notify.NewWithClient(h.cfg, fake.server.Client())
+	if err != nil {
+		h.t.Fatalf("could not set up push transports: %s", err)
+	}
+	pool := jobs.NewPool(h.repos, h.cfg)
+	notify.NewNotifier(h.repos, h.cfg, transports).Register(pool)
+	return pool
+}
+
+// goOffline moves the last request of the user out of PUSH_ONLINE_WINDOW
+func (h *harness) goOffline(c *client) {
+	h.t.Helper()
+
+	if err := h.repos.Users.MarkSeen(context.Background(), c.user.Id, time.Now().Add(-time.Hour)); err != nil {
+		h.t.Fatalf("could not mark user offline: %s", err)
+	}
+}
+
+// registerDevice registers the device and returns its id
+func (c *client) registerDevice(request user.RegisterDeviceRequest) string {
+	c.h.t.Helper()
+
+	var device user.DeviceResponse
+	c.do(http.MethodPost, "/user/devices", request).expect(http.StatusCreated).decode(&device)
+	return device.Id
+}
+
+func (c *client) listDevices() []user.DeviceResponse {
+	c.h.t.Helper()
+
+	var devices []user.DeviceResponse
+	c.do(http.MethodGet, "/user/devices", nil).expect(http.StatusOK).decode(&devices)
+	return devices
+}
+
+func TestPushNotifications(t *testing.T) {
+	fake := newFakePush(t)
+	h := newPushHarness(t, fake)
+	pool := h.pushPool(fake)
+	alice, bob, carol, dave, erin := h.newUser("alice"), h.newUser("bob"), h.newUser("carol"), h.newUser("dave"), h.newUser("erin")
+	talk := alice.createChat("talk", bob, carol, dave, erin)
+
+	subscription := fake.subscribe("bob")
+	bob.registerDevice(user.RegisterDeviceRequest{Platform: database.PushWeb, Subscription: &subscription})
+	carol.registerDevice(user.RegisterDeviceRequest{Platform: database.PushFCM, Token: "carol-phone"})
+	dave.registerDevice(user.RegisterDeviceRequest{Platform: database.PushAPNs, Token: "dave-phone"})
+	erin.registerDevice(user.RegisterDeviceRequest{Platform: database.PushAPNs, Token: "erin-phone"})
+	alice.registerDevice(user.RegisterDeviceRequest{Platform: database.PushAPNs, Token: "alice-phone"})
+
+	var mute chat.ChatMuteResponse
+	dave.do(http.MethodPut, "/chat/"+talk.Id+"/mute", nil).expect(http.StatusOK).decode(&mute)
+	if !mute.Muted || mute.MuteUntil != nil {
+		t.Fatalf("chat is not muted: %+v", mute)
+	}
+
+	// erin keeps using the app, the sender is never notified
+	for _, member := range []*client{alice, bob, carol, dave} {
+		h.goOffline(member)
+	}
+	alice.sendMessageWith(talk.Id).expect(http.StatusCreated)
+	drainJobs(t, pool)
+
+	received := map[string]pushed{}
+	for _, push := range fake.take() {
+		received[push.token] = push
+	}
+	if len(received) != 2 {
+		t.Fatalf("expected notifications to bob and carol, got %+v", received)
+	}
+	for token, platform := range map[string]database.PushPlatform{"bob": database.PushWeb, "carol-phone": database.PushFCM} {
+		push := received[token]
+		if push.platform != platform || push.notification != (notify.Notification{Type: notify.TypeMessage, ChatId: talk.Id}) {
+			t.Fatalf("unexpected notification to %s: %+v", token, push)
+		}
+	}
+
+	// gone devices are removed, dave gets notifications again once the chat is unmuted
+	fake.expire("bob")
+	fake.expire("carol-phone")
+	dave.do(http.MethodDelete, "/chat/"+talk.Id+"/mute", nil).expect(http.StatusOK).decode(&mute)
+	if mute.Muted {
+		t.Fatalf("chat is still muted: %+v", mute)
+	}
+	h.goOffline(dave)
+	alice.sendMessageWith(talk.Id).expect(http.StatusCreated)
+	drainJobs(t, pool)
+
+	received = map[string]pushed{}
+	for _, push := range fake.take() {
+		received[push.token] = push
+	}
+	if _, ok := received["dave-phone"]; len(received) != 1 || !ok {
+		t.Fatalf("expected a notification to dave, got %+v", received)
+	}
+	if devices := bob.listDevices(); len(devices) != 0 {
+		t.Fatalf("gone subscription was kept: %+v", devices)
+	}
+	if devices := carol.listDevices(); len(devices) != 0 {
+		t.Fatalf("gone token was kept: %+v", devices)
+	}
+	if dead := h.listJobs(database.JobDead); len(dead) != 0 {
+		t.Fatalf("deliveries failed: %+v", dead)
+	}
+}
+
+func TestChatMute(t *testing.T) {
+	h := newHarness(t)
+	alice, bob, mallory := h.newUser("alice"), h.newUser("bob"), h.newUser("mallory")
+	talk := alice.createChat("talk", bob)
+
+	until := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	var mute chat.ChatMuteResponse
+	bob.do(http.MethodPut, "/chat/"+talk.Id+"/mute", chat.MuteChatRequest{Until: &until}).expect(http.StatusOK).decode(&mute)
+	if !mute.Muted || mute.MuteUntil == nil || !mute.MuteUntil.Equal(until) {
+		t.Fatalf("chat is not muted until %s: %+v", until, mute)
+	}
+
+	var fetched chat.GetChatByIdResponse
+	bob.do(http.MethodGet, "/chat/"+talk.Id, nil).expect(http.StatusOK).decode(&fetched)
+	if !fetched.Muted || fetched.MuteUntil == nil || !fetched.MuteUntil.Equal(until) {
+		t.Fatalf("chat is not shown as muted: %+v", fetched.ChatMuteResponse)
+	}
+
+	// the mute belongs to the member
+	var previews []chat.GetChatPreviewResponse
+	alice.do(http.MethodGet, "/chat/preview", nil).expect(http.StatusOK).decode(&previews)
+	if len(previews) != 1 || previews[0].Muted {
+		t.Fatalf("chat is muted for alice: %+v", previews)
+	}
+
+	// a mute that ran out is not reported
+	member, err := h.repos.Chats.GetMember(context.Background(), talk.Id, bob.user.Id)
+	if err != nil {
+		t.Fatalf("could not get member: %s", err)
+	}
+	past := time.Now().Add(-time.Minute)
+	if err := h.repos.Chats.SetMute(context.Background(), member.Id, member.Muted, &past); err != nil {
+		t.Fatalf("could not update member: %s", err)
+	}
+	bob.do(http.MethodGet, "/chat/preview", nil).expect(http.StatusOK).decode(&previews)
+	if len(previews) != 1 || previews[0].Muted || previews[0].MuteUntil != nil {
+		t.Fatalf("expired mute is reported: %+v", previews)
+	}
+
+	bob.do(http.MethodPut, "/chat/"+talk.Id+"/mute", chat.MuteChatRequest{Until: &past}).expectError(http.StatusBadRequest, enum.MalformedRequest)
+	mallory.do(http.MethodPut, "/chat/"+talk.Id+"/mute", nil).expectError(http.StatusForbidden, enum.NotAllowed)
+	mallory.do(http.MethodDelete, "/chat/"+talk.Id+"/mute", nil).expectError(http.StatusForbidden, enum.NotAllowed)
+}
+
+func TestPushDevices(t *testing.T) {
+	fake := newFakePush(t)
+	h := newPushHarness(t, fake)
+	alice, bob := h.newUser("alice"), h.newUser("bob")
+
+	var key user.VapidPublicKeyResponse
+	alice.do(http.MethodGet, "/user/devices/vapid-public-key", nil).expect(http.StatusOK).decode(&key)
+	if expected, _ := notify.VapidPublicKey(h.cfg.PushVapidPrivateKey); key.PublicKey != expected {
+		t.Fatalf("unexpected public key %q, expected %q", key.PublicKey, expected)
+	}
+
+	subscription := fake.subscribe("alice")
+	broken := subscription
+	broken.Keys.P256dh = base64.RawURLEncoding.EncodeToString(make([]byte, 65))
+	alice.do(http.MethodPost, "/user/devices", user.RegisterDeviceRequest{Platform: database.PushWeb, Subscription: &broken}).expectError(http.StatusBadRequest, enum.MalformedRequest)
+	broken = subscription
+	broken.Keys.Auth = "c2hvcnQ"
+	alice.do(http.MethodPost, "/user/devices", user.RegisterDeviceRequest{Platform: database.PushWeb, Subscription: &broken}).expectError(http.StatusBadRequest, enum.MalformedRequest)
+	alice.do(http.MethodPost, "/user/devices", user.RegisterDeviceRequest{Platform: database.PushWeb, Token: "token"}).expectError(http.StatusBadRequest, enum.MalformedRequest)
+
+	// the server posts to the endpoint, the accepted urls are covered by the tests of ValidateEndpoint
+	for _, endpoint := range []string{
+		strings.Replace(subscription.Endpoint, "https://", "http://", 1),
+		"https://169.254.169.254/latest/meta-data",
+	} {
+		broken = subscription
+		broken.Endpoint = endpoint
+		alice.do(http.MethodPost, "/user/devices", user.RegisterDeviceRequest{Platform: database.PushWeb, Subscription: &broken}).expectError(http.StatusBadRequest, enum.MalformedRequest)
+	}
+	alice.do(http.MethodPost, "/user/devices", user.RegisterDeviceRequest{Platform: database.PushFCM}).expectError(http.StatusBadRequest, enum.MalformedRequest)
+
+	webId := alice.registerDevice(user.RegisterDeviceRequest{Platform: database.PushWeb, Subscription: &subscription})
+	phoneId := alice.registerDevice(user.RegisterDeviceRequest{Platform: database.PushFCM, Token: "shared-phone"})
+	if again := alice.registerDevice(user.RegisterDeviceRequest{Platform: database.PushWeb, Subscription: &subscription}); again != webId {
+		t.Fatalf("subscription was registered twice: %s and %s", webId, again)
+	}
+
+	// a token that is registered again moves to the user that is signed in on the device now
+	if moved := bob.registerDevice(user.RegisterDeviceRequest{Platform: database.PushFCM, Token: "shared-phone"}); moved != phoneId {
+		t.Fatalf("token was not moved: %s and %s", phoneId, moved)
+	}
+	if devices := alice.listDevices(); len(devices) != 1 || devices[0].Id != webId || devices[0].Platform != database.PushWeb {
+		t.Fatalf("unexpected devices of alice: %+v", devices)
+	}
+
+	alice.do(http.MethodDelete, "/user/devices/"+phoneId, nil).expectError(http.StatusNotFound, enum.NotFound)
+	bob.do(http.MethodDelete, "/user/devices/"+phoneId, nil).expect(http.StatusNoContent)
+	if devices := bob.listDevices(); len(devices) != 0 {
+		t.Fatalf("device was not deleted: %+v", devices)
+	}
+
+	// devices of deleted accounts are removed with them
+	alice.do(http.MethodDelete, "/user/", nil).expect(http.StatusOK)
+	if _, err := h.repos.Devices.GetById(context.Background(), webId); err == nil {
+		t.Fatalf("device of the deleted user was kept")
+	}
+}
+
+func TestPushNotConfigured(t *testing.T) {
+	h := newHarness(t)
+	alice, _, talk := h.newTalk()
+
+	alice.do(http.MethodGet, "/user/devices/vapid-public-key", nil).expectError(http.StatusBadRequest, enum.PushNotConfigured)
+	alice.do(http.MethodPost, "/user/devices", user.RegisterDeviceRequest{Platform: database.PushAPNs, Token: "phone"}).expectError(http.StatusBadRequest, enum.PushNotConfigured)
+
+	// messages do not queue notifications nobody delivers
+	alice.sendMessageWith(talk.Id).expect(http.StatusCreated)
+	if queued := h.listJobs(database.JobQueued); len(queued) != 0 {
+		t.Fatalf("notification was queued: %+v", queued)
+	}
+}
+
+func TestValidatePushConfig(t *testing.T) {
+	h := newHarness(t)
+
+	cfg := *h.cfg
+	cfg.PushVapidPrivateKey = "not-a-key"
+	cfg.PushVapidSubject = "ops@example.com"
+	cfg.PushApnsKeyFile = "AuthKey.p8"
+	cfg.PushFcmURL = "fcm.googleapis.com"
+	cfg.PushOnlineWindow = 0
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+	for _, expected := range []string{"PUSH_VAPID_PRIVATE_KEY", "PUSH_VAPID_SUBJECT", "PUSH_APNS_TEAM_ID", "PUSH_FCM_URL", "PUSH_ONLINE_WINDOW"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Fatalf("error does not mention %s: %s", expected, err)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package e2e
+
+import (
+	"context"
+	"easyflow-backend/src/common"
+	"easyflow-backend/src/middleware"
+	"easyflow-backend/src/router"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const testFeature = "beta"
+
+// useConfigFile writes the harness config to a file and rebuilds the router with a runtime config that reloads from it
+func (h *harness) useConfigFile() string {
+	h.t.Helper()
+
+	path := filepath.Join(h.t.TempDir(), "config.yaml")
+	h.writeConfigFile(path, func(*common.Config) {})
+
+	h.runtime = common.NewRuntimeConfig(h.cfg, path)
+	r, err := router.New(h.runtime, h.repos, h.checker, h.scans, h.recorder, h.store, common.NewLogger(io.Discard, "Test", nil, h.cfg.LogLevel))
+	if err != nil {
+		h.t.Fatalf("could not build router: %s", err)
+	}
+	r.GET("/feature", middleware.RequireFeature(testFeature), func(c *gin.Context) { c.Status(http.StatusOK) })
+	h.router = r
+
+	return path
+}
+
+// writeConfigFile writes the harness config changed by modify to path, secrets are written redacted
+func (h *harness) writeConfigFile(path string, modify func(cfg *common.Config)) {
+	h.t.Helper()
+
+	cfg := *h.cfg
+	modify(&cfg)
+
+	file, err := os.Create(path)
+	if err != nil {
+		h.t.Fatalf("could not create config file: %s", err)
+	}
+	defer file.Close()
+
+	if err := cfg.Print(file); err != nil {
+		h.t.Fatalf("could not write config file: %s", err)
+	}
+}
+
+func (h *harness) requestFromOrigin(origin string, path string) int {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("Origin", origin)
+	rec := httptest.NewRecorder()
+	h.router.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+var rateLimitThrottled = regexp.MustCompile(`easyflow_rate_limit_throttled_total\{route="/user/exists/:email"\} (\d+)`)
+
+func (h *harness) rateLimitThrottled() int {
+	h.t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer "+testMetricsToken)
+	rec := httptest.NewRecorder()
+	h.router.ServeHTTP(rec, req)
+
+	match := rateLimitThrottled.FindStringSubmatch(rec.Body.String())
+	if match == nil {
+		return 0
+	}
+	count, _ := strconv.Atoi(match[1])
+	return count
+}
+
+func TestReloadConfig(t *testing.T) {
+	h := newHarness(t)
+	path := h.useConfigFile()
+	initial := h.runtime.Load()
+
+	const newOrigin = "https://app.example.com"
+	if status := h.requestFromOrigin(newOrigin, "/user/exists/nobody@example.com"); status != http.StatusForbidden {
+		t.Fatalf("unknown origin was not rejected: %d", status)
+	}
+	h.newClient().do(http.MethodGet, "/feature", nil).expect(http.StatusNotFound)
+
+	h.writeConfigFile(path, func(cfg *common.Config) {
+		cfg.LogLevel = common.INFO
+		cfg.FrontendURL = testOrigin + ", " + newOrigin
+		cfg.FeatureFlags = []string{testFeature}
+		cfg.RateLimitEnabled = true
+		cfg.RateLimitUserRate = 2
+		cfg.RateLimitUserBurst = 1
+		cfg.ShutdownTimeout = time.Minute
+	})
+
+	changes, err := h.runtime.Reload()
+	if err != nil {
+		t.Fatalf("could not reload config: %s", err)
+	}
+
+	for _, expected := range []string{
+		"LOG_LEVEL: ERROR -> INFO",
+		"FRONTEND_URL: " + testOrigin + " -> " + testOrigin + ", " + newOrigin,
+		"FEATURE_FLAGS: [] -> [" + testFeature + "]",
+		"RATE_LIMIT_USER_RATE: 1 -> 2",
+		"RATE_LIMIT_USER_BURST: 4 -> 1",
+	} {
+		if !slices.Contains(changes.Applied, expected) {
+			t.Fatalf("changes do not contain %q: %v", expected, changes.Applied)
+		}
+	}
+	if !slices.Contains(changes.Ignored, "SHUTDOWN_TIMEOUT") {
+		t.Fatalf("SHUTDOWN_TIMEOUT was not reported as ignored: %v", changes.Ignored)
+	}
+
+	cfg := h.runtime.Load()
+	if cfg.LogLevel != common.INFO || cfg.ShutdownTimeout != initial.ShutdownTimeout || cfg.JwtSecret != initial.JwtSecret {
+		t.Fatalf("only the reloadable settings must change: %+v", cfg)
+	}
+	if initial.LogLevel != common.ERROR {
+		t.Fatalf("the previous snapshot was modified")
+	}
+
+	if status := h.requestFromOrigin(newOrigin, "/user/exists/nobody@example.com"); status != http.StatusOK {
+		t.Fatalf("reloaded origin was rejected: %d", status)
+	}
+	h.newClient().do(http.MethodGet, "/feature", nil).expect(http.StatusOK)
+
+	c := h.newClient()
+	throttled := h.rateLimitThrottled()
+	c.do(http.MethodGet, "/user/exists/nobody@example.com", nil).expect(http.StatusOK)
+	c.do(http.MethodGet, "/user/exists/nobody@example.com", nil).expect(http.StatusOK)
+	if h.rateLimitThrottled() != throttled+1 {
+		t.Fatalf("the reloaded rate limit was not applied")
+	}
+}
+
+func TestReloadInvalidConfig(t *testing.T) {
+	h := newHarness(t)
+	path := h.useConfigFile()
+	initial := h.runtime.Load()
+
+	h.writeConfigFile(path, func(cfg *common.Config) {
+		cfg.LogLevel = "LOUD"
+		cfg.FrontendURL = "*"
+	})
+
+	if _, err := h.runtime.Reload(); err == nil {
+		t.Fatalf("expected an error")
+	}
+	if h.runtime.Load() != initial {
+		t.Fatalf("the config was swapped although it is invalid")
+	}
+	h.newClient().do(http.MethodGet, "/user/exists/nobody@example.com", nil).expect(http.StatusOK)
+}
+
+func TestWatchConfigFile(t *testing.T) {
+	h := newHarness(t)
+	h.cfg.ConfigWatchInterval = 10 * time.Millisecond
+	path := h.useConfigFile()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.runtime.Watch(ctx, common.NewLogger(io.Discard, "Test", nil, h.cfg.LogLevel))
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	h.writeConfigFile(path, func(cfg *common.Config) { cfg.FeatureFlags = []string{testFeature} })
+	// the modification time is moved forward in case the file system has a coarse resolution
+	modified := time.Now().Add(time.Second)
+	if err := os.Chtimes(path, modified, modified); err != nil {
+		t.Fatalf("could not touch config file: %s", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !h.runtime.Load().FeatureEnabled(testFeature) {
+		if time.Now().After(deadline) {
+			t.Fatalf("the changed config file was not reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	h.newClient().do(http.MethodGet, "/feature", nil).expect(http.StatusOK)
+}
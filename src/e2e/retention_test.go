@@ -0,0 +1,203 @@
+package e2e
+
+import (
+	"context"
+	"easyflow-backend/src/api/chat"
+	"easyflow-backend/src/api/utils"
+	"easyflow-backend/src/database"
+	"easyflow-backend/src/retention"
+	"easyflow-backend/src/storage"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// unscopedCount counts the rows of a model including the soft deleted ones
+func (h *harness) unscopedCount(model any, query string, args ...any) int64 {
+	h.t.Helper()
+
+	var count int64
+	if err := h.db.GetClient().Unscoped().Model(model).Where(query, args...).Count(&count).Error; err != nil {
+		h.t.Fatalf("could not count rows: %s", err)
+	}
+
+	return count
+}
+
+// objectExists reports whether the object is still in the store
+func (h *harness) objectExists(bucketName string, key string) bool {
+	h.t.Helper()
+
+	_, err := h.store.Head(context.Background(), bucketName, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return false
+	}
+	if err != nil {
+		h.t.Fatalf("could not head object %s: %s", key, err)
+	}
+	return true
+}
+
+// sendAttachment uploads the content and sends it in the chat, it returns the key of the stored object
+func (c *client) sendAttachment(chatId string, content []byte) string {
+	c.h.t.Helper()
+
+	created := c.createAttachment(chatId, content)
+	c.h.upload(created.UploadURL, created.UploadHeaders, content)
+	c.sendMessageWith(chatId, created.Id).expect(http.StatusCreated)
+
+	attachment, err := c.h.repos.Attachments.GetById(context.Background(), chatId, created.Id)
+	if err != nil {
+		c.h.t.Fatalf("could not get attachment: %s", err)
+	}
+	return attachment.ObjectKey
+}
+
+func (h *harness) runRetention() retention.Result {
+	h.t.Helper()
+
+	result, err := retention.NewWorker(h.repos, h.cfg, h.store).RunOnce(context.Background())
+	if err != nil {
+		h.t.Fatalf("retention run failed: %s", err)
+	}
+
+	return result
+}
+
+func TestRetentionPurgesDeletedUsers(t *testing.T) {
+	for _, purgeMessages := range []bool{false, true} {
+		name := "keeps messages"
+		if purgeMessages {
+			name = "purges messages"
+		}
+
+		t.Run(name, func(t *testing.T) {
+			h := newHarness(t)
+			h.cfg.RetentionPurgeMessages = purgeMessages
+
+			alice, bob, talk := h.newTalk()
+			message := alice.sendMessage(talk.Id, "hello")
+			alice.uploadProfilePicture("image/png", pngOf(t, testPicture(64, 64))).expect(http.StatusOK)
+			attachmentKey := alice.sendAttachment(talk.Id, []byte("file"))
+			alice.do(http.MethodDelete, "/user/", nil).expect(http.StatusOK)
+
+			// still within the grace period
+			if result := h.runRetention(); result.Users != 0 {
+				t.Fatalf("user was purged before the grace period ended: %+v", result)
+			}
+			if h.unscopedCount(&database.User{}, "id = ?", alice.user.Id) != 1 {
+				t.Fatalf("soft deleted user is missing")
+			}
+
+			h.cfg.RetentionGracePeriod = -time.Minute
+			if result := h.runRetention(); result.Users != 1 {
+				t.Fatalf("expected one purged user, got %+v", result)
+			}
+
+			if h.unscopedCount(&database.User{}, "id = ?", alice.user.Id) != 0 {
+				t.Fatalf("user was not purged")
+			}
+			if h.unscopedCount(&database.ChatUserKeys{}, "user_id = ?", alice.user.Id) != 0 {
+				t.Fatalf("memberships were not purged")
+			}
+			if h.unscopedCount(&database.UserKeys{}, "user_id = ?", alice.user.Id) != 0 {
+				t.Fatalf("sessions were not purged")
+			}
+			for _, key := range utils.PictureKeys(alice.user.Id) {
+				if h.objectExists(testBucket, key) {
+					t.Fatalf("profile picture %s was not deleted", key)
+				}
+			}
+			if h.objectExists(testAttachments, attachmentKey) == purgeMessages {
+				t.Fatalf("attachment object does not follow its message, purge messages: %t", purgeMessages)
+			}
+
+			var fetched chat.GetChatByIdResponse
+			bob.do(http.MethodGet, "/chat/"+talk.Id, nil).expect(http.StatusOK).decode(&fetched)
+			if purgeMessages {
+				if len(fetched.Messages) != 0 {
+					t.Fatalf("messages of the purged user were kept: %+v", fetched.Messages)
+				}
+				return
+			}
+			if len(fetched.Messages) != 2 || fetched.Messages[1].Id != message.Id || fetched.Messages[1].SenderId != nil {
+				t.Fatalf("expected the message without a sender, got %+v", fetched.Messages)
+			}
+
+			// the email is free again once the account is purged
+			expectBody("false")(t, h, bob, h.newClient().do(http.MethodGet, "/user/exists/"+alice.user.Email, nil))
+		})
+	}
+}
+
+func TestRetentionSignupWithDeletedEmail(t *testing.T) {
+	h := newHarness(t)
+	alice := h.newUser("alice")
+	alice.do(http.MethodDelete, "/user/", nil).expect(http.StatusOK)
+
+	h.newClient().do(http.MethodPost, "/user/signup", signupBody(alice.user.Email, "alice")).expect(http.StatusConflict)
+}
+
+func TestChatMessageRetention(t *testing.T) {
+	h := newHarness(t)
+
+	alice := h.newUser("alice")
+	days := 7
+
+	var created chat.CreateChatResponse
+	alice.do(http.MethodPost, "/chat", chat.CreateChatRequest{
+		Name:                 "ephemeral",
+		UserKeys:             []chat.UserKeyEntry{{UserID: alice.user.Id, Key: "key-alice"}},
+		MessageRetentionDays: &days,
+	}).expect(http.StatusCreated).decode(&created)
+	if created.MessageRetentionDays == nil || *created.MessageRetentionDays != days {
+		t.Fatalf("retention was not stored: %+v", created)
+	}
+
+	forever := alice.createChat("forever")
+
+	old := time.Now().AddDate(0, 0, -days-1)
+	for _, chatId := range []string{created.Id, forever.Id} {
+		if err := h.repos.Messages.Create(context.Background(), &database.Message{
+			ChatId:    chatId,
+			SenderId:  &alice.user.Id,
+			Content:   "old",
+			Iv:        "iv",
+			CreatedAt: old,
+		}); err != nil {
+			t.Fatalf("could not create message: %s", err)
+		}
+	}
+	alice.sendMessage(created.Id, "new")
+
+	// an attachment of an expired message
+	attachmentKey := alice.sendAttachment(created.Id, []byte("file"))
+	if err := h.db.GetClient().Model(&database.Message{}).Where("chat_id = ? AND content = ?", created.Id, "encrypted").UpdateColumn("created_at", old).Error; err != nil {
+		t.Fatalf("could not age message: %s", err)
+	}
+
+	if result := h.runRetention(); result.ExpiredMessages != 2 {
+		t.Fatalf("expected two expired messages, got %+v", result)
+	}
+	if h.objectExists(testAttachments, attachmentKey) {
+		t.Fatalf("attachment of an expired message was not deleted")
+	}
+
+	var fetched chat.GetChatByIdResponse
+	alice.do(http.MethodGet, "/chat/"+created.Id, nil).expect(http.StatusOK).decode(&fetched)
+	if len(fetched.Messages) != 1 || fetched.Messages[0].Content != "new" {
+		t.Fatalf("unexpected messages after retention: %+v", fetched.Messages)
+	}
+
+	alice.do(http.MethodGet, "/chat/"+forever.Id, nil).expect(http.StatusOK).decode(&fetched)
+	if len(fetched.Messages) != 1 {
+		t.Fatalf("messages of a chat without retention were deleted: %+v", fetched.Messages)
+	}
+
+	alice.do(http.MethodPost, "/chat", map[string]any{
+		"name":                 "invalid",
+		"userKeys":             []chat.UserKeyEntry{{UserID: alice.user.Id, Key: "key-alice"}},
+		"messageRetentionDays": 0,
+	}).expect(http.StatusInternalServerError)
+}
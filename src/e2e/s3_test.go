@@ -0,0 +1,167 @@
+package e2e
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeS3 is an in-process stand-in for the bucket api, it only understands path style
+// requests and implements the calls the backend makes: Put/Get/Head object, HeadBucket and ListObjectsV2.
+// Presigned urls are signed locally by the sdk and can be used against it directly.
+type fakeS3 struct {
+	server *httptest.Server
+
+	mu      sync.Mutex
+	objects map[string]fakeObject
+}
+
+type fakeObject struct {
+	body        []byte
+	contentType string
+}
+
+type listBucketResult struct {
+	XMLName  xml.Name       `xml:"ListBucketResult"`
+	Name     string         `xml:"Name"`
+	Prefix   string         `xml:"Prefix"`
+	KeyCount int            `xml:"KeyCount"`
+	Contents []listedObject `xml:"Contents"`
+}
+
+type listedObject struct {
+	Key  string `xml:"Key"`
+	Size int    `xml:"Size"`
+}
+
+func newFakeS3(t *testing.T) *fakeS3 {
+	t.Helper()
+
+	f := &fakeS3{objects: make(map[string]fakeObject)}
+	f.server = httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+	t.Cleanup(f.server.Close)
+
+	return f
+}
+
+func (f *fakeS3) URL() string {
+	return f.server.URL
+}
+
+// Put stores an object as if it was uploaded through a presigned url
+func (f *fakeS3) Put(bucket string, key string, body []byte, contentType string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.objects[bucket+"/"+key] = fakeObject{body: body, contentType: contentType}
+}
+
+// Get returns an object and whether it exists
+func (f *fakeS3) Get(bucket string, key string) ([]byte, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	object, ok := f.objects[bucket+"/"+key]
+	return object.body, ok
+}
+
+// Keys returns the sorted keys of the objects in the bucket that start with the prefix
+func (f *fakeS3) Keys(bucket string, prefix string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.keys(bucket, prefix)
+}
+
+func (f *fakeS3) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if key == "" {
+		switch r.Method {
+		case http.MethodHead:
+			w.WriteHeader(http.StatusOK)
+		case http.MethodGet:
+			f.list(w, bucket, r.URL.Query().Get("prefix"))
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		// like the real api a presigned checksum has to match the uploaded body
+		checksum := r.Header.Get("X-Amz-Checksum-Sha256")
+		if checksum == "" {
+			checksum = r.URL.Query().Get("X-Amz-Checksum-Sha256")
+		}
+		if sum := sha256.Sum256(body); checksum != "" && checksum != base64.StdEncoding.EncodeToString(sum[:]) {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte("<Error><Code>BadDigest</Code><Message>The SHA256 you specified did not match the calculated checksum.</Message></Error>"))
+			return
+		}
+		f.objects[bucket+"/"+key] = fakeObject{body: body, contentType: r.Header.Get("Content-Type")}
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet, http.MethodHead:
+		object, ok := f.objects[bucket+"/"+key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			if r.Method == http.MethodGet {
+				_, _ = w.Write([]byte("<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>"))
+			}
+			return
+		}
+		w.Header().Set("Content-Type", object.contentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(object.body)))
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(object.body)
+		}
+	case http.MethodDelete:
+		delete(f.objects, bucket+"/"+key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, bucket string, prefix string) {
+	result := listBucketResult{Name: bucket, Prefix: prefix}
+
+	keys := f.keys(bucket, prefix)
+	for _, key := range keys {
+		result.Contents = append(result.Contents, listedObject{Key: key, Size: len(f.objects[bucket+"/"+key].body)})
+	}
+	result.KeyCount = len(keys)
+
+	w.Header().Set("Content-Type", "application/xml")
+	_ = xml.NewEncoder(w).Encode(result)
+}
+
+// keys is Keys for callers that hold the lock
+func (f *fakeS3) keys(bucket string, prefix string) []string {
+	keys := make([]string, 0, len(f.objects))
+	for path := range f.objects {
+		if key, ok := strings.CutPrefix(path, bucket+"/"); ok && strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
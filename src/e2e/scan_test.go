@@ -0,0 +1,372 @@
+package e2e
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"easyflow-backend/src/api/chat"
+	"easyflow-backend/src/api/user"
+	"easyflow-backend/src/common"
+	"easyflow-backend/src/database"
+	"easyflow-backend/src/enum"
+	"easyflow-backend/src/scanning"
+	"encoding/binary"
+	"image/jpeg"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// eicar is the signature the fake clamd reports, real clamd reports the EICAR test file the same way
+const eicar = "EICAR-STANDARD-ANTIVIRUS-TEST-FILE"
+
+/*
+fakeClamd speaks the INSTREAM part of the clamd protocol. Content is infected if infected returns true,
+by default if it contains the EICAR marker. Replies are held back until release is called if hold is set.
+*/
+type fakeClamd struct {
+	addr     string
+	infected func(body []byte) bool
+	hold     chan struct{}
+
+	mu       sync.Mutex
+	scans    int
+	maxChunk int
+	failures int
+}
+
+func newFakeClamd(t *testing.T) *fakeClamd {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not start fake clamd: %s", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	fake := &fakeClamd{addr: listener.Addr().String()}
+	fake.flag(func(body []byte) bool { return bytes.Contains(body, []byte(eicar)) })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go fake.serve(conn)
+		}
+	}()
+	return fake
+}
+
+// flag changes what the fake reports as infected
+func (f *fakeClamd) flag(infected func(body []byte) bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.infected = infected
+}
+
+// holdReplies makes every scan wait until release is called
+func (f *fakeClamd) holdReplies() {
+	f.hold = make(chan struct{})
+}
+
+func (f *fakeClamd) release() {
+	close(f.hold)
+}
+
+// fail makes the next n scans reply with an error instead of a verdict
+func (f *fakeClamd) fail(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures = n
+}
+
+func (f *fakeClamd) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	command, err := reader.ReadString(0)
+	if err != nil || command != "zINSTREAM\x00" {
+		conn.Write([]byte("UNKNOWN COMMAND\x00"))
+		return
+	}
+
+	var body []byte
+	size := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(reader, size); err != nil {
+			return
+		}
+		length := int(binary.BigEndian.Uint32(size))
+		if length == 0 {
+			break
+		}
+		chunk := make([]byte, length)
+		if _, err := io.ReadFull(reader, chunk); err != nil {
+			return
+		}
+		body = append(body, chunk...)
+
+		f.mu.Lock()
+		f.maxChunk = max(f.maxChunk, length)
+		f.mu.Unlock()
+	}
+
+	if f.hold != nil {
+		<-f.hold
+	}
+
+	f.mu.Lock()
+	f.scans++
+	infected := f.infected(body)
+	failed := f.failures > 0
+	if failed {
+		f.failures--
+	}
+	f.mu.Unlock()
+
+	if failed {
+		conn.Write([]byte("stream: INSTREAM size limit exceeded. ERROR\x00"))
+		return
+	}
+
+	if infected {
+		conn.Write([]byte("stream: Eicar-Test-Signature FOUND\x00"))
+		return
+	}
+	conn.Write([]byte("stream: OK\x00"))
+}
+
+func newScanningHarness(t *testing.T, fake *fakeClamd) *harness {
+	return buildHarness(t, false, func(cfg *common.Config) {
+		cfg.ScannerDriver = common.ScannerDriverClamd
+		cfg.ScannerClamdAddress = fake.addr
+		cfg.ScannerTimeout = 5 * time.Second
+	})
+}
+
+// waitForScan runs the queued jobs and polls the path until it no longer reports the scan as pending, it returns the last response
+func (c *client) waitForScan(path string) *response {
+	c.h.t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		c.h.runJobs()
+		res := c.do(http.MethodGet, path, nil)
+		if res.rec.Code != http.StatusConflict {
+			return res
+		}
+		if time.Now().After(deadline) {
+			c.h.t.Fatalf("scan of %s did not finish", path)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAttachmentScan(t *testing.T) {
+	fake := newFakeClamd(t)
+	fake.holdReplies()
+	h := newScanningHarness(t, fake)
+	alice, bob, talk := h.newTalk()
+
+	clean := alice.createAttachment(talk.Id, []byte("encrypted picture"))
+	h.upload(clean.UploadURL, clean.UploadHeaders, []byte("encrypted picture"))
+	infected := alice.createAttachment(talk.Id, []byte(eicar))
+	h.upload(infected.UploadURL, infected.UploadHeaders, []byte(eicar))
+
+	var message chat.MessageEntry
+	alice.sendMessageWith(talk.Id, clean.Id, infected.Id).expect(http.StatusCreated).decode(&message)
+	for _, attachment := range message.Attachments {
+		if attachment.ScanStatus != database.ScanPending {
+			t.Fatalf("attachment is not pending: %+v", attachment)
+		}
+	}
+
+	// nothing is handed out while the scan runs
+	bob.do(http.MethodGet, "/chat/"+talk.Id+"/attachments/"+clean.Id, nil).expectError(http.StatusConflict, enum.ScanPending)
+	fake.release()
+
+	var attachment chat.GetAttachmentResponse
+	bob.waitForScan("/chat/" + talk.Id + "/attachments/" + clean.Id).expect(http.StatusOK).decode(&attachment)
+	if !bytes.Equal(download(t, attachment.DownloadURL), []byte("encrypted picture")) {
+		t.Fatalf("unexpected attachment content")
+	}
+	bob.waitForScan("/chat/"+talk.Id+"/attachments/"+infected.Id).expectError(http.StatusForbidden, enum.Quarantined)
+
+	var fetched chat.GetChatByIdResponse
+	bob.do(http.MethodGet, "/chat/"+talk.Id, nil).expect(http.StatusOK).decode(&fetched)
+	statuses := map[string]database.ScanStatus{}
+	for _, attachment := range fetched.Messages[0].Attachments {
+		statuses[attachment.Id] = attachment.ScanStatus
+	}
+	if statuses[clean.Id] != database.ScanClean || statuses[infected.Id] != database.ScanQuarantined {
+		t.Fatalf("unexpected scan statuses: %+v", statuses)
+	}
+}
+
+func TestProfilePictureScan(t *testing.T) {
+	fake := newFakeClamd(t)
+	h := newScanningHarness(t, fake)
+	alice, mallory := h.newUser("alice"), h.newUser("mallory")
+
+	var confirmed user.UserProfileResponse
+	alice.uploadProfilePicture("image/png", pngOf(t, testPicture(64, 64))).expect(http.StatusOK).decode(&confirmed)
+	if confirmed.ProfilePicture != nil || confirmed.ProfilePictureScan == nil || *confirmed.ProfilePictureScan != database.ScanPending {
+		t.Fatalf("picture is not pending: %+v", confirmed)
+	}
+
+	var pictureURL string
+	alice.waitForScan("/user/profile-picture").expect(http.StatusOK).decode(&pictureURL)
+	if len(download(t, pictureURL)) == 0 {
+		t.Fatalf("picture is empty")
+	}
+
+	// the original and every variant are scanned
+	fake.mu.Lock()
+	scans := fake.scans
+	fake.mu.Unlock()
+	if scans != 4 {
+		t.Fatalf("expected 4 scans, got %d", scans)
+	}
+
+	// a new picture is scanned while the previous one is still served, an infected one never replaces it and is deleted
+	fake.flag(func(body []byte) bool { return true })
+	var replacing user.UserProfileResponse
+	alice.uploadProfilePicture("image/png", pngOf(t, testPicture(128, 128))).expect(http.StatusOK).decode(&replacing)
+	if replacing.ProfilePicture == nil || *replacing.ProfilePicture != pictureURL || *replacing.ProfilePictureScan != database.ScanPending {
+		t.Fatalf("previous picture is not served while the new one is scanned: %+v", replacing)
+	}
+	h.runJobs()
+	var kept user.UserProfileResponse
+	alice.do(http.MethodGet, "/user/", nil).expect(http.StatusOK).decode(&kept)
+	if kept.ProfilePicture == nil || *kept.ProfilePicture != pictureURL || *kept.ProfilePictureScan != database.ScanQuarantined {
+		t.Fatalf("previous picture is not served after the new one was quarantined: %+v", kept)
+	}
+	if keys := h.s3.Keys(testBucket, alice.user.Id+"/"); len(keys) != 4 {
+		t.Fatalf("quarantined picture was not deleted: %v", keys)
+	}
+
+	mallory.uploadProfilePicture("image/png", pngOf(t, testPicture(64, 64))).expect(http.StatusOK)
+	mallory.waitForScan("/user/profile-picture").expectError(http.StatusForbidden, enum.Quarantined)
+
+	var profile user.UserProfileResponse
+	mallory.do(http.MethodGet, "/user/", nil).expect(http.StatusOK).decode(&profile)
+	if profile.ProfilePicture != nil || len(profile.ProfilePictureVariants) != 0 || *profile.ProfilePictureScan != database.ScanQuarantined {
+		t.Fatalf("quarantined picture is exposed: %+v", profile)
+	}
+}
+
+func TestReplacedPictureIsDeletedByItsScan(t *testing.T) {
+	fake := newFakeClamd(t)
+	h := newScanningHarness(t, fake)
+	alice := h.newUser("alice")
+
+	// the first picture is replaced before it was scanned, only the second one is published
+	alice.uploadProfilePicture("image/png", pngOf(t, testPicture(64, 64))).expect(http.StatusOK)
+	alice.uploadProfilePicture("image/png", pngOf(t, testPicture(128, 128))).expect(http.StatusOK)
+
+	var pictureURL string
+	alice.waitForScan("/user/profile-picture").expect(http.StatusOK).decode(&pictureURL)
+	config, err := jpeg.DecodeConfig(bytes.NewReader(download(t, pictureURL)))
+	if err != nil || config.Width != 128 {
+		t.Fatalf("replaced picture was published: %+v %v", config, err)
+	}
+
+	key := h.profilePictureKey(alice.user.Id)
+	if keys := h.s3.Keys(testBucket, alice.user.Id+"/"); len(keys) != 4 || !strings.HasPrefix(keys[0], key) {
+		t.Fatalf("replaced picture was not deleted: %v", keys)
+	}
+}
+
+func TestChatPictureScan(t *testing.T) {
+	fake := newFakeClamd(t)
+	fake.flag(func(body []byte) bool { return true })
+	h := newScanningHarness(t, fake)
+	alice, bob, talk := h.newTalk()
+
+	alice.uploadChatPicture(talk.Id, "image/png", pngOf(t, testPicture(64, 64))).expect(http.StatusOK)
+	bob.waitForScan("/chat/"+talk.Id+"/picture").expectError(http.StatusForbidden, enum.Quarantined)
+
+	var fetched chat.GetChatByIdResponse
+	bob.do(http.MethodGet, "/chat/"+talk.Id, nil).expect(http.StatusOK).decode(&fetched)
+	if fetched.Picture != nil || fetched.PictureScan == nil || *fetched.PictureScan != database.ScanQuarantined {
+		t.Fatalf("quarantined picture is exposed: %+v", fetched.CreateChatResponse)
+	}
+}
+
+func TestFailedScanIsRetried(t *testing.T) {
+	fake := newFakeClamd(t)
+	fake.fail(1)
+	h := newScanningHarness(t, fake)
+	alice, bob, talk := h.newTalk()
+
+	created := alice.createAttachment(talk.Id, []byte("file"))
+	h.upload(created.UploadURL, created.UploadHeaders, []byte("file"))
+	alice.sendMessageWith(talk.Id, created.Id).expect(http.StatusCreated)
+
+	// the failed attempt leaves the upload pending and queues the scan again
+	h.runJobs()
+	path := "/chat/" + talk.Id + "/attachments/" + created.Id
+	bob.do(http.MethodGet, path, nil).expectError(http.StatusConflict, enum.ScanPending)
+	queued := h.listJobs(database.JobQueued)
+	if len(queued) != 1 || queued[0].Type != scanning.ScanJob.Name || queued[0].Attempts != 1 {
+		t.Fatalf("expected the scan to be queued again: %+v", queued)
+	}
+
+	h.makeDue(queued[0].Id)
+	bob.waitForScan(path).expect(http.StatusOK)
+}
+
+func TestClamdStreamsInChunks(t *testing.T) {
+	fake := newFakeClamd(t)
+	clamd := scanning.NewClamd(fake.addr, 5*time.Second)
+
+	body := bytes.Repeat([]byte("a"), 200<<10)
+	found, err := clamd.Scan(context.Background(), append(body, eicar...))
+	if err != nil || found != "Eicar-Test-Signature" {
+		t.Fatalf("infected content was not found: %q, %v", found, err)
+	}
+	fake.mu.Lock()
+	maxChunk := fake.maxChunk
+	fake.mu.Unlock()
+	if maxChunk != 64<<10 {
+		t.Fatalf("unexpected chunk size %d", maxChunk)
+	}
+
+	if found, err := clamd.Scan(context.Background(), body); err != nil || found != "" {
+		t.Fatalf("clean content was flagged: %q, %v", found, err)
+	}
+
+	// an unreachable clamd is an error, not a verdict
+	unreachable := scanning.NewClamd("127.0.0.1:1", time.Second)
+	if _, err := unreachable.Scan(context.Background(), body); err == nil {
+		t.Fatalf("expected an error")
+	}
+}
+
+func TestValidateScannerConfig(t *testing.T) {
+	h := newHarness(t)
+
+	cfg := *h.cfg
+	cfg.ScannerDriver = "antivirus"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "SCANNER_DRIVER") {
+		t.Fatalf("unknown driver was accepted: %v", err)
+	}
+
+	cfg.ScannerDriver = common.ScannerDriverClamd
+	cfg.ScannerClamdAddress = "clamd"
+	cfg.ScannerTimeout = 0
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+	for _, expected := range []string{"SCANNER_CLAMD_ADDRESS", "SCANNER_TIMEOUT"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Fatalf("error does not mention %s: %s", expected, err)
+		}
+	}
+}
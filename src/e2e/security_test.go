@@ -0,0 +1,178 @@
+package e2e
+
+import (
+	"bufio"
+	"easyflow-backend/src/api/auth"
+	"easyflow-backend/src/api/user"
+	"easyflow-backend/src/database"
+	"easyflow-backend/src/enum"
+	"encoding/json"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func (c *client) securityEvents() []user.SecurityEventResponse {
+	c.h.t.Helper()
+
+	var events []user.SecurityEventResponse
+	c.do(http.MethodGet, "/user/security-events", nil).expect(http.StatusOK).decode(&events)
+	return events
+}
+
+// securityEventLog returns the events written to the json lines file sink
+func (h *harness) securityEventLog() []database.SecurityEvent {
+	h.t.Helper()
+
+	raw, err := os.ReadFile(h.cfg.SecurityEventLogFile)
+	if err != nil {
+		h.t.Fatalf("could not read security event log: %s", err)
+	}
+
+	var events []database.SecurityEvent
+	scanner := bufio.NewScanner(strings.NewReader(string(raw)))
+	for scanner.Scan() {
+		var event database.SecurityEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			h.t.Fatalf("invalid security event log line %q: %s", scanner.Text(), err)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+func eventKinds(events []user.SecurityEventResponse) []database.SecurityEventKind {
+	kinds := make([]database.SecurityEventKind, 0, len(events))
+	for _, event := range events {
+		kinds = append(kinds, event.Kind)
+	}
+	return kinds
+}
+
+func TestSecurityEventsOfSessions(t *testing.T) {
+	h := newHarness(t)
+	c := h.newClient()
+	alice := c.signup("alice")
+
+	c.do(http.MethodPost, "/auth/login", auth.LoginRequest{Email: alice.Email, Password: "wrong password"}).
+		expectError(http.StatusUnauthorized, enum.WrongCredentials)
+	c.login(alice)
+	c.do(http.MethodGet, "/auth/refresh", nil).expect(http.StatusOK)
+	c.do(http.MethodGet, "/auth/logout", nil).expect(http.StatusOK)
+	c.login(alice)
+
+	events := c.securityEvents()
+	expected := []database.SecurityEventKind{
+		database.EventLoginSucceeded,
+		database.EventLogout,
+		database.EventTokenRefreshed,
+		database.EventLoginSucceeded,
+		database.EventLoginFailed,
+	}
+	if kinds := eventKinds(events); !slices.Equal(kinds, expected) {
+		t.Fatalf("unexpected events, newest first: %v", kinds)
+	}
+
+	failed := events[len(events)-1]
+	if failed.Details["reason"] != "wrong_password" || failed.Ip != c.ip {
+		t.Fatalf("unexpected failed login event: %+v", failed)
+	}
+
+	c.do(http.MethodGet, "/user/security-events?limit=2&offset=1", nil).expect(http.StatusOK).decode(&events)
+	if len(events) != 2 || events[0].Kind != database.EventLogout {
+		t.Fatalf("unexpected page of events: %v", eventKinds(events))
+	}
+
+	// other users only see their own events
+	if events := h.newUser("bob").securityEvents(); len(events) != 1 || events[0].Kind != database.EventLoginSucceeded {
+		t.Fatalf("unexpected events of another user: %v", eventKinds(events))
+	}
+}
+
+func TestSecurityEventsOfUnknownAccount(t *testing.T) {
+	h := newHarness(t)
+	const email = "nobody@example.com"
+
+	h.newClient().do(http.MethodPost, "/auth/login", auth.LoginRequest{Email: email, Password: testPassword}).
+		expectError(http.StatusUnauthorized, enum.WrongCredentials)
+
+	logged := h.securityEventLog()
+	if len(logged) != 1 || logged[0].Kind != database.EventLoginFailed || logged[0].UserId != nil {
+		t.Fatalf("unexpected logged events: %+v", logged)
+	}
+	if h.unscopedCount(&database.SecurityEvent{}, "user_id IS NULL AND kind = ?", database.EventLoginFailed) != 1 {
+		t.Fatalf("failed login was not stored")
+	}
+
+	raw, err := os.ReadFile(h.cfg.SecurityEventLogFile)
+	if err != nil {
+		t.Fatalf("could not read security event log: %s", err)
+	}
+	if strings.Contains(string(raw), email) {
+		t.Fatalf("security event log contains the email: %s", raw)
+	}
+}
+
+func TestSecurityEventsOfChats(t *testing.T) {
+	h := newHarness(t)
+	alice, bob, talk := h.newTalk()
+
+	if events := alice.securityEvents(); events[0].Kind != database.EventChatCreated || events[0].Details["chatId"] != talk.Id {
+		t.Fatalf("chat creation was not recorded: %+v", events)
+	}
+
+	added := bob.securityEvents()[0]
+	if added.Kind != database.EventChatMemberAdded || added.Details["chatId"] != talk.Id || added.Details["addedBy"] != alice.user.Id {
+		t.Fatalf("membership was not recorded: %+v", added)
+	}
+}
+
+func TestSecurityEventsOfDeletedAccount(t *testing.T) {
+	h := newHarness(t)
+	alice := h.newUser("alice")
+	alice.do(http.MethodDelete, "/user/", nil).expect(http.StatusOK)
+
+	if h.unscopedCount(&database.SecurityEvent{}, "user_id = ? AND kind = ?", alice.user.Id, database.EventAccountDeleted) != 1 {
+		t.Fatalf("account deletion was not stored")
+	}
+
+	logged := h.securityEventLog()
+	last := logged[len(logged)-1]
+	if last.Kind != database.EventAccountDeleted || last.UserId == nil || *last.UserId != alice.user.Id {
+		t.Fatalf("account deletion was not logged: %+v", last)
+	}
+}
+
+func TestListSecurityEvents(t *testing.T) {
+	runEndpointCases(t, []endpointCase{
+		{
+			name:   "logged out",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				return h.newClient(), "/user/security-events", nil
+			},
+			status: http.StatusBadRequest,
+			code:   enum.InvalidCookie,
+		},
+		{
+			name:   "invalid limit",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				return h.newUser("alice"), "/user/security-events?limit=101", nil
+			},
+			status: http.StatusBadRequest,
+			code:   enum.MalformedRequest,
+		},
+		{
+			name:   "offset past the end",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				return h.newUser("alice"), "/user/security-events?offset=10", nil
+			},
+			status: http.StatusOK,
+			check:  expectBody("[]"),
+		},
+	})
+}
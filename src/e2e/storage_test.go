@@ -0,0 +1,245 @@
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"easyflow-backend/src/api/chat"
+	"easyflow-backend/src/api/user"
+	"easyflow-backend/src/storage"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// storageRequest sends a request to a signed url of the local store
+func (h *harness) storageRequest(method string, target string, contentType string, body []byte) *http.Response {
+	h.t.Helper()
+
+	req, err := http.NewRequest(method, target, bytes.NewReader(body))
+	if err != nil {
+		h.t.Fatalf("could not build request: %s", err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		h.t.Fatalf("could not send request: %s", err)
+	}
+	h.t.Cleanup(func() { _ = res.Body.Close() })
+	return res
+}
+
+func TestLocalStorageAttachmentRoundTrip(t *testing.T) {
+	h := newLocalHarness(t)
+	alice, bob, talk := h.newTalk()
+	content := []byte("encrypted picture")
+
+	created := alice.createAttachment(talk.Id, content)
+	if !strings.HasPrefix(created.UploadURL, h.cfg.StorageLocalURL+storage.LocalPathPrefix+testAttachments+"/chats/"+talk.Id+"/") {
+		t.Fatalf("upload url does not point to the app: %s", created.UploadURL)
+	}
+	if status := h.upload(created.UploadURL, created.UploadHeaders, content); status != http.StatusOK {
+		t.Fatalf("upload failed with status %d", status)
+	}
+	alice.sendMessageWith(talk.Id, created.Id).expect(http.StatusCreated)
+
+	var attachment chat.GetAttachmentResponse
+	bob.do(http.MethodGet, "/chat/"+talk.Id+"/attachments/"+created.Id, nil).expect(http.StatusOK).decode(&attachment)
+
+	res := h.storageRequest(http.MethodGet, attachment.DownloadURL, "", nil)
+	body, _ := io.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK || !bytes.Equal(body, content) || res.Header.Get("Content-Type") != "image/png" {
+		t.Fatalf("unexpected download %d %s: %q", res.StatusCode, res.Header.Get("Content-Type"), body)
+	}
+}
+
+func TestLocalStorageProfilePicture(t *testing.T) {
+	h := newLocalHarness(t)
+	alice := h.newUser("alice")
+
+	var confirmed user.UserProfileResponse
+	alice.uploadProfilePicture("image/png", pngOf(t, testPicture(128, 128))).expect(http.StatusOK).decode(&confirmed)
+	if confirmed.ProfilePicture == nil || len(confirmed.ProfilePictureVariants) == 0 {
+		t.Fatalf("picture was not processed: %+v", confirmed)
+	}
+
+	for size, variantURL := range confirmed.ProfilePictureVariants {
+		if body := download(t, variantURL); len(body) == 0 {
+			t.Fatalf("variant %s is empty", size)
+		}
+	}
+
+	// the sanitized original is published under a key of its own
+	info, err := h.store.Head(context.Background(), testBucket, h.profilePictureKey(alice.user.Id))
+	if err != nil || info.ContentType != "image/jpeg" {
+		t.Fatalf("unexpected original %+v: %v", info, err)
+	}
+}
+
+func TestLocalStorageRejectsUnsignedRequests(t *testing.T) {
+	h := newLocalHarness(t)
+	ctx := context.Background()
+	content := []byte("content")
+
+	if err := h.store.Put(ctx, testBucket, "object", content, "text/plain"); err != nil {
+		t.Fatalf("could not put object: %s", err)
+	}
+	downloadURL, err := h.store.PresignGet(ctx, testBucket, "object", time.Minute)
+	if err != nil {
+		t.Fatalf("could not presign download: %s", err)
+	}
+	expiredURL, _ := h.store.PresignGet(ctx, testBucket, "object", -time.Minute)
+	upload, err := h.store.PresignPut(ctx, testBucket, "upload", storage.UploadConstraints{
+		ContentType:    "text/plain",
+		ContentLength:  int64(len(content)),
+		ChecksumSHA256: describeFile(content).Checksum,
+	}, time.Minute)
+	if err != nil {
+		t.Fatalf("could not presign upload: %s", err)
+	}
+
+	// replaces a query parameter of a signed url
+	tamper := func(signed string, key string, value string) string {
+		parsed, _ := url.Parse(signed)
+		query := parsed.Query()
+		query.Set(key, value)
+		parsed.RawQuery = query.Encode()
+		return parsed.String()
+	}
+
+	for _, tc := range []struct {
+		name        string
+		method      string
+		url         string
+		contentType string
+		body        []byte
+		status      int
+	}{
+		{name: "signed download", method: http.MethodGet, url: downloadURL, status: http.StatusOK},
+		{name: "head with download url", method: http.MethodHead, url: downloadURL, status: http.StatusOK},
+		{name: "expired", method: http.MethodGet, url: expiredURL, status: http.StatusForbidden},
+		{name: "tampered signature", method: http.MethodGet, url: tamper(downloadURL, "signature", "forged"), status: http.StatusForbidden},
+		{name: "extended expiration", method: http.MethodGet, url: tamper(downloadURL, "expires", "99999999999"), status: http.StatusForbidden},
+		{name: "other object", method: http.MethodGet, url: strings.Replace(downloadURL, "/object?", "/upload?", 1), status: http.StatusForbidden},
+		{name: "upload with download url", method: http.MethodPut, url: downloadURL, contentType: "text/plain", body: content, status: http.StatusForbidden},
+		{name: "upload of another type", method: http.MethodPut, url: upload.URL, contentType: "text/html", body: content, status: http.StatusForbidden},
+		{name: "upload with a raised limit", method: http.MethodPut, url: tamper(upload.URL, "contentLength", "100"), contentType: "text/plain", body: content, status: http.StatusForbidden},
+		{name: "upload of other content", method: http.MethodPut, url: upload.URL, contentType: "text/plain", body: []byte("CONTENT"), status: http.StatusBadRequest},
+		{name: "traversal", method: http.MethodGet, url: h.cfg.StorageLocalURL + storage.LocalPathPrefix + "%2e%2e/object", status: http.StatusForbidden},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if res := h.storageRequest(tc.method, tc.url, tc.contentType, tc.body); res.StatusCode != tc.status {
+				t.Fatalf("expected status %d, got %d", tc.status, res.StatusCode)
+			}
+		})
+	}
+
+	if _, err := h.store.Head(ctx, testBucket, "upload"); err != storage.ErrNotFound {
+		t.Fatalf("rejected upload was stored: %v", err)
+	}
+	if res := h.storageRequest(http.MethodPut, upload.URL, "text/plain", content); res.StatusCode != http.StatusOK {
+		t.Fatalf("signed upload failed with status %d", res.StatusCode)
+	}
+	if stored, err := h.store.Get(ctx, testBucket, "upload"); err != nil || !bytes.Equal(stored, content) {
+		t.Fatalf("unexpected upload %q: %v", stored, err)
+	}
+}
+
+func TestLocalStorageKeepsKeysInTheirBucket(t *testing.T) {
+	h := newLocalHarness(t)
+	ctx := context.Background()
+
+	for _, key := range []string{"../../escape", "user", "user/64.jpg"} {
+		if err := h.store.Put(ctx, testBucket, key, []byte(key), "text/plain"); err != nil {
+			t.Fatalf("could not put %s: %s", key, err)
+		}
+	}
+	if err := h.store.Put(ctx, "../escape", "object", []byte("content"), "text/plain"); err == nil {
+		t.Fatalf("bucket outside of the root was accepted")
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(h.cfg.StorageLocalDir))
+	if err != nil {
+		t.Fatalf("could not list directory: %s", err)
+	}
+	for _, entry := range entries {
+		if strings.Contains(entry.Name(), "escape") {
+			t.Fatalf("object escaped the storage directory: %s", entry.Name())
+		}
+	}
+
+	keys, err := h.store.List(ctx, testBucket, "user")
+	if err != nil || len(keys) != 2 || keys[0] != "user" || keys[1] != "user/64.jpg" {
+		t.Fatalf("unexpected keys %v: %v", keys, err)
+	}
+
+	if err := h.store.Delete(ctx, testBucket, "user"); err != nil {
+		t.Fatalf("could not delete object: %s", err)
+	}
+	if body, err := h.store.Get(ctx, testBucket, "user/64.jpg"); err != nil || string(body) != "user/64.jpg" {
+		t.Fatalf("deleting a key removed another one: %v", err)
+	}
+}
+
+func TestLocalStorageCors(t *testing.T) {
+	h := newLocalHarness(t)
+
+	for _, tc := range []struct {
+		origin string
+		status int
+	}{
+		{origin: testOrigin, status: http.StatusNoContent},
+		{origin: "https://evil.example", status: http.StatusForbidden},
+	} {
+		t.Run(tc.origin, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodOptions, h.cfg.StorageLocalURL+storage.LocalPathPrefix+testAttachments+"/object", nil)
+			req.Header.Set("Origin", tc.origin)
+			req.Header.Set("Access-Control-Request-Method", http.MethodPut)
+
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("could not send preflight: %s", err)
+			}
+			defer res.Body.Close()
+
+			if res.StatusCode != tc.status {
+				t.Fatalf("expected status %d, got %d", tc.status, res.StatusCode)
+			}
+			if allowed := res.Header.Get("Access-Control-Allow-Origin"); (tc.status == http.StatusNoContent) != (allowed == tc.origin) {
+				t.Fatalf("unexpected allowed origin %q", allowed)
+			}
+		})
+	}
+}
+
+func TestLocalStorageConfig(t *testing.T) {
+	h := newLocalHarness(t)
+
+	// the bucket credentials are only needed by the s3 driver
+	if h.cfg.BucketURL != "" || h.cfg.Validate() != nil {
+		t.Fatalf("local config without bucket credentials is invalid: %v", h.cfg.Validate())
+	}
+
+	cfg := *h.cfg
+	cfg.StorageLocalSecret = ""
+	cfg.StorageLocalURL = "localhost:4000"
+	err := cfg.Validate()
+	for _, expected := range []string{"STORAGE_LOCAL_SECRET", "STORAGE_LOCAL_URL"} {
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Fatalf("expected %s to be reported, got %v", expected, err)
+		}
+	}
+
+	cfg = *h.cfg
+	cfg.StorageDriver = "ftp"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "STORAGE_DRIVER") {
+		t.Fatalf("unknown driver was accepted: %v", err)
+	}
+}
@@ -0,0 +1,369 @@
+package e2e
+
+import (
+	"easyflow-backend/src/api/auth"
+	"easyflow-backend/src/api/user"
+	"easyflow-backend/src/api/utils"
+	"easyflow-backend/src/database"
+	"easyflow-backend/src/enum"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestSignup(t *testing.T) {
+	runEndpointCases(t, []endpointCase{
+		{
+			name:   "creates user",
+			method: http.MethodPost,
+			prepare: func(h *harness) (*client, string, any) {
+				return h.newClient(), "/user/signup", signupBody("new@example.com", "new")
+			},
+			status: http.StatusOK,
+			check: func(t *testing.T, h *harness, c *client, r *response) {
+				var user database.User
+				r.decode(&user)
+				if user.Id == "" || user.Email != "new@example.com" {
+					t.Fatalf("unexpected user: %+v", user)
+				}
+				if strings.Contains(r.rec.Body.String(), "password") {
+					t.Fatalf("password hash leaked in signup response")
+				}
+			},
+		},
+		{
+			name:   "duplicate email",
+			method: http.MethodPost,
+			prepare: func(h *harness) (*client, string, any) {
+				c := h.newClient()
+				user := c.signup("taken")
+				return c, "/user/signup", signupBody(user.Email, "other")
+			},
+			status: http.StatusConflict,
+			code:   enum.AlreadyExists,
+		},
+		{
+			name:   "password too short",
+			method: http.MethodPost,
+			prepare: func(h *harness) (*client, string, any) {
+				body := signupBody("short@example.com", "short")
+				body["password"] = "short"
+				return h.newClient(), "/user/signup", body
+			},
+			status: http.StatusInternalServerError,
+			code:   enum.ApiError,
+		},
+	})
+}
+
+func TestGetUser(t *testing.T) {
+	runEndpointCases(t, []endpointCase{
+		{
+			name:   "returns logged in user",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				return h.newUser("alice"), "/user/", nil
+			},
+			status: http.StatusOK,
+			check: func(t *testing.T, h *harness, c *client, r *response) {
+				var user database.User
+				r.decode(&user)
+				if user.Id != c.user.Id || user.Email != c.user.Email {
+					t.Fatalf("expected %s, got %+v", c.user.Id, user)
+				}
+			},
+		},
+		{
+			name:   "without cookie",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				return h.newClient(), "/user/", nil
+			},
+			status: http.StatusBadRequest,
+			code:   enum.InvalidCookie,
+		},
+		{
+			name:   "empty access token",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				c := h.newClient()
+				c.setCookie("access_token", "")
+				return c, "/user/", nil
+			},
+			status: http.StatusBadRequest,
+			code:   enum.InvalidAccessToken,
+		},
+		{
+			name:   "malformed access token",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				c := h.newClient()
+				c.setCookie("access_token", "not-a-jwt")
+				return c, "/user/", nil
+			},
+			status: 498,
+			code:   enum.InvalidAccessToken,
+		},
+		{
+			name:   "access token signed with another secret",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				c := h.newUser("alice")
+				c.setCookie("access_token", h.token(c.user.Id, uuid.New(), time.Minute, "another-secret"))
+				return c, "/user/", nil
+			},
+			status: 498,
+			code:   enum.InvalidAccessToken,
+		},
+		{
+			name:   "expired access token",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				c := h.newUser("alice")
+				c.setCookie("access_token", h.token(c.user.Id, uuid.New(), -time.Minute, h.cfg.JwtSecret))
+				return c, "/user/", nil
+			},
+			status: 498,
+			code:   enum.ExpiredAccessToken,
+		},
+	})
+}
+
+func TestUserExists(t *testing.T) {
+	runEndpointCases(t, []endpointCase{
+		{
+			name:   "existing email",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				c := h.newClient()
+				user := c.signup("alice")
+				return c, "/user/exists/" + user.Email, nil
+			},
+			status: http.StatusOK,
+			check:  expectBody("true"),
+		},
+		{
+			name:   "unknown email",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				return h.newClient(), "/user/exists/nobody@example.com", nil
+			},
+			status: http.StatusOK,
+			check:  expectBody("false"),
+		},
+		{
+			name:   "unfilled path parameter",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				return h.newClient(), "/user/exists/:email", nil
+			},
+			status: http.StatusBadRequest,
+			code:   enum.MalformedRequest,
+		},
+	})
+}
+
+func TestProfilePicture(t *testing.T) {
+	runEndpointCases(t, []endpointCase{
+		{
+			name:   "no picture uploaded",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				return h.newUser("alice"), "/user/profile-picture", nil
+			},
+			status: http.StatusNoContent,
+		},
+		{
+			name:   "presigned download url",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				c := h.newUser("alice")
+				h.s3.Put(testBucket, c.user.Id, []byte("picture"), "image/png")
+				h.setPictureKey(c.user.Id, c.user.Id)
+				return c, "/user/profile-picture", nil
+			},
+			status: http.StatusOK,
+			check: func(t *testing.T, h *harness, c *client, r *response) {
+				var pictureURL string
+				r.decode(&pictureURL)
+
+				res, err := http.Get(pictureURL)
+				if err != nil {
+					t.Fatalf("could not download picture: %s", err)
+				}
+				defer res.Body.Close()
+				body, _ := io.ReadAll(res.Body)
+				if res.StatusCode != http.StatusOK || string(body) != "picture" {
+					t.Fatalf("unexpected download: %d %q", res.StatusCode, body)
+				}
+			},
+		},
+		{
+			name:   "presigned upload url",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				return h.newUser("alice"), "/user/upload-profile-picture?mimeType=image/png&size=7", nil
+			},
+			status: http.StatusOK,
+			check: func(t *testing.T, h *harness, c *client, r *response) {
+				var upload user.UploadProfilePictureResponse
+				r.decode(&upload)
+				if upload.UploadHeaders["Content-Type"] != "image/png" || upload.UploadHeaders["Content-Length"] != "7" {
+					t.Fatalf("upload is not restricted to the described picture: %+v", upload.UploadHeaders)
+				}
+
+				if status := h.upload(upload.UploadURL, upload.UploadHeaders, []byte("picture")); status != http.StatusOK {
+					t.Fatalf("upload failed with status %d", status)
+				}
+				// the upload goes to a staging object, the picture is only published once it was confirmed
+				uploads := h.s3.Keys(testBucket, utils.PictureUploadPrefix)
+				if body, ok := h.s3.Get(testBucket, c.requestedUpload()); len(uploads) != 1 || !ok || string(body) != "picture" {
+					t.Fatalf("picture was not stored in the staging object: %v", uploads)
+				}
+			},
+		},
+		{
+			name:   "upload url for a disallowed type",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				return h.newUser("alice"), "/user/upload-profile-picture?mimeType=text/html&size=7", nil
+			},
+			status: http.StatusUnsupportedMediaType,
+			code:   enum.UnsupportedFileType,
+		},
+		{
+			name:   "upload url for a too large picture",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				return h.newUser("alice"), fmt.Sprintf("/user/upload-profile-picture?mimeType=image/png&size=%d", h.cfg.ProfilePictureMaxSize+1), nil
+			},
+			status: http.StatusRequestEntityTooLarge,
+			code:   enum.FileTooLarge,
+		},
+		{
+			name:   "upload url without a description",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				return h.newUser("alice"), "/user/upload-profile-picture", nil
+			},
+			status: http.StatusBadRequest,
+			code:   enum.MalformedRequest,
+		},
+		{
+			name:   "confirm without upload",
+			method: http.MethodPost,
+			prepare: func(h *harness) (*client, string, any) {
+				return h.newUser("alice"), "/user/profile-picture", nil
+			},
+			status: http.StatusNotFound,
+			code:   enum.NotFound,
+		},
+		{
+			name:   "confirm deletes a violating picture",
+			method: http.MethodPost,
+			prepare: func(h *harness) (*client, string, any) {
+				c := h.newUser("alice")
+				h.s3.Put(testBucket, c.requestProfilePictureUpload(), []byte("<script>"), "text/html")
+				return c, "/user/profile-picture", nil
+			},
+			status: http.StatusUnsupportedMediaType,
+			code:   enum.UnsupportedFileType,
+			check: func(t *testing.T, h *harness, c *client, r *response) {
+				if keys := h.s3.Keys(testBucket, ""); len(keys) != 0 {
+					t.Fatalf("violating picture was kept: %v", keys)
+				}
+			},
+		},
+		{
+			name:   "upload url without login",
+			method: http.MethodGet,
+			prepare: func(h *harness) (*client, string, any) {
+				return h.newClient(), "/user/upload-profile-picture", nil
+			},
+			status: http.StatusBadRequest,
+			code:   enum.InvalidCookie,
+		},
+	})
+}
+
+func TestUpdateUser(t *testing.T) {
+	runEndpointCases(t, []endpointCase{
+		{
+			name:   "updates name and bio",
+			method: http.MethodPut,
+			prepare: func(h *harness) (*client, string, any) {
+				return h.newUser("alice"), "/user/", map[string]string{"name": "Alice", "bio": "hello"}
+			},
+			status: http.StatusOK,
+			check: func(t *testing.T, h *harness, c *client, r *response) {
+				var user database.User
+				c.do(http.MethodGet, "/user/", nil).expect(http.StatusOK).decode(&user)
+				if user.Name != "Alice" || user.Bio == nil || *user.Bio != "hello" {
+					t.Fatalf("update was not persisted: %+v", user)
+				}
+			},
+		},
+		{
+			name:   "name too long",
+			method: http.MethodPut,
+			prepare: func(h *harness) (*client, string, any) {
+				return h.newUser("alice"), "/user/", map[string]string{"name": strings.Repeat("a", 51)}
+			},
+			status: http.StatusInternalServerError,
+			code:   enum.ApiError,
+		},
+		{
+			name:   "without login",
+			method: http.MethodPut,
+			prepare: func(h *harness) (*client, string, any) {
+				return h.newClient(), "/user/", map[string]string{"name": "Alice"}
+			},
+			status: http.StatusBadRequest,
+			code:   enum.InvalidCookie,
+		},
+	})
+}
+
+func TestDeleteUser(t *testing.T) {
+	runEndpointCases(t, []endpointCase{
+		{
+			name:   "deletes user and sessions",
+			method: http.MethodDelete,
+			prepare: func(h *harness) (*client, string, any) {
+				return h.newUser("alice"), "/user/", nil
+			},
+			status: http.StatusOK,
+			check: func(t *testing.T, h *harness, c *client, r *response) {
+				// the account is only soft deleted, its email stays taken until the retention worker purges it
+				expectBody("true")(t, h, c, h.newClient().do(http.MethodGet, "/user/exists/"+c.user.Email, nil))
+				c.do(http.MethodGet, "/auth/refresh", nil).expectError(498, enum.InvalidRefreshToken)
+				h.newClient().do(http.MethodPost, "/auth/login", auth.LoginRequest{Email: c.user.Email, Password: c.user.Password}).
+					expectError(http.StatusUnauthorized, enum.WrongCredentials)
+			},
+		},
+		{
+			name:   "without login",
+			method: http.MethodDelete,
+			prepare: func(h *harness) (*client, string, any) {
+				return h.newClient(), "/user/", nil
+			},
+			status: http.StatusBadRequest,
+			code:   enum.InvalidCookie,
+		},
+	})
+}
+
+func expectBody(expected string) func(t *testing.T, h *harness, c *client, r *response) {
+	return func(t *testing.T, h *harness, c *client, r *response) {
+		t.Helper()
+
+		if body := strings.TrimSpace(r.rec.Body.String()); body != expected {
+			t.Fatalf("expected body %s, got %s", expected, body)
+		}
+	}
+}
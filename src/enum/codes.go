@@ -18,4 +18,12 @@ const (
 	ExpiredAccessToken  ErrorCode = "EXPIRED_ACCESS_TOKEN"
 	ExpiredRefreshToken ErrorCode = "EXPIRED_REFRESH_TOKEN"
 	UserNotFound        ErrorCode = "USER_NOT_FOUND"
+	ServiceUnavailable  ErrorCode = "SERVICE_UNAVAILABLE"
+	AccountDisabled     ErrorCode = "ACCOUNT_DISABLED"
+	FileTooLarge        ErrorCode = "FILE_TOO_LARGE"
+	UnsupportedFileType ErrorCode = "UNSUPPORTED_FILE_TYPE"
+	InvalidImage        ErrorCode = "INVALID_IMAGE"
+	ScanPending         ErrorCode = "SCAN_PENDING"
+	Quarantined         ErrorCode = "QUARANTINED"
+	PushNotConfigured   ErrorCode = "PUSH_NOT_CONFIGURED"
 )
@@ -0,0 +1,289 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"easyflow-backend/src/common"
+	"easyflow-backend/src/database"
+	"easyflow-backend/src/enum"
+	"easyflow-backend/src/jobs"
+	"easyflow-backend/src/repository"
+	"easyflow-backend/src/storage"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Builder collects the data of a user into a zip archive and uploads it to the export bucket.
+// Archives are built by the BuildJob jobs, the state is tracked on the DataExport record.
+type Builder struct {
+	repos  *repository.Repositories
+	cfg    *common.Config
+	store  storage.ObjectStore
+	logger *common.Logger
+}
+
+// BuildPayload names the export a build job builds
+type BuildPayload struct {
+	ExportId string `json:"exportId"`
+	UserId   string `json:"userId"`
+}
+
+var BuildJob = jobs.NewKind[BuildPayload]("export.build")
+
+// Chat is a chat the user is a member of together with the wrapped chat key of the user
+type Chat struct {
+	Id          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description *string   `json:"description"`
+	CreatedAt   time.Time `json:"createdAt"`
+	JoinedAt    time.Time `json:"joinedAt"`
+	Key         string    `json:"key"`
+	MemberIds   []string  `json:"memberIds"`
+}
+
+// Message is a message sent by the user, the content stays encrypted
+type Message struct {
+	Id        string    `json:"id"`
+	ChatId    string    `json:"chatId"`
+	CreatedAt time.Time `json:"createdAt"`
+	Content   string    `json:"content"`
+	Iv        string    `json:"iv"`
+}
+
+// Session is an active login of the user, the refresh token random is left out
+type Session struct {
+	Id        string    `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+func NewBuilder(repos *repository.Repositories, cfg *common.Config, store storage.ObjectStore) *Builder {
+	return &Builder{
+		repos:  repos,
+		cfg:    cfg,
+		store:  store,
+		logger: common.NewLogger(os.Stdout, "Export", nil, cfg.LogLevel),
+	}
+}
+
+// Register adds the handler of the build jobs to the pool
+func (b *Builder) Register(pool *jobs.Pool) {
+	jobs.Handle(pool, BuildJob, b.run)
+}
+
+// SetLogLevel changes the log level of the builder after the config was reloaded
+func (b *Builder) SetLogLevel(logLevel common.LogLevel) {
+	b.logger.SetLogLevel(logLevel)
+}
+
+// ObjectKey is the key of the archive of an export in the export bucket
+func ObjectKey(export *database.DataExport) string {
+	return fmt.Sprintf("%s/%s.zip", export.UserId, export.Id)
+}
+
+/*
+Private function to build the export of a job. A failed build is not retried, the export is marked as failed and
+the user can request a new one. A build that is interrupted by a shutdown is put back and run again.
+*/
+func (b *Builder) run(ctx context.Context, payload BuildPayload) error {
+	export, err := b.repos.Exports.GetByUser(ctx, payload.UserId, payload.ExportId)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if export.Status == database.ExportReady || export.Status == database.ExportFailed {
+		return nil
+	}
+
+	buildCtx, cancel := context.WithTimeout(ctx, b.cfg.ExportTimeout)
+	defer cancel()
+
+	if err := b.Build(buildCtx, export); err != nil {
+		if ctx.Err() != nil {
+			export.Status = database.ExportPending
+			export.CompletedAt = nil
+			if updateErr := b.repos.Exports.Update(context.WithoutCancel(ctx), export); updateErr != nil {
+				return errors.Join(err, updateErr)
+			}
+			return err
+		}
+
+		b.logger.PrintfError("Failed to build export: %s. Error: %s", export.Id, err)
+		return jobs.Permanent(err)
+	}
+
+	b.logger.Printf("Successfully built export: %s", export.Id)
+	return nil
+}
+
+// Build collects the data, uploads the archive and marks the export as ready.
+// The export is marked as failed if any step fails.
+func (b *Builder) Build(ctx context.Context, export *database.DataExport) error {
+	export.Status = database.ExportRunning
+	if err := b.repos.Exports.Update(ctx, export); err != nil {
+		return err
+	}
+
+	archive, err := b.archive(ctx, export.UserId)
+	if err == nil {
+		objectKey := ObjectKey(export)
+		if apiErr := storage.PutObject(ctx, b.logger, b.store, b.cfg.ExportBucketName, objectKey, archive, "application/zip"); apiErr != nil {
+			err = fmt.Errorf("could not upload archive: %v", apiErr.Details)
+		} else {
+			export.ObjectKey = &objectKey
+		}
+	}
+
+	now := time.Now()
+	export.CompletedAt = &now
+	export.Status = database.ExportReady
+	if err != nil {
+		export.Status = database.ExportFailed
+	}
+
+	// the result is recorded even if the build was cancelled by a shutdown
+	if updateErr := b.repos.Exports.Update(context.WithoutCancel(ctx), export); updateErr != nil {
+		return errors.Join(err, updateErr)
+	}
+
+	return err
+}
+
+func (b *Builder) archive(ctx context.Context, userId string) ([]byte, error) {
+	user, err := b.repos.Users.GetById(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	chats, err := b.chats(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	sentMessages, err := b.repos.Messages.ListBySender(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]Message, 0, len(sentMessages))
+	for _, message := range sentMessages {
+		messages = append(messages, Message{
+			Id:        message.Id,
+			ChatId:    message.ChatId,
+			CreatedAt: message.CreatedAt,
+			Content:   message.Content,
+			Iv:        message.Iv,
+		})
+	}
+
+	activeSessions, err := b.repos.Sessions.ListActiveByUser(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	sessions := make([]Session, 0, len(activeSessions))
+	for _, session := range activeSessions {
+		sessions = append(sessions, Session{
+			Id:        session.Id,
+			CreatedAt: session.CreatedAt,
+			ExpiresAt: session.ExpiredAt,
+		})
+	}
+
+	// only pictures that were scanned clean are published, a picture that is still scanned is left out like its download urls
+	var picture []byte
+	if user.PictureKey != nil {
+		body, apiErr := storage.GetObject(ctx, b.logger, b.store, b.cfg.ProfilePictureBucketName, *user.PictureKey)
+		if apiErr != nil && apiErr.Error != enum.NotFound {
+			return nil, fmt.Errorf("could not download profile picture: %v", apiErr.Details)
+		}
+		picture = body
+	}
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+
+	files := []struct {
+		name string
+		data any
+	}{
+		{"profile.json", user},
+		{"chats.json", chats},
+		{"messages.json", messages},
+		{"sessions.json", sessions},
+	}
+	for _, file := range files {
+		content, err := json.MarshalIndent(file.data, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		if err := writeFile(w, file.name, content); err != nil {
+			return nil, err
+		}
+	}
+
+	if picture != nil {
+		if err := writeFile(w, "profile-picture", picture); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (b *Builder) chats(ctx context.Context, userId string) ([]Chat, error) {
+	memberships, err := b.repos.Chats.ListMembershipsOfUser(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	chats := make([]Chat, 0, len(memberships))
+	for _, membership := range memberships {
+		chat, err := b.repos.Chats.GetById(ctx, membership.ChatId)
+		if errors.Is(err, repository.ErrNotFound) {
+			// the chat was deleted, its membership is purged together with it
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		members, err := b.repos.Chats.ListMembers(ctx, chat.Id)
+		if err != nil {
+			return nil, err
+		}
+		memberIds := make([]string, 0, len(members))
+		for _, member := range members {
+			memberIds = append(memberIds, member.UserId)
+		}
+
+		chats = append(chats, Chat{
+			Id:          chat.Id,
+			Name:        chat.Name,
+			Description: chat.Description,
+			CreatedAt:   chat.CreatedAt,
+			JoinedAt:    membership.CreatedAt,
+			Key:         membership.Key,
+			MemberIds:   memberIds,
+		})
+	}
+
+	return chats, nil
+}
+
+func writeFile(w *zip.Writer, name string, content []byte) error {
+	f, err := w.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(content)
+	return err
+}
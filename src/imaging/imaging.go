@@ -0,0 +1,160 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"slices"
+
+	// registers the decoders for image.Decode
+	_ "image/gif"
+	_ "image/png"
+)
+
+// VariantSizes are the edge lengths of the square variants generated for every picture
+var VariantSizes = []int{64, 256, 512}
+
+// VariantContentType is the type of all generated variants. The standard library has no webp encoder,
+// so every variant is a jpeg until an encoder is vendored.
+const VariantContentType = "image/jpeg"
+
+const jpegQuality = 85
+
+// ErrInvalidImage is returned for files that can not be decoded or do not have acceptable dimensions
+var ErrInvalidImage = errors.New("invalid image")
+
+var decodableTypes = []string{"image/jpeg", "image/png", "image/gif"}
+
+// Decodable reports whether pictures of the content type can be processed
+func Decodable(contentType string) bool {
+	return slices.Contains(decodableTypes, contentType)
+}
+
+// Limits are the dimensions a picture must have, both apply to width and height
+type Limits struct {
+	MinDimension int
+	MaxDimension int
+}
+
+// Variant is an encoded square rendition of a picture
+type Variant struct {
+	Size int
+	Body []byte
+}
+
+// Result holds the sanitized picture in its original dimensions and the variants
+type Result struct {
+	Original []byte
+	Variants []Variant
+}
+
+// VariantKey is the object key of a variant of the picture stored under objectKey
+func VariantKey(objectKey string, size int) string {
+	return fmt.Sprintf("%s/%d.jpg", objectKey, size)
+}
+
+// Process decodes the picture, applies the exif orientation and re-encodes it, which drops all metadata.
+// The dimensions are checked before the pixels are decoded so huge pictures are rejected cheaply.
+func Process(raw []byte, limits Limits) (*Result, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidImage, err)
+	}
+	if config.Width > limits.MaxDimension || config.Height > limits.MaxDimension {
+		return nil, fmt.Errorf("%w: %dx%d is larger than %d pixels", ErrInvalidImage, config.Width, config.Height, limits.MaxDimension)
+	}
+	if config.Width < limits.MinDimension || config.Height < limits.MinDimension {
+		return nil, fmt.Errorf("%w: %dx%d is smaller than %d pixels", ErrInvalidImage, config.Width, config.Height, limits.MinDimension)
+	}
+
+	decoded, _, err := image.Decode(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidImage, err)
+	}
+
+	picture := orient(toRGBA(decoded), exifOrientation(raw))
+
+	original, err := encode(picture)
+	if err != nil {
+		return nil, err
+	}
+	result := &Result{Original: original}
+
+	square := cropSquare(picture)
+	for _, size := range VariantSizes {
+		body, err := encode(resize(square, size, size))
+		if err != nil {
+			return nil, err
+		}
+		result.Variants = append(result.Variants, Variant{Size: size, Body: body})
+	}
+
+	return result, nil
+}
+
+func encode(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return nil, fmt.Errorf("could not encode picture: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// toRGBA copies the picture onto a white background, jpeg has no alpha channel
+func toRGBA(img image.Image) *image.RGBA {
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Over)
+	return rgba
+}
+
+// cropSquare cuts the largest centered square out of the picture
+func cropSquare(img *image.RGBA) *image.RGBA {
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	size := min(width, height)
+	x, y := (width-size)/2, (height-size)/2
+
+	square := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(square, square.Bounds(), img, image.Pt(x, y), draw.Src)
+	return square
+}
+
+// resize scales the picture with a box filter, every target pixel is the average of the source pixels it covers
+func resize(src *image.RGBA, width int, height int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	srcWidth, srcHeight := src.Bounds().Dx(), src.Bounds().Dy()
+
+	for y := 0; y < height; y++ {
+		y0 := y * srcHeight / height
+		y1 := max((y+1)*srcHeight/height, y0+1)
+		for x := 0; x < width; x++ {
+			x0 := x * srcWidth / width
+			x1 := max((x+1)*srcWidth/width, x0+1)
+
+			var r, g, b, a, count int
+			for sy := y0; sy < y1; sy++ {
+				offset := src.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					r += int(src.Pix[offset])
+					g += int(src.Pix[offset+1])
+					b += int(src.Pix[offset+2])
+					a += int(src.Pix[offset+3])
+					offset += 4
+					count++
+				}
+			}
+
+			offset := dst.PixOffset(x, y)
+			dst.Pix[offset] = uint8(r / count)
+			dst.Pix[offset+1] = uint8(g / count)
+			dst.Pix[offset+2] = uint8(b / count)
+			dst.Pix[offset+3] = uint8(a / count)
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,61 @@
+package jobs
+
+import (
+	"context"
+	"easyflow-backend/src/database"
+	"easyflow-backend/src/repository"
+	"encoding/json"
+	"time"
+)
+
+/*
+Kind is a type of job whose payload is a T, the payload is stored as json. The name is stored with every job,
+it has to stay the same as long as jobs of the kind can be queued.
+*/
+type Kind[T any] struct {
+	Name string
+}
+
+func NewKind[T any](name string) Kind[T] {
+	return Kind[T]{Name: name}
+}
+
+// Enqueue stores a job of the kind that is due right away, pass the repositories of a transaction to enqueue it together with other changes
+func (k Kind[T]) Enqueue(ctx context.Context, repos *repository.Repositories, payload T) (*database.Job, error) {
+	return k.EnqueueAt(ctx, repos, payload, time.Now())
+}
+
+// EnqueueAt stores a job of the kind that is not run before runAt
+func (k Kind[T]) EnqueueAt(ctx context.Context, repos *repository.Repositories, payload T, runAt time.Time) (*database.Job, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &database.Job{
+		Type:    k.Name,
+		Payload: string(body),
+		RunAt:   runAt,
+	}
+	if err := repos.Jobs.Create(ctx, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks an error of a handler that a retry can not fix, the job is dead-lettered right away
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
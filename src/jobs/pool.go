@@ -0,0 +1,188 @@
+package jobs
+
+import (
+	"context"
+	"easyflow-backend/src/common"
+	"easyflow-backend/src/database"
+	"easyflow-backend/src/repository"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type handler func(ctx context.Context, payload string) error
+
+/*
+Pool runs the queued jobs with JOB_WORKERS workers. Every worker leases one due job at a time, jobs that succeed are deleted
+and failed jobs are retried with a doubling pause until they run out of attempts and are dead-lettered.
+Only the kinds with a registered handler are leased, other instances may run the rest.
+*/
+type Pool struct {
+	repos    *repository.Repositories
+	cfg      *common.Config
+	logger   *common.Logger
+	handlers map[string]handler
+}
+
+func NewPool(repos *repository.Repositories, cfg *common.Config) *Pool {
+	return &Pool{
+		repos:    repos,
+		cfg:      cfg,
+		logger:   common.NewLogger(os.Stdout, "Jobs", nil, cfg.LogLevel),
+		handlers: map[string]handler{},
+	}
+}
+
+// Handle registers the handler of the kind, all handlers have to be registered before the pool is run
+func Handle[T any](p *Pool, kind Kind[T], handle func(ctx context.Context, payload T) error) {
+	p.handlers[kind.Name] = func(ctx context.Context, payload string) error {
+		var decoded T
+		if err := json.Unmarshal([]byte(payload), &decoded); err != nil {
+			return Permanent(fmt.Errorf("could not decode the payload: %w", err))
+		}
+		return handle(ctx, decoded)
+	}
+}
+
+// SetLogLevel changes the log level of the pool after the config was reloaded
+func (p *Pool) SetLogLevel(logLevel common.LogLevel) {
+	p.logger.SetLogLevel(logLevel)
+}
+
+// Run starts the workers and blocks until ctx is cancelled and the running jobs returned.
+// Running jobs are cancelled with ctx and put back into the queue without counting the attempt.
+func (p *Pool) Run(ctx context.Context) {
+	if len(p.handlers) == 0 {
+		p.logger.Printf("No job handlers are registered, the workers are not started")
+		return
+	}
+
+	var wg sync.WaitGroup
+	for range p.cfg.JobWorkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.work(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+/*
+Private function of a single worker, it looks for the next job right away after one was run and polls otherwise
+*/
+func (p *Pool) work(ctx context.Context) {
+	for ctx.Err() == nil {
+		ran, err := p.RunOnce(ctx)
+		if err != nil && ctx.Err() == nil {
+			p.logger.PrintfError("Failed to run a job: %s", err)
+		}
+		if ran && err == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(p.cfg.JobPollInterval):
+		}
+	}
+}
+
+// RunOnce leases a due job and runs it, it returns false if no job was due. Failures of the job itself are not returned.
+func (p *Pool) RunOnce(ctx context.Context) (bool, error) {
+	types := slices.Sorted(maps.Keys(p.handlers))
+	if len(types) == 0 {
+		return false, nil
+	}
+
+	token := uuid.NewString()
+	job, err := p.repos.Jobs.Lease(ctx, types, token, time.Now().Add(p.cfg.JobLeaseDuration), p.cfg.JobMaxAttempts)
+	if errors.Is(err, repository.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if job == nil {
+		// other workers claimed the due jobs first
+		return false, nil
+	}
+
+	runCtx, cancel := context.WithDeadline(ctx, *job.LeasedUntil)
+	jobErr := p.run(runCtx, job)
+	cancel()
+
+	// the outcome is stored even if the pool is shutting down
+	storeCtx := context.WithoutCancel(ctx)
+	switch {
+	case jobErr == nil:
+		err = p.repos.Jobs.Delete(storeCtx, job.Id, token)
+	case ctx.Err() != nil:
+		p.logger.PrintfWarning("Job %s (%s) was interrupted by the shutdown, putting it back into the queue", job.Id, job.Type)
+		job.Status = database.JobQueued
+		job.Attempts--
+		job.RunAt = time.Now()
+		job.LeaseToken = nil
+		job.LeasedUntil = nil
+		err = p.repos.Jobs.Update(storeCtx, job, token)
+	default:
+		err = p.fail(storeCtx, job, token, jobErr)
+	}
+
+	if errors.Is(err, repository.ErrNotFound) {
+		p.logger.PrintfWarning("Job %s (%s) ran longer than its lease, it is run again", job.Id, job.Type)
+		return true, nil
+	}
+	return true, err
+}
+
+/*
+Private function to run the handler of the job, a panic fails the job like an error
+*/
+func (p *Pool) run(ctx context.Context, job *database.Job) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("handler panicked: %v", recovered)
+		}
+	}()
+
+	return p.handlers[job.Type](ctx, job.Payload)
+}
+
+/*
+Private function to schedule the next attempt of a failed job or to dead-letter it
+*/
+func (p *Pool) fail(ctx context.Context, job *database.Job, token string, jobErr error) error {
+	message := jobErr.Error()
+	job.LastError = &message
+	job.LeaseToken = nil
+	job.LeasedUntil = nil
+
+	var permanent *permanentError
+	if errors.As(jobErr, &permanent) || job.Attempts >= p.cfg.JobMaxAttempts {
+		job.Status = database.JobDead
+		p.logger.PrintfError("Job %s (%s) failed after %d attempts, moving it to the dead letters. Error: %s", job.Id, job.Type, job.Attempts, jobErr)
+	} else {
+		job.Status = database.JobQueued
+		job.RunAt = time.Now().Add(Backoff(p.cfg, job.Attempts))
+		p.logger.PrintfWarning("Job %s (%s) failed, retrying at %s. Attempt %d: %s", job.Id, job.Type, job.RunAt.Format(time.RFC3339), job.Attempts, jobErr)
+	}
+
+	return p.repos.Jobs.Update(ctx, job, token)
+}
+
+// Backoff is the pause after the failed attempt, it starts at JOB_RETRY_BACKOFF and doubles up to JOB_RETRY_MAX_BACKOFF
+func Backoff(cfg *common.Config, attempt int) time.Duration {
+	backoff := cfg.JobRetryBackoff
+	for i := 1; i < attempt && backoff < cfg.JobRetryMaxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, cfg.JobRetryMaxBackoff)
+}
@@ -0,0 +1,202 @@
+package jobs
+
+import (
+	"context"
+	"easyflow-backend/src/common"
+	"easyflow-backend/src/database"
+	"easyflow-backend/src/repository"
+	"errors"
+	"testing"
+	"time"
+)
+
+type testPayload struct {
+	Value string `json:"value"`
+}
+
+var testJob = NewKind[testPayload]("test.job")
+
+func newTestPool(t *testing.T, backoff time.Duration, handle func(ctx context.Context, payload testPayload) error) (*Pool, *repository.Repositories) {
+	t.Helper()
+
+	cfg := &common.Config{
+		LogLevel:           common.ERROR,
+		JobLeaseDuration:   time.Minute,
+		JobMaxAttempts:     3,
+		JobRetryBackoff:    backoff,
+		JobRetryMaxBackoff: backoff,
+	}
+	repos := repository.NewMemoryRepositories()
+	pool := NewPool(repos, cfg)
+	Handle(pool, testJob, handle)
+	return pool, repos
+}
+
+/*
+Private function to run due jobs until none is left and return the stored job, nil if it was deleted
+*/
+func runUntilDone(t *testing.T, pool *Pool, repos *repository.Repositories, id string) *database.Job {
+	t.Helper()
+
+	ctx := context.Background()
+	for range 10 {
+		ran, err := pool.RunOnce(ctx)
+		if err != nil {
+			t.Fatalf("could not run the job: %s", err)
+		}
+		if !ran {
+			return findJob(t, repos, id)
+		}
+	}
+	t.Fatalf("the job did not finish")
+	return nil
+}
+
+/*
+Private function to look up a job in every status, nil if it does not exist
+*/
+func findJob(t *testing.T, repos *repository.Repositories, id string) *database.Job {
+	t.Helper()
+
+	for _, status := range []database.JobStatus{database.JobQueued, database.JobRunning, database.JobDead} {
+		jobs, err := repos.Jobs.List(context.Background(), status, 100)
+		if err != nil {
+			t.Fatalf("could not list the jobs: %s", err)
+		}
+		for _, job := range jobs {
+			if job.Id == id {
+				return &job
+			}
+		}
+	}
+	return nil
+}
+
+func TestBackoff(t *testing.T) {
+	cfg := &common.Config{JobRetryBackoff: 30 * time.Second, JobRetryMaxBackoff: 5 * time.Minute}
+
+	expected := []time.Duration{30 * time.Second, time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute}
+	for i, backoff := range expected {
+		if actual := Backoff(cfg, i+1); actual != backoff {
+			t.Fatalf("attempt %d: expected %s, got %s", i+1, backoff, actual)
+		}
+	}
+
+	// a backoff above the maximum is capped
+	cfg.JobRetryBackoff = time.Hour
+	if actual := Backoff(cfg, 1); actual != 5*time.Minute {
+		t.Fatalf("expected the maximum, got %s", actual)
+	}
+}
+
+func TestRunOnceSucceeds(t *testing.T) {
+	var received []string
+	pool, repos := newTestPool(t, time.Minute, func(ctx context.Context, payload testPayload) error {
+		received = append(received, payload.Value)
+		return nil
+	})
+
+	job, err := testJob.Enqueue(context.Background(), repos, testPayload{Value: "hello"})
+	if err != nil {
+		t.Fatalf("could not enqueue: %s", err)
+	}
+
+	if job := runUntilDone(t, pool, repos, job.Id); job != nil {
+		t.Fatalf("the job was not deleted: %+v", job)
+	}
+	if len(received) != 1 || received[0] != "hello" {
+		t.Fatalf("unexpected payloads %v", received)
+	}
+
+	if ran, err := pool.RunOnce(context.Background()); ran || err != nil {
+		t.Fatalf("expected no due job, got %t %v", ran, err)
+	}
+}
+
+func TestRunOnceRetriesWithBackoff(t *testing.T) {
+	pool, repos := newTestPool(t, time.Minute, func(ctx context.Context, payload testPayload) error {
+		return errors.New("unavailable")
+	})
+	ctx := context.Background()
+
+	job, err := testJob.Enqueue(ctx, repos, testPayload{})
+	if err != nil {
+		t.Fatalf("could not enqueue: %s", err)
+	}
+
+	before := time.Now()
+	if _, err := pool.RunOnce(ctx); err != nil {
+		t.Fatalf("could not run the job: %s", err)
+	}
+
+	job = findJob(t, repos, job.Id)
+	if job == nil || job.Status != database.JobQueued || job.Attempts != 1 || job.LastError == nil || *job.LastError != "unavailable" {
+		t.Fatalf("unexpected job %+v", job)
+	}
+	if job.RunAt.Before(before.Add(time.Minute)) {
+		t.Fatalf("the retry is not delayed by the backoff: %s", job.RunAt.Sub(before))
+	}
+
+	if ran, err := pool.RunOnce(ctx); ran || err != nil {
+		t.Fatalf("the job was run again before its backoff, got %t %v", ran, err)
+	}
+}
+
+func TestRunOnceDeadLetters(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		attempts int
+	}{
+		{"after the last attempt", errors.New("unavailable"), 3},
+		{"permanent error", Permanent(errors.New("invalid payload")), 1},
+		{"panic", nil, 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// without a backoff every retry is due right away
+			pool, repos := newTestPool(t, time.Nanosecond, func(ctx context.Context, payload testPayload) error {
+				if test.err == nil {
+					panic("broken handler")
+				}
+				return test.err
+			})
+
+			job, err := testJob.Enqueue(context.Background(), repos, testPayload{})
+			if err != nil {
+				t.Fatalf("could not enqueue: %s", err)
+			}
+
+			job = runUntilDone(t, pool, repos, job.Id)
+			if job == nil || job.Status != database.JobDead {
+				t.Fatalf("the job was not dead-lettered: %+v", job)
+			}
+			if job.Attempts != test.attempts || job.LastError == nil || job.LeaseToken != nil {
+				t.Fatalf("unexpected dead job %+v", job)
+			}
+		})
+	}
+}
+
+func TestRunOnceRequeuesOnShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	pool, repos := newTestPool(t, time.Minute, func(ctx context.Context, payload testPayload) error {
+		cancel()
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	job, err := testJob.Enqueue(ctx, repos, testPayload{})
+	if err != nil {
+		t.Fatalf("could not enqueue: %s", err)
+	}
+	if _, err := pool.RunOnce(ctx); err != nil {
+		t.Fatalf("could not run the job: %s", err)
+	}
+
+	job = findJob(t, repos, job.Id)
+	if job == nil || job.Status != database.JobQueued || job.Attempts != 0 || job.LeaseToken != nil {
+		t.Fatalf("the interrupted job was not queued again: %+v", job)
+	}
+}
@@ -1,106 +1,306 @@
 package main
 
 import (
-	"easyflow-backend/src/api/auth"
-	"easyflow-backend/src/api/chat"
-	"easyflow-backend/src/api/user"
+	"context"
+	"easyflow-backend/src/api/health"
+	"easyflow-backend/src/audit"
 	"easyflow-backend/src/common"
 	"easyflow-backend/src/database"
-	"easyflow-backend/src/middleware"
+	"easyflow-backend/src/export"
+	"easyflow-backend/src/jobs"
+	"easyflow-backend/src/metrics"
+	"easyflow-backend/src/notify"
+	"easyflow-backend/src/repository"
+	"easyflow-backend/src/retention"
+	"easyflow-backend/src/router"
+	"easyflow-backend/src/scanning"
+	"easyflow-backend/src/storage"
+	"easyflow-backend/src/tracing"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
 	"os"
-	"strings"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
-	cors "github.com/OnlyNico43/gin-cors"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm/logger"
 )
 
 func main() {
-	cfg := common.LoadDefaultConfig()
+	configFile := os.Getenv("CONFIG_FILE")
+	cfg, err := common.LoadConfig(configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not load the configuration:\n%s\n", err)
+		os.Exit(1)
+	}
 
 	log := common.NewLogger(os.Stdout, "Main", nil, common.LogLevel(cfg.LogLevel))
-	var isConnected = false
-	var dbInst *database.DatabaseInst
-	var connectionAttempts = 0
-	var connectionPause = 5
-	for !isConnected {
-		var err error
-		dbInst, err = database.NewDatabaseInst(cfg.DatabaseURL, &cfg.GormConfig)
 
-		if err != nil {
-			if connectionAttempts <= 5 {
-				connectionAttempts++
-				log.PrintfError("Failed to connect to database, retrying in %d seconds. Attempt %d", connectionPause, connectionAttempts)
-				time.Sleep(time.Duration(connectionPause) * time.Second)
-				connectionPause += 5
-			} else {
-				panic(err)
-			}
-		} else {
-			isConnected = true
-		}
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(cfg, log, os.Args[1:]))
 	}
 
+	if err := cfg.Validate(); err != nil {
+		log.PrintfError("Invalid configuration:\n%s", err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := tracing.Setup(cfg)
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			log.PrintfError("Failed to flush traces: %s", err)
+		}
+	}()
+
 	if !cfg.DebugMode {
 		gin.SetMode(gin.ReleaseMode)
-		dbInst.SetLogMode(logger.Silent)
 	}
 
-	err := dbInst.Migrate()
+	// shared by all requests, the s3 client is only connected on first use
+	store, err := storage.New(cfg)
 	if err != nil {
-		panic(err)
+		log.PrintfError("Could not set up the object storage: %s", err)
+		os.Exit(1)
+	}
+
+	checker := health.NewChecker(cfg, store)
+
+	// until the database is connected only the health endpoints are served,
+	// afterwards the handler is swapped for the full router
+	startupRouter := router.NewStartup(checker)
+
+	var handler atomic.Value
+	handler.Store(http.Handler(startupRouter))
+
+	// in-flight requests keep running after the signal and are only cancelled once draining them timed out
+	requestCtx, cancelRequests := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelRequests()
+
+	server := &http.Server{
+		Addr: ":" + cfg.Port,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handler.Load().(http.Handler).ServeHTTP(w, r)
+		}),
+		ReadTimeout:       cfg.ServerReadTimeout,
+		ReadHeaderTimeout: cfg.ServerReadHeaderTimeout,
+		WriteTimeout:      cfg.ServerWriteTimeout,
+		IdleTimeout:       cfg.ServerIdleTimeout,
+		BaseContext: func(net.Listener) context.Context {
+			return requestCtx
+		},
 	}
 
-	router := gin.New()
+	serverErr := make(chan error, 1)
+	go func() {
+		log.Printf("Starting server on port %s", cfg.Port)
+		serverErr <- server.ListenAndServe()
+	}()
 
-	err = router.SetTrustedProxies(nil)
+	dbInst, err := database.Connect(ctx, cfg.DatabaseURL, &cfg.GormConfig, cfg.DatabaseOptions(), func(attempt int, wait time.Duration, err error) {
+		log.PrintfError("Failed to connect to database, retrying in %s. Attempt %d: %s", wait.Round(time.Millisecond), attempt, err)
+	})
 	if err != nil {
-		log.PrintfError("Could not set trusted proxies list")
-		return
+		if ctx.Err() != nil {
+			log.PrintfWarning("Received shutdown signal while connecting to the database")
+			shutdown(log, server, cancelRequests, checker, nil, nil, cfg)
+			return
+		}
+		panic(err)
 	}
 
-	router.RedirectFixedPath = true
-	router.RedirectTrailingSlash = true
+	if !cfg.DebugMode {
+		dbInst.SetLogMode(logger.Silent)
+	}
 
-	log.Printf("Frontend URL for cors: %s", cfg.FrontendURL)
+	if cfg.MigrateOnStart {
+		// a migration must not be interrupted halfway by a shutdown signal
+		applied, err := dbInst.Migrate(context.WithoutCancel(ctx))
+		if err != nil {
+			panic(err)
+		}
+		for _, migration := range applied {
+			log.Printf("Applied migration %d_%s", migration.Version, migration.Name)
+		}
+	}
 
-	router.Use(cors.CorsMiddleware(cors.Config{
-		AllowedOrigins:   strings.Split(cfg.FrontendURL, ", "),
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE"},
-		AllowedHeaders:   []string{"Authorization", "Content-Length", "Content-Type"},
-		ExposeHeaders:    []string{"Content-Length"},
-		AllowCredentials: true,
-		MaxAge:           12 * time.Hour,
-	}))
+	if err := dbInst.GetClient().Use(metrics.GormPlugin{}); err != nil {
+		panic(err)
+	}
 
-	router.Use(middleware.DatabaseMiddleware(dbInst.GetClient()))
-	router.Use(middleware.ConfigMiddleware(cfg))
-	router.Use(gin.Recovery())
+	if err := dbInst.GetClient().Use(tracing.GormPlugin{}); err != nil {
+		panic(err)
+	}
 
-	//register user endpoints
-	userEndpoints := router.Group("/user")
-	{
-		log.Printf("Registering user endpoints")
-		user.RegisterUserEndpoints(userEndpoints)
+	repos := repository.NewGormRepositories(dbInst.GetClient())
+
+	if err := metrics.RegisterSessionGauge(repos.Sessions); err != nil {
+		panic(err)
 	}
 
-	authEndpoints := router.Group("/auth")
-	{
-		log.Printf("Registering auth endpoints")
-		auth.RegisterAuthEndpoints(authEndpoints)
+	checker.SetDatabase(dbInst)
+
+	// settings that are read per request can be reloaded, long living loggers are updated by the listener below
+	runtime := common.NewRuntimeConfig(cfg, configFile)
+
+	var workers sync.WaitGroup
+
+	// failures once the server is up stop the workers, drain the server and exit with an error so a crash loop is noticed
+	fail := func(format string, args ...interface{}) {
+		log.PrintfError(format, args...)
+		stop()
+		shutdown(log, server, cancelRequests, checker, &workers, dbInst, cfg)
+		os.Exit(1)
 	}
 
-	chatEndpoints := router.Group("/chat")
-	{
-		log.Printf("Registering chat endpoints")
-		chat.RegisterChatEndpoints(chatEndpoints)
+	if cfg.RetentionInterval > 0 {
+		retentionWorker := retention.NewWorker(repos, cfg, store)
+		runtime.OnReload(func(cfg *common.Config) { retentionWorker.SetLogLevel(cfg.LogLevel) })
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			retentionWorker.Run(ctx)
+		}()
+	} else {
+		log.PrintfWarning("RETENTION_INTERVAL is 0, deleted accounts and expired messages are not purged")
 	}
 
-	log.Printf("Starting server on port %s", cfg.Port)
-	err = router.Run(":" + cfg.Port)
+	scanner, err := scanning.New(cfg)
 	if err != nil {
-		log.PrintfError("Failed to start server: %s", err)
-		return
+		fail("Could not set up the upload scanner: %s", err)
+	}
+
+	// jobs that are still running on shutdown are cancelled and put back into the queue
+	pool := jobs.NewPool(repos, cfg)
+
+	// exports and scans of confirmed uploads are queued by the requests and run by the pool
+	exports := export.NewBuilder(repos, cfg, store)
+	exports.Register(pool)
+	scans := scanning.NewRunner(repos, cfg, store, scanner)
+	scans.Register(pool)
+
+	// push notifications are delivered by the pool, the handlers are only registered if a platform is configured
+	var notifier *notify.Notifier
+	if cfg.PushEnabled() {
+		transports, err := notify.New(cfg)
+		if err != nil {
+			fail("Could not set up push notifications: %s", err)
+		}
+		notifier = notify.NewNotifier(repos, cfg, transports)
+		notifier.Register(pool)
 	}
+
+	if cfg.JobWorkers > 0 {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			pool.Run(ctx)
+		}()
+	} else {
+		log.PrintfWarning("JOB_WORKERS is 0, background jobs are not run on this instance")
+	}
+
+	runtime.OnReload(func(cfg *common.Config) {
+		log.SetLogLevel(cfg.LogLevel)
+		exports.SetLogLevel(cfg.LogLevel)
+		scans.SetLogLevel(cfg.LogLevel)
+		pool.SetLogLevel(cfg.LogLevel)
+		if notifier != nil {
+			notifier.SetLogLevel(cfg.LogLevel)
+		}
+	})
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		runtime.Watch(ctx, log)
+	}()
+
+	// closed once main returns, after the server was shut down and no request records events anymore
+	recorder, err := audit.NewRecorder(cfg.SecurityEventLogFile)
+	if err != nil {
+		fail("Could not set up the security event log: %s", err)
+	}
+	defer recorder.Close()
+
+	apiRouter, err := router.New(runtime, repos, checker, scans, recorder, store, log)
+	if err != nil {
+		fail("Could not set up the router: %s", err)
+	}
+
+	if cfg.MetricsAddr != "" {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("/metrics", metrics.Handler(cfg.MetricsToken))
+		metricsServer := &http.Server{
+			Addr:              cfg.MetricsAddr,
+			Handler:           metricsMux,
+			ReadHeaderTimeout: cfg.ServerReadHeaderTimeout,
+		}
+		server.RegisterOnShutdown(func() {
+			_ = metricsServer.Close()
+		})
+		go func() {
+			log.Printf("Serving metrics on %s", cfg.MetricsAddr)
+			if err := metricsServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.PrintfError("Metrics server stopped: %s", err)
+			}
+		}()
+	}
+
+	handler.Store(http.Handler(apiRouter))
+	checker.MarkReady()
+	log.Printf("Server is ready")
+
+	select {
+	case err := <-serverErr:
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fail("Failed to start server: %s", err)
+		}
+	case <-ctx.Done():
+		log.Printf("Received shutdown signal")
+		shutdown(log, server, cancelRequests, checker, &workers, dbInst, cfg)
+	}
+}
+
+// shutdown marks the process as not ready, drains in-flight requests and
+// hijacked connections registered via server.RegisterOnShutdown, waits for the background workers and closes the database pool.
+// Shutdown does not cancel the requests it waits for, cancelRequests cancels them once the timeout is hit.
+func shutdown(log *common.Logger, server *http.Server, cancelRequests context.CancelFunc, checker *health.Checker, workers *sync.WaitGroup, dbInst *database.DatabaseInst, cfg *common.Config) {
+	checker.MarkDraining()
+
+	// give load balancers a chance to observe the failing readiness probe before we stop accepting connections
+	time.Sleep(cfg.ShutdownDelay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		log.PrintfError("Failed to drain connections within %s: %s", cfg.ShutdownTimeout, err)
+		cancelRequests()
+		_ = server.Close()
+	}
+
+	// the workers stop on their own once the signal context is cancelled
+	if workers != nil {
+		workers.Wait()
+	}
+
+	if dbInst != nil {
+		if err := dbInst.Close(); err != nil {
+			log.PrintfError("Failed to close database connection: %s", err)
+		}
+	}
+
+	log.Printf("Server stopped")
 }
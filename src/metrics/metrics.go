@@ -0,0 +1,124 @@
+package metrics
+
+import (
+	"context"
+	"easyflow-backend/src/repository"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// Registry holds every collector exposed on /metrics.
+// A dedicated registry keeps third party packages from registering into our endpoint.
+var Registry = prometheus.NewRegistry()
+
+var (
+	HttpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "easyflow",
+		Name:      "http_requests_total",
+		Help:      "Number of handled http requests by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	HttpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "easyflow",
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of handled http requests by method and route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	DatabaseQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "easyflow",
+		Name:      "db_query_duration_seconds",
+		Help:      "Latency of database statements by operation and table.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"operation", "table", "status"})
+
+	RateLimitThrottled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "easyflow",
+		Name:      "rate_limit_throttled_total",
+		Help:      "Number of requests that exceeded their rate limit and were delayed before they were handled, by route.",
+	}, []string{"route"})
+
+	Logins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "easyflow",
+		Name:      "logins_total",
+		Help:      "Number of login attempts by result.",
+	}, []string{"result"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HttpRequests,
+		HttpRequestDuration,
+		DatabaseQueryDuration,
+		RateLimitThrottled,
+		Logins,
+	)
+}
+
+// sessionRefreshInterval is how long a counted number of sessions is reported before it is counted again
+const sessionRefreshInterval = 30 * time.Second
+
+// RegisterSessionGauge exposes the number of active sessions, meaning refresh tokens that are not expired yet.
+// The sessions are counted on a scrape at most every sessionRefreshInterval, a failed count skips the sample.
+func RegisterSessionGauge(sessions repository.SessionRepository) error {
+	return Registry.Register(newSessionCollector(sessions))
+}
+
+func newSessionCollector(sessions repository.SessionRepository) *sessionCollector {
+	return &sessionCollector{
+		sessions: sessions,
+		desc: prometheus.NewDesc(
+			"easyflow_active_sessions",
+			"Number of sessions with a refresh token that has not expired yet.",
+			nil, nil,
+		),
+		errors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "easyflow",
+			Name:      "active_sessions_errors_total",
+			Help:      "Number of failed counts of the active sessions.",
+		}),
+	}
+}
+
+// sessionCollector caches the count of the active sessions so frequent scrapes do not each query the database
+type sessionCollector struct {
+	sessions repository.SessionRepository
+	desc     *prometheus.Desc
+	errors   prometheus.Counter
+
+	mu        sync.Mutex
+	count     int64
+	countedAt time.Time
+}
+
+func (c *sessionCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+	c.errors.Describe(ch)
+}
+
+func (c *sessionCollector) Collect(ch chan<- prometheus.Metric) {
+	defer c.errors.Collect(ch)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Since(c.countedAt) >= sessionRefreshInterval {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		count, err := c.sessions.CountActive(ctx)
+		if err != nil {
+			c.errors.Inc()
+			return
+		}
+		c.count = count
+		c.countedAt = time.Now()
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(c.count))
+}
@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"context"
+	"easyflow-backend/src/repository"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// fakeSessions only implements CountActive, the collector needs nothing else
+type fakeSessions struct {
+	repository.SessionRepository
+	count int64
+	err   error
+	calls int
+}
+
+func (f *fakeSessions) CountActive(ctx context.Context) (int64, error) {
+	f.calls++
+	return f.count, f.err
+}
+
+// gather scrapes the collector and returns the sample of every metric by name
+func gather(t *testing.T, registry *prometheus.Registry) map[string]float64 {
+	t.Helper()
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("could not gather metrics: %s", err)
+	}
+
+	samples := map[string]float64{}
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			if metric.GetGauge() != nil {
+				samples[family.GetName()] = metric.GetGauge().GetValue()
+			} else {
+				samples[family.GetName()] = metric.GetCounter().GetValue()
+			}
+		}
+	}
+	return samples
+}
+
+func TestSessionCollectorCachesTheCount(t *testing.T) {
+	sessions := &fakeSessions{count: 3}
+	collector := newSessionCollector(sessions)
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collector)
+
+	if samples := gather(t, registry); samples["easyflow_active_sessions"] != 3 {
+		t.Fatalf("unexpected samples: %v", samples)
+	}
+
+	sessions.count = 5
+	if samples := gather(t, registry); samples["easyflow_active_sessions"] != 3 || sessions.calls != 1 {
+		t.Fatalf("the cached count was not reported: %v after %d counts", samples, sessions.calls)
+	}
+
+	collector.countedAt = time.Now().Add(-sessionRefreshInterval)
+	if samples := gather(t, registry); samples["easyflow_active_sessions"] != 5 || sessions.calls != 2 {
+		t.Fatalf("the count was not refreshed: %v after %d counts", samples, sessions.calls)
+	}
+}
+
+func TestSessionCollectorSkipsFailedCounts(t *testing.T) {
+	sessions := &fakeSessions{err: errors.New("database is down")}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(newSessionCollector(sessions))
+
+	samples := gather(t, registry)
+	if _, ok := samples["easyflow_active_sessions"]; ok {
+		t.Fatalf("a failed count was reported: %v", samples)
+	}
+	if samples["easyflow_active_sessions_errors_total"] != 1 {
+		t.Fatalf("the failed count was not counted: %v", samples)
+	}
+
+	// the next scrape tries again
+	sessions.err = nil
+	sessions.count = 2
+	if samples := gather(t, registry); samples["easyflow_active_sessions"] != 2 {
+		t.Fatalf("unexpected samples: %v", samples)
+	}
+}
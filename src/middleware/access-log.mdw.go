@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"easyflow-backend/src/common"
+	"math/rand/v2"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AccessLogMiddleware writes one line per request with the method, route template,
+// status, latency, response size, client ip and the authenticated user id.
+// Successful requests are sampled with cfg.AccessLogSampleRate, failed ones are always logged,
+// whatever the log level is.
+func AccessLogMiddleware(runtime *common.RuntimeConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cfg := runtime.Load()
+		if slices.Contains(cfg.AccessLogSkipPaths, c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+
+		start := time.Now()
+		c.Next()
+		latency := time.Since(start)
+
+		status := c.Writer.Status()
+		if status < 400 && cfg.AccessLogSampleRate < 1 && rand.Float64() >= cfg.AccessLogSampleRate {
+			return
+		}
+
+		route := c.FullPath()
+		if route == "" {
+			route = "<unmatched>"
+		}
+
+		userId := c.GetString("userId")
+		if userId == "" {
+			userId = "-"
+		}
+
+		// the volume is controlled by the sample rate and the skipped paths, LOG_LEVEL only applies to the app log
+		logger := common.NewLogger(os.Stdout, "Access", c, common.DEBUG)
+		format := "%s %s %d %s %dB user=%s"
+		args := []interface{}{c.Request.Method, route, status, latency, max(c.Writer.Size(), 0), userId}
+
+		switch {
+		case status >= 500:
+			logger.PrintfError(format, args...)
+		case status >= 400:
+			logger.PrintfWarning(format, args...)
+		default:
+			logger.PrintfInfo(format, args...)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+package middleware
+
+import (
+	"easyflow-backend/src/audit"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AuditMiddleware provides the security event recorder and attaches the client of the request
+// to the request context, so the services can record events without knowing about gin
+func AuditMiddleware(recorder *audit.Recorder) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("auditRecorder", recorder)
+		c.Request = c.Request.WithContext(audit.WithClient(c.Request.Context(), c.ClientIP(), c.Request.UserAgent()))
+		c.Next()
+	}
+}
@@ -6,9 +6,10 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func ConfigMiddleware(cfg *common.Config) gin.HandlerFunc {
+// ConfigMiddleware injects the current config, a request keeps its snapshot even if the config is reloaded meanwhile
+func ConfigMiddleware(runtime *common.RuntimeConfig) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		c.Set("config", cfg)
+		c.Set("config", runtime.Load())
 		c.Next()
 	}
 }
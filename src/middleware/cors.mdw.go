@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"easyflow-backend/src/common"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	cors "github.com/OnlyNico43/gin-cors"
+	"github.com/gin-gonic/gin"
+)
+
+type corsHandler struct {
+	origins []string
+	handler gin.HandlerFunc
+}
+
+// CorsMiddleware allows the origins in FRONTEND_URL with credentials,
+// the handler is rebuilt on the first request after the origins were reloaded.
+func CorsMiddleware(runtime *common.RuntimeConfig) gin.HandlerFunc {
+	var current atomic.Pointer[corsHandler]
+
+	return func(c *gin.Context) {
+		origins := runtime.Load().CorsOrigins()
+
+		h := current.Load()
+		if h == nil || !slices.Equal(h.origins, origins) {
+			h = &corsHandler{
+				origins: origins,
+				handler: cors.CorsMiddleware(cors.Config{
+					AllowedOrigins:   origins,
+					AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE"},
+					AllowedHeaders:   []string{"Authorization", "Content-Length", "Content-Type", "traceparent", "tracestate"},
+					ExposeHeaders:    []string{"Content-Length"},
+					AllowCredentials: true,
+					MaxAge:           12 * time.Hour,
+				}),
+			}
+			current.Store(h)
+		}
+
+		h.handler(c)
+	}
+}
@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"easyflow-backend/src/api"
+	"easyflow-backend/src/common"
+	"easyflow-backend/src/enum"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireFeature answers 404 unless the feature flag is enabled in the current config
+func RequireFeature(name string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if cfg, ok := c.Get("config"); ok && cfg.(*common.Config).FeatureEnabled(name) {
+			c.Next()
+			return
+		}
+
+		c.JSON(http.StatusNotFound, api.ApiError{
+			Code:  http.StatusNotFound,
+			Error: enum.NotFound,
+		})
+		c.Abort()
+	}
+}
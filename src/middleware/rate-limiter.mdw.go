@@ -1,6 +1,8 @@
 package middleware
 
 import (
+	"easyflow-backend/src/common"
+	"easyflow-backend/src/metrics"
 	"sync"
 	"time"
 
@@ -9,32 +11,55 @@ import (
 	"golang.org/x/time/rate"
 )
 
-var userLimiterMap = make(map[string]*rate.Limiter)
+type limiterKey struct {
+	scope           common.RateLimitScope
+	clientIPAddress string
+}
+
+var userLimiterMap = make(map[limiterKey]*rate.Limiter)
 var userLimiterMapMutex sync.Mutex
 
-// returns the rate limiter for the client IP address.
-func getUserLimiter(clientIPAddress string, limit float64, burst int) *rate.Limiter {
+// returns the rate limiter of the scope for the client IP address, an existing limiter is adjusted if the limits were reloaded.
+func getUserLimiter(scope common.RateLimitScope, clientIPAddress string, limit float64, burst int) *rate.Limiter {
 	userLimiterMapMutex.Lock()
 	defer userLimiterMapMutex.Unlock()
 
-	limiter, ok := userLimiterMap[clientIPAddress]
+	key := limiterKey{scope: scope, clientIPAddress: clientIPAddress}
+	limiter, ok := userLimiterMap[key]
 	if !ok {
 		limiter = rate.NewLimiter(rate.Limit(limit), burst)
-		userLimiterMap[clientIPAddress] = limiter
+		userLimiterMap[key] = limiter
+		return limiter
+	}
+
+	if limiter.Limit() != rate.Limit(limit) {
+		limiter.SetLimit(rate.Limit(limit))
+	}
+	if limiter.Burst() != burst {
+		limiter.SetBurst(burst)
 	}
 	return limiter
 }
 
-// RateLimiter is a middleware that limits the number of requests a client can make
-func RateLimiter(limit float64, burst int) gin.HandlerFunc {
+// RateLimiter is a middleware that limits the number of requests a client can make,
+// the limits of the scope are read from the current config on every request
+func RateLimiter(scope common.RateLimitScope) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		cfg := c.MustGet("config").(*common.Config)
+		if !cfg.RateLimitEnabled {
+			c.Next()
+			return
+		}
+
+		limit, burst := cfg.RateLimit(scope)
 		clientIPAddress := c.ClientIP()
 
-		limiter := getUserLimiter(clientIPAddress, limit, burst)
+		limiter := getUserLimiter(scope, clientIPAddress, limit, burst)
 		if limiter.Allow() {
 			c.Next()
 		} else {
-			time.Sleep(time.Duration(1/limit) * time.Second)
+			metrics.RateLimitThrottled.WithLabelValues(c.FullPath()).Inc()
+			time.Sleep(time.Duration(float64(time.Second) / limit))
 			c.Next()
 		}
 
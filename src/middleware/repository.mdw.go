@@ -0,0 +1,14 @@
+package middleware
+
+import (
+	"easyflow-backend/src/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RepositoryMiddleware(repos *repository.Repositories) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("repositories", repos)
+		c.Next()
+	}
+}
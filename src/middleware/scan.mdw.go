@@ -0,0 +1,14 @@
+package middleware
+
+import (
+	"easyflow-backend/src/scanning"
+
+	"github.com/gin-gonic/gin"
+)
+
+func ScanMiddleware(runner *scanning.Runner) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("scanRunner", runner)
+		c.Next()
+	}
+}
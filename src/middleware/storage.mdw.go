@@ -0,0 +1,14 @@
+package middleware
+
+import (
+	"easyflow-backend/src/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+func StorageMiddleware(store storage.ObjectStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("objectStore", store)
+		c.Next()
+	}
+}
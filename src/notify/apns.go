@@ -0,0 +1,141 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"easyflow-backend/src/database"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// apnsTokenLifetime is how long a provider token is reused, apple rejects tokens older than an hour and throttles frequent renewals
+const apnsTokenLifetime = 30 * time.Minute
+
+// apnsExpiration is how long apple keeps a notification for a device that is offline
+const apnsExpiration = 24 * time.Hour
+
+/*
+Apns sends notifications through the http/2 api of the apple push notification service with token based authentication.
+The alert has no content, the app localizes NEW_MESSAGE and may load the chat in a notification service extension.
+*/
+type Apns struct {
+	key    *ecdsa.PrivateKey
+	keyId  string
+	teamId string
+	topic  string
+	url    string
+	client *http.Client
+
+	mu       sync.Mutex
+	token    string
+	issuedAt time.Time
+}
+
+func NewApns(keyFile string, keyId string, teamId string, topic string, baseURL string, client *http.Client) (*Apns, error) {
+	raw, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := jwt.ParseECPrivateKeyFromPEM(raw)
+	if err != nil {
+		return nil, fmt.Errorf("the signing key is invalid: %w", err)
+	}
+
+	return &Apns{
+		key:    key,
+		keyId:  keyId,
+		teamId: teamId,
+		topic:  topic,
+		url:    strings.TrimSuffix(baseURL, "/"),
+		client: client,
+	}, nil
+}
+
+func (a *Apns) Send(ctx context.Context, device *database.PushDevice, notification Notification) error {
+	token, err := a.providerToken()
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(map[string]any{
+		"aps": map[string]any{
+			"alert":           map[string]string{"loc-key": "NEW_MESSAGE"},
+			"sound":           "default",
+			"thread-id":       notification.ChatId,
+			"mutable-content": 1,
+		},
+		"type":   notification.Type,
+		"chatId": notification.ChatId,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.url+"/3/device/"+url.PathEscape(device.Token), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("apns-topic", a.topic)
+	req.Header.Set("apns-push-type", "alert")
+	req.Header.Set("apns-priority", "10")
+	req.Header.Set("apns-expiration", fmt.Sprint(time.Now().Add(apnsExpiration).Unix()))
+
+	res, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	// a token of another app or environment is rejected with a reason instead of a status
+	if res.StatusCode == http.StatusBadRequest {
+		var reason struct {
+			Reason string `json:"reason"`
+		}
+		if json.NewDecoder(res.Body).Decode(&reason) == nil && (reason.Reason == "BadDeviceToken" || reason.Reason == "DeviceTokenNotForTopic") {
+			return ErrGone
+		}
+		return fmt.Errorf("push service answered %d: %s", res.StatusCode, reason.Reason)
+	}
+
+	return checkResponse(res, http.StatusGone)
+}
+
+/*
+Private function to return the cached provider token or to sign a new one
+*/
+func (a *Apns) providerToken() (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+	if a.token != "" && now.Sub(a.issuedAt) < apnsTokenLifetime {
+		return a.token, nil
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"iss": a.teamId,
+		"iat": now.Unix(),
+	})
+	token.Header["kid"] = a.keyId
+
+	signed, err := token.SignedString(a.key)
+	if err != nil {
+		return "", err
+	}
+
+	a.token = signed
+	a.issuedAt = now
+	return a.token, nil
+}
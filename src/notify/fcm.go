@@ -0,0 +1,172 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"easyflow-backend/src/database"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// fcmScope is the oauth scope of the access token that sends messages
+const fcmScope = "https://www.googleapis.com/auth/firebase.messaging"
+
+// serviceAccount is the part of the service account json of the firebase project that is needed to send
+type serviceAccount struct {
+	ProjectId   string `json:"project_id"`
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+/*
+Fcm sends notifications through the http v1 api of firebase cloud messaging. It signs in as the service account
+of the project and caches the access token until shortly before it expires.
+*/
+type Fcm struct {
+	account serviceAccount
+	key     *rsa.PrivateKey
+	url     string
+	client  *http.Client
+
+	mu          sync.Mutex
+	accessToken string
+	expiresAt   time.Time
+}
+
+func NewFcm(credentialsFile string, baseURL string, client *http.Client) (*Fcm, error) {
+	raw, err := os.ReadFile(credentialsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var account serviceAccount
+	if err := json.Unmarshal(raw, &account); err != nil {
+		return nil, fmt.Errorf("the credentials are not a service account json: %w", err)
+	}
+	if account.ProjectId == "" || account.ClientEmail == "" || account.PrivateKey == "" || account.TokenURI == "" {
+		return nil, errors.New("the service account json is missing project_id, client_email, private_key or token_uri")
+	}
+
+	key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(account.PrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("the private key of the service account is invalid: %w", err)
+	}
+
+	return &Fcm{account: account, key: key, url: strings.TrimSuffix(baseURL, "/"), client: client}, nil
+}
+
+func (f *Fcm) Send(ctx context.Context, device *database.PushDevice, notification Notification) error {
+	accessToken, err := f.token(ctx)
+	if err != nil {
+		return err
+	}
+
+	// data messages are handed to the app, it decides what to show
+	body, err := json.Marshal(map[string]any{
+		"message": map[string]any{
+			"token": device.Token,
+			"data": map[string]string{
+				"type":   notification.Type,
+				"chatId": notification.ChatId,
+			},
+			"android": map[string]any{"priority": "high"},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	endpoint := f.url + "/v1/projects/" + url.PathEscape(f.account.ProjectId) + "/messages:send"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	// the next attempt signs in again
+	if res.StatusCode == http.StatusUnauthorized {
+		f.mu.Lock()
+		f.accessToken = ""
+		f.mu.Unlock()
+	}
+
+	return checkResponse(res, http.StatusNotFound)
+}
+
+/*
+Private function to return the cached access token or to exchange a signed assertion for a new one
+*/
+func (f *Fcm) token(ctx context.Context) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+	if f.accessToken != "" && now.Before(f.expiresAt) {
+		return f.accessToken, nil
+	}
+
+	assertion, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   f.account.ClientEmail,
+		"scope": fcmScope,
+		"aud":   f.account.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}).SignedString(f.key)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.account.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := f.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if err := checkResponse(res); err != nil {
+		return "", fmt.Errorf("could not sign in as the service account: %w", err)
+	}
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return "", err
+	}
+	if body.AccessToken == "" {
+		return "", errors.New("the token endpoint returned no access token")
+	}
+
+	// the token is renewed a minute early so it does not expire during a send
+	f.accessToken = body.AccessToken
+	f.expiresAt = now.Add(time.Duration(body.ExpiresIn)*time.Second - time.Minute)
+	return f.accessToken, nil
+}
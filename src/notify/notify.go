@@ -0,0 +1,140 @@
+package notify
+
+import (
+	"context"
+	"easyflow-backend/src/common"
+	"easyflow-backend/src/jobs"
+	"easyflow-backend/src/repository"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// NewMessagePayload is enqueued with every message, the members to notify are looked up once the job runs
+type NewMessagePayload struct {
+	ChatId   string `json:"chatId"`
+	SenderId string `json:"senderId"`
+}
+
+// DeliveryPayload notifies a single device, every device is retried on its own
+type DeliveryPayload struct {
+	DeviceId string `json:"deviceId"`
+	ChatId   string `json:"chatId"`
+}
+
+var (
+	NewMessage = jobs.NewKind[NewMessagePayload]("push.new_message")
+	Delivery   = jobs.NewKind[DeliveryPayload]("push.delivery")
+)
+
+/*
+Notifier tells members about new messages in their chats while they are offline. Members that are seen within
+PUSH_ONLINE_WINDOW, the sender and members that muted the chat are skipped.
+*/
+type Notifier struct {
+	repos      *repository.Repositories
+	cfg        *common.Config
+	transports Transports
+	logger     *common.Logger
+}
+
+func NewNotifier(repos *repository.Repositories, cfg *common.Config, transports Transports) *Notifier {
+	return &Notifier{
+		repos:      repos,
+		cfg:        cfg,
+		transports: transports,
+		logger:     common.NewLogger(os.Stdout, "Push", nil, cfg.LogLevel),
+	}
+}
+
+// SetLogLevel changes the log level of the notifier after the config was reloaded
+func (n *Notifier) SetLogLevel(logLevel common.LogLevel) {
+	n.logger.SetLogLevel(logLevel)
+}
+
+// Register adds the handlers of the push jobs to the pool
+func (n *Notifier) Register(pool *jobs.Pool) {
+	jobs.Handle(pool, NewMessage, n.notifyMembers)
+	jobs.Handle(pool, Delivery, n.deliver)
+}
+
+/*
+Private function to enqueue a delivery for every device of the members that are notified
+*/
+func (n *Notifier) notifyMembers(ctx context.Context, payload NewMessagePayload) error {
+	members, err := n.repos.Chats.ListMembers(ctx, payload.ChatId)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var recipients []string
+	for _, member := range members {
+		if member.UserId == payload.SenderId || member.IsMuted(now) {
+			continue
+		}
+
+		user, err := n.repos.Users.GetById(ctx, member.UserId)
+		if errors.Is(err, repository.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if user.DisabledAt != nil || (user.LastSeenAt != nil && now.Sub(*user.LastSeenAt) < n.cfg.PushOnlineWindow) {
+			continue
+		}
+		recipients = append(recipients, user.Id)
+	}
+
+	devices, err := n.repos.Devices.ListByUsers(ctx, recipients)
+	if err != nil || len(devices) == 0 {
+		return err
+	}
+
+	// all deliveries are enqueued at once so a retry of this job does not notify a device twice
+	err = n.repos.Transaction(ctx, func(tx *repository.Repositories) error {
+		for _, device := range devices {
+			if _, err := Delivery.Enqueue(ctx, tx, DeliveryPayload{DeviceId: device.Id, ChatId: payload.ChatId}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	n.logger.PrintfDebug("Notifying %d devices of %d members about a message in chat %s", len(devices), len(recipients), payload.ChatId)
+	return nil
+}
+
+/*
+Private function to send the notification to the device, devices the push service no longer knows are removed
+*/
+func (n *Notifier) deliver(ctx context.Context, payload DeliveryPayload) error {
+	device, err := n.repos.Devices.GetById(ctx, payload.DeviceId)
+	if errors.Is(err, repository.ErrNotFound) {
+		// the device was removed since the delivery was enqueued
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	transport, ok := n.transports[device.Platform]
+	if !ok {
+		return jobs.Permanent(fmt.Errorf("push platform %s is not configured", device.Platform))
+	}
+
+	err = transport.Send(ctx, device, Notification{Type: TypeMessage, ChatId: payload.ChatId})
+	if errors.Is(err, ErrGone) {
+		n.logger.Printf("Removing push device %s of user %s, the push service no longer knows it", device.Id, device.UserId)
+		if err := n.repos.Devices.Delete(ctx, device.UserId, device.Id); err != nil && !errors.Is(err, repository.ErrNotFound) {
+			return err
+		}
+		return nil
+	}
+	return err
+}
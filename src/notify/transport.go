@@ -0,0 +1,85 @@
+package notify
+
+import (
+	"context"
+	"easyflow-backend/src/common"
+	"easyflow-backend/src/database"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// ErrGone is returned by a transport if the device unsubscribed or its token expired, the device is removed
+var ErrGone = errors.New("the push device is gone")
+
+// Notification is the payload of a push, it never contains message content
+type Notification struct {
+	Type   string `json:"type"`
+	ChatId string `json:"chatId"`
+}
+
+// TypeMessage is the type of the notification about a new message in a chat
+const TypeMessage = "message"
+
+/*
+Transport delivers notifications to the devices of one push platform. Send returns ErrGone if the
+push service no longer knows the device, other errors are retried.
+*/
+type Transport interface {
+	Send(ctx context.Context, device *database.PushDevice, notification Notification) error
+}
+
+// Transports maps every enabled push platform to its transport
+type Transports map[database.PushPlatform]Transport
+
+// New returns the transports of the push platforms whose credentials are configured
+func New(cfg *common.Config) (Transports, error) {
+	return NewWithClient(cfg, &http.Client{Timeout: cfg.PushTimeout})
+}
+
+// NewWithClient is like New but sends through client, e.g. one that trusts the certificate of a test server
+func NewWithClient(cfg *common.Config, client *http.Client) (Transports, error) {
+	transports := Transports{}
+
+	if cfg.PushPlatformEnabled(database.PushWeb) {
+		webPush, err := NewWebPush(cfg.PushVapidPrivateKey, cfg.PushVapidSubject, cfg.PushWebPushHosts, client)
+		if err != nil {
+			return nil, fmt.Errorf("could not set up web push: %w", err)
+		}
+		transports[database.PushWeb] = webPush
+	}
+	if cfg.PushPlatformEnabled(database.PushFCM) {
+		fcm, err := NewFcm(cfg.PushFcmCredentialsFile, cfg.PushFcmURL, client)
+		if err != nil {
+			return nil, fmt.Errorf("could not set up fcm: %w", err)
+		}
+		transports[database.PushFCM] = fcm
+	}
+	if cfg.PushPlatformEnabled(database.PushAPNs) {
+		apns, err := NewApns(cfg.PushApnsKeyFile, cfg.PushApnsKeyId, cfg.PushApnsTeamId, cfg.PushApnsTopic, cfg.PushApnsURL, client)
+		if err != nil {
+			return nil, fmt.Errorf("could not set up apns: %w", err)
+		}
+		transports[database.PushAPNs] = apns
+	}
+
+	return transports, nil
+}
+
+/*
+Private function to turn the response of a push service into an error, the statuses in gone mean the device is gone
+*/
+func checkResponse(res *http.Response, gone ...int) error {
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return nil
+	}
+	if slices.Contains(gone, res.StatusCode) {
+		return ErrGone
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+	return fmt.Errorf("push service answered %d: %s", res.StatusCode, strings.TrimSpace(string(body)))
+}
@@ -0,0 +1,281 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"easyflow-backend/src/database"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/hkdf"
+)
+
+// webPushRecordSize is the record size in the header of the encrypted body, the payload always fits into one record
+const webPushRecordSize = 4096
+
+// webPushTTL is how long the push service keeps a notification for a browser that is offline
+const webPushTTL = 24 * time.Hour
+
+/*
+WebPush sends notifications to the endpoints of browser push subscriptions. The payload is encrypted for the
+subscription (RFC 8291) and the server identifies itself with its VAPID key (RFC 8292).
+*/
+type WebPush struct {
+	key       *ecdsa.PrivateKey
+	publicKey string
+	subject   string
+	hosts     []string
+	client    *http.Client
+}
+
+func NewWebPush(privateKey string, subject string, hosts []string, client *http.Client) (*WebPush, error) {
+	key, err := parseVapidKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey, err := VapidPublicKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &WebPush{key: key, publicKey: publicKey, subject: subject, hosts: hosts, client: client}, nil
+}
+
+func (w *WebPush) Send(ctx context.Context, device *database.PushDevice, notification Notification) error {
+	if device.P256dh == nil || device.Auth == nil {
+		return errors.New("the subscription has no keys")
+	}
+
+	payload, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	body, err := encryptWebPush(payload, *device.P256dh, *device.Auth)
+	if err != nil {
+		return err
+	}
+
+	// the endpoint is checked again in case PUSH_WEBPUSH_HOSTS changed since the device was registered
+	endpoint, err := ValidateEndpoint(device.Token, w.hosts)
+	if err != nil {
+		return ErrGone
+	}
+
+	// the token is bound to the origin of the push service
+	token, err := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"aud": endpoint.Scheme + "://" + endpoint.Host,
+		"exp": time.Now().Add(12 * time.Hour).Unix(),
+		"sub": w.subject,
+	}).SignedString(w.key)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, device.Token, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("vapid t=%s, k=%s", token, w.publicKey))
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", fmt.Sprint(int(webPushTTL.Seconds())))
+	req.Header.Set("Urgency", "high")
+
+	res, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	return checkResponse(res, http.StatusNotFound, http.StatusGone)
+}
+
+// VapidPublicKey returns the application server key browsers subscribe with, base64url encoded
+func VapidPublicKey(privateKey string) (string, error) {
+	key, err := decodeVapidKey(privateKey)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(key.PublicKey().Bytes()), nil
+}
+
+// GenerateVapidKey returns a new VAPID private key and its public key, both base64url encoded
+func GenerateVapidKey() (string, string, error) {
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(key.Bytes()), base64.RawURLEncoding.EncodeToString(key.PublicKey().Bytes()), nil
+}
+
+/*
+ValidateEndpoint parses the endpoint of a browser push subscription, the server posts to it so only https
+endpoints on the push services in hosts or their subdomains are accepted
+*/
+func ValidateEndpoint(endpoint string, hosts []string) (*url.URL, error) {
+	parsed, err := url.Parse(endpoint)
+	if err != nil || parsed.Scheme != "https" || parsed.User != nil || parsed.Hostname() == "" {
+		return nil, errors.New("the endpoint has to be an https url")
+	}
+
+	host := strings.ToLower(parsed.Hostname())
+	for _, allowed := range hosts {
+		allowed = strings.ToLower(allowed)
+		if host == allowed || strings.HasSuffix(host, "."+allowed) {
+			return parsed, nil
+		}
+	}
+	return nil, fmt.Errorf("%s is not a known push service", host)
+}
+
+// ValidateSubscription checks the keys of a browser push subscription, p256dh is a P-256 point and auth a 16 byte secret
+func ValidateSubscription(p256dh string, auth string) error {
+	public, err := base64.RawURLEncoding.DecodeString(p256dh)
+	if err != nil {
+		return errors.New("p256dh is not base64url encoded")
+	}
+	if _, err := ecdh.P256().NewPublicKey(public); err != nil {
+		return errors.New("p256dh is not an uncompressed P-256 point")
+	}
+
+	secret, err := base64.RawURLEncoding.DecodeString(auth)
+	if err != nil || len(secret) != 16 {
+		return errors.New("auth is not a base64url encoded 16 byte secret")
+	}
+	return nil
+}
+
+/*
+Private function to decode the raw private scalar of PUSH_VAPID_PRIVATE_KEY
+*/
+func decodeVapidKey(privateKey string) (*ecdh.PrivateKey, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("the vapid key is not base64url encoded: %w", err)
+	}
+	return ecdh.P256().NewPrivateKey(raw)
+}
+
+/*
+Private function to turn the vapid key into the ecdsa key that signs the tokens
+*/
+func parseVapidKey(privateKey string) (*ecdsa.PrivateKey, error) {
+	key, err := decodeVapidKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// the uncompressed point is 0x04 followed by x and y
+	point := key.PublicKey().Bytes()
+	return &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(point[1:33]),
+			Y:     new(big.Int).SetBytes(point[33:]),
+		},
+		D: new(big.Int).SetBytes(key.Bytes()),
+	}, nil
+}
+
+/*
+Private function to encrypt the payload for the subscription with a new ephemeral key and salt
+*/
+func encryptWebPush(plaintext []byte, p256dh string, auth string) ([]byte, error) {
+	public, err := base64.RawURLEncoding.DecodeString(p256dh)
+	if err != nil {
+		return nil, err
+	}
+	subscriber, err := ecdh.P256().NewPublicKey(public)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := base64.RawURLEncoding.DecodeString(auth)
+	if err != nil {
+		return nil, err
+	}
+
+	ephemeral, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	return encryptAes128gcm(plaintext, subscriber, secret, ephemeral, salt)
+}
+
+/*
+Private function implementing the aes128gcm content coding of RFC 8291, the body is a single record
+*/
+func encryptAes128gcm(plaintext []byte, subscriber *ecdh.PublicKey, authSecret []byte, ephemeral *ecdh.PrivateKey, salt []byte) ([]byte, error) {
+	shared, err := ephemeral.ECDH(subscriber)
+	if err != nil {
+		return nil, err
+	}
+	serverPublic := ephemeral.PublicKey().Bytes()
+
+	keyInfo := append([]byte("WebPush: info\x00"), subscriber.Bytes()...)
+	keyInfo = append(keyInfo, serverPublic...)
+	ikm, err := expand(hkdf.Extract(sha256.New, shared, authSecret), keyInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	prk := hkdf.Extract(sha256.New, ikm, salt)
+	cek, err := expand(prk, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := expand(prk, []byte("Content-Encoding: nonce\x00"), 12)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	// the header holds the salt, the record size and the key of the server, 0x02 marks the last record
+	header := make([]byte, 0, 21+len(serverPublic))
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, webPushRecordSize)
+	header = append(header, byte(len(serverPublic)))
+	header = append(header, serverPublic...)
+
+	return gcm.Seal(header, nonce, append(plaintext, 0x02), nil), nil
+}
+
+func expand(prk []byte, info []byte, length int) ([]byte, error) {
+	out := make([]byte, length)
+	if _, err := io.ReadFull(hkdf.Expand(sha256.New, prk, info), out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
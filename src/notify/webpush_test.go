@@ -0,0 +1,153 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"easyflow-backend/src/database"
+	"encoding/base64"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func decode(t *testing.T, value string) []byte {
+	t.Helper()
+
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		t.Fatalf("could not decode %q: %s", value, err)
+	}
+	return raw
+}
+
+// the example of RFC 8291 section 5
+func TestEncryptAes128gcm(t *testing.T) {
+	ephemeral, err := ecdh.P256().NewPrivateKey(decode(t, "yfWPiYE-n46HLnH0KqZOF1fJJU3MYrct3AELtAQ-oRw"))
+	if err != nil {
+		t.Fatalf("invalid server key: %s", err)
+	}
+	subscriber, err := ecdh.P256().NewPublicKey(decode(t, "BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4"))
+	if err != nil {
+		t.Fatalf("invalid subscriber key: %s", err)
+	}
+
+	body, err := encryptAes128gcm(
+		[]byte("When I grow up, I want to be a watermelon"),
+		subscriber,
+		decode(t, "BTBZMqHH6r4Tts7J_aSIgg"),
+		ephemeral,
+		decode(t, "DGv6ra1nlYgDCS1FRnbzlw"),
+	)
+	if err != nil {
+		t.Fatalf("could not encrypt: %s", err)
+	}
+
+	expected := "DGv6ra1nlYgDCS1FRnbzlwAAEABBBP4z9KsN6nGRTbVYI_c7VJSPQTBtkgcy27mlmlMoZIIgDll6e3vCYLocInmYWAmS6TlzAC8wEqKK6PBru3jl7A_yl95bQpu6cVPTpK4Mqgkf1CXztLVBSt2Ks3oZwbuwXPXLWyouBWLVWGNWQexSgSxsj_Qulcy4a-fN"
+	if encoded := base64.RawURLEncoding.EncodeToString(body); encoded != expected {
+		t.Fatalf("expected %s, got %s", expected, encoded)
+	}
+}
+
+func TestWebPushSend(t *testing.T) {
+	privateKey, publicKey, err := GenerateVapidKey()
+	if err != nil {
+		t.Fatalf("could not generate vapid key: %s", err)
+	}
+	subscriber, err := ecdh.P256().NewPrivateKey(decode(t, "q1dXpw3UpT5VOmu_cf_v6ih07Aems3njxI-JWgLcM94"))
+	if err != nil {
+		t.Fatalf("invalid subscriber key: %s", err)
+	}
+	p256dh := base64.RawURLEncoding.EncodeToString(subscriber.PublicKey().Bytes())
+	auth := "BTBZMqHH6r4Tts7J_aSIgg"
+
+	var request *http.Request
+	var body []byte
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request = r
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	endpoint, _ := url.Parse(server.URL)
+	webPush, err := NewWebPush(privateKey, "mailto:admin@example.com", []string{endpoint.Hostname()}, server.Client())
+	if err != nil {
+		t.Fatalf("could not create web push: %s", err)
+	}
+
+	device := &database.PushDevice{Token: server.URL + "/push/device", P256dh: &p256dh, Auth: &auth}
+	if err := webPush.Send(context.Background(), device, Notification{Type: TypeMessage, ChatId: "chat"}); err != nil {
+		t.Fatalf("could not send: %s", err)
+	}
+
+	if request.Header.Get("Content-Encoding") != "aes128gcm" {
+		t.Fatalf("unexpected content encoding %q", request.Header.Get("Content-Encoding"))
+	}
+
+	// the token is signed with the vapid key and bound to the origin of the endpoint
+	authorization := request.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, "vapid t=") || !strings.HasSuffix(authorization, ", k="+publicKey) {
+		t.Fatalf("unexpected authorization %q", authorization)
+	}
+	signed := strings.TrimSuffix(strings.TrimPrefix(authorization, "vapid t="), ", k="+publicKey)
+
+	point := decode(t, publicKey)
+	verifier := &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(point[1:33]),
+		Y:     new(big.Int).SetBytes(point[33:]),
+	}
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(signed, claims, func(*jwt.Token) (any, error) { return verifier, nil }, jwt.WithValidMethods([]string{"ES256"})); err != nil {
+		t.Fatalf("the token does not verify with the public key: %s", err)
+	}
+	if claims["aud"] != "https://"+endpoint.Host || claims["sub"] != "mailto:admin@example.com" {
+		t.Fatalf("unexpected claims %v", claims)
+	}
+
+	// the body carries the salt, the record size and the ephemeral key in its header
+	if len(body) < 86 || body[20] != 65 {
+		t.Fatalf("unexpected body header %x", body)
+	}
+	if bytes.Contains(body, []byte("chatId")) {
+		t.Fatalf("the payload was sent in plain text")
+	}
+}
+
+func TestValidateEndpoint(t *testing.T) {
+	hosts := []string{"fcm.googleapis.com", "push.services.mozilla.com"}
+
+	tests := []struct {
+		name     string
+		endpoint string
+		valid    bool
+	}{
+		{"known host", "https://fcm.googleapis.com/fcm/send/abc", true},
+		{"subdomain", "https://updates.push.services.mozilla.com/wpush/v2/abc", true},
+		{"upper case host", "https://FCM.googleapis.com/fcm/send/abc", true},
+		{"http", "http://fcm.googleapis.com/fcm/send/abc", false},
+		{"unknown host", "https://169.254.169.254/latest/meta-data", false},
+		{"suffix without dot", "https://evilfcm.googleapis.com.attacker.test/", false},
+		{"lookalike suffix", "https://attackerfcm.googleapis.com/", false},
+		{"user info", "https://user@fcm.googleapis.com/fcm/send/abc", false},
+		{"no host", "https:///fcm/send/abc", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ValidateEndpoint(test.endpoint, hosts)
+			if (err == nil) != test.valid {
+				t.Fatalf("expected valid %t, got %v", test.valid, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,761 @@
+package repository
+
+import (
+	"context"
+	"easyflow-backend/src/database"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// NewGormRepositories returns repositories that are backed by db.
+func NewGormRepositories(db *gorm.DB) *Repositories {
+	return &Repositories{
+		Users:       &gormUserRepository{db: db},
+		Chats:       &gormChatRepository{db: db},
+		Messages:    &gormMessageRepository{db: db},
+		Sessions:    &gormSessionRepository{db: db},
+		Exports:     &gormExportRepository{db: db},
+		AdminAudit:  &gormAdminAuditRepository{db: db},
+		Security:    &gormSecurityEventRepository{db: db},
+		Attachments: &gormAttachmentRepository{db: db},
+		Jobs:        &gormJobRepository{db: db},
+		Devices:     &gormPushDeviceRepository{db: db},
+		transaction: func(ctx context.Context, fn func(repos *Repositories) error) error {
+			return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+				return fn(NewGormRepositories(tx))
+			})
+		},
+	}
+}
+
+func translateError(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// updateColumns writes only the given columns of the record, so concurrent changes to its other columns are kept
+func updateColumns(ctx context.Context, db *gorm.DB, model any, id string, columns map[string]any) error {
+	result := db.WithContext(ctx).Model(model).Where("id = ?", id).Updates(columns)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// updateColumnsIf is updateColumns for a row whose column still holds the expected value, ErrNotFound is returned otherwise
+func updateColumnsIf(ctx context.Context, db *gorm.DB, model any, id string, column string, expected any, columns map[string]any) error {
+	result := db.WithContext(ctx).Model(model).Where("id = ?", id).Where(column+" = ?", expected).Updates(columns)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type gormUserRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormUserRepository) Create(ctx context.Context, user *database.User) error {
+	return r.db.WithContext(ctx).Create(user).Error
+}
+
+func (r *gormUserRepository) GetById(ctx context.Context, id string) (*database.User, error) {
+	var user database.User
+	if err := r.db.WithContext(ctx).First(&user, "id = ?", id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &user, nil
+}
+
+func (r *gormUserRepository) GetByEmail(ctx context.Context, email string) (*database.User, error) {
+	var user database.User
+	if err := r.db.WithContext(ctx).First(&user, "email = ?", email).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &user, nil
+}
+
+func (r *gormUserRepository) ExistsByEmail(ctx context.Context, email string) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Unscoped().Model(&database.User{}).Where("email = ?", email).Count(&count).Error
+	return count > 0, err
+}
+
+func (r *gormUserRepository) UpdateProfile(ctx context.Context, id string, name string, bio *string) error {
+	return updateColumns(ctx, r.db, &database.User{}, id, map[string]any{"name": name, "bio": bio})
+}
+
+func (r *gormUserRepository) SetRole(ctx context.Context, id string, role database.UserRole) error {
+	return updateColumns(ctx, r.db, &database.User{}, id, map[string]any{"role": role})
+}
+
+func (r *gormUserRepository) SetPictureUpload(ctx context.Context, id string, uploadKey string) error {
+	return updateColumns(ctx, r.db, &database.User{}, id, map[string]any{"picture_upload": uploadKey})
+}
+
+func (r *gormUserRepository) SetPendingPicture(ctx context.Context, id string, uploadKey string, key string) error {
+	return updateColumnsIf(ctx, r.db, &database.User{}, id, "picture_upload", uploadKey, map[string]any{
+		"picture_upload":  nil,
+		"picture_pending": key,
+		"picture_scan":    database.ScanPending,
+	})
+}
+
+func (r *gormUserRepository) PublishPicture(ctx context.Context, id string, key string, version time.Time) error {
+	return updateColumnsIf(ctx, r.db, &database.User{}, id, "picture_pending", key, map[string]any{
+		"picture_key":     key,
+		"picture_version": version,
+		"picture_pending": nil,
+		"picture_scan":    database.ScanClean,
+	})
+}
+
+func (r *gormUserRepository) RejectPicture(ctx context.Context, id string, key string) error {
+	return updateColumnsIf(ctx, r.db, &database.User{}, id, "picture_pending", key, map[string]any{
+		"picture_pending": nil,
+		"picture_scan":    database.ScanQuarantined,
+	})
+}
+
+func (r *gormUserRepository) MarkSeen(ctx context.Context, id string, at time.Time) error {
+	return r.db.WithContext(ctx).Model(&database.User{}).Where("id = ?", id).UpdateColumn("last_seen_at", at).Error
+}
+
+func (r *gormUserRepository) Delete(ctx context.Context, id string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&database.User{}, "id = ?", id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+
+		if err := tx.Delete(&database.ChatUserKeys{}, "user_id = ?", id).Error; err != nil {
+			return err
+		}
+
+		// a deleted account gets no push notifications
+		if err := tx.Delete(&database.PushDevice{}, "user_id = ?", id).Error; err != nil {
+			return err
+		}
+
+		return tx.Delete(&database.UserKeys{}, "user_id = ?", id).Error
+	})
+}
+
+func (r *gormUserRepository) ListDeleted(ctx context.Context, before time.Time) ([]database.User, error) {
+	var users []database.User
+	if err := r.db.WithContext(ctx).Unscoped().Where("deleted_at < ?", before).Order("deleted_at asc").Find(&users).Error; err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (r *gormUserRepository) Search(ctx context.Context, query string, limit int, offset int) ([]database.User, error) {
+	var users []database.User
+	pattern := containsPattern(query)
+	err := r.db.WithContext(ctx).
+		Where("LOWER(email) LIKE ? OR LOWER(name) LIKE ?", pattern, pattern).
+		Order("created_at desc").
+		Limit(limit).
+		Offset(offset).
+		Find(&users).Error
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (r *gormUserRepository) SetDisabled(ctx context.Context, id string, disabled bool) error {
+	var disabledAt *time.Time
+	if disabled {
+		now := time.Now()
+		disabledAt = &now
+	}
+
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&database.User{}).Where("id = ?", id).Update("disabled_at", disabledAt)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+
+		if !disabled {
+			return nil
+		}
+		return tx.Delete(&database.UserKeys{}, "user_id = ?", id).Error
+	})
+}
+
+func (r *gormUserRepository) Purge(ctx context.Context, id string, purgeMessages bool) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if purgeMessages {
+			if err := tx.Where("sender_id = ?", id).Delete(&database.Message{}).Error; err != nil {
+				return err
+			}
+		}
+
+		// memberships, sessions and exports follow through ON DELETE CASCADE, remaining messages through ON DELETE SET NULL
+		result := tx.Unscoped().Delete(&database.User{}, "id = ?", id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+// containsPattern returns a LIKE pattern for a case insensitive substring match,
+// wildcards in query are dropped because the dialects do not agree on an escape character
+func containsPattern(query string) string {
+	query = strings.NewReplacer("%", "", "_", "").Replace(strings.ToLower(query))
+	return "%" + query + "%"
+}
+
+type gormChatRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormChatRepository) Create(ctx context.Context, chat *database.Chat) error {
+	return r.db.WithContext(ctx).Create(chat).Error
+}
+
+func (r *gormChatRepository) GetById(ctx context.Context, id string) (*database.Chat, error) {
+	var chat database.Chat
+	if err := r.db.WithContext(ctx).First(&chat, "id = ?", id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &chat, nil
+}
+
+func (r *gormChatRepository) SetPictureUpload(ctx context.Context, id string, uploadKey string) error {
+	return updateColumns(ctx, r.db, &database.Chat{}, id, map[string]any{"picture_upload": uploadKey})
+}
+
+func (r *gormChatRepository) SetPendingPicture(ctx context.Context, id string, uploadKey string, key string) error {
+	return updateColumnsIf(ctx, r.db, &database.Chat{}, id, "picture_upload", uploadKey, map[string]any{
+		"picture_upload":  nil,
+		"picture_pending": key,
+		"picture_scan":    database.ScanPending,
+	})
+}
+
+func (r *gormChatRepository) PublishPicture(ctx context.Context, id string, key string, version time.Time) error {
+	return updateColumnsIf(ctx, r.db, &database.Chat{}, id, "picture_pending", key, map[string]any{
+		"picture_key":     key,
+		"picture_version": version,
+		"picture_pending": nil,
+		"picture_scan":    database.ScanClean,
+	})
+}
+
+func (r *gormChatRepository) RejectPicture(ctx context.Context, id string, key string) error {
+	return updateColumnsIf(ctx, r.db, &database.Chat{}, id, "picture_pending", key, map[string]any{
+		"picture_pending": nil,
+		"picture_scan":    database.ScanQuarantined,
+	})
+}
+
+func (r *gormChatRepository) AddMember(ctx context.Context, member *database.ChatUserKeys) error {
+	return r.db.WithContext(ctx).Omit("Chat", "User").Create(member).Error
+}
+
+func (r *gormChatRepository) GetMember(ctx context.Context, chatId string, userId string) (*database.ChatUserKeys, error) {
+	var member database.ChatUserKeys
+	if err := r.db.WithContext(ctx).First(&member, "chat_id = ? AND user_id = ?", chatId, userId).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &member, nil
+}
+
+func (r *gormChatRepository) SetMute(ctx context.Context, memberId string, muted bool, until *time.Time) error {
+	return updateColumns(ctx, r.db, &database.ChatUserKeys{}, memberId, map[string]any{"muted": muted, "mute_until": until})
+}
+
+func (r *gormChatRepository) ListMembers(ctx context.Context, chatId string) ([]database.ChatUserKeys, error) {
+	var members []database.ChatUserKeys
+	if err := r.db.WithContext(ctx).Where("chat_id = ?", chatId).Order("created_at asc").Find(&members).Error; err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+func (r *gormChatRepository) ListMembershipsOfUser(ctx context.Context, userId string) ([]database.ChatUserKeys, error) {
+	var memberships []database.ChatUserKeys
+	if err := r.db.WithContext(ctx).Where("user_id = ?", userId).Order("created_at asc").Find(&memberships).Error; err != nil {
+		return nil, err
+	}
+	return memberships, nil
+}
+
+func (r *gormChatRepository) ListWithMessageRetention(ctx context.Context) ([]database.Chat, error) {
+	var chats []database.Chat
+	if err := r.db.WithContext(ctx).Where("message_retention_days IS NOT NULL").Find(&chats).Error; err != nil {
+		return nil, err
+	}
+	return chats, nil
+}
+
+func (r *gormChatRepository) Search(ctx context.Context, query string, limit int, offset int) ([]database.Chat, error) {
+	var chats []database.Chat
+	err := r.db.WithContext(ctx).
+		Where("LOWER(name) LIKE ?", containsPattern(query)).
+		Order("created_at desc").
+		Limit(limit).
+		Offset(offset).
+		Find(&chats).Error
+	if err != nil {
+		return nil, err
+	}
+	return chats, nil
+}
+
+func (r *gormChatRepository) CountMembers(ctx context.Context, chatIds []string) (map[string]int64, error) {
+	var rows []struct {
+		ChatId string
+		Count  int64
+	}
+	err := r.db.WithContext(ctx).Model(&database.ChatUserKeys{}).
+		Select("chat_id, COUNT(*) AS count").
+		Where("chat_id IN ?", chatIds).
+		Group("chat_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.ChatId] = row.Count
+	}
+	return counts, nil
+}
+
+func (r *gormChatRepository) Purge(ctx context.Context, id string) error {
+	// memberships and messages follow through ON DELETE CASCADE
+	result := r.db.WithContext(ctx).Delete(&database.Chat{}, "id = ?", id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type gormMessageRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormMessageRepository) Create(ctx context.Context, message *database.Message) error {
+	return r.db.WithContext(ctx).Omit("Chat", "Sender").Create(message).Error
+}
+
+func (r *gormMessageRepository) ListByChat(ctx context.Context, chatId string, limit int) ([]database.Message, error) {
+	var messages []database.Message
+	if err := r.db.WithContext(ctx).Where("chat_id = ?", chatId).Order("created_at desc").Limit(limit).Find(&messages).Error; err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+func (r *gormMessageRepository) GetLatest(ctx context.Context, chatId string) (*database.Message, error) {
+	var message database.Message
+	if err := r.db.WithContext(ctx).Where("chat_id = ?", chatId).Order("created_at desc").First(&message).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &message, nil
+}
+
+func (r *gormMessageRepository) ListBySender(ctx context.Context, senderId string) ([]database.Message, error) {
+	var messages []database.Message
+	if err := r.db.WithContext(ctx).Where("sender_id = ?", senderId).Order("created_at asc").Find(&messages).Error; err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+func (r *gormMessageRepository) DeleteOlderThan(ctx context.Context, chatId string, before time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Where("chat_id = ? AND created_at < ?", chatId, before).Delete(&database.Message{})
+	return result.RowsAffected, result.Error
+}
+
+type gormSessionRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormSessionRepository) Create(ctx context.Context, session *database.UserKeys) error {
+	return r.db.WithContext(ctx).Omit("User").Create(session).Error
+}
+
+func (r *gormSessionRepository) Get(ctx context.Context, userId string, random string) (*database.UserKeys, error) {
+	var session database.UserKeys
+	if err := r.db.WithContext(ctx).First(&session, "user_id = ? AND random = ?", userId, random).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &session, nil
+}
+
+func (r *gormSessionRepository) Rotate(ctx context.Context, userId string, random string, newRandom string, expiresAt time.Time) error {
+	result := r.db.WithContext(ctx).Model(&database.UserKeys{}).
+		Where("user_id = ? AND random = ?", userId, random).
+		Updates(map[string]interface{}{"random": newRandom, "expired_at": expiresAt})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *gormSessionRepository) Delete(ctx context.Context, userId string, random string) error {
+	result := r.db.WithContext(ctx).Delete(&database.UserKeys{}, "user_id = ? AND random = ?", userId, random)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *gormSessionRepository) CountActive(ctx context.Context) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&database.UserKeys{}).Where("expired_at > ?", time.Now()).Count(&count).Error
+	return count, err
+}
+
+func (r *gormSessionRepository) ListActiveByUser(ctx context.Context, userId string) ([]database.UserKeys, error) {
+	var sessions []database.UserKeys
+	if err := r.db.WithContext(ctx).Where("user_id = ? AND expired_at > ?", userId, time.Now()).Order("created_at asc").Find(&sessions).Error; err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+type gormExportRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormExportRepository) Create(ctx context.Context, export *database.DataExport) error {
+	return r.db.WithContext(ctx).Omit("User").Create(export).Error
+}
+
+func (r *gormExportRepository) GetByUser(ctx context.Context, userId string, id string) (*database.DataExport, error) {
+	var export database.DataExport
+	if err := r.db.WithContext(ctx).First(&export, "id = ? AND user_id = ?", id, userId).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &export, nil
+}
+
+func (r *gormExportRepository) GetUnfinishedByUser(ctx context.Context, userId string) (*database.DataExport, error) {
+	var export database.DataExport
+	err := r.db.WithContext(ctx).
+		Where("user_id = ? AND status IN ?", userId, []database.ExportStatus{database.ExportPending, database.ExportRunning}).
+		Order("created_at desc").
+		First(&export).Error
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &export, nil
+}
+
+func (r *gormExportRepository) ListByUser(ctx context.Context, userId string) ([]database.DataExport, error) {
+	var exports []database.DataExport
+	if err := r.db.WithContext(ctx).Where("user_id = ?", userId).Order("created_at asc").Find(&exports).Error; err != nil {
+		return nil, err
+	}
+	return exports, nil
+}
+
+func (r *gormExportRepository) Update(ctx context.Context, export *database.DataExport) error {
+	return r.db.WithContext(ctx).Omit("User").Save(export).Error
+}
+
+type gormAdminAuditRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormAdminAuditRepository) Create(ctx context.Context, entry *database.AdminAuditLog) error {
+	return r.db.WithContext(ctx).Create(entry).Error
+}
+
+func (r *gormAdminAuditRepository) List(ctx context.Context, since time.Time, until time.Time, limit int) ([]database.AdminAuditLog, error) {
+	var entries []database.AdminAuditLog
+	query := r.db.WithContext(ctx).Where("created_at >= ? AND created_at < ?", since, until).Order("created_at asc")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if err := query.Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+type gormSecurityEventRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormSecurityEventRepository) Create(ctx context.Context, event *database.SecurityEvent) error {
+	return r.db.WithContext(ctx).Create(event).Error
+}
+
+func (r *gormSecurityEventRepository) ListByUser(ctx context.Context, userId string, limit int, offset int) ([]database.SecurityEvent, error) {
+	var events []database.SecurityEvent
+	err := r.db.WithContext(ctx).
+		Where("user_id = ?", userId).
+		Order("created_at desc").
+		Limit(limit).
+		Offset(offset).
+		Find(&events).Error
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+type gormAttachmentRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormAttachmentRepository) Create(ctx context.Context, attachment *database.Attachment) error {
+	return r.db.WithContext(ctx).Create(attachment).Error
+}
+
+func (r *gormAttachmentRepository) GetById(ctx context.Context, chatId string, id string) (*database.Attachment, error) {
+	var attachment database.Attachment
+	if err := r.db.WithContext(ctx).First(&attachment, "id = ? AND chat_id = ?", id, chatId).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &attachment, nil
+}
+
+func (r *gormAttachmentRepository) AttachToMessage(ctx context.Context, ids []string, messageId string) error {
+	// a repeated id matches only one row
+	ids = slices.Compact(slices.Sorted(slices.Values(ids)))
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&database.Attachment{}).
+			Where("id IN ? AND message_id IS NULL", ids).
+			Update("message_id", messageId)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != int64(len(ids)) {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+func (r *gormAttachmentRepository) SetScanStatus(ctx context.Context, ids []string, status database.ScanStatus) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).Model(&database.Attachment{}).Where("id IN ?", ids).Update("scan_status", status).Error
+}
+
+func (r *gormAttachmentRepository) ListByMessages(ctx context.Context, messageIds []string) ([]database.Attachment, error) {
+	var attachments []database.Attachment
+	if len(messageIds) == 0 {
+		return attachments, nil
+	}
+	if err := r.db.WithContext(ctx).Where("message_id IN ?", messageIds).Order("created_at asc").Find(&attachments).Error; err != nil {
+		return nil, err
+	}
+	return attachments, nil
+}
+
+func (r *gormAttachmentRepository) ListOlderThan(ctx context.Context, chatId string, before time.Time) ([]database.Attachment, error) {
+	var attachments []database.Attachment
+	expired := r.db.Model(&database.Message{}).Select("id").Where("chat_id = ? AND created_at < ?", chatId, before)
+	if err := r.db.WithContext(ctx).Where("message_id IN (?)", expired).Order("created_at asc").Find(&attachments).Error; err != nil {
+		return nil, err
+	}
+	return attachments, nil
+}
+
+type gormJobRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormJobRepository) Create(ctx context.Context, job *database.Job) error {
+	return r.db.WithContext(ctx).Create(job).Error
+}
+
+// leaseAttempts bounds how often Lease looks for another job after other workers claimed the candidates
+const leaseAttempts = 3
+
+func (r *gormJobRepository) Lease(ctx context.Context, types []string, token string, until time.Time, maxAttempts int) (*database.Job, error) {
+	now := time.Now()
+	for range leaseAttempts {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		var job database.Job
+		err := r.db.WithContext(ctx).
+			Where("type IN ? AND ((status = ? AND run_at <= ?) OR (status = ? AND leased_until <= ?))", types, database.JobQueued, now, database.JobRunning, now).
+			Order("run_at asc").
+			First(&job).Error
+		if err != nil {
+			return nil, translateError(err)
+		}
+
+		// a job whose lease ran out on its last attempt took its worker down, it is not run again
+		updates := map[string]any{
+			"status":       database.JobRunning,
+			"attempts":     job.Attempts + 1,
+			"lease_token":  token,
+			"leased_until": until,
+		}
+		dead := job.Status == database.JobRunning && job.Attempts >= maxAttempts
+		if dead {
+			updates = map[string]any{
+				"status":       database.JobDead,
+				"lease_token":  nil,
+				"leased_until": nil,
+				"last_error":   leaseExpiredError,
+			}
+		}
+
+		// every lease counts an attempt, the update fails if another worker leased the job in between
+		result := r.db.WithContext(ctx).Model(&database.Job{}).
+			Where("id = ? AND status = ? AND attempts = ?", job.Id, job.Status, job.Attempts).
+			Updates(updates)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 1 && !dead {
+			job.Status = database.JobRunning
+			job.Attempts++
+			job.LeaseToken = &token
+			job.LeasedUntil = &until
+			return &job, nil
+		}
+	}
+
+	// the queue is contended, the next poll tries again
+	return nil, nil
+}
+
+func (r *gormJobRepository) Update(ctx context.Context, job *database.Job, token string) error {
+	result := r.db.WithContext(ctx).Model(job).
+		Where("lease_token = ?", token).
+		Select("updated_at", "status", "attempts", "run_at", "lease_token", "leased_until", "last_error").
+		Updates(job)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *gormJobRepository) Delete(ctx context.Context, id string, token string) error {
+	result := r.db.WithContext(ctx).Where("id = ? AND lease_token = ?", id, token).Delete(&database.Job{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *gormJobRepository) List(ctx context.Context, status database.JobStatus, limit int) ([]database.Job, error) {
+	var jobs []database.Job
+	query := r.db.WithContext(ctx).Where("status = ?", status).Order("created_at asc")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if err := query.Find(&jobs).Error; err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+func (r *gormJobRepository) Requeue(ctx context.Context, ids []string) (int64, error) {
+	query := r.db.WithContext(ctx).Model(&database.Job{}).Where("status = ?", database.JobDead)
+	if len(ids) > 0 {
+		query = query.Where("id IN ?", ids)
+	}
+	result := query.Updates(map[string]any{
+		"status":       database.JobQueued,
+		"attempts":     0,
+		"run_at":       time.Now(),
+		"lease_token":  nil,
+		"leased_until": nil,
+	})
+	return result.RowsAffected, result.Error
+}
+
+type gormPushDeviceRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormPushDeviceRepository) Register(ctx context.Context, device *database.PushDevice) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var existing database.PushDevice
+		err := tx.Where("platform = ? AND token = ?", device.Platform, device.Token).First(&existing).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return tx.Omit("User").Create(device).Error
+		}
+		if err != nil {
+			return err
+		}
+
+		device.Id = existing.Id
+		device.CreatedAt = existing.CreatedAt
+		return tx.Omit("User").Save(device).Error
+	})
+}
+
+func (r *gormPushDeviceRepository) GetById(ctx context.Context, id string) (*database.PushDevice, error) {
+	var device database.PushDevice
+	if err := r.db.WithContext(ctx).First(&device, "id = ?", id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &device, nil
+}
+
+func (r *gormPushDeviceRepository) ListByUsers(ctx context.Context, userIds []string) ([]database.PushDevice, error) {
+	var devices []database.PushDevice
+	if len(userIds) == 0 {
+		return devices, nil
+	}
+	if err := r.db.WithContext(ctx).Where("user_id IN ?", userIds).Order("created_at asc").Find(&devices).Error; err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
+
+func (r *gormPushDeviceRepository) Delete(ctx context.Context, userId string, id string) error {
+	result := r.db.WithContext(ctx).Where("id = ? AND user_id = ?", id, userId).Delete(&database.PushDevice{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,1237 @@
+package repository
+
+import (
+	"context"
+	"easyflow-backend/src/database"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// memoryStore keeps every record by id, records are copied in and out so callers never share memory with the store.
+type memoryStore struct {
+	mu       sync.RWMutex
+	users    map[string]database.User
+	chats    map[string]database.Chat
+	members  map[string]database.ChatUserKeys
+	messages map[string]database.Message
+	sessions map[string]database.UserKeys
+	exports  map[string]database.DataExport
+	audit    map[string]database.AdminAuditLog
+	security map[string]database.SecurityEvent
+	files    map[string]database.Attachment
+	jobs     map[string]database.Job
+	devices  map[string]database.PushDevice
+}
+
+func (s *memoryStore) snapshot() *memoryStore {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return &memoryStore{
+		users:    maps.Clone(s.users),
+		chats:    maps.Clone(s.chats),
+		members:  maps.Clone(s.members),
+		messages: maps.Clone(s.messages),
+		sessions: maps.Clone(s.sessions),
+		exports:  maps.Clone(s.exports),
+		audit:    maps.Clone(s.audit),
+		security: maps.Clone(s.security),
+		files:    maps.Clone(s.files),
+		jobs:     maps.Clone(s.jobs),
+		devices:  maps.Clone(s.devices),
+	}
+}
+
+func (s *memoryStore) restore(snapshot *memoryStore) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.users = snapshot.users
+	s.chats = snapshot.chats
+	s.members = snapshot.members
+	s.messages = snapshot.messages
+	s.sessions = snapshot.sessions
+	s.exports = snapshot.exports
+	s.audit = snapshot.audit
+	s.security = snapshot.security
+	s.files = snapshot.files
+	s.jobs = snapshot.jobs
+	s.devices = snapshot.devices
+}
+
+// NewMemoryRepositories returns repositories that keep all records in memory.
+// They are meant for tests and behave like the gorm repositories without a database.
+func NewMemoryRepositories() *Repositories {
+	store := &memoryStore{
+		users:    map[string]database.User{},
+		chats:    map[string]database.Chat{},
+		members:  map[string]database.ChatUserKeys{},
+		messages: map[string]database.Message{},
+		sessions: map[string]database.UserKeys{},
+		exports:  map[string]database.DataExport{},
+		audit:    map[string]database.AdminAuditLog{},
+		security: map[string]database.SecurityEvent{},
+		files:    map[string]database.Attachment{},
+		jobs:     map[string]database.Job{},
+		devices:  map[string]database.PushDevice{},
+	}
+
+	repos := &Repositories{
+		Users:       &memoryUserRepository{store: store},
+		Chats:       &memoryChatRepository{store: store},
+		Messages:    &memoryMessageRepository{store: store},
+		Sessions:    &memorySessionRepository{store: store},
+		Exports:     &memoryExportRepository{store: store},
+		AdminAudit:  &memoryAdminAuditRepository{store: store},
+		Security:    &memorySecurityEventRepository{store: store},
+		Attachments: &memoryAttachmentRepository{store: store},
+		Jobs:        &memoryJobRepository{store: store},
+		Devices:     &memoryPushDeviceRepository{store: store},
+	}
+
+	// transactions are serialized and rolled back by restoring a snapshot of the store
+	var txMutex sync.Mutex
+	repos.transaction = func(ctx context.Context, fn func(repos *Repositories) error) error {
+		txMutex.Lock()
+		defer txMutex.Unlock()
+
+		snapshot := store.snapshot()
+		if err := fn(repos); err != nil {
+			store.restore(snapshot)
+			return err
+		}
+		return nil
+	}
+
+	return repos
+}
+
+// deleteMessage removes a message together with its attachments like ON DELETE CASCADE, the caller holds the lock
+func (s *memoryStore) deleteMessage(id string) {
+	delete(s.messages, id)
+	for key, attachment := range s.files {
+		if attachment.MessageId != nil && *attachment.MessageId == id {
+			delete(s.files, key)
+		}
+	}
+}
+
+// softDeleted mirrors the default scope gorm adds for models with a DeletedAt field
+func softDeleted(deletedAt gorm.DeletedAt) bool {
+	return deletedAt.Valid
+}
+
+// holds mirrors `column = value`, NULL never matches
+func holds(column *string, value string) bool {
+	return column != nil && *column == value
+}
+
+// deletedBefore mirrors `deleted_at < before`, live records never match
+func deletedBefore(deletedAt gorm.DeletedAt, before time.Time) bool {
+	return deletedAt.Valid && deletedAt.Time.Before(before)
+}
+
+func touch(createdAt *time.Time, updatedAt *time.Time) {
+	now := time.Now()
+	if createdAt.IsZero() {
+		*createdAt = now
+	}
+	*updatedAt = now
+}
+
+type memoryUserRepository struct {
+	store *memoryStore
+}
+
+func (r *memoryUserRepository) Create(ctx context.Context, user *database.User) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	_ = user.BeforeCreate(nil)
+	touch(&user.CreatedAt, &user.UpdatedAt)
+	r.store.users[user.Id] = *user
+	return nil
+}
+
+func (r *memoryUserRepository) GetById(ctx context.Context, id string) (*database.User, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	user, ok := r.store.users[id]
+	if !ok || softDeleted(user.DeletedAt) {
+		return nil, ErrNotFound
+	}
+	return &user, nil
+}
+
+func (r *memoryUserRepository) GetByEmail(ctx context.Context, email string) (*database.User, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	for _, user := range r.store.users {
+		if user.Email == email && !softDeleted(user.DeletedAt) {
+			return &user, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryUserRepository) ExistsByEmail(ctx context.Context, email string) (bool, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	for _, user := range r.store.users {
+		if user.Email == email {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *memoryUserRepository) UpdateProfile(ctx context.Context, id string, name string, bio *string) error {
+	return r.modify(id, func(user *database.User) {
+		user.Name = name
+		user.Bio = bio
+	})
+}
+
+func (r *memoryUserRepository) SetRole(ctx context.Context, id string, role database.UserRole) error {
+	return r.modify(id, func(user *database.User) {
+		user.Role = role
+	})
+}
+
+func (r *memoryUserRepository) SetPictureUpload(ctx context.Context, id string, uploadKey string) error {
+	return r.modify(id, func(user *database.User) {
+		user.PictureUpload = &uploadKey
+	})
+}
+
+func (r *memoryUserRepository) SetPendingPicture(ctx context.Context, id string, uploadKey string, key string) error {
+	return r.modifyIf(id, func(user *database.User) bool { return holds(user.PictureUpload, uploadKey) }, func(user *database.User) {
+		user.PictureUpload = nil
+		user.PicturePending = &key
+		user.PictureScan = database.ScanPending
+	})
+}
+
+func (r *memoryUserRepository) PublishPicture(ctx context.Context, id string, key string, version time.Time) error {
+	return r.modifyIf(id, func(user *database.User) bool { return holds(user.PicturePending, key) }, func(user *database.User) {
+		user.PictureKey = &key
+		user.PictureVersion = &version
+		user.PicturePending = nil
+		user.PictureScan = database.ScanClean
+	})
+}
+
+func (r *memoryUserRepository) RejectPicture(ctx context.Context, id string, key string) error {
+	return r.modifyIf(id, func(user *database.User) bool { return holds(user.PicturePending, key) }, func(user *database.User) {
+		user.PicturePending = nil
+		user.PictureScan = database.ScanQuarantined
+	})
+}
+
+// modify changes the stored user in place like an update of single columns, the caller does not hold the lock
+func (r *memoryUserRepository) modify(id string, change func(user *database.User)) error {
+	return r.modifyIf(id, func(*database.User) bool { return true }, change)
+}
+
+// modifyIf is modify for a user that matches the condition, ErrNotFound is returned otherwise
+func (r *memoryUserRepository) modifyIf(id string, matches func(user *database.User) bool, change func(user *database.User)) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	user, ok := r.store.users[id]
+	if !ok || softDeleted(user.DeletedAt) || !matches(&user) {
+		return ErrNotFound
+	}
+	change(&user)
+	user.UpdatedAt = time.Now()
+	r.store.users[id] = user
+	return nil
+}
+
+func (r *memoryUserRepository) MarkSeen(ctx context.Context, id string, at time.Time) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if user, ok := r.store.users[id]; ok {
+		user.LastSeenAt = &at
+		r.store.users[id] = user
+	}
+	return nil
+}
+
+func (r *memoryUserRepository) Delete(ctx context.Context, id string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	user, ok := r.store.users[id]
+	if !ok || softDeleted(user.DeletedAt) {
+		return ErrNotFound
+	}
+	now := gorm.DeletedAt{Time: time.Now(), Valid: true}
+	user.DeletedAt = now
+	r.store.users[id] = user
+
+	for key, member := range r.store.members {
+		if member.UserId == id && !softDeleted(member.DeletedAt) {
+			member.DeletedAt = now
+			r.store.members[key] = member
+		}
+	}
+	for key, session := range r.store.sessions {
+		if session.UserId == id {
+			delete(r.store.sessions, key)
+		}
+	}
+	for key, device := range r.store.devices {
+		if device.UserId == id {
+			delete(r.store.devices, key)
+		}
+	}
+	return nil
+}
+
+func (r *memoryUserRepository) ListDeleted(ctx context.Context, before time.Time) ([]database.User, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	users := []database.User{}
+	for _, user := range r.store.users {
+		if deletedBefore(user.DeletedAt, before) {
+			users = append(users, user)
+		}
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].DeletedAt.Time.Before(users[j].DeletedAt.Time)
+	})
+	return users, nil
+}
+
+// purge removes the user and mirrors the ON DELETE CASCADE and SET NULL foreign keys of the schema, the caller holds the lock
+func (r *memoryUserRepository) purge(id string, purgeMessages bool) {
+	delete(r.store.users, id)
+
+	for key, member := range r.store.members {
+		if member.UserId == id {
+			delete(r.store.members, key)
+		}
+	}
+	for key, session := range r.store.sessions {
+		if session.UserId == id {
+			delete(r.store.sessions, key)
+		}
+	}
+	for key, export := range r.store.exports {
+		if export.UserId == id {
+			delete(r.store.exports, key)
+		}
+	}
+	for key, device := range r.store.devices {
+		if device.UserId == id {
+			delete(r.store.devices, key)
+		}
+	}
+	for key, entry := range r.store.audit {
+		if entry.AdminId != nil && *entry.AdminId == id {
+			entry.AdminId = nil
+			r.store.audit[key] = entry
+		}
+	}
+	for key, event := range r.store.security {
+		if event.UserId != nil && *event.UserId == id {
+			event.UserId = nil
+			r.store.security[key] = event
+		}
+	}
+	for key, attachment := range r.store.files {
+		if attachment.UploaderId != nil && *attachment.UploaderId == id {
+			attachment.UploaderId = nil
+			r.store.files[key] = attachment
+		}
+	}
+	for key, message := range r.store.messages {
+		if message.SenderId == nil || *message.SenderId != id {
+			continue
+		}
+		if purgeMessages {
+			r.store.deleteMessage(key)
+		} else {
+			message.SenderId = nil
+			r.store.messages[key] = message
+		}
+	}
+}
+
+func (r *memoryUserRepository) Search(ctx context.Context, query string, limit int, offset int) ([]database.User, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	query = strings.ToLower(query)
+	users := []database.User{}
+	for _, user := range r.store.users {
+		if softDeleted(user.DeletedAt) {
+			continue
+		}
+		if strings.Contains(strings.ToLower(user.Email), query) || strings.Contains(strings.ToLower(user.Name), query) {
+			users = append(users, user)
+		}
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].CreatedAt.After(users[j].CreatedAt)
+	})
+	return page(users, limit, offset), nil
+}
+
+func (r *memoryUserRepository) SetDisabled(ctx context.Context, id string, disabled bool) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	user, ok := r.store.users[id]
+	if !ok || softDeleted(user.DeletedAt) {
+		return ErrNotFound
+	}
+
+	user.DisabledAt = nil
+	if disabled {
+		now := time.Now()
+		user.DisabledAt = &now
+
+		for key, session := range r.store.sessions {
+			if session.UserId == id {
+				delete(r.store.sessions, key)
+			}
+		}
+	}
+	r.store.users[id] = user
+	return nil
+}
+
+func (r *memoryUserRepository) Purge(ctx context.Context, id string, purgeMessages bool) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.users[id]; !ok {
+		return ErrNotFound
+	}
+	r.purge(id, purgeMessages)
+	return nil
+}
+
+// page mirrors LIMIT and OFFSET, a limit of 0 returns everything after offset
+func page[T any](records []T, limit int, offset int) []T {
+	if offset >= len(records) {
+		return records[:0]
+	}
+	records = records[offset:]
+	if limit > 0 && len(records) > limit {
+		records = records[:limit]
+	}
+	return records
+}
+
+type memoryChatRepository struct {
+	store *memoryStore
+}
+
+func (r *memoryChatRepository) Create(ctx context.Context, chat *database.Chat) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	_ = chat.BeforeCreate(nil)
+	touch(&chat.CreatedAt, &chat.UpdatedAt)
+	r.store.chats[chat.Id] = *chat
+	return nil
+}
+
+func (r *memoryChatRepository) GetById(ctx context.Context, id string) (*database.Chat, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	chat, ok := r.store.chats[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &chat, nil
+}
+
+func (r *memoryChatRepository) SetPictureUpload(ctx context.Context, id string, uploadKey string) error {
+	return r.modify(id, func(chat *database.Chat) {
+		chat.PictureUpload = &uploadKey
+	})
+}
+
+func (r *memoryChatRepository) SetPendingPicture(ctx context.Context, id string, uploadKey string, key string) error {
+	return r.modifyIf(id, func(chat *database.Chat) bool { return holds(chat.PictureUpload, uploadKey) }, func(chat *database.Chat) {
+		chat.PictureUpload = nil
+		chat.PicturePending = &key
+		chat.PictureScan = database.ScanPending
+	})
+}
+
+func (r *memoryChatRepository) PublishPicture(ctx context.Context, id string, key string, version time.Time) error {
+	return r.modifyIf(id, func(chat *database.Chat) bool { return holds(chat.PicturePending, key) }, func(chat *database.Chat) {
+		chat.PictureKey = &key
+		chat.PictureVersion = &version
+		chat.PicturePending = nil
+		chat.PictureScan = database.ScanClean
+	})
+}
+
+func (r *memoryChatRepository) RejectPicture(ctx context.Context, id string, key string) error {
+	return r.modifyIf(id, func(chat *database.Chat) bool { return holds(chat.PicturePending, key) }, func(chat *database.Chat) {
+		chat.PicturePending = nil
+		chat.PictureScan = database.ScanQuarantined
+	})
+}
+
+// modify changes the stored chat in place like an update of single columns, the caller does not hold the lock
+func (r *memoryChatRepository) modify(id string, change func(chat *database.Chat)) error {
+	return r.modifyIf(id, func(*database.Chat) bool { return true }, change)
+}
+
+// modifyIf is modify for a chat that matches the condition, ErrNotFound is returned otherwise
+func (r *memoryChatRepository) modifyIf(id string, matches func(chat *database.Chat) bool, change func(chat *database.Chat)) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	chat, ok := r.store.chats[id]
+	if !ok || !matches(&chat) {
+		return ErrNotFound
+	}
+	change(&chat)
+	chat.UpdatedAt = time.Now()
+	r.store.chats[id] = chat
+	return nil
+}
+
+func (r *memoryChatRepository) AddMember(ctx context.Context, member *database.ChatUserKeys) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	_ = member.BeforeCreate(nil)
+	touch(&member.CreatedAt, &member.UpdatedAt)
+	r.store.members[member.Id] = *member
+	return nil
+}
+
+func (r *memoryChatRepository) GetMember(ctx context.Context, chatId string, userId string) (*database.ChatUserKeys, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	for _, member := range r.store.members {
+		if member.ChatId == chatId && member.UserId == userId && !softDeleted(member.DeletedAt) {
+			return &member, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryChatRepository) SetMute(ctx context.Context, memberId string, muted bool, until *time.Time) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	member, ok := r.store.members[memberId]
+	if !ok || softDeleted(member.DeletedAt) {
+		return ErrNotFound
+	}
+	member.Muted = muted
+	member.MuteUntil = until
+	member.UpdatedAt = time.Now()
+	r.store.members[memberId] = member
+	return nil
+}
+
+func (r *memoryChatRepository) ListMembers(ctx context.Context, chatId string) ([]database.ChatUserKeys, error) {
+	return r.filterMembers(func(member database.ChatUserKeys) bool {
+		return member.ChatId == chatId
+	}), nil
+}
+
+func (r *memoryChatRepository) ListMembershipsOfUser(ctx context.Context, userId string) ([]database.ChatUserKeys, error) {
+	return r.filterMembers(func(member database.ChatUserKeys) bool {
+		return member.UserId == userId
+	}), nil
+}
+
+func (r *memoryChatRepository) filterMembers(match func(database.ChatUserKeys) bool) []database.ChatUserKeys {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	members := []database.ChatUserKeys{}
+	for _, member := range r.store.members {
+		if match(member) && !softDeleted(member.DeletedAt) {
+			members = append(members, member)
+		}
+	}
+
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].CreatedAt.Before(members[j].CreatedAt)
+	})
+	return members
+}
+
+func (r *memoryChatRepository) ListWithMessageRetention(ctx context.Context) ([]database.Chat, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	chats := []database.Chat{}
+	for _, chat := range r.store.chats {
+		if chat.MessageRetentionDays != nil {
+			chats = append(chats, chat)
+		}
+	}
+	return chats, nil
+}
+
+// purge removes the chat and mirrors the ON DELETE CASCADE foreign keys of the schema, the caller holds the lock
+func (r *memoryChatRepository) purge(id string) {
+	delete(r.store.chats, id)
+
+	for key, member := range r.store.members {
+		if member.ChatId == id {
+			delete(r.store.members, key)
+		}
+	}
+	for key, message := range r.store.messages {
+		if message.ChatId == id {
+			r.store.deleteMessage(key)
+		}
+	}
+	for key, attachment := range r.store.files {
+		if attachment.ChatId == id {
+			delete(r.store.files, key)
+		}
+	}
+}
+
+func (r *memoryChatRepository) Search(ctx context.Context, query string, limit int, offset int) ([]database.Chat, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	query = strings.ToLower(query)
+	chats := []database.Chat{}
+	for _, chat := range r.store.chats {
+		if strings.Contains(strings.ToLower(chat.Name), query) {
+			chats = append(chats, chat)
+		}
+	}
+
+	sort.Slice(chats, func(i, j int) bool {
+		return chats[i].CreatedAt.After(chats[j].CreatedAt)
+	})
+	return page(chats, limit, offset), nil
+}
+
+func (r *memoryChatRepository) CountMembers(ctx context.Context, chatIds []string) (map[string]int64, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	counts := map[string]int64{}
+	for _, member := range r.store.members {
+		if slices.Contains(chatIds, member.ChatId) && !softDeleted(member.DeletedAt) {
+			counts[member.ChatId]++
+		}
+	}
+	return counts, nil
+}
+
+func (r *memoryChatRepository) Purge(ctx context.Context, id string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.chats[id]; !ok {
+		return ErrNotFound
+	}
+	r.purge(id)
+	return nil
+}
+
+type memoryMessageRepository struct {
+	store *memoryStore
+}
+
+func (r *memoryMessageRepository) Create(ctx context.Context, message *database.Message) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	_ = message.BeforeCreate(nil)
+	touch(&message.CreatedAt, &message.UpdatedAt)
+	r.store.messages[message.Id] = *message
+	return nil
+}
+
+func (r *memoryMessageRepository) ListByChat(ctx context.Context, chatId string, limit int) ([]database.Message, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	messages := []database.Message{}
+	for _, message := range r.store.messages {
+		if message.ChatId == chatId {
+			messages = append(messages, message)
+		}
+	}
+
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].CreatedAt.After(messages[j].CreatedAt)
+	})
+
+	if limit > 0 && len(messages) > limit {
+		messages = messages[:limit]
+	}
+	return messages, nil
+}
+
+func (r *memoryMessageRepository) GetLatest(ctx context.Context, chatId string) (*database.Message, error) {
+	messages, _ := r.ListByChat(ctx, chatId, 1)
+	if len(messages) == 0 {
+		return nil, ErrNotFound
+	}
+	return &messages[0], nil
+}
+
+func (r *memoryMessageRepository) ListBySender(ctx context.Context, senderId string) ([]database.Message, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	messages := []database.Message{}
+	for _, message := range r.store.messages {
+		if message.SenderId != nil && *message.SenderId == senderId {
+			messages = append(messages, message)
+		}
+	}
+
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].CreatedAt.Before(messages[j].CreatedAt)
+	})
+	return messages, nil
+}
+
+func (r *memoryMessageRepository) DeleteOlderThan(ctx context.Context, chatId string, before time.Time) (int64, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	var deleted int64
+	for key, message := range r.store.messages {
+		if message.ChatId == chatId && message.CreatedAt.Before(before) {
+			r.store.deleteMessage(key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+type memorySessionRepository struct {
+	store *memoryStore
+}
+
+func (r *memorySessionRepository) Create(ctx context.Context, session *database.UserKeys) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	_ = session.BeforeCreate(nil)
+	touch(&session.CreatedAt, &session.UpdatedAt)
+	r.store.sessions[session.Id] = *session
+	return nil
+}
+
+func (r *memorySessionRepository) Get(ctx context.Context, userId string, random string) (*database.UserKeys, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	for _, session := range r.store.sessions {
+		if session.UserId == userId && session.Random == random {
+			return &session, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memorySessionRepository) Rotate(ctx context.Context, userId string, random string, newRandom string, expiresAt time.Time) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for key, session := range r.store.sessions {
+		if session.UserId == userId && session.Random == random {
+			session.Random = newRandom
+			session.ExpiredAt = expiresAt
+			session.UpdatedAt = time.Now()
+			r.store.sessions[key] = session
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (r *memorySessionRepository) Delete(ctx context.Context, userId string, random string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for key, session := range r.store.sessions {
+		if session.UserId == userId && session.Random == random {
+			delete(r.store.sessions, key)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (r *memorySessionRepository) CountActive(ctx context.Context) (int64, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var count int64
+	now := time.Now()
+	for _, session := range r.store.sessions {
+		if session.ExpiredAt.After(now) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *memorySessionRepository) ListActiveByUser(ctx context.Context, userId string) ([]database.UserKeys, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	sessions := []database.UserKeys{}
+	now := time.Now()
+	for _, session := range r.store.sessions {
+		if session.UserId == userId && session.ExpiredAt.After(now) {
+			sessions = append(sessions, session)
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.Before(sessions[j].CreatedAt)
+	})
+	return sessions, nil
+}
+
+type memoryExportRepository struct {
+	store *memoryStore
+}
+
+func (r *memoryExportRepository) Create(ctx context.Context, export *database.DataExport) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	_ = export.BeforeCreate(nil)
+	touch(&export.CreatedAt, &export.UpdatedAt)
+	r.store.exports[export.Id] = *export
+	return nil
+}
+
+func (r *memoryExportRepository) GetByUser(ctx context.Context, userId string, id string) (*database.DataExport, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	export, ok := r.store.exports[id]
+	if !ok || export.UserId != userId {
+		return nil, ErrNotFound
+	}
+	return &export, nil
+}
+
+func (r *memoryExportRepository) GetUnfinishedByUser(ctx context.Context, userId string) (*database.DataExport, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var latest *database.DataExport
+	for _, export := range r.store.exports {
+		if export.UserId != userId || (export.Status != database.ExportPending && export.Status != database.ExportRunning) {
+			continue
+		}
+		if latest == nil || export.CreatedAt.After(latest.CreatedAt) {
+			latest = &export
+		}
+	}
+	if latest == nil {
+		return nil, ErrNotFound
+	}
+	return latest, nil
+}
+
+func (r *memoryExportRepository) ListByUser(ctx context.Context, userId string) ([]database.DataExport, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	exports := []database.DataExport{}
+	for _, export := range r.store.exports {
+		if export.UserId == userId {
+			exports = append(exports, export)
+		}
+	}
+
+	sort.Slice(exports, func(i, j int) bool {
+		return exports[i].CreatedAt.Before(exports[j].CreatedAt)
+	})
+	return exports, nil
+}
+
+func (r *memoryExportRepository) Update(ctx context.Context, export *database.DataExport) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.exports[export.Id]; !ok {
+		return ErrNotFound
+	}
+	touch(&export.CreatedAt, &export.UpdatedAt)
+	r.store.exports[export.Id] = *export
+	return nil
+}
+
+type memoryAdminAuditRepository struct {
+	store *memoryStore
+}
+
+func (r *memoryAdminAuditRepository) Create(ctx context.Context, entry *database.AdminAuditLog) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	_ = entry.BeforeCreate(nil)
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+	r.store.audit[entry.Id] = *entry
+	return nil
+}
+
+func (r *memoryAdminAuditRepository) List(ctx context.Context, since time.Time, until time.Time, limit int) ([]database.AdminAuditLog, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	entries := []database.AdminAuditLog{}
+	for _, entry := range r.store.audit {
+		if !entry.CreatedAt.Before(since) && entry.CreatedAt.Before(until) {
+			entries = append(entries, entry)
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].CreatedAt.Before(entries[j].CreatedAt)
+	})
+	return page(entries, limit, 0), nil
+}
+
+type memorySecurityEventRepository struct {
+	store *memoryStore
+}
+
+func (r *memorySecurityEventRepository) Create(ctx context.Context, event *database.SecurityEvent) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	_ = event.BeforeCreate(nil)
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	r.store.security[event.Id] = *event
+	return nil
+}
+
+func (r *memorySecurityEventRepository) ListByUser(ctx context.Context, userId string, limit int, offset int) ([]database.SecurityEvent, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	events := []database.SecurityEvent{}
+	for _, event := range r.store.security {
+		if event.UserId != nil && *event.UserId == userId {
+			events = append(events, event)
+		}
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].CreatedAt.After(events[j].CreatedAt)
+	})
+	return page(events, limit, offset), nil
+}
+
+type memoryAttachmentRepository struct {
+	store *memoryStore
+}
+
+func (r *memoryAttachmentRepository) Create(ctx context.Context, attachment *database.Attachment) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	_ = attachment.BeforeCreate(nil)
+	touch(&attachment.CreatedAt, &attachment.UpdatedAt)
+	r.store.files[attachment.Id] = *attachment
+	return nil
+}
+
+func (r *memoryAttachmentRepository) GetById(ctx context.Context, chatId string, id string) (*database.Attachment, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	attachment, ok := r.store.files[id]
+	if !ok || attachment.ChatId != chatId {
+		return nil, ErrNotFound
+	}
+	return &attachment, nil
+}
+
+func (r *memoryAttachmentRepository) AttachToMessage(ctx context.Context, ids []string, messageId string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for _, id := range ids {
+		attachment, ok := r.store.files[id]
+		if !ok || attachment.MessageId != nil {
+			return ErrNotFound
+		}
+	}
+	for _, id := range ids {
+		attachment := r.store.files[id]
+		attachment.MessageId = &messageId
+		attachment.UpdatedAt = time.Now()
+		r.store.files[id] = attachment
+	}
+	return nil
+}
+
+func (r *memoryAttachmentRepository) SetScanStatus(ctx context.Context, ids []string, status database.ScanStatus) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for _, id := range ids {
+		if attachment, ok := r.store.files[id]; ok {
+			attachment.ScanStatus = status
+			attachment.UpdatedAt = time.Now()
+			r.store.files[id] = attachment
+		}
+	}
+	return nil
+}
+
+func (r *memoryAttachmentRepository) ListByMessages(ctx context.Context, messageIds []string) ([]database.Attachment, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	attachments := []database.Attachment{}
+	for _, attachment := range r.store.files {
+		if attachment.MessageId != nil && slices.Contains(messageIds, *attachment.MessageId) {
+			attachments = append(attachments, attachment)
+		}
+	}
+
+	sort.Slice(attachments, func(i, j int) bool {
+		return attachments[i].CreatedAt.Before(attachments[j].CreatedAt)
+	})
+	return attachments, nil
+}
+
+func (r *memoryAttachmentRepository) ListOlderThan(ctx context.Context, chatId string, before time.Time) ([]database.Attachment, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	attachments := []database.Attachment{}
+	for _, attachment := range r.store.files {
+		if attachment.MessageId == nil {
+			continue
+		}
+		message, ok := r.store.messages[*attachment.MessageId]
+		if ok && message.ChatId == chatId && message.CreatedAt.Before(before) {
+			attachments = append(attachments, attachment)
+		}
+	}
+
+	sort.Slice(attachments, func(i, j int) bool {
+		return attachments[i].CreatedAt.Before(attachments[j].CreatedAt)
+	})
+	return attachments, nil
+}
+
+type memoryJobRepository struct {
+	store *memoryStore
+}
+
+func (r *memoryJobRepository) Create(ctx context.Context, job *database.Job) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	_ = job.BeforeCreate(nil)
+	touch(&job.CreatedAt, &job.UpdatedAt)
+	r.store.jobs[job.Id] = *job
+	return nil
+}
+
+func (r *memoryJobRepository) Lease(ctx context.Context, types []string, token string, until time.Time, maxAttempts int) (*database.Job, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	now := time.Now()
+	var due *database.Job
+	for id, job := range r.store.jobs {
+		if !slices.Contains(types, job.Type) {
+			continue
+		}
+		queued := job.Status == database.JobQueued && !job.RunAt.After(now)
+		expired := job.Status == database.JobRunning && job.LeasedUntil != nil && !job.LeasedUntil.After(now)
+		if expired && job.Attempts >= maxAttempts {
+			message := leaseExpiredError
+			job.Status = database.JobDead
+			job.LeaseToken = nil
+			job.LeasedUntil = nil
+			job.LastError = &message
+			job.UpdatedAt = now
+			r.store.jobs[id] = job
+			continue
+		}
+		if (queued || expired) && (due == nil || job.RunAt.Before(due.RunAt)) {
+			due = &job
+		}
+	}
+	if due == nil {
+		return nil, ErrNotFound
+	}
+
+	due.Status = database.JobRunning
+	due.Attempts++
+	due.LeaseToken = &token
+	due.LeasedUntil = &until
+	due.UpdatedAt = now
+	r.store.jobs[due.Id] = *due
+	return due, nil
+}
+
+func (r *memoryJobRepository) Update(ctx context.Context, job *database.Job, token string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	stored, ok := r.store.jobs[job.Id]
+	if !ok || stored.LeaseToken == nil || *stored.LeaseToken != token {
+		return ErrNotFound
+	}
+	touch(&job.CreatedAt, &job.UpdatedAt)
+	r.store.jobs[job.Id] = *job
+	return nil
+}
+
+func (r *memoryJobRepository) Delete(ctx context.Context, id string, token string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	stored, ok := r.store.jobs[id]
+	if !ok || stored.LeaseToken == nil || *stored.LeaseToken != token {
+		return ErrNotFound
+	}
+	delete(r.store.jobs, id)
+	return nil
+}
+
+func (r *memoryJobRepository) List(ctx context.Context, status database.JobStatus, limit int) ([]database.Job, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var jobs []database.Job
+	for _, job := range r.store.jobs {
+		if job.Status == status {
+			jobs = append(jobs, job)
+		}
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+	if limit > 0 && len(jobs) > limit {
+		jobs = jobs[:limit]
+	}
+	return jobs, nil
+}
+
+func (r *memoryJobRepository) Requeue(ctx context.Context, ids []string) (int64, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	var requeued int64
+	now := time.Now()
+	for id, job := range r.store.jobs {
+		if job.Status != database.JobDead || (len(ids) > 0 && !slices.Contains(ids, id)) {
+			continue
+		}
+		job.Status = database.JobQueued
+		job.Attempts = 0
+		job.RunAt = now
+		job.LeaseToken = nil
+		job.LeasedUntil = nil
+		job.UpdatedAt = now
+		r.store.jobs[id] = job
+		requeued++
+	}
+	return requeued, nil
+}
+
+type memoryPushDeviceRepository struct {
+	store *memoryStore
+}
+
+func (r *memoryPushDeviceRepository) Register(ctx context.Context, device *database.PushDevice) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for _, existing := range r.store.devices {
+		if existing.Platform == device.Platform && existing.Token == device.Token {
+			device.Id = existing.Id
+			device.CreatedAt = existing.CreatedAt
+			touch(&device.CreatedAt, &device.UpdatedAt)
+			r.store.devices[device.Id] = *device
+			return nil
+		}
+	}
+
+	_ = device.BeforeCreate(nil)
+	touch(&device.CreatedAt, &device.UpdatedAt)
+	r.store.devices[device.Id] = *device
+	return nil
+}
+
+func (r *memoryPushDeviceRepository) GetById(ctx context.Context, id string) (*database.PushDevice, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	device, ok := r.store.devices[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &device, nil
+}
+
+func (r *memoryPushDeviceRepository) ListByUsers(ctx context.Context, userIds []string) ([]database.PushDevice, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var devices []database.PushDevice
+	for _, device := range r.store.devices {
+		if slices.Contains(userIds, device.UserId) {
+			devices = append(devices, device)
+		}
+	}
+
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].CreatedAt.Before(devices[j].CreatedAt)
+	})
+	return devices, nil
+}
+
+func (r *memoryPushDeviceRepository) Delete(ctx context.Context, userId string, id string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	device, ok := r.store.devices[id]
+	if !ok || device.UserId != userId {
+		return ErrNotFound
+	}
+	delete(r.store.devices, id)
+	return nil
+}
@@ -0,0 +1,191 @@
+package repository
+
+import (
+	"context"
+	"easyflow-backend/src/database"
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned by every repository if the requested record does not exist.
+var ErrNotFound = errors.New("record not found")
+
+// UserRepository only returns users that are not soft deleted.
+type UserRepository interface {
+	Create(ctx context.Context, user *database.User) error
+	GetById(ctx context.Context, id string) (*database.User, error)
+	GetByEmail(ctx context.Context, email string) (*database.User, error)
+	// ExistsByEmail includes soft deleted users, their email stays taken until they are purged
+	ExistsByEmail(ctx context.Context, email string) (bool, error)
+	// UpdateProfile stores the name and bio of the user without touching anything else
+	UpdateProfile(ctx context.Context, id string, name string, bio *string) error
+	// SetRole stores the role of the user without touching anything else
+	SetRole(ctx context.Context, id string, role database.UserRole) error
+	// SetPictureUpload stores the staging object key the next profile picture of the user is uploaded to
+	SetPictureUpload(ctx context.Context, id string, uploadKey string) error
+	// SetPendingPicture replaces the upload with its processed copy at key, which is pending until it was scanned.
+	// ErrNotFound is returned if uploadKey is not the last requested upload anymore.
+	SetPendingPicture(ctx context.Context, id string, uploadKey string, key string) error
+	// PublishPicture points the profile picture of the user to the pending picture at key once it was scanned clean,
+	// ErrNotFound is returned if a newer picture was confirmed in the meantime
+	PublishPicture(ctx context.Context, id string, key string, version time.Time) error
+	// RejectPicture drops the pending picture at key as quarantined, ErrNotFound is returned if a newer picture was confirmed in the meantime
+	RejectPicture(ctx context.Context, id string, key string) error
+	// MarkSeen stores the time of the last authenticated request of the user without touching anything else
+	MarkSeen(ctx context.Context, id string, at time.Time) error
+	// Delete soft deletes the user and its memberships and ends all of its sessions
+	Delete(ctx context.Context, id string) error
+	// ListDeleted returns the users that were soft deleted before the given time
+	ListDeleted(ctx context.Context, before time.Time) ([]database.User, error)
+	// Search returns the users whose email or name contains query, newest first
+	Search(ctx context.Context, query string, limit int, offset int) ([]database.User, error)
+	// SetDisabled disables or enables the user, disabling also ends all of its sessions
+	SetDisabled(ctx context.Context, id string, disabled bool) error
+	// Purge removes the user together with its memberships and sessions, also if it was not soft deleted before.
+	// Its messages are removed as well if purgeMessages is set, otherwise they lose their sender.
+	Purge(ctx context.Context, id string, purgeMessages bool) error
+}
+
+// ChatRepository covers chats and their memberships, a membership holds the wrapped chat key of a user.
+type ChatRepository interface {
+	Create(ctx context.Context, chat *database.Chat) error
+	GetById(ctx context.Context, id string) (*database.Chat, error)
+	// SetPictureUpload, SetPendingPicture, PublishPicture and RejectPicture move the picture of the chat through
+	// the upload and the scan like the ones of the UserRepository
+	SetPictureUpload(ctx context.Context, id string, uploadKey string) error
+	SetPendingPicture(ctx context.Context, id string, uploadKey string, key string) error
+	PublishPicture(ctx context.Context, id string, key string, version time.Time) error
+	RejectPicture(ctx context.Context, id string, key string) error
+	AddMember(ctx context.Context, member *database.ChatUserKeys) error
+	GetMember(ctx context.Context, chatId string, userId string) (*database.ChatUserKeys, error)
+	// SetMute stores whether the member muted the chat and until when without touching anything else
+	SetMute(ctx context.Context, memberId string, muted bool, until *time.Time) error
+	ListMembers(ctx context.Context, chatId string) ([]database.ChatUserKeys, error)
+	ListMembershipsOfUser(ctx context.Context, userId string) ([]database.ChatUserKeys, error)
+	// ListWithMessageRetention returns every chat that has a message retention period
+	ListWithMessageRetention(ctx context.Context) ([]database.Chat, error)
+	// Search returns the chats whose name contains query, newest first
+	Search(ctx context.Context, query string, limit int, offset int) ([]database.Chat, error)
+	// CountMembers returns the number of members by chat id, chats without members are left out
+	CountMembers(ctx context.Context, chatIds []string) (map[string]int64, error)
+	// Purge removes the chat with its memberships and messages right away
+	Purge(ctx context.Context, id string) error
+}
+
+type MessageRepository interface {
+	Create(ctx context.Context, message *database.Message) error
+	// ListByChat returns the newest messages of a chat first
+	ListByChat(ctx context.Context, chatId string, limit int) ([]database.Message, error)
+	GetLatest(ctx context.Context, chatId string) (*database.Message, error)
+	// ListBySender returns every message the user sent, oldest first
+	ListBySender(ctx context.Context, senderId string) ([]database.Message, error)
+	// DeleteOlderThan removes the messages of a chat that were created before the given time
+	DeleteOlderThan(ctx context.Context, chatId string, before time.Time) (int64, error)
+}
+
+// SessionRepository covers the refresh token randoms stored in UserKeys.
+type SessionRepository interface {
+	Create(ctx context.Context, session *database.UserKeys) error
+	Get(ctx context.Context, userId string, random string) (*database.UserKeys, error)
+	Rotate(ctx context.Context, userId string, random string, newRandom string, expiresAt time.Time) error
+	Delete(ctx context.Context, userId string, random string) error
+	CountActive(ctx context.Context) (int64, error)
+	// ListActiveByUser returns the sessions of the user that have not expired yet
+	ListActiveByUser(ctx context.Context, userId string) ([]database.UserKeys, error)
+}
+
+// ExportRepository covers the data exports requested by users.
+type ExportRepository interface {
+	Create(ctx context.Context, export *database.DataExport) error
+	// GetByUser only returns the export if it belongs to the user
+	GetByUser(ctx context.Context, userId string, id string) (*database.DataExport, error)
+	// GetUnfinishedByUser returns the pending or running export of the user
+	GetUnfinishedByUser(ctx context.Context, userId string) (*database.DataExport, error)
+	// ListByUser returns every export of the user, oldest first
+	ListByUser(ctx context.Context, userId string) ([]database.DataExport, error)
+	Update(ctx context.Context, export *database.DataExport) error
+}
+
+// AdminAuditRepository is append only, entries are never updated or deleted.
+type AdminAuditRepository interface {
+	Create(ctx context.Context, entry *database.AdminAuditLog) error
+	// List returns the entries created in [since, until) oldest first, a limit of 0 returns all of them
+	List(ctx context.Context, since time.Time, until time.Time, limit int) ([]database.AdminAuditLog, error)
+}
+
+// SecurityEventRepository is append only, events are never updated or deleted.
+type SecurityEventRepository interface {
+	Create(ctx context.Context, event *database.SecurityEvent) error
+	// ListByUser returns the events of the user, newest first
+	ListByUser(ctx context.Context, userId string, limit int, offset int) ([]database.SecurityEvent, error)
+}
+
+// AttachmentRepository covers the attachments of chat messages, every lookup is scoped to a chat.
+type AttachmentRepository interface {
+	Create(ctx context.Context, attachment *database.Attachment) error
+	GetById(ctx context.Context, chatId string, id string) (*database.Attachment, error)
+	// AttachToMessage links the attachments to the message, it fails with ErrNotFound
+	// and changes nothing if one of them does not exist or already belongs to a message. Repeated ids are linked once.
+	AttachToMessage(ctx context.Context, ids []string, messageId string) error
+	// SetScanStatus stores the verdict of the malware scan of the attachments
+	SetScanStatus(ctx context.Context, ids []string, status database.ScanStatus) error
+	// ListByMessages returns the attachments of the messages, oldest first
+	ListByMessages(ctx context.Context, messageIds []string) ([]database.Attachment, error)
+	// ListOlderThan returns the attachments of the messages of a chat that were created before the given time
+	ListOlderThan(ctx context.Context, chatId string, before time.Time) ([]database.Attachment, error)
+}
+
+// leaseExpiredError is the last error of a job that was dead-lettered because its lease ran out on the last attempt
+const leaseExpiredError = "lease expired"
+
+// JobRepository is the queue of background jobs. Changes to a leased job are guarded by the token of the lease,
+// a worker whose lease ran out can not change the job anymore.
+type JobRepository interface {
+	Create(ctx context.Context, job *database.Job) error
+	// Lease claims the due job of one of the types with the oldest RunAt until the given time, it fails with ErrNotFound
+	// if there is none. Running jobs whose lease is over are due again, the attempt is counted when the job is leased.
+	// A job whose lease ran out on attempt maxAttempts is dead-lettered instead, so a job that kills its worker is not leased forever.
+	// It returns no job and no error if other workers claimed every candidate it found.
+	Lease(ctx context.Context, types []string, token string, until time.Time, maxAttempts int) (*database.Job, error)
+	// Update stores the job if it is still leased with the token and fails with ErrNotFound otherwise
+	Update(ctx context.Context, job *database.Job, token string) error
+	// Delete removes a job that succeeded if it is still leased with the token and fails with ErrNotFound otherwise
+	Delete(ctx context.Context, id string, token string) error
+	// List returns the jobs with the status, oldest first. A limit of 0 returns all of them
+	List(ctx context.Context, status database.JobStatus, limit int) ([]database.Job, error)
+	// Requeue makes dead jobs due again with fresh attempts, all of them if no ids are given, and returns how many were requeued
+	Requeue(ctx context.Context, ids []string) (int64, error)
+}
+
+// PushDeviceRepository covers the devices that receive push notifications.
+type PushDeviceRepository interface {
+	// Register stores the device, a token that was registered before is moved to the user of the device and gets its keys
+	Register(ctx context.Context, device *database.PushDevice) error
+	GetById(ctx context.Context, id string) (*database.PushDevice, error)
+	// ListByUsers returns the devices of the users, oldest first
+	ListByUsers(ctx context.Context, userIds []string) ([]database.PushDevice, error)
+	// Delete only removes the device if it belongs to the user
+	Delete(ctx context.Context, userId string, id string) error
+}
+
+// Repositories bundles the repository of every aggregate.
+type Repositories struct {
+	Users       UserRepository
+	Chats       ChatRepository
+	Messages    MessageRepository
+	Sessions    SessionRepository
+	Exports     ExportRepository
+	AdminAudit  AdminAuditRepository
+	Security    SecurityEventRepository
+	Attachments AttachmentRepository
+	Jobs        JobRepository
+	Devices     PushDeviceRepository
+
+	transaction func(ctx context.Context, fn func(repos *Repositories) error) error
+}
+
+// Transaction runs fn with repositories that share one transaction.
+// The transaction is rolled back if fn returns an error and committed otherwise.
+func (r *Repositories) Transaction(ctx context.Context, fn func(repos *Repositories) error) error {
+	return r.transaction(ctx, fn)
+}
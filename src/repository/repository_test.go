@@ -0,0 +1,222 @@
+package repository
+
+import (
+	"context"
+	"easyflow-backend/src/database"
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+/*
+Private function to run the test against the gorm repositories on a migrated in-memory sqlite and the memory repositories
+*/
+func forEachRepositories(t *testing.T, test func(t *testing.T, repos *Repositories)) {
+	t.Run("gorm", func(t *testing.T) {
+		db, err := database.NewDatabaseInst("sqlite://:memory:", &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)}, database.Options{})
+		if err != nil {
+			t.Fatalf("could not open database: %s", err)
+		}
+		t.Cleanup(func() { _ = db.Close() })
+		if _, err := db.Migrate(context.Background()); err != nil {
+			t.Fatalf("could not migrate: %s", err)
+		}
+		test(t, NewGormRepositories(db.GetClient()))
+	})
+	t.Run("memory", func(t *testing.T) {
+		test(t, NewMemoryRepositories())
+	})
+}
+
+func TestLeaseDeadLettersExpiredLastAttempt(t *testing.T) {
+	forEachRepositories(t, func(t *testing.T, repos *Repositories) {
+		ctx := context.Background()
+		types := []string{"test.crash"}
+
+		job := &database.Job{Type: types[0], Payload: "{}"}
+		if err := repos.Jobs.Create(ctx, job); err != nil {
+			t.Fatalf("could not enqueue: %s", err)
+		}
+
+		// the worker dies on every attempt, the lease runs out without the job being updated
+		for attempt := 1; attempt <= 2; attempt++ {
+			leased, err := repos.Jobs.Lease(ctx, types, "crashed", time.Now().Add(-time.Second), 2)
+			if err != nil || leased == nil || leased.Id != job.Id || leased.Attempts != attempt {
+				t.Fatalf("attempt %d was not leased: %+v, %v", attempt, leased, err)
+			}
+		}
+
+		if leased, err := repos.Jobs.Lease(ctx, types, "third", time.Now().Add(time.Minute), 2); leased != nil || (err != nil && !errors.Is(err, ErrNotFound)) {
+			t.Fatalf("the job was leased after its last attempt: %+v, %v", leased, err)
+		}
+
+		dead, err := repos.Jobs.List(ctx, database.JobDead, 0)
+		if err != nil || len(dead) != 1 || dead[0].Id != job.Id {
+			t.Fatalf("the job was not dead-lettered: %+v, %v", dead, err)
+		}
+		if dead[0].Attempts != 2 || dead[0].LastError == nil || *dead[0].LastError != leaseExpiredError || dead[0].LeaseToken != nil || dead[0].LeasedUntil != nil {
+			t.Fatalf("unexpected dead job %+v", dead[0])
+		}
+
+		// a requeued job gets its attempts back
+		if requeued, err := repos.Jobs.Requeue(ctx, []string{job.Id}); err != nil || requeued != 1 {
+			t.Fatalf("could not requeue: %d, %v", requeued, err)
+		}
+		if leased, err := repos.Jobs.Lease(ctx, types, "fresh", time.Now().Add(time.Minute), 2); err != nil || leased == nil || leased.Attempts != 1 {
+			t.Fatalf("the requeued job was not leased: %+v, %v", leased, err)
+		}
+	})
+}
+
+func TestUserUpdatesKeepOtherColumns(t *testing.T) {
+	forEachRepositories(t, func(t *testing.T, repos *Repositories) {
+		ctx := context.Background()
+
+		user := &database.User{Email: "alice@example.com", Name: "alice"}
+		if err := repos.Users.Create(ctx, user); err != nil {
+			t.Fatalf("could not create the user: %s", err)
+		}
+
+		// an admin disables the account while the user and the scanner still work on what they loaded before
+		if err := repos.Users.SetDisabled(ctx, user.Id, true); err != nil {
+			t.Fatalf("could not disable the user: %s", err)
+		}
+
+		bio := "hello"
+		for i, update := range []func() error{
+			func() error { return repos.Users.UpdateProfile(ctx, user.Id, "alice cooper", &bio) },
+			func() error { return repos.Users.SetRole(ctx, user.Id, database.RoleAdmin) },
+			func() error { return repos.Users.SetPictureUpload(ctx, user.Id, "uploads/1") },
+			func() error { return repos.Users.SetPendingPicture(ctx, user.Id, "uploads/1", user.Id+"/1") },
+			func() error { return repos.Users.PublishPicture(ctx, user.Id, user.Id+"/1", time.Now()) },
+		} {
+			if err := update(); err != nil {
+				t.Fatalf("update %d failed: %s", i, err)
+			}
+		}
+
+		stored, err := repos.Users.GetById(ctx, user.Id)
+		if err != nil {
+			t.Fatalf("could not get the user: %s", err)
+		}
+		if stored.DisabledAt == nil {
+			t.Fatalf("an update enabled the disabled user again")
+		}
+		if stored.Name != "alice cooper" || stored.Bio == nil || *stored.Bio != bio || stored.Role != database.RoleAdmin ||
+			stored.PictureKey == nil || stored.PictureScan != database.ScanClean || stored.Email != user.Email {
+			t.Fatalf("unexpected user %+v", stored)
+		}
+
+		if err := repos.Users.SetRole(ctx, "unknown", database.RoleAdmin); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	})
+}
+
+func TestMuteKeepsDeletedMembership(t *testing.T) {
+	forEachRepositories(t, func(t *testing.T, repos *Repositories) {
+		ctx := context.Background()
+
+		user := &database.User{Email: "alice@example.com", Name: "alice"}
+		if err := repos.Users.Create(ctx, user); err != nil {
+			t.Fatalf("could not create the user: %s", err)
+		}
+		chat := &database.Chat{Name: "talk"}
+		if err := repos.Chats.Create(ctx, chat); err != nil {
+			t.Fatalf("could not create the chat: %s", err)
+		}
+		member := &database.ChatUserKeys{ChatId: chat.Id, UserId: user.Id, Key: "key"}
+		if err := repos.Chats.AddMember(ctx, member); err != nil {
+			t.Fatalf("could not add the member: %s", err)
+		}
+
+		if err := repos.Chats.SetMute(ctx, member.Id, true, nil); err != nil {
+			t.Fatalf("could not mute: %s", err)
+		}
+		stored, err := repos.Chats.GetMember(ctx, chat.Id, user.Id)
+		if err != nil || !stored.Muted || stored.Key != "key" {
+			t.Fatalf("unexpected member %+v: %v", stored, err)
+		}
+
+		// a mute that arrives after the account was deleted does not bring the membership back
+		if err := repos.Users.Delete(ctx, user.Id); err != nil {
+			t.Fatalf("could not delete the user: %s", err)
+		}
+		if err := repos.Chats.SetMute(ctx, member.Id, false, nil); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+		if members, err := repos.Chats.ListMembers(ctx, chat.Id); err != nil || len(members) != 0 {
+			t.Fatalf("the deleted membership is back: %+v, %v", members, err)
+		}
+	})
+}
+
+func TestPictureIsOnlyPublishedWhilePending(t *testing.T) {
+	forEachRepositories(t, func(t *testing.T, repos *Repositories) {
+		ctx := context.Background()
+
+		user := &database.User{Email: "alice@example.com", Name: "alice"}
+		if err := repos.Users.Create(ctx, user); err != nil {
+			t.Fatalf("could not create the user: %s", err)
+		}
+
+		expectNotFound := func(name string, err error) {
+			t.Helper()
+			if !errors.Is(err, ErrNotFound) {
+				t.Fatalf("%s: expected ErrNotFound, got %v", name, err)
+			}
+		}
+		expectPicture := func(key string, pending string, scan database.ScanStatus) {
+			t.Helper()
+			stored, err := repos.Users.GetById(ctx, user.Id)
+			if err != nil {
+				t.Fatalf("could not get the user: %s", err)
+			}
+			if (key == "") != (stored.PictureKey == nil) || (key != "" && *stored.PictureKey != key) ||
+				(pending == "") != (stored.PicturePending == nil) || (pending != "" && *stored.PicturePending != pending) ||
+				stored.PictureScan != scan || stored.PictureUpload != nil {
+				t.Fatalf("unexpected picture %v, pending %v, scan %s, upload %v", stored.PictureKey, stored.PicturePending, stored.PictureScan, stored.PictureUpload)
+			}
+		}
+
+		expectNotFound("nothing uploaded", repos.Users.SetPendingPicture(ctx, user.Id, "uploads/1", "alice/1"))
+		if err := repos.Users.SetPictureUpload(ctx, user.Id, "uploads/1"); err != nil {
+			t.Fatalf("could not store the upload: %s", err)
+		}
+		expectNotFound("other upload", repos.Users.SetPendingPicture(ctx, user.Id, "uploads/2", "alice/1"))
+		if err := repos.Users.SetPendingPicture(ctx, user.Id, "uploads/1", "alice/1"); err != nil {
+			t.Fatalf("could not confirm the upload: %s", err)
+		}
+		expectNotFound("confirmed twice", repos.Users.SetPendingPicture(ctx, user.Id, "uploads/1", "alice/1"))
+		expectPicture("", "alice/1", database.ScanPending)
+
+		// a newer picture is confirmed while the first one is scanned, the verdict of the first one is dropped
+		if err := repos.Users.SetPictureUpload(ctx, user.Id, "uploads/2"); err != nil {
+			t.Fatalf("could not store the upload: %s", err)
+		}
+		if err := repos.Users.SetPendingPicture(ctx, user.Id, "uploads/2", "alice/2"); err != nil {
+			t.Fatalf("could not confirm the upload: %s", err)
+		}
+		expectNotFound("publish replaced picture", repos.Users.PublishPicture(ctx, user.Id, "alice/1", time.Now()))
+		expectNotFound("reject replaced picture", repos.Users.RejectPicture(ctx, user.Id, "alice/1"))
+		if err := repos.Users.PublishPicture(ctx, user.Id, "alice/2", time.Now()); err != nil {
+			t.Fatalf("could not publish the picture: %s", err)
+		}
+		expectPicture("alice/2", "", database.ScanClean)
+
+		// a quarantined picture keeps the published one
+		if err := repos.Users.SetPictureUpload(ctx, user.Id, "uploads/3"); err != nil {
+			t.Fatalf("could not store the upload: %s", err)
+		}
+		if err := repos.Users.SetPendingPicture(ctx, user.Id, "uploads/3", "alice/3"); err != nil {
+			t.Fatalf("could not confirm the upload: %s", err)
+		}
+		if err := repos.Users.RejectPicture(ctx, user.Id, "alice/3"); err != nil {
+			t.Fatalf("could not reject the picture: %s", err)
+		}
+		expectPicture("alice/2", "", database.ScanQuarantined)
+	})
+}
@@ -0,0 +1,194 @@
+package retention
+
+import (
+	"context"
+	"easyflow-backend/src/api/utils"
+	"easyflow-backend/src/common"
+	"easyflow-backend/src/database"
+	"easyflow-backend/src/repository"
+	"easyflow-backend/src/storage"
+	"errors"
+	"os"
+	"time"
+)
+
+// Worker enforces the data retention policy. It purges soft deleted users
+// once the grace period is over and deletes messages that are older than the retention period of their chat.
+// The stored objects of the records are deleted first, a record whose objects could not be deleted is kept for the next run.
+type Worker struct {
+	repos  *repository.Repositories
+	cfg    *common.Config
+	store  storage.ObjectStore
+	logger *common.Logger
+}
+
+// object is a stored object that belongs to a record
+type object struct {
+	BucketName string
+	Key        string
+}
+
+// Result counts the records removed by a single run
+type Result struct {
+	Users           int64
+	ExpiredMessages int64
+}
+
+func NewWorker(repos *repository.Repositories, cfg *common.Config, store storage.ObjectStore) *Worker {
+	return &Worker{
+		repos:  repos,
+		cfg:    cfg,
+		store:  store,
+		logger: common.NewLogger(os.Stdout, "Retention", nil, cfg.LogLevel),
+	}
+}
+
+// SetLogLevel changes the log level of the worker after the config was reloaded
+func (w *Worker) SetLogLevel(logLevel common.LogLevel) {
+	w.logger.SetLogLevel(logLevel)
+}
+
+// Run enforces the policy right away and then every RetentionInterval until ctx is cancelled
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.cfg.RetentionInterval)
+	defer ticker.Stop()
+
+	for {
+		result, err := w.RunOnce(ctx)
+		if err != nil && ctx.Err() == nil {
+			w.logger.PrintfError("Failed to enforce the retention policy: %s", err)
+		} else if err == nil {
+			w.logger.Printf("Purged %d users, deleted %d expired messages", result.Users, result.ExpiredMessages)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce purges everything that is due at the time of the call, a failing step does not stop the others
+func (w *Worker) RunOnce(ctx context.Context) (Result, error) {
+	var result Result
+	var errs []error
+
+	now := time.Now()
+	cutoff := now.Add(-w.cfg.RetentionGracePeriod)
+
+	users, err := w.repos.Users.ListDeleted(ctx, cutoff)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	for _, user := range users {
+		if err := w.purgeUser(ctx, &user); err != nil {
+			w.logger.PrintfError("Failed to purge user: %s. Error: %s", user.Id, err)
+			errs = append(errs, err)
+			continue
+		}
+		result.Users++
+	}
+
+	chatsWithRetention, err := w.repos.Chats.ListWithMessageRetention(ctx)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	for _, chat := range chatsWithRetention {
+		expiresBefore := now.AddDate(0, 0, -*chat.MessageRetentionDays)
+		expired, err := w.deleteExpiredMessages(ctx, chat.Id, expiresBefore)
+		if err != nil {
+			w.logger.PrintfError("Failed to delete expired messages of chat: %s. Error: %s", chat.Id, err)
+			errs = append(errs, err)
+			continue
+		}
+		result.ExpiredMessages += expired
+	}
+
+	return result, errors.Join(errs...)
+}
+
+/*
+Private function to purge the user after deleting its pictures, the archives of its exports
+and the attachments of the messages that are purged with it
+*/
+func (w *Worker) purgeUser(ctx context.Context, user *database.User) error {
+	var objects []object
+	for _, picture := range []*string{user.PictureKey, user.PicturePending} {
+		if picture != nil {
+			for _, key := range utils.PictureKeys(*picture) {
+				objects = append(objects, object{BucketName: w.cfg.ProfilePictureBucketName, Key: key})
+			}
+		}
+	}
+	if user.PictureUpload != nil {
+		objects = append(objects, object{BucketName: w.cfg.ProfilePictureBucketName, Key: *user.PictureUpload})
+	}
+
+	exports, err := w.repos.Exports.ListByUser(ctx, user.Id)
+	if err != nil {
+		return err
+	}
+	for _, export := range exports {
+		if export.ObjectKey != nil {
+			objects = append(objects, object{BucketName: w.cfg.ExportBucketName, Key: *export.ObjectKey})
+		}
+	}
+
+	if w.cfg.RetentionPurgeMessages {
+		messages, err := w.repos.Messages.ListBySender(ctx, user.Id)
+		if err != nil {
+			return err
+		}
+		messageIds := make([]string, 0, len(messages))
+		for _, message := range messages {
+			messageIds = append(messageIds, message.Id)
+		}
+		attachments, err := w.repos.Attachments.ListByMessages(ctx, messageIds)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, w.attachmentObjects(attachments)...)
+	}
+
+	if err := w.deleteObjects(ctx, objects); err != nil {
+		return err
+	}
+	return w.repos.Users.Purge(ctx, user.Id, w.cfg.RetentionPurgeMessages)
+}
+
+/*
+Private function to delete the expired messages of the chat after deleting their attachments
+*/
+func (w *Worker) deleteExpiredMessages(ctx context.Context, chatId string, before time.Time) (int64, error) {
+	attachments, err := w.repos.Attachments.ListOlderThan(ctx, chatId, before)
+	if err != nil {
+		return 0, err
+	}
+	if err := w.deleteObjects(ctx, w.attachmentObjects(attachments)); err != nil {
+		return 0, err
+	}
+	return w.repos.Messages.DeleteOlderThan(ctx, chatId, before)
+}
+
+func (w *Worker) attachmentObjects(attachments []database.Attachment) []object {
+	objects := make([]object, 0, len(attachments))
+	for _, attachment := range attachments {
+		objects = append(objects, object{BucketName: w.cfg.AttachmentBucketName, Key: attachment.ObjectKey})
+	}
+	return objects
+}
+
+/*
+Private function to delete the objects, objects that are already gone are skipped by the store
+*/
+func (w *Worker) deleteObjects(ctx context.Context, objects []object) error {
+	for _, object := range objects {
+		if err := w.store.Delete(ctx, object.BucketName, object.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package retention
+
+import (
+	"context"
+	"easyflow-backend/src/common"
+	"easyflow-backend/src/database"
+	"easyflow-backend/src/repository"
+	"easyflow-backend/src/storage"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestRunOnceCutoffs(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	cfg := &common.Config{
+		LogLevel:                 common.ERROR,
+		RetentionGracePeriod:     24 * time.Hour,
+		ProfilePictureBucketName: "profile-pictures",
+	}
+	repos := repository.NewMemoryRepositories()
+	store, err := storage.NewLocalStore(t.TempDir(), "http://localhost:8080", []byte("secret"))
+	if err != nil {
+		t.Fatalf("could not create the store: %s", err)
+	}
+
+	deletedAt := func(age time.Duration) gorm.DeletedAt {
+		return gorm.DeletedAt{Time: now.Add(-age), Valid: true}
+	}
+	pictureKey := "expired-user"
+	users := map[string]*database.User{
+		"expired": {Email: "expired@example.com", DeletedAt: deletedAt(25 * time.Hour), PictureKey: &pictureKey},
+		"grace":   {Email: "grace@example.com", DeletedAt: deletedAt(23 * time.Hour)},
+		"active":  {Email: "active@example.com"},
+	}
+	for _, user := range users {
+		if err := repos.Users.Create(ctx, user); err != nil {
+			t.Fatalf("could not create the user: %s", err)
+		}
+	}
+	if err := store.Put(ctx, cfg.ProfilePictureBucketName, pictureKey, []byte("picture"), "image/jpeg"); err != nil {
+		t.Fatalf("could not store the picture: %s", err)
+	}
+
+	week := 7
+	withRetention := &database.Chat{Name: "with retention", MessageRetentionDays: &week}
+	withoutRetention := &database.Chat{Name: "without retention"}
+	for _, chat := range []*database.Chat{withRetention, withoutRetention} {
+		if err := repos.Chats.Create(ctx, chat); err != nil {
+			t.Fatalf("could not create the chat: %s", err)
+		}
+	}
+
+	sender := users["active"].Id
+	for _, message := range []*database.Message{
+		{ChatId: withRetention.Id, SenderId: &sender, Content: "expired", CreatedAt: now.AddDate(0, 0, -8)},
+		{ChatId: withRetention.Id, SenderId: &sender, Content: "kept", CreatedAt: now.AddDate(0, 0, -6)},
+		{ChatId: withoutRetention.Id, SenderId: &sender, Content: "kept forever", CreatedAt: now.AddDate(-1, 0, 0)},
+	} {
+		if err := repos.Messages.Create(ctx, message); err != nil {
+			t.Fatalf("could not create the message: %s", err)
+		}
+	}
+
+	result, err := NewWorker(repos, cfg, store).RunOnce(ctx)
+	if err != nil {
+		t.Fatalf("could not enforce the policy: %s", err)
+	}
+	if result.Users != 1 || result.ExpiredMessages != 1 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+
+	// only the user whose grace period is over was purged
+	deleted, err := repos.Users.ListDeleted(ctx, now)
+	if err != nil || len(deleted) != 1 || deleted[0].Id != users["grace"].Id {
+		t.Fatalf("unexpected deleted users %+v: %v", deleted, err)
+	}
+	if _, err := repos.Users.GetById(ctx, users["active"].Id); err != nil {
+		t.Fatalf("the active user was purged: %s", err)
+	}
+	if _, err := store.Head(ctx, cfg.ProfilePictureBucketName, pictureKey); err == nil {
+		t.Fatalf("the picture of the purged user was kept")
+	}
+
+	for chatId, expected := range map[string]string{withRetention.Id: "kept", withoutRetention.Id: "kept forever"} {
+		messages, err := repos.Messages.ListByChat(ctx, chatId, 0)
+		if err != nil || len(messages) != 1 || messages[0].Content != expected {
+			t.Fatalf("unexpected messages %+v: %v", messages, err)
+		}
+	}
+
+	// nothing else is due on the next run
+	if result, err := NewWorker(repos, cfg, store).RunOnce(ctx); err != nil || result != (Result{}) {
+		t.Fatalf("unexpected second run %+v: %v", result, err)
+	}
+}
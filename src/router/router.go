@@ -0,0 +1,110 @@
+package router
+
+import (
+	"easyflow-backend/src/api"
+	"easyflow-backend/src/api/admin"
+	"easyflow-backend/src/api/auth"
+	"easyflow-backend/src/api/chat"
+	"easyflow-backend/src/api/health"
+	"easyflow-backend/src/api/user"
+	"easyflow-backend/src/audit"
+	"easyflow-backend/src/common"
+	"easyflow-backend/src/enum"
+	"easyflow-backend/src/metrics"
+	"easyflow-backend/src/middleware"
+	"easyflow-backend/src/repository"
+	"easyflow-backend/src/scanning"
+	"easyflow-backend/src/storage"
+	"easyflow-backend/src/tracing"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+)
+
+// NewStartup builds the router that is served until the database is connected,
+// it only answers the health endpoints and rejects everything else with 503.
+func NewStartup(checker *health.Checker) *gin.Engine {
+	router := gin.New()
+	health.RegisterHealthEndpoints(router, checker)
+	router.NoRoute(func(c *gin.Context) {
+		c.JSON(http.StatusServiceUnavailable, api.ApiError{
+			Code:  http.StatusServiceUnavailable,
+			Error: enum.ServiceUnavailable,
+		})
+	})
+
+	return router
+}
+
+// New builds the full api router with all middlewares and endpoints.
+// The /metrics route is only mounted if metrics are not served on a separate address.
+// The middlewares read the reloadable settings from runtime on every request.
+// The signed urls of the local object store are served by this router as well.
+func New(runtime *common.RuntimeConfig, repos *repository.Repositories, checker *health.Checker, scans *scanning.Runner, recorder *audit.Recorder, store storage.ObjectStore, log *common.Logger) (*gin.Engine, error) {
+	cfg := runtime.Load()
+	router := gin.New()
+
+	if err := router.SetTrustedProxies(nil); err != nil {
+		return nil, err
+	}
+
+	router.RedirectFixedPath = true
+	router.RedirectTrailingSlash = true
+
+	// probes and scrapers send no Origin header, so these are mounted in front of the cors middleware
+	health.RegisterHealthEndpoints(router, checker)
+	if cfg.MetricsAddr == "" {
+		if cfg.MetricsToken != "" {
+			router.GET("/metrics", gin.WrapH(metrics.Handler(cfg.MetricsToken)))
+		} else {
+			log.PrintfWarning("Neither METRICS_ADDR nor METRICS_TOKEN is set, metrics endpoint is disabled")
+		}
+	}
+	if local, ok := store.(*storage.LocalStore); ok {
+		log.Printf("Registering local storage endpoints")
+		storage.RegisterLocalEndpoints(router, local, runtime)
+	}
+
+	router.Use(otelgin.Middleware(tracing.ServiceName))
+	router.Use(middleware.AccessLogMiddleware(runtime))
+	router.Use(middleware.MetricsMiddleware())
+
+	log.Printf("Frontend URL for cors: %s", cfg.FrontendURL)
+
+	router.Use(middleware.CorsMiddleware(runtime))
+
+	router.Use(middleware.RepositoryMiddleware(repos))
+	router.Use(middleware.ConfigMiddleware(runtime))
+	router.Use(middleware.ScanMiddleware(scans))
+	router.Use(middleware.AuditMiddleware(recorder))
+	router.Use(middleware.StorageMiddleware(store))
+	router.Use(gin.Recovery())
+
+	//register user endpoints
+	userEndpoints := router.Group("/user")
+	{
+		log.Printf("Registering user endpoints")
+		user.RegisterUserEndpoints(userEndpoints)
+	}
+
+	authEndpoints := router.Group("/auth")
+	{
+		log.Printf("Registering auth endpoints")
+		auth.RegisterAuthEndpoints(authEndpoints)
+	}
+
+	chatEndpoints := router.Group("/chat")
+	{
+		log.Printf("Registering chat endpoints")
+		chat.RegisterChatEndpoints(chatEndpoints)
+	}
+
+	adminEndpoints := router.Group("/admin")
+	{
+		log.Printf("Registering admin endpoints")
+		admin.RegisterAdminEndpoints(adminEndpoints)
+	}
+
+	return router, nil
+}
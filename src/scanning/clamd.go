@@ -0,0 +1,88 @@
+package scanning
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// clamdChunkSize is the size of the chunks the content is streamed in, clamd rejects chunks above its StreamMaxLength
+const clamdChunkSize = 64 << 10
+
+/*
+Clamd scans the content with a clamd daemon over tcp. Every scan opens its own connection and streams the
+content with the INSTREAM command, the connection is closed after the reply.
+*/
+type Clamd struct {
+	address string
+	timeout time.Duration
+}
+
+func NewClamd(address string, timeout time.Duration) *Clamd {
+	return &Clamd{address: address, timeout: timeout}
+}
+
+func (c *Clamd) Scan(ctx context.Context, body []byte) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", c.address)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		return "", err
+	}
+
+	// the z prefix terminates the command and the reply with a null byte
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return "", err
+	}
+
+	// every chunk is prefixed with its length, a chunk of length 0 ends the stream
+	size := make([]byte, 4)
+	for offset := 0; offset < len(body); offset += clamdChunkSize {
+		chunk := body[offset:min(offset+clamdChunkSize, len(body))]
+		binary.BigEndian.PutUint32(size, uint32(len(chunk)))
+		if _, err := conn.Write(append(size, chunk...)); err != nil {
+			return "", err
+		}
+	}
+	binary.BigEndian.PutUint32(size, 0)
+	if _, err := conn.Write(size); err != nil {
+		return "", err
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil {
+		return "", err
+	}
+
+	return parseClamdReply(strings.TrimSuffix(reply, "\x00"))
+}
+
+/*
+Private function to read the verdict from a reply like "stream: OK" or "stream: Eicar-Signature FOUND"
+*/
+func parseClamdReply(reply string) (string, error) {
+	result := strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case result == "OK":
+		return "", nil
+	case strings.HasSuffix(result, " FOUND"):
+		return strings.TrimSuffix(result, " FOUND"), nil
+	case strings.HasSuffix(result, " ERROR"):
+		return "", fmt.Errorf("clamd could not scan the content: %s", strings.TrimSuffix(result, " ERROR"))
+	default:
+		return "", errors.New("unexpected reply from clamd: " + reply)
+	}
+}
@@ -0,0 +1,238 @@
+package scanning
+
+import (
+	"context"
+	"easyflow-backend/src/api/utils"
+	"easyflow-backend/src/common"
+	"easyflow-backend/src/database"
+	"easyflow-backend/src/jobs"
+	"easyflow-backend/src/repository"
+	"easyflow-backend/src/storage"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Upload is the kind of upload a scan job scans
+type Upload string
+
+const (
+	UploadAttachment     Upload = "attachment"
+	UploadProfilePicture Upload = "profile_picture"
+	UploadChatPicture    Upload = "chat_picture"
+)
+
+// ScanPayload names the upload a scan job scans, the chat id is only set for attachments and the key only for pictures
+type ScanPayload struct {
+	Upload Upload `json:"upload"`
+	Id     string `json:"id"`
+	ChatId string `json:"chatId,omitempty"`
+	Key    string `json:"key,omitempty"`
+}
+
+var ScanJob = jobs.NewKind[ScanPayload]("scan.upload")
+
+/*
+target is a confirmed upload. Its objects are downloaded and scanned one after the other,
+the target is quarantined if one of them is infected.
+*/
+type target struct {
+	Name       string // shown in the logs, e.g. "attachment <id>"
+	BucketName string
+	Keys       []string
+	// Record stores the verdict, it is not called if the target could not be scanned
+	Record func(ctx context.Context, status database.ScanStatus) error
+}
+
+/*
+Runner scans confirmed uploads with the ScanJob jobs. Scans that fail are retried by the job queue,
+the upload stays pending if they run out of attempts.
+*/
+type Runner struct {
+	repos   *repository.Repositories
+	cfg     *common.Config
+	store   storage.ObjectStore
+	scanner Scanner
+	logger  *common.Logger
+}
+
+func NewRunner(repos *repository.Repositories, cfg *common.Config, store storage.ObjectStore, scanner Scanner) *Runner {
+	return &Runner{
+		repos:   repos,
+		cfg:     cfg,
+		store:   store,
+		scanner: scanner,
+		logger:  common.NewLogger(os.Stdout, "Scan", nil, cfg.LogLevel),
+	}
+}
+
+// SetLogLevel changes the log level of the runner after the config was reloaded
+func (r *Runner) SetLogLevel(logLevel common.LogLevel) {
+	r.logger.SetLogLevel(logLevel)
+}
+
+// Register adds the handler of the scan jobs to the pool
+func (r *Runner) Register(pool *jobs.Pool) {
+	jobs.Handle(pool, ScanJob, r.run)
+}
+
+// InitialStatus is the status of a confirmed upload, without a scanner there is nothing to wait for
+func (r *Runner) InitialStatus() database.ScanStatus {
+	if _, ok := r.scanner.(Noop); ok {
+		return database.ScanClean
+	}
+	return database.ScanPending
+}
+
+// Enqueue queues the scan of a pending upload, pass the repositories of the transaction that stores the pending status
+func (r *Runner) Enqueue(ctx context.Context, repos *repository.Repositories, payload ScanPayload) error {
+	if r.InitialStatus() != database.ScanPending {
+		return nil
+	}
+
+	_, err := ScanJob.Enqueue(ctx, repos, payload)
+	return err
+}
+
+/*
+Private function to scan the upload of a job, uploads that were deleted or scanned in the meantime are skipped
+*/
+func (r *Runner) run(ctx context.Context, payload ScanPayload) error {
+	target, err := r.target(ctx, payload)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil
+	}
+	if err != nil || target == nil {
+		return err
+	}
+
+	status, err := r.scan(ctx, target)
+	if err != nil {
+		return err
+	}
+	if err := target.Record(ctx, status); err != nil {
+		return err
+	}
+
+	r.logger.Printf("Scanned %s: %s", target.Name, status)
+	return nil
+}
+
+/*
+Private function to look up the objects of the upload and how its verdict is stored. A picture is only scanned
+while it is still the pending one, a newer picture has a job of its own.
+*/
+func (r *Runner) target(ctx context.Context, payload ScanPayload) (*target, error) {
+	switch payload.Upload {
+	case UploadAttachment:
+		attachment, err := r.repos.Attachments.GetById(ctx, payload.ChatId, payload.Id)
+		if err != nil || attachment.ScanStatus != database.ScanPending {
+			return nil, err
+		}
+		return &target{
+			Name:       "attachment " + attachment.Id,
+			BucketName: r.cfg.AttachmentBucketName,
+			Keys:       []string{attachment.ObjectKey},
+			Record: func(ctx context.Context, status database.ScanStatus) error {
+				return r.repos.Attachments.SetScanStatus(ctx, []string{attachment.Id}, status)
+			},
+		}, nil
+
+	case UploadProfilePicture:
+		user, err := r.repos.Users.GetById(ctx, payload.Id)
+		if err != nil {
+			return nil, err
+		}
+		return r.pictureTarget(ctx, payload, "profile picture of user "+user.Id, r.cfg.ProfilePictureBucketName, user.PictureKey, user.PicturePending, func(ctx context.Context, version time.Time) error {
+			return r.repos.Users.PublishPicture(ctx, user.Id, payload.Key, version)
+		}, func(ctx context.Context) error {
+			return r.repos.Users.RejectPicture(ctx, user.Id, payload.Key)
+		}), nil
+
+	case UploadChatPicture:
+		chat, err := r.repos.Chats.GetById(ctx, payload.Id)
+		if err != nil {
+			return nil, err
+		}
+		return r.pictureTarget(ctx, payload, "picture of chat "+chat.Id, r.cfg.ChatPictureBucket(), chat.PictureKey, chat.PicturePending, func(ctx context.Context, version time.Time) error {
+			return r.repos.Chats.PublishPicture(ctx, chat.Id, payload.Key, version)
+		}, func(ctx context.Context) error {
+			return r.repos.Chats.RejectPicture(ctx, chat.Id, payload.Key)
+		}), nil
+
+	default:
+		return nil, jobs.Permanent(fmt.Errorf("unknown upload %q", payload.Upload))
+	}
+}
+
+/*
+Private function to build the target of a pending picture. A clean picture is published and the one it replaces is deleted,
+a quarantined picture is deleted right away. A picture that was replaced by a newer one before or during the scan
+is deleted as well, it can not become pending again and the newer one has a job of its own.
+*/
+func (r *Runner) pictureTarget(ctx context.Context, payload ScanPayload, name string, bucketName string, published *string, pending *string, publish func(ctx context.Context, version time.Time) error, reject func(ctx context.Context) error) *target {
+	// jobs that were queued before pictures were uploaded to staging objects name no key, their pictures were dropped
+	if payload.Key == "" {
+		return nil
+	}
+	if pending == nil || *pending != payload.Key {
+		if published == nil || *published != payload.Key {
+			utils.DeletePicture(ctx, r.logger, r.store, bucketName, payload.Key)
+		}
+		return nil
+	}
+
+	return &target{
+		Name:       name,
+		BucketName: bucketName,
+		Keys:       utils.PictureKeys(payload.Key),
+		Record: func(ctx context.Context, status database.ScanStatus) error {
+			var err error
+			if status == database.ScanClean {
+				err = publish(ctx, time.Now())
+			} else {
+				err = reject(ctx)
+			}
+			if errors.Is(err, repository.ErrNotFound) {
+				// replaced during the scan, looking it up again deletes it
+				if _, err := r.target(ctx, payload); err != nil && !errors.Is(err, repository.ErrNotFound) {
+					return err
+				}
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			if status != database.ScanClean {
+				utils.DeletePicture(ctx, r.logger, r.store, bucketName, payload.Key)
+			} else if published != nil {
+				utils.DeletePicture(ctx, r.logger, r.store, bucketName, *published)
+			}
+			return nil
+		},
+	}
+}
+
+/*
+Private function to scan every object of the target once
+*/
+func (r *Runner) scan(ctx context.Context, target *target) (database.ScanStatus, error) {
+	for _, key := range target.Keys {
+		body, err := r.store.Get(ctx, target.BucketName, key)
+		if err != nil {
+			return "", err
+		}
+
+		found, err := r.scanner.Scan(ctx, body)
+		if err != nil {
+			return "", err
+		}
+		if found != "" {
+			r.logger.PrintfWarning("Quarantining %s, object %s in bucket %s contains %s", target.Name, key, target.BucketName, found)
+			return database.ScanQuarantined, nil
+		}
+	}
+	return database.ScanClean, nil
+}
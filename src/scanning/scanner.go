@@ -0,0 +1,60 @@
+package scanning
+
+import (
+	"context"
+	"easyflow-backend/src/api"
+	"easyflow-backend/src/common"
+	"easyflow-backend/src/database"
+	"easyflow-backend/src/enum"
+	"fmt"
+	"net/http"
+)
+
+/*
+Scanner checks the content of an upload for malware. Scan returns the name of what was found,
+an empty name means the content is clean. An error means the content could not be scanned.
+*/
+type Scanner interface {
+	Scan(ctx context.Context, body []byte) (string, error)
+}
+
+// Noop accepts every upload, it is used when no scanner is configured
+type Noop struct{}
+
+func (Noop) Scan(ctx context.Context, body []byte) (string, error) {
+	return "", nil
+}
+
+// New returns the scanner of SCANNER_DRIVER
+func New(cfg *common.Config) (Scanner, error) {
+	switch cfg.ScannerDriver {
+	case common.ScannerDriverNone:
+		return Noop{}, nil
+	case common.ScannerDriverClamd:
+		return NewClamd(cfg.ScannerClamdAddress, cfg.ScannerTimeout), nil
+	default:
+		return nil, fmt.Errorf("unknown scanner driver %q", cfg.ScannerDriver)
+	}
+}
+
+/*
+RequireClean refuses to hand out an object that was not scanned yet or was quarantined
+*/
+func RequireClean(status database.ScanStatus) *api.ApiError {
+	switch status {
+	case database.ScanClean:
+		return nil
+	case database.ScanQuarantined:
+		return &api.ApiError{
+			Code:    http.StatusForbidden,
+			Error:   enum.Quarantined,
+			Details: "the file was quarantined by the malware scan",
+		}
+	default:
+		return &api.ApiError{
+			Code:    http.StatusConflict,
+			Error:   enum.ScanPending,
+			Details: "the file is still being scanned",
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"context"
+	"easyflow-backend/src/api"
+	"easyflow-backend/src/common"
+	"sync"
+	"time"
+)
+
+// maxCachedURLs bounds the memory of the cache, expired urls are dropped once it is full
+const maxCachedURLs = 10000
+
+// the store is part of the key, urls of different stores are never mixed up
+type urlCacheKey struct {
+	store      ObjectStore
+	bucketName string
+	objectKey  string
+	version    string
+	expiration int
+}
+
+type cachedURL struct {
+	url     string
+	renewAt time.Time
+}
+
+// urlCache keeps presigned download urls until half of their lifetime is over. Every url handed out is valid
+// for at least half of the requested expiration and the same object keeps the same url, which browsers can cache.
+type urlCache struct {
+	mu      sync.Mutex
+	entries map[urlCacheKey]cachedURL
+}
+
+var downloadURLs = &urlCache{entries: make(map[urlCacheKey]cachedURL)}
+
+func (c *urlCache) get(key urlCacheKey, now time.Time) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || !now.Before(entry.renewAt) {
+		return "", false
+	}
+	return entry.url, true
+}
+
+func (c *urlCache) put(key urlCacheKey, url string, renewAt time.Time, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.entries) >= maxCachedURLs {
+		for cached, entry := range c.entries {
+			if !now.Before(entry.renewAt) {
+				delete(c.entries, cached)
+			}
+		}
+	}
+	if len(c.entries) >= maxCachedURLs {
+		clear(c.entries)
+	}
+
+	c.entries[key] = cachedURL{url: url, renewAt: renewAt}
+}
+
+/*
+CachedDownloadURL returns a presigned URL for an object the caller knows to exist, it is signed again once half
+of its expiration has passed. A new version of the object is signed again instead of being served from the cache.
+*/
+func CachedDownloadURL(ctx context.Context, logger *common.Logger, store ObjectStore, bucketName string, objectKey string, version string, expiration int) (*string, *api.ApiError) {
+	key := urlCacheKey{
+		store:      store,
+		bucketName: bucketName,
+		objectKey:  objectKey,
+		version:    version,
+		expiration: expiration,
+	}
+
+	now := time.Now()
+	if cached, ok := downloadURLs.get(key, now); ok {
+		return &cached, nil
+	}
+
+	signed, apiErr := PresignDownloadURL(ctx, logger, store, bucketName, objectKey, expiration)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	downloadURLs.put(key, *signed, now.Add(time.Duration(expiration)*time.Second/2), now)
+
+	return signed, nil
+}
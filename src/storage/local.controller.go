@@ -0,0 +1,180 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"easyflow-backend/src/api"
+	"easyflow-backend/src/common"
+	"easyflow-backend/src/enum"
+	"encoding/base64"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+/*
+RegisterLocalEndpoints serves the presigned urls of the local store. They are opened by browsers without
+an Origin header, so the routes are mounted in front of the cors middleware and answer cors on their own,
+like the cors rules of a bucket.
+*/
+func RegisterLocalEndpoints(r gin.IRouter, store *LocalStore, runtime *common.RuntimeConfig) {
+	path := LocalPathPrefix + ":bucket/*key"
+	r.OPTIONS(path, localCors(runtime))
+	r.GET(path, localCors(runtime), DownloadController(store))
+	r.HEAD(path, localCors(runtime), DownloadController(store))
+	r.PUT(path, localCors(runtime), UploadController(store, runtime))
+}
+
+/*
+Private function to allow the frontend origins, presigned urls carry no credentials
+*/
+func localCors(runtime *common.RuntimeConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Vary", "Origin")
+
+		origin := c.GetHeader("Origin")
+		if origin != "" && slices.Contains(runtime.Load().CorsOrigins(), origin) {
+			c.Header("Access-Control-Allow-Origin", origin)
+			c.Header("Access-Control-Expose-Headers", "Content-Length")
+		} else if c.Request.Method == http.MethodOptions {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+
+		if c.Request.Method == http.MethodOptions {
+			c.Header("Access-Control-Allow-Methods", "GET, HEAD, PUT")
+			c.Header("Access-Control-Allow-Headers", "Content-Type, Content-Length")
+			c.Header("Access-Control-Max-Age", strconv.Itoa(int((12 * time.Hour).Seconds())))
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+/*
+Private function to reject a request whose url is not signed for it
+*/
+func forbidden(c *gin.Context, err error) {
+	c.JSON(http.StatusForbidden, api.ApiError{
+		Code:    http.StatusForbidden,
+		Error:   enum.NotAllowed,
+		Details: err.Error(),
+	})
+}
+
+func DownloadController(store *LocalStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		bucketName, objectKey := c.Param("bucket"), strings.TrimPrefix(c.Param("key"), "/")
+
+		// a HEAD is allowed with the url of a GET, like a bucket does
+		if _, err := store.verify(http.MethodGet, bucketName, objectKey, c.Request.URL.Query(), time.Now()); err != nil {
+			forbidden(c, err)
+			return
+		}
+
+		path, err := store.path(bucketName, objectKey)
+		if err != nil {
+			forbidden(c, err)
+			return
+		}
+
+		var file *os.File
+		info, err := store.Head(c.Request.Context(), bucketName, objectKey)
+		if err == nil {
+			file, err = os.Open(path)
+		}
+		if errors.Is(err, ErrNotFound) || errors.Is(err, fs.ErrNotExist) {
+			c.JSON(http.StatusNotFound, api.ApiError{
+				Code:  http.StatusNotFound,
+				Error: enum.NotFound,
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, api.ApiError{
+				Code:  http.StatusInternalServerError,
+				Error: enum.ApiError,
+			})
+			return
+		}
+		defer file.Close()
+
+		stat, err := file.Stat()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, api.ApiError{
+				Code:  http.StatusInternalServerError,
+				Error: enum.ApiError,
+			})
+			return
+		}
+
+		c.Header("Content-Type", info.ContentType)
+		c.Header("X-Content-Type-Options", "nosniff")
+		http.ServeContent(c.Writer, c.Request, "", stat.ModTime(), file)
+	}
+}
+
+func UploadController(store *LocalStore, runtime *common.RuntimeConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		logger := common.NewLogger(os.Stdout, "Storage", c, common.LogLevel(runtime.Load().LogLevel))
+		bucketName, objectKey := c.Param("bucket"), strings.TrimPrefix(c.Param("key"), "/")
+
+		req, err := store.verify(http.MethodPut, bucketName, objectKey, c.Request.URL.Query(), time.Now())
+		if err != nil {
+			forbidden(c, err)
+			return
+		}
+		if c.GetHeader("Content-Type") != req.constraints.ContentType {
+			forbidden(c, errors.New("the Content-Type header does not match the signed type"))
+			return
+		}
+		if c.Request.ContentLength != req.constraints.ContentLength {
+			forbidden(c, errors.New("the Content-Length header does not match the signed length"))
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, req.constraints.ContentLength))
+		if err != nil || int64(len(body)) != req.constraints.ContentLength {
+			c.JSON(http.StatusBadRequest, api.ApiError{
+				Code:    http.StatusBadRequest,
+				Error:   enum.MalformedRequest,
+				Details: "the body does not have the signed length",
+			})
+			return
+		}
+
+		if req.constraints.ChecksumSHA256 != "" {
+			sum := sha256.Sum256(body)
+			expected, err := base64.StdEncoding.DecodeString(req.constraints.ChecksumSHA256)
+			if err != nil || !bytes.Equal(sum[:], expected) {
+				c.JSON(http.StatusBadRequest, api.ApiError{
+					Code:    http.StatusBadRequest,
+					Error:   enum.MalformedRequest,
+					Details: "the body does not match the signed checksum",
+				})
+				return
+			}
+		}
+
+		if err := store.Put(c.Request.Context(), bucketName, objectKey, body, req.constraints.ContentType); err != nil {
+			logger.PrintfError("Could not store object %s in bucket %s: %s", objectKey, bucketName, err)
+			c.JSON(http.StatusInternalServerError, api.ApiError{
+				Code:  http.StatusInternalServerError,
+				Error: enum.ApiError,
+			})
+			return
+		}
+
+		c.Status(http.StatusOK)
+	}
+}
@@ -0,0 +1,311 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LocalPathPrefix is the path under which the app serves the objects of the local store
+const LocalPathPrefix = "/storage/"
+
+// metaSuffix marks the file next to an object that holds its content type
+const metaSuffix = ".meta"
+
+// maxLocalKeyLength keeps the encoded file names below the 255 bytes most file systems allow
+const maxLocalKeyLength = 180
+
+var bucketNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// errInvalidObjectName is returned for bucket names and keys that can not be mapped to a file
+var errInvalidObjectName = errors.New("invalid bucket name or object key")
+
+/*
+LocalStore keeps the objects on disk, every bucket is a directory below the root. The file of an object is named
+after the base64url encoded key, keys can not escape their bucket and a key can be the prefix of another one.
+The presigned urls point to the app itself and are signed with an hmac of the secret, see RegisterLocalEndpoints.
+*/
+type LocalStore struct {
+	root    string
+	baseURL *url.URL
+	secret  []byte
+}
+
+func NewLocalStore(root string, baseURL string, secret []byte) (*LocalStore, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("the local store needs a secret to sign urls")
+	}
+
+	parsed, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid url of the local store %q", baseURL)
+	}
+
+	if err := os.MkdirAll(root, 0o750); err != nil {
+		return nil, err
+	}
+
+	return &LocalStore{root: root, baseURL: parsed, secret: secret}, nil
+}
+
+/*
+Private function to map an object to its file, the metadata is stored in the same path with metaSuffix
+*/
+func (s *LocalStore) path(bucketName string, objectKey string) (string, error) {
+	if !bucketNamePattern.MatchString(bucketName) || objectKey == "" || len(objectKey) > maxLocalKeyLength {
+		return "", errInvalidObjectName
+	}
+	return filepath.Join(s.root, bucketName, base64.RawURLEncoding.EncodeToString([]byte(objectKey))), nil
+}
+
+func (s *LocalStore) Check(ctx context.Context, bucketName string) error {
+	if !bucketNamePattern.MatchString(bucketName) {
+		return errInvalidObjectName
+	}
+
+	info, err := os.Stat(s.root)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", s.root)
+	}
+	return nil
+}
+
+func (s *LocalStore) Put(ctx context.Context, bucketName string, objectKey string, body []byte, contentType string) error {
+	path, err := s.path(bucketName, objectKey)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+
+	// the metadata is written first, an object without its content type is never visible
+	if err := writeFileAtomic(path+metaSuffix, []byte(contentType)); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, body)
+}
+
+/*
+Private function to replace a file at once, readers see either the old or the new content
+*/
+func writeFileAtomic(path string, content []byte) error {
+	// the dot can not appear in an encoded key, so temporary files never clash with objects
+	file, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(content); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+func (s *LocalStore) Get(ctx context.Context, bucketName string, objectKey string) ([]byte, error) {
+	path, err := s.path(bucketName, objectKey)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return body, err
+}
+
+func (s *LocalStore) Head(ctx context.Context, bucketName string, objectKey string) (*ObjectInfo, error) {
+	path, err := s.path(bucketName, objectKey)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	contentType, err := os.ReadFile(path + metaSuffix)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	return &ObjectInfo{Size: info.Size(), ContentType: string(contentType)}, nil
+}
+
+func (s *LocalStore) Delete(ctx context.Context, bucketName string, objectKey string) error {
+	path, err := s.path(bucketName, objectKey)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range []string{path, path + metaSuffix} {
+		if err := os.Remove(file); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *LocalStore) List(ctx context.Context, bucketName string, prefix string) ([]string, error) {
+	if !bucketNamePattern.MatchString(bucketName) {
+		return nil, errInvalidObjectName
+	}
+
+	entries, err := os.ReadDir(filepath.Join(s.root, bucketName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for _, entry := range entries {
+		// skips the metadata and temporary files, their names are no valid encoding
+		key, err := base64.RawURLEncoding.DecodeString(entry.Name())
+		if err != nil || entry.IsDir() {
+			continue
+		}
+		if strings.HasPrefix(string(key), prefix) {
+			keys = append(keys, string(key))
+		}
+	}
+	slices.Sort(keys)
+
+	return keys, nil
+}
+
+func (s *LocalStore) PresignGet(ctx context.Context, bucketName string, objectKey string, expiration time.Duration) (string, error) {
+	if _, err := s.path(bucketName, objectKey); err != nil {
+		return "", err
+	}
+
+	return s.signedURL(signedRequest{
+		method:     "GET",
+		bucketName: bucketName,
+		objectKey:  objectKey,
+		expires:    time.Now().Add(expiration).Unix(),
+	}), nil
+}
+
+func (s *LocalStore) PresignPut(ctx context.Context, bucketName string, objectKey string, constraints UploadConstraints, expiration time.Duration) (*PresignedUpload, error) {
+	if _, err := s.path(bucketName, objectKey); err != nil {
+		return nil, err
+	}
+
+	uploadURL := s.signedURL(signedRequest{
+		method:      "PUT",
+		bucketName:  bucketName,
+		objectKey:   objectKey,
+		expires:     time.Now().Add(expiration).Unix(),
+		constraints: constraints,
+	})
+
+	return &PresignedUpload{
+		URL:     uploadURL,
+		Headers: map[string]string{"Content-Type": constraints.ContentType},
+	}, nil
+}
+
+/*
+signedRequest is everything a presigned url of the local store allows, all of it is covered by the signature
+*/
+type signedRequest struct {
+	method      string
+	bucketName  string
+	objectKey   string
+	expires     int64
+	constraints UploadConstraints
+}
+
+/*
+Private function to compute the signature, the fields are joined with newlines which no field can contain
+*/
+func (s *LocalStore) sign(req signedRequest) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(strings.Join([]string{
+		req.method,
+		req.bucketName,
+		req.objectKey,
+		strconv.FormatInt(req.expires, 10),
+		req.constraints.ContentType,
+		strconv.FormatInt(req.constraints.ContentLength, 10),
+		req.constraints.ChecksumSHA256,
+	}, "\n")))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (s *LocalStore) signedURL(req signedRequest) string {
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(req.expires, 10))
+	if req.method == "PUT" {
+		query.Set("contentType", req.constraints.ContentType)
+		query.Set("contentLength", strconv.FormatInt(req.constraints.ContentLength, 10))
+		if req.constraints.ChecksumSHA256 != "" {
+			query.Set("checksum", req.constraints.ChecksumSHA256)
+		}
+	}
+	query.Set("signature", s.sign(req))
+
+	signed := s.baseURL.JoinPath(LocalPathPrefix, req.bucketName, req.objectKey)
+	signed.RawQuery = query.Encode()
+	return signed.String()
+}
+
+/*
+Private function to check the signature of a request against the url, the query is parsed back into the request
+*/
+func (s *LocalStore) verify(method string, bucketName string, objectKey string, query url.Values, now time.Time) (*signedRequest, error) {
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil {
+		return nil, errors.New("missing expiration")
+	}
+
+	req := signedRequest{
+		method:     method,
+		bucketName: bucketName,
+		objectKey:  objectKey,
+		expires:    expires,
+	}
+	if method == "PUT" {
+		req.constraints.ContentType = query.Get("contentType")
+		req.constraints.ChecksumSHA256 = query.Get("checksum")
+		if req.constraints.ContentLength, err = strconv.ParseInt(query.Get("contentLength"), 10, 64); err != nil {
+			return nil, errors.New("missing content length")
+		}
+	}
+
+	if !hmac.Equal([]byte(s.sign(req)), []byte(query.Get("signature"))) {
+		return nil, errors.New("invalid signature")
+	}
+	if now.Unix() > expires {
+		return nil, errors.New("url expired")
+	}
+
+	return &req, nil
+}
@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestStore(t *testing.T, secret string) *LocalStore {
+	t.Helper()
+
+	store, err := NewLocalStore(t.TempDir(), "http://localhost:8080/", []byte(secret))
+	if err != nil {
+		t.Fatalf("could not create the store: %s", err)
+	}
+	return store
+}
+
+/*
+Private function to split a presigned url into the bucket, the key and the query the endpoint verifies
+*/
+func parseSignedURL(t *testing.T, signed string) (string, string, url.Values) {
+	t.Helper()
+
+	parsed, err := url.Parse(signed)
+	if err != nil {
+		t.Fatalf("invalid url %q: %s", signed, err)
+	}
+	bucketName, objectKey, ok := strings.Cut(strings.TrimPrefix(parsed.Path, LocalPathPrefix), "/")
+	if !ok || parsed.Host != "localhost:8080" {
+		t.Fatalf("unexpected url %q", signed)
+	}
+	return bucketName, objectKey, parsed.Query()
+}
+
+func TestLocalStoreVerify(t *testing.T) {
+	store := newTestStore(t, "secret")
+	ctx := context.Background()
+	now := time.Now()
+
+	download, err := store.PresignGet(ctx, "attachments", "chat/file", time.Minute)
+	if err != nil {
+		t.Fatalf("could not presign: %s", err)
+	}
+	upload, err := store.PresignPut(ctx, "attachments", "chat/file", UploadConstraints{
+		ContentType:    "image/png",
+		ContentLength:  42,
+		ChecksumSHA256: "n4bQgYhMfWWaL+qgxVrQFaO/TxsrC4Is0V1sFbDwCgg=",
+	}, time.Minute)
+	if err != nil {
+		t.Fatalf("could not presign: %s", err)
+	}
+	if upload.Headers["Content-Type"] != "image/png" {
+		t.Fatalf("unexpected headers %v", upload.Headers)
+	}
+
+	bucketName, objectKey, query := parseSignedURL(t, download)
+	if bucketName != "attachments" || objectKey != "chat/file" {
+		t.Fatalf("unexpected object %s/%s", bucketName, objectKey)
+	}
+	if _, err := store.verify("GET", bucketName, objectKey, query, now); err != nil {
+		t.Fatalf("valid download was refused: %s", err)
+	}
+
+	_, _, uploadQuery := parseSignedURL(t, upload.URL)
+	req, err := store.verify("PUT", bucketName, objectKey, uploadQuery, now)
+	if err != nil {
+		t.Fatalf("valid upload was refused: %s", err)
+	}
+	if req.constraints.ContentType != "image/png" || req.constraints.ContentLength != 42 || req.constraints.ChecksumSHA256 == "" {
+		t.Fatalf("the constraints were not parsed: %+v", req.constraints)
+	}
+
+	tamper := func(query url.Values, key string, value string) url.Values {
+		changed := url.Values{}
+		for k, v := range query {
+			changed[k] = v
+		}
+		changed.Set(key, value)
+		return changed
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		bucketName string
+		objectKey  string
+		query      url.Values
+		now        time.Time
+	}{
+		{"other method", "PUT", bucketName, objectKey, query, now},
+		{"other bucket", "GET", "exports", objectKey, query, now},
+		{"other key", "GET", bucketName, "chat/other", query, now},
+		{"key prefix", "GET", bucketName, "chat", query, now},
+		{"later expiration", "GET", bucketName, objectKey, tamper(query, "expires", "99999999999"), now},
+		{"no expiration", "GET", bucketName, objectKey, tamper(query, "expires", ""), now},
+		{"no signature", "GET", bucketName, objectKey, tamper(query, "signature", ""), now},
+		{"expired", "GET", bucketName, objectKey, query, now.Add(2 * time.Minute)},
+		{"download as upload", "PUT", bucketName, objectKey, tamper(tamper(query, "contentType", "image/png"), "contentLength", "42"), now},
+		{"other content type", "PUT", bucketName, objectKey, tamper(uploadQuery, "contentType", "text/html"), now},
+		{"larger upload", "PUT", bucketName, objectKey, tamper(uploadQuery, "contentLength", "4200"), now},
+		{"no checksum", "PUT", bucketName, objectKey, tamper(uploadQuery, "checksum", ""), now},
+		{"no content length", "PUT", bucketName, objectKey, tamper(uploadQuery, "contentLength", ""), now},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := store.verify(test.method, test.bucketName, test.objectKey, test.query, test.now); err == nil {
+				t.Fatalf("the request was accepted")
+			}
+		})
+	}
+
+	// a url of another secret is not accepted
+	if _, err := newTestStore(t, "other").verify("GET", bucketName, objectKey, query, now); err == nil {
+		t.Fatalf("the url of another secret was accepted")
+	}
+}
+
+func TestLocalStoreObjectNames(t *testing.T) {
+	store := newTestStore(t, "secret")
+	ctx := context.Background()
+
+	for _, name := range [][2]string{
+		{"Uppercase", "key"},
+		{"../attachments", "key"},
+		{"attachments", ""},
+		{"attachments", strings.Repeat("k", maxLocalKeyLength+1)},
+	} {
+		if _, err := store.PresignGet(ctx, name[0], name[1], time.Minute); err == nil {
+			t.Fatalf("%q/%q was presigned", name[0], name[1])
+		}
+	}
+
+	// keys are encoded, they can not escape their bucket
+	if err := store.Put(ctx, "attachments", "../../escape", []byte("content"), "text/plain"); err != nil {
+		t.Fatalf("could not put: %s", err)
+	}
+	keys, err := store.List(ctx, "attachments", "../")
+	if err != nil || len(keys) != 1 || keys[0] != "../../escape" {
+		t.Fatalf("unexpected keys %v: %v", keys, err)
+	}
+}
+
+func TestNewLocalStore(t *testing.T) {
+	if _, err := NewLocalStore(t.TempDir(), "http://localhost:8080", nil); err == nil {
+		t.Fatalf("a store without a secret was created")
+	}
+	if _, err := NewLocalStore(t.TempDir(), "localhost:8080", []byte("secret")); err == nil {
+		t.Fatalf("a store with a relative url was created")
+	}
+}
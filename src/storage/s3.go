@@ -0,0 +1,298 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"easyflow-backend/src/common"
+	"easyflow-backend/src/tracing"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go/aws"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+/*
+S3Store keeps the objects in an s3 compatible bucket. The client is built on first use and then shared,
+a failed attempt is retried by the next call.
+*/
+type S3Store struct {
+	endpoint    string
+	accessKeyId string
+	secret      string
+	pathStyle   bool
+
+	mu     sync.Mutex
+	client *s3.Client
+}
+
+func NewS3Store(cfg *common.Config) *S3Store {
+	return &S3Store{
+		endpoint:    cfg.BucketURL,
+		accessKeyId: cfg.BucketAccessKeyId,
+		secret:      cfg.BucketSecret,
+		pathStyle:   cfg.BucketUsePathStyle,
+	}
+}
+
+/*
+Private function to get the shared client, it is connected on the first call
+*/
+func (s *S3Store) connect(ctx context.Context) (*s3.Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.client != nil {
+		return s.client, nil
+	}
+
+	config, err := config.LoadDefaultConfig(ctx,
+		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(s.accessKeyId, s.secret, "")),
+		config.WithRegion("auto"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	s.client = s3.NewFromConfig(config, func(o *s3.Options) {
+		o.BaseEndpoint = aws.String(s.endpoint)
+		o.UsePathStyle = s.pathStyle
+	})
+
+	return s.client, nil
+}
+
+/*
+Private function to start a span for a bucket operation
+*/
+func startSpan(ctx context.Context, operation string, bucketName string, objectKey string) (context.Context, trace.Span) {
+	return tracing.Tracer.Start(ctx, "s3."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("aws.s3.bucket", bucketName),
+			attribute.String("aws.s3.key", objectKey),
+		),
+	)
+}
+
+/*
+Private function to mark a span as failed
+*/
+func failSpan(span trace.Span, err error) error {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+	return err
+}
+
+func (s *S3Store) Check(ctx context.Context, bucketName string) error {
+	ctx, span := startSpan(ctx, "HeadBucket", bucketName, "")
+	defer span.End()
+
+	client, err := s.connect(ctx)
+	if err != nil {
+		return failSpan(span, err)
+	}
+
+	if _, err := client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: &bucketName}); err != nil {
+		return failSpan(span, err)
+	}
+
+	return nil
+}
+
+func (s *S3Store) Put(ctx context.Context, bucketName string, objectKey string, body []byte, contentType string) error {
+	ctx, span := startSpan(ctx, "PutObject", bucketName, objectKey)
+	defer span.End()
+
+	client, err := s.connect(ctx)
+	if err != nil {
+		return failSpan(span, err)
+	}
+
+	if _, err := client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        &bucketName,
+		Key:           &objectKey,
+		Body:          bytes.NewReader(body),
+		ContentLength: aws.Int64(int64(len(body))),
+		ContentType:   &contentType,
+	}); err != nil {
+		return failSpan(span, err)
+	}
+
+	return nil
+}
+
+func (s *S3Store) Get(ctx context.Context, bucketName string, objectKey string) ([]byte, error) {
+	ctx, span := startSpan(ctx, "GetObject", bucketName, objectKey)
+	defer span.End()
+
+	client, err := s.connect(ctx)
+	if err != nil {
+		return nil, failSpan(span, err)
+	}
+
+	object, err := client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: &bucketName,
+		Key:    &objectKey,
+	})
+	if err != nil {
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, ErrNotFound
+		}
+		return nil, failSpan(span, err)
+	}
+	defer object.Body.Close()
+
+	body, err := io.ReadAll(object.Body)
+	if err != nil {
+		return nil, failSpan(span, err)
+	}
+
+	return body, nil
+}
+
+func (s *S3Store) Head(ctx context.Context, bucketName string, objectKey string) (*ObjectInfo, error) {
+	ctx, span := startSpan(ctx, "HeadObject", bucketName, objectKey)
+	defer span.End()
+
+	client, err := s.connect(ctx)
+	if err != nil {
+		return nil, failSpan(span, err)
+	}
+
+	object, err := client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: &bucketName,
+		Key:    &objectKey,
+	})
+	if err != nil {
+		var notFound *types.NotFound
+		if errors.As(err, &notFound) {
+			return nil, ErrNotFound
+		}
+		return nil, failSpan(span, err)
+	}
+
+	info := &ObjectInfo{}
+	if object.ContentLength != nil {
+		info.Size = *object.ContentLength
+	}
+	if object.ContentType != nil {
+		info.ContentType = *object.ContentType
+	}
+	return info, nil
+}
+
+func (s *S3Store) Delete(ctx context.Context, bucketName string, objectKey string) error {
+	ctx, span := startSpan(ctx, "DeleteObject", bucketName, objectKey)
+	defer span.End()
+
+	client, err := s.connect(ctx)
+	if err != nil {
+		return failSpan(span, err)
+	}
+
+	if _, err := client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: &bucketName,
+		Key:    &objectKey,
+	}); err != nil {
+		return failSpan(span, err)
+	}
+
+	return nil
+}
+
+func (s *S3Store) List(ctx context.Context, bucketName string, prefix string) ([]string, error) {
+	ctx, span := startSpan(ctx, "ListObjectsV2", bucketName, prefix)
+	defer span.End()
+
+	client, err := s.connect(ctx)
+	if err != nil {
+		return nil, failSpan(span, err)
+	}
+
+	var keys []string
+	pages := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+		Bucket: &bucketName,
+		Prefix: &prefix,
+	})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, failSpan(span, err)
+		}
+		for _, object := range page.Contents {
+			keys = append(keys, aws.StringValue(object.Key))
+		}
+	}
+
+	return keys, nil
+}
+
+func (s *S3Store) PresignGet(ctx context.Context, bucketName string, objectKey string, expiration time.Duration) (string, error) {
+	ctx, span := startSpan(ctx, "PresignGetObject", bucketName, objectKey)
+	defer span.End()
+
+	client, err := s.connect(ctx)
+	if err != nil {
+		return "", failSpan(span, err)
+	}
+
+	req, err := s3.NewPresignClient(client).PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: &bucketName,
+		Key:    &objectKey,
+	}, func(opts *s3.PresignOptions) {
+		opts.Expires = expiration
+	})
+	if err != nil {
+		return "", failSpan(span, err)
+	}
+
+	return req.URL, nil
+}
+
+func (s *S3Store) PresignPut(ctx context.Context, bucketName string, objectKey string, constraints UploadConstraints, expiration time.Duration) (*PresignedUpload, error) {
+	ctx, span := startSpan(ctx, "PresignPutObject", bucketName, objectKey)
+	defer span.End()
+
+	client, err := s.connect(ctx)
+	if err != nil {
+		return nil, failSpan(span, err)
+	}
+
+	input := &s3.PutObjectInput{
+		Bucket:        &bucketName,
+		Key:           &objectKey,
+		ContentType:   &constraints.ContentType,
+		ContentLength: aws.Int64(constraints.ContentLength),
+	}
+	if constraints.ChecksumSHA256 != "" {
+		input.ChecksumSHA256 = &constraints.ChecksumSHA256
+	}
+
+	req, err := s3.NewPresignClient(client).PresignPutObject(ctx, input, func(opts *s3.PresignOptions) {
+		opts.Expires = expiration
+	})
+	if err != nil {
+		return nil, failSpan(span, err)
+	}
+
+	// the host header is set by every http client on its own
+	headers := make(map[string]string, len(req.SignedHeader))
+	for name := range req.SignedHeader {
+		if !strings.EqualFold(name, "Host") {
+			headers[name] = req.SignedHeader.Get(name)
+		}
+	}
+
+	return &PresignedUpload{URL: req.URL, Headers: headers}, nil
+}
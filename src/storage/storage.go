@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"context"
+	"easyflow-backend/src/common"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNotFound is returned by the stores for objects that do not exist
+var ErrNotFound = errors.New("object not found")
+
+/*
+ObjectStore keeps the uploaded files. The clients never talk to the backend for the content of a file,
+they up- and download it directly through the presigned urls of the store.
+*/
+type ObjectStore interface {
+	// Check verifies that the bucket exists and is reachable
+	Check(ctx context.Context, bucketName string) error
+	Put(ctx context.Context, bucketName string, objectKey string, body []byte, contentType string) error
+	Get(ctx context.Context, bucketName string, objectKey string) ([]byte, error)
+	Head(ctx context.Context, bucketName string, objectKey string) (*ObjectInfo, error)
+	// Delete removes the object, deleting a missing object is not an error
+	Delete(ctx context.Context, bucketName string, objectKey string) error
+	// List returns the keys of the objects whose key starts with the prefix
+	List(ctx context.Context, bucketName string, prefix string) ([]string, error)
+	PresignGet(ctx context.Context, bucketName string, objectKey string, expiration time.Duration) (string, error)
+	// PresignPut returns an upload url that only accepts an object matching the constraints
+	PresignPut(ctx context.Context, bucketName string, objectKey string, constraints UploadConstraints, expiration time.Duration) (*PresignedUpload, error)
+}
+
+/*
+ObjectInfo is the metadata of an object in the bucket
+*/
+type ObjectInfo struct {
+	Size        int64
+	ContentType string
+}
+
+/*
+UploadConstraints are signed into a presigned upload url, the upload is rejected by the store
+unless the client sends exactly these Content-Type, Content-Length and checksum headers
+*/
+type UploadConstraints struct {
+	ContentType    string
+	ContentLength  int64
+	ChecksumSHA256 string // base64 encoded, optional
+}
+
+/*
+PresignedUpload is a presigned PUT together with the headers the client has to send
+*/
+type PresignedUpload struct {
+	URL     string
+	Headers map[string]string
+}
+
+/*
+New builds the store of the configured driver, it is created once at startup and shared by all requests
+*/
+func New(cfg *common.Config) (ObjectStore, error) {
+	switch cfg.StorageDriver {
+	case common.StorageDriverS3:
+		return NewS3Store(cfg), nil
+	case common.StorageDriverLocal:
+		return NewLocalStore(cfg.StorageLocalDir, cfg.StorageLocalURL, []byte(cfg.StorageLocalSecret))
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", cfg.StorageDriver)
+	}
+}
@@ -0,0 +1,180 @@
+package storage
+
+import (
+	"context"
+	"easyflow-backend/src/api"
+	"easyflow-backend/src/common"
+	"easyflow-backend/src/enum"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+/*
+Private function to report a failed store operation as an internal error
+*/
+func internalError(err error) *api.ApiError {
+	return &api.ApiError{
+		Code:    http.StatusInternalServerError,
+		Error:   enum.ApiError,
+		Details: err,
+	}
+}
+
+/*
+PutObject uploads the body as an object to the bucket
+*/
+func PutObject(ctx context.Context, logger *common.Logger, store ObjectStore, bucketName string, objectKey string, body []byte, contentType string) *api.ApiError {
+	if err := store.Put(ctx, bucketName, objectKey, body, contentType); err != nil {
+		logger.PrintfError("Could not put object %s in bucket %s: %s", objectKey, bucketName, err)
+		return internalError(err)
+	}
+
+	return nil
+}
+
+/*
+GetObject downloads an object from the bucket, a missing object is reported as NOT_FOUND
+*/
+func GetObject(ctx context.Context, logger *common.Logger, store ObjectStore, bucketName string, objectKey string) ([]byte, *api.ApiError) {
+	body, err := store.Get(ctx, bucketName, objectKey)
+	if errors.Is(err, ErrNotFound) {
+		return nil, &api.ApiError{
+			Code:  http.StatusNotFound,
+			Error: enum.NotFound,
+		}
+	}
+	if err != nil {
+		logger.PrintfError("Could not get object %s in bucket %s: %s", objectKey, bucketName, err)
+		return nil, internalError(err)
+	}
+
+	return body, nil
+}
+
+/*
+HeadObject returns the metadata of an object, a missing object is reported as NOT_FOUND
+*/
+func HeadObject(ctx context.Context, logger *common.Logger, store ObjectStore, bucketName string, objectKey string) (*ObjectInfo, *api.ApiError) {
+	info, err := store.Head(ctx, bucketName, objectKey)
+	if errors.Is(err, ErrNotFound) {
+		return nil, &api.ApiError{
+			Code:  http.StatusNotFound,
+			Error: enum.NotFound,
+		}
+	}
+	if err != nil {
+		logger.PrintfError("Could not get metadata of object %s in bucket %s: %s", objectKey, bucketName, err)
+		return nil, internalError(err)
+	}
+
+	return info, nil
+}
+
+/*
+DeleteObject removes an object from the bucket, deleting a missing object is not an error
+*/
+func DeleteObject(ctx context.Context, logger *common.Logger, store ObjectStore, bucketName string, objectKey string) *api.ApiError {
+	if err := store.Delete(ctx, bucketName, objectKey); err != nil {
+		logger.PrintfError("Could not delete object %s in bucket %s: %s", objectKey, bucketName, err)
+		return internalError(err)
+	}
+
+	return nil
+}
+
+/*
+GenerateDownloadURL returns a presigned URL for an object in the bucket
+*/
+func GenerateDownloadURL(ctx context.Context, logger *common.Logger, store ObjectStore, bucketName string, objectKey string, expiration int) (*string, *api.ApiError) {
+	exists, err := store.Head(ctx, bucketName, objectKey)
+	if err != nil || exists == nil {
+		logger.PrintfWarning("Could not get object %s in bucket %s", objectKey, bucketName)
+		return nil, &api.ApiError{
+			Code:    http.StatusNoContent,
+			Error:   enum.NotFound,
+			Details: err,
+		}
+	}
+
+	return PresignDownloadURL(ctx, logger, store, bucketName, objectKey, expiration)
+}
+
+/*
+PresignDownloadURL returns a presigned URL without checking that the object exists, for objects the caller knows about
+*/
+func PresignDownloadURL(ctx context.Context, logger *common.Logger, store ObjectStore, bucketName string, objectKey string, expiration int) (*string, *api.ApiError) {
+	signed, err := store.PresignGet(ctx, bucketName, objectKey, time.Duration(expiration)*time.Second)
+	if err != nil {
+		logger.PrintfError("Could not presign url to get object %s in bucket %s: %s", objectKey, bucketName, err)
+		return nil, internalError(err)
+	}
+
+	return &signed, nil
+}
+
+/*
+GenerateConstrainedUploadURL returns a presigned PUT url that only accepts an object matching the constraints
+*/
+func GenerateConstrainedUploadURL(ctx context.Context, logger *common.Logger, store ObjectStore, bucketName string, objectKey string, constraints UploadConstraints, expiration int) (*PresignedUpload, *api.ApiError) {
+	upload, err := store.PresignPut(ctx, bucketName, objectKey, constraints, time.Duration(expiration)*time.Second)
+	if err != nil {
+		logger.PrintfError("Could not presign upload of object %s in bucket %s: %s", objectKey, bucketName, err)
+		return nil, internalError(err)
+	}
+
+	return upload, nil
+}
+
+/*
+UploadPolicy is what an uploaded object has to satisfy before it is used
+*/
+type UploadPolicy struct {
+	ContentTypes []string
+	MaxSize      int64
+}
+
+/*
+Check reports why a file of the type and size violates the policy
+*/
+func (p UploadPolicy) Check(contentType string, size int64) *api.ApiError {
+	if !slices.Contains(p.ContentTypes, contentType) {
+		return &api.ApiError{
+			Code:    http.StatusUnsupportedMediaType,
+			Error:   enum.UnsupportedFileType,
+			Details: fmt.Sprintf("allowed types are %s", strings.Join(p.ContentTypes, ", ")),
+		}
+	}
+	if size > p.MaxSize {
+		return &api.ApiError{
+			Code:    http.StatusRequestEntityTooLarge,
+			Error:   enum.FileTooLarge,
+			Details: fmt.Sprintf("files may be at most %d bytes", p.MaxSize),
+		}
+	}
+	return nil
+}
+
+/*
+ConfirmUpload checks an uploaded object against the policy, an object that violates it is deleted.
+The signed headers already stop such uploads, this catches objects that got into the bucket another way.
+*/
+func ConfirmUpload(ctx context.Context, logger *common.Logger, store ObjectStore, bucketName string, objectKey string, policy UploadPolicy) (*ObjectInfo, *api.ApiError) {
+	info, apiErr := HeadObject(ctx, logger, store, bucketName, objectKey)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	if violation := policy.Check(info.ContentType, info.Size); violation != nil {
+		logger.PrintfWarning("Deleting object %s in bucket %s, it violates the upload policy: %s", objectKey, bucketName, violation.Error)
+		if apiErr := DeleteObject(ctx, logger, store, bucketName, objectKey); apiErr != nil {
+			return nil, apiErr
+		}
+		return nil, violation
+	}
+
+	return info, nil
+}